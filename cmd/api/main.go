@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
 	"cource-api/internal/aws"
 	"cource-api/internal/config"
 	"cource-api/internal/database"
+	"cource-api/internal/encryption"
+	"cource-api/internal/events"
+	"cource-api/internal/jobs"
+	"cource-api/internal/logger"
+	"cource-api/internal/mailer"
+	"cource-api/internal/media"
+	"cource-api/internal/middleware"
 	"cource-api/internal/repository"
 	"cource-api/internal/server"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
@@ -16,11 +28,21 @@ func main() {
 		log.Fatal("Failed to load configuration:", err)
 	}
 
+	logger.Init()
+	logrus.WithFields(config.AppConfig.LogFields()).Info("Effective configuration")
+
+	tokenKeys, err := middleware.LoadTokenKeys(config.AppConfig)
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+	middleware.SetTokenKeys(tokenKeys)
+
 	// Initialize MongoDB connection
-	if err := database.Connect(config.AppConfig.MongoURI, config.AppConfig.DatabaseName); err != nil {
+	if err := database.Connect(config.AppConfig.MongoURI, config.AppConfig.DatabaseName, database.IndexMode(config.AppConfig.MongoIndexMode)); err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 	defer database.Disconnect()
+	repository.SetStrictDecoding(config.AppConfig.MongoStrictDecode)
 
 	s3c, err := aws.NewS3Client()
 	if err != nil {
@@ -28,14 +50,87 @@ func main() {
 	}
 	aws.S3C = s3c
 
+	// Optional CloudFront delivery for videos
+	if config.AppConfig.CDNEnabled {
+		signer, err := aws.NewCloudFrontSigner(config.AppConfig.CDNDomain, config.AppConfig.CDNKeyPairID, config.AppConfig.CDNPrivateKeyPath)
+		if err != nil {
+			log.Fatal("Failed to initialize CloudFront signing: ", err)
+		}
+		aws.CFSigner = signer
+	}
+
+	// Optional encryption for sensitive subscription fields
+	var subscriptionCipher *encryption.FieldCipher
+	if config.AppConfig.SubscriptionEncryptionKey != "" {
+		subscriptionCipher, err = encryption.NewFieldCipher(config.AppConfig.SubscriptionEncryptionKey)
+		if err != nil {
+			log.Fatal("Failed to initialize subscription encryption: ", err)
+		}
+	}
+
 	// Initialize repositories
 	userRepo := repository.NewUserRepository()
 	videoRepo := repository.NewVideoRepository()
 	courseRepo := repository.NewCourseRepository(videoRepo)
 	paymentRepo := repository.NewPaymentRepository()
 	otpRepo := repository.NewOTPRepository()
-	subscriptionRepo := repository.NewSubscriptionRepository()
+	subscriptionRepo := repository.NewSubscriptionRepository(subscriptionCipher)
 	productRepo := repository.NewProductRepository()
+	analyticsRepo := repository.NewAnalyticsRepository()
+	activityRepo := repository.NewActivityRepository()
+	refreshTokenRepo := repository.NewRefreshTokenRepository()
+	enrollmentRepo := repository.NewEnrollmentRepository()
+	auditRepo := repository.NewAuditRepository()
+	webhookEventRepo := repository.NewWebhookEventRepository()
+	revokedTokenRepo := repository.NewRevokedTokenRepository()
+	loginEventRepo := repository.NewLoginEventRepository()
+	couponRepo := repository.NewCouponRepository()
+	uploadIntentRepo := repository.NewUploadIntentRepository()
+	categoryRepo := repository.NewCategoryRepository()
+	reviewRepo := repository.NewReviewRepository()
+	notificationRepo := repository.NewNotificationRepository()
+	certificateRepo := repository.NewCertificateRepository()
+
+	// Encrypt any subscription rows stored before encryption was enabled
+	if subscriptionCipher != nil {
+		migrated, err := subscriptionRepo.EncryptExisting(context.Background())
+		if err != nil {
+			log.Fatal("Failed to encrypt existing subscriptions: ", err)
+		}
+		log.Printf("Encrypted %d existing subscriptions", migrated)
+	}
+
+	// Background jobs stop when the process is asked to shut down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Purge soft deleted records once they are past the retention window
+	if config.AppConfig.SoftDeleteRetention > 0 {
+		purger := jobs.NewPurger(userRepo, courseRepo, aws.S3C, config.AppConfig.SoftDeleteRetention)
+		go purger.Run(ctx, config.AppConfig.PurgeInterval)
+	} else {
+		log.Printf("SOFT_DELETE_RETENTION_DAYS is 0, soft deleted records will not be purged")
+	}
+
+	// Delete the objects of presigned uploads that were never completed
+	if config.AppConfig.StaleUploadAge > 0 {
+		cleaner := jobs.NewUploadCleaner(uploadIntentRepo, aws.S3C, config.AppConfig.StaleUploadAge)
+		go cleaner.Run(ctx, config.AppConfig.UploadCleanupInterval)
+	}
+
+	// Delete expired OTPs and orphaned watch history, and abort abandoned multipart uploads
+	maintainer := jobs.NewMaintainer(otpRepo, videoRepo, aws.S3C, config.AppConfig.StaleUploadAge)
+	go maintainer.Run(ctx, config.AppConfig.MaintenanceInterval)
+
+	// Live events hold a connection open per session, so they are opt in
+	var broker *events.Broker
+	if config.AppConfig.LiveEventsEnabled {
+		broker = events.NewBroker()
+	}
+
+	// Announce published courses to active subscribers in the background
+	announcer := jobs.NewCourseAnnouncer(userRepo, notificationRepo, broker)
+	go announcer.Run(ctx)
 
 	// Initialize and start server
 	srv := server.New(
@@ -46,13 +141,58 @@ func main() {
 		otpRepo,
 		subscriptionRepo,
 		productRepo,
+		analyticsRepo,
+		activityRepo,
+		refreshTokenRepo,
+		enrollmentRepo,
+		auditRepo,
+		webhookEventRepo,
+		revokedTokenRepo,
+		loginEventRepo,
+		couponRepo,
+		uploadIntentRepo,
+		categoryRepo,
+		reviewRepo,
+		notificationRepo,
+		certificateRepo,
 	)
 
+	srv.CourseAnnouncer = announcer
+	srv.EventBroker = broker
+
+	if config.AppConfig.AutoThumbnail {
+		thumbnails := jobs.NewThumbnailWorker(media.NewFFmpegThumbnailGenerator(aws.S3C, config.AppConfig.FFmpegPath), videoRepo)
+		go thumbnails.Run(ctx)
+		srv.ThumbnailWorker = thumbnails
+	}
+
+	if config.AppConfig.SMTPHost != "" {
+		srv.Mailer = mailer.NewSMTPMailer(
+			config.AppConfig.SMTPHost,
+			config.AppConfig.SMTPPort,
+			config.AppConfig.SMTPUsername,
+			config.AppConfig.SMTPPassword,
+			config.AppConfig.SMTPFrom,
+		)
+	} else {
+		log.Printf("SMTP_HOST not set, emails will not be sent")
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		// Open event streams would otherwise keep the server from shutting down
+		broker.Close()
+		if err := srv.App.Shutdown(); err != nil {
+			log.Printf("Failed to shut down server: %v", err)
+		}
+	}()
+
 	log.Printf("Server starting on port %s", port)
 	srv.Listen()
 }
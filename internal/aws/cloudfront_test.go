@@ -0,0 +1,64 @@
+package aws
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCloudFrontSignURLUsesCannedPolicy(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "cloudfront.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	signer, err := NewCloudFrontSigner("cdn.example.com/", "K2JCJMDEHXQW5F", keyPath)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	expires := time.Unix(1700000000, 0)
+	signed, err := signer.SignURL("videos/intro clip.mp4", expires)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("signed URL does not parse: %v", err)
+	}
+	resource := "https://cdn.example.com/videos/intro%20clip.mp4"
+	if got := strings.SplitN(signed, "?", 2)[0]; got != resource {
+		t.Fatalf("expected resource %s, got %s", resource, got)
+	}
+
+	query := parsed.Query()
+	if query.Get("Expires") != "1700000000" || query.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" {
+		t.Fatalf("unexpected query %v", query)
+	}
+
+	encoded := strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(query.Get("Signature"))
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("signature is not CloudFront base64: %v", err)
+	}
+	digest := sha1.Sum([]byte(cannedPolicy(resource, expires.Unix())))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+}
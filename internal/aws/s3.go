@@ -3,7 +3,9 @@ package aws
 import (
 	"context"
 	"cource-api/internal/config"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"time"
 
@@ -11,8 +13,14 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// expiryDuration converts a presigned URL lifetime in hours, which may be fractional
+func expiryDuration(hours float64) time.Duration {
+	return time.Duration(hours * float64(time.Hour))
+}
+
 type S3Client struct {
 	client          *s3.Client
 	bucketName      string
@@ -57,7 +65,7 @@ func NewS3Client() (*S3Client, error) {
 func (s *S3Client) GeneratePresignedURL(fileKey, contentType string, hours float64) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 
-	expirationDuration := time.Hour * time.Duration(hours)
+	expirationDuration := expiryDuration(hours)
 	fmt.Println(expirationDuration)
 
 	presignedURL, err := presignClient.PresignPutObject(context.Background(), &s3.PutObjectInput{
@@ -77,7 +85,7 @@ func (s *S3Client) GeneratePresignedURL(fileKey, contentType string, hours float
 func (s *S3Client) GenerateThumbnailUploadURL(fileKey, contentType string, hours float64) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 
-	expirationDuration := time.Hour * time.Duration(hours)
+	expirationDuration := expiryDuration(hours)
 
 	presignedURL, err := presignClient.PresignPutObject(context.Background(), &s3.PutObjectInput{
 		Bucket:      aws.String(s.thumbnailBucket),
@@ -92,11 +100,44 @@ func (s *S3Client) GenerateThumbnailUploadURL(fileKey, contentType string, hours
 	return presignedURL.URL, nil
 }
 
+// thumbnailPostConditions builds the policy conditions for a thumbnail upload,
+// restricting the object size to 1..maxBytes and pinning the content type
+func thumbnailPostConditions(contentType string, maxBytes int64) []interface{} {
+	return []interface{}{
+		[]interface{}{"content-length-range", 1, maxBytes},
+		map[string]string{"Content-Type": contentType},
+	}
+}
+
+// GenerateThumbnailUploadPost generates a pre-signed POST policy for uploading a thumbnail.
+// S3 rejects uploads larger than maxBytes or with a different content type. The returned
+// fields must be sent as form data along with the file.
+func (s *S3Client) GenerateThumbnailUploadPost(fileKey, contentType string, maxBytes int64, hours float64) (string, map[string]string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	expirationDuration := expiryDuration(hours)
+
+	presigned, err := presignClient.PresignPostObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(s.thumbnailBucket),
+		Key:    aws.String(fileKey),
+	}, func(opts *s3.PresignPostOptions) {
+		opts.Expires = expirationDuration
+		opts.Conditions = thumbnailPostConditions(contentType, maxBytes)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	presigned.Values["Content-Type"] = contentType
+
+	return presigned.URL, presigned.Values, nil
+}
+
 // GenerateWatchURL generates a pre-signed URL for watching a video
 func (s *S3Client) GenerateWatchURL(fileKey string, hours float64) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 
-	expirationDuration := time.Hour * time.Duration(hours)
+	expirationDuration := expiryDuration(hours)
 
 	presignedURL, err := presignClient.PresignGetObject(context.Background(), &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
@@ -110,6 +151,166 @@ func (s *S3Client) GenerateWatchURL(fileKey string, hours float64) (string, erro
 	return presignedURL.URL, nil
 }
 
+// GenerateThumbnailWatchURL generates a pre-signed URL for viewing a thumbnail
+func (s *S3Client) GenerateThumbnailWatchURL(fileKey string, hours float64) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	expirationDuration := expiryDuration(hours)
+
+	presignedURL, err := presignClient.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.thumbnailBucket),
+		Key:    aws.String(fileKey),
+	}, s3.WithPresignExpires(expirationDuration))
+
+	if err != nil {
+		return "", err
+	}
+
+	return presignedURL.URL, nil
+}
+
+// CompletedPart is an uploaded part of a multipart upload, identified by the ETag S3 returned for it
+type CompletedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// CreateMultipartUpload starts a multipart upload to the main bucket and returns its upload ID
+func (s *S3Client) CreateMultipartUpload(fileKey, contentType string) (string, error) {
+	output, err := s.client.CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(fileKey),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(output.UploadId), nil
+}
+
+// PresignUploadPart generates a pre-signed URL for uploading one part of a multipart upload
+func (s *S3Client) PresignUploadPart(fileKey, uploadID string, partNumber int32, hours float64) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	expirationDuration := expiryDuration(hours)
+
+	presignedURL, err := presignClient.PresignUploadPart(context.Background(), &s3.UploadPartInput{
+		Bucket:     aws.String(s.bucketName),
+		Key:        aws.String(fileKey),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int32(partNumber),
+	}, s3.WithPresignExpires(expirationDuration))
+
+	if err != nil {
+		return "", err
+	}
+
+	return presignedURL.URL, nil
+}
+
+// CompleteMultipartUpload assembles the uploaded parts into the final object
+func (s *S3Client) CompleteMultipartUpload(fileKey, uploadID string, parts []CompletedPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			PartNumber: aws.Int32(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		}
+	}
+
+	_, err := s.client.CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucketName),
+		Key:             aws.String(fileKey),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
+}
+
+// AbortMultipartUpload cancels a multipart upload, letting S3 discard the parts uploaded so far
+func (s *S3Client) AbortMultipartUpload(fileKey, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(fileKey),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
+
+// MultipartUpload is a multipart upload that was started but not completed or aborted
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// ListMultipartUploadsBefore lists the multipart uploads of the main bucket started before cutoff
+func (s *S3Client) ListMultipartUploadsBefore(ctx context.Context, cutoff time.Time) ([]MultipartUpload, error) {
+	var uploads []MultipartUpload
+	input := &s3.ListMultipartUploadsInput{Bucket: aws.String(s.bucketName)}
+
+	for {
+		output, err := s.client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, upload := range output.Uploads {
+			initiated := aws.ToTime(upload.Initiated)
+			if initiated.Before(cutoff) {
+				uploads = append(uploads, MultipartUpload{
+					Key:       aws.ToString(upload.Key),
+					UploadID:  aws.ToString(upload.UploadId),
+					Initiated: initiated,
+				})
+			}
+		}
+
+		if !aws.ToBool(output.IsTruncated) {
+			return uploads, nil
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.UploadIdMarker = output.NextUploadIdMarker
+	}
+}
+
+// ObjectInfo is the metadata S3 stored for an uploaded object
+type ObjectInfo struct {
+	ContentType string
+	Size        int64
+}
+
+// headObject reads the metadata of an object in a bucket, nil when there is no such object
+func (s *S3Client) headObject(bucket, fileKey string) (*ObjectInfo, error) {
+	output, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(fileKey),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		ContentType: aws.ToString(output.ContentType),
+		Size:        aws.ToInt64(output.ContentLength),
+	}, nil
+}
+
+// HeadFile reads the metadata of a file in the main bucket
+func (s *S3Client) HeadFile(fileKey string) (*ObjectInfo, error) {
+	return s.headObject(s.bucketName, fileKey)
+}
+
+// HeadThumbnail reads the metadata of a file in the thumbnail bucket
+func (s *S3Client) HeadThumbnail(fileKey string) (*ObjectInfo, error) {
+	return s.headObject(s.thumbnailBucket, fileKey)
+}
+
 // FileExists checks if a file exists in S3
 func (s *S3Client) FileExists(fileKey string) (bool, error) {
 	_, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
@@ -138,6 +339,17 @@ func (s *S3Client) ThumbnailExists(fileKey string) (bool, error) {
 	return true, nil
 }
 
+// UploadThumbnail uploads a file to the thumbnail bucket
+func (s *S3Client) UploadThumbnail(ctx context.Context, fileKey, contentType string, body io.Reader) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.thumbnailBucket),
+		Key:         aws.String(fileKey),
+		ContentType: aws.String(contentType),
+		Body:        body,
+	})
+	return err
+}
+
 // DeleteFile deletes a file from the main S3 bucket
 func (s *S3Client) DeleteFile(fileKey string) error {
 	_, err := s.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
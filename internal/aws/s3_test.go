@@ -0,0 +1,41 @@
+package aws
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestThumbnailPostConditionsIncludeSizeRange(t *testing.T) {
+	conditions := thumbnailPostConditions("image/png", 1024)
+
+	var foundRange, foundType bool
+	for _, condition := range conditions {
+		switch c := condition.(type) {
+		case []interface{}:
+			if reflect.DeepEqual(c, []interface{}{"content-length-range", 1, int64(1024)}) {
+				foundRange = true
+			}
+		case map[string]string:
+			if c["Content-Type"] == "image/png" {
+				foundType = true
+			}
+		}
+	}
+
+	if !foundRange {
+		t.Fatalf("expected content-length-range condition, got %v", conditions)
+	}
+	if !foundType {
+		t.Fatalf("expected Content-Type condition, got %v", conditions)
+	}
+}
+
+func TestExpiryDurationKeepsFractionalHours(t *testing.T) {
+	if got := expiryDuration(0.5); got != 30*time.Minute {
+		t.Fatalf("expected half an hour, got %v", got)
+	}
+	if got := expiryDuration(12); got != 12*time.Hour {
+		t.Fatalf("expected 12 hours, got %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+// Package certificate renders downloadable certificates for completed courses
+package certificate
+
+import (
+	"io"
+	"time"
+
+	"cource-api/internal/models"
+)
+
+// A4 landscape in points
+const (
+	pageWidth  = 842
+	pageHeight = 595
+	margin     = 50
+)
+
+// Certificate holds everything printed on a course completion certificate
+type Certificate struct {
+	ID          string
+	Name        string
+	CourseTitle string
+	CompletedAt time.Time
+}
+
+// New builds the certificate of an issued certificate record
+func New(record *models.Certificate) *Certificate {
+	return &Certificate{
+		ID:          record.ID.Hex(),
+		Name:        record.RecipientName,
+		CourseTitle: record.CourseTitle,
+		CompletedAt: record.IssuedAt.UTC(),
+	}
+}
+
+// WritePDF renders the certificate as a one page PDF document
+func (c *Certificate) WritePDF(w io.Writer) error {
+	p := &page{width: pageWidth, height: pageHeight}
+	textWidth := float64(pageWidth - 4*margin)
+
+	p.rect(margin/2, margin/2, pageWidth-margin, pageHeight-margin, 3)
+	p.rect(margin/2+8, margin/2+8, pageWidth-margin-16, pageHeight-margin-16, 1)
+
+	p.centeredText("Certificate of Completion", fontBold, 36, 450, textWidth)
+	p.centeredText("This certifies that", fontRegular, 16, 385, textWidth)
+	p.centeredText(c.Name, fontBold, 30, 335, textWidth)
+	p.centeredText("has successfully completed the course", fontRegular, 16, 285, textWidth)
+	p.centeredText(c.CourseTitle, fontBold, 24, 240, textWidth)
+	p.centeredText("Completed on "+c.CompletedAt.Format("January 2, 2006"), fontRegular, 14, 170, textWidth)
+	p.centeredText("Certificate ID: "+c.ID, fontRegular, 10, 70, textWidth)
+
+	return writePDF(w, p)
+}
@@ -0,0 +1,83 @@
+package certificate
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCertificatePDF(t *testing.T) {
+	record := &models.Certificate{
+		ID:            primitive.NewObjectID(),
+		RecipientName: "Zoë (Jane) Doe",
+		CourseTitle:   "Go Basics",
+		IssuedAt:      time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC),
+	}
+
+	var buf bytes.Buffer
+	if err := New(record).WritePDF(&buf); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("expected a complete PDF document")
+	}
+	for _, want := range []string{
+		"(Zo\xeb \\(Jane\\) Doe)",
+		"(Go Basics)",
+		"(Completed on March 14, 2025)",
+		"(Certificate ID: " + record.ID.Hex() + ")",
+	} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("expected the PDF to contain %q", want)
+		}
+	}
+
+	// Every cross reference entry must point at the start of its object
+	match := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("expected a startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) != 6 {
+		t.Fatalf("expected 6 objects, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if !bytes.HasPrefix(pdf[offset:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Errorf("xref entry %d does not point at its object", i+1)
+		}
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	if got := encodeText("Café 日本\n"); string(got) != "Caf\xe9 ?? " {
+		t.Fatalf("unexpected encoding %q", got)
+	}
+}
+
+func TestCenteredTextShrinksToFit(t *testing.T) {
+	p := &page{width: pageWidth, height: pageHeight}
+	long := "An Extremely Long Course Title That Would Never Fit On A Single Line Of The Certificate"
+	p.centeredText(long, fontBold, 24, 240, 400)
+
+	var size, x float64
+	if _, err := fmt.Sscanf(p.content.String(), "BT /F2 %f Tf %f", &size, &x); err != nil {
+		t.Fatalf("unexpected content %q: %v", p.content.String(), err)
+	}
+	if size >= 24 || textWidth(encodeText(long), fontBold, size) > 400 {
+		t.Fatalf("expected the title to shrink to fit, got size %.1f", size)
+	}
+	if x < (pageWidth-400)/2 {
+		t.Fatalf("expected the title to be centered within the width, got x %.2f", x)
+	}
+}
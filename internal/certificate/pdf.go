@@ -0,0 +1,137 @@
+package certificate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Fonts of the certificate, both standard PDF fonts every viewer has built in
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// Glyph widths of the printable ASCII characters in thousandths of the font size, from
+// the Adobe font metrics of the standard fonts
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// defaultGlyphWidth is used for characters outside printable ASCII
+const defaultGlyphWidth = 556
+
+// encodeText converts text to the WinAnsi encoding of the standard fonts. Latin-1
+// characters keep their code, anything else the fonts cannot show becomes "?".
+func encodeText(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			encoded = append(encoded, ' ')
+		case r < 0x7f, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+// textWidth returns the width in points of encoded text set in font at size
+func textWidth(encoded []byte, font string, size float64) float64 {
+	widths := &helveticaWidths
+	if font == fontBold {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, b := range encoded {
+		if b >= 0x20 && b < 0x7f {
+			total += widths[b-0x20]
+		} else {
+			total += defaultGlyphWidth
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// escapeText escapes encoded text for a PDF string literal
+func escapeText(encoded []byte) string {
+	var b strings.Builder
+	for _, c := range encoded {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// page builds the content stream of a single page
+type page struct {
+	width, height float64
+	content       bytes.Buffer
+}
+
+// centeredText writes a line of text centered horizontally at baseline y. The size is
+// reduced until the line fits within maxWidth.
+func (p *page) centeredText(text, font string, size, y, maxWidth float64) {
+	encoded := encodeText(text)
+	width := textWidth(encoded, font, size)
+	for width > maxWidth && size > 6 {
+		size--
+		width = textWidth(encoded, font, size)
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, (p.width-width)/2, y, escapeText(encoded))
+}
+
+// rect strokes a rectangle with the given line width
+func (p *page) rect(x, y, w, h, lineWidth float64) {
+	fmt.Fprintf(&p.content, "%.1f w %.1f %.1f %.1f %.1f re S\n", lineWidth, x, y, w, h)
+}
+
+// writePDF writes a one page PDF document with the page's content
+func writePDF(w io.Writer, p *page) error {
+	var buf bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /%s 4 0 R /%s 5 0 R >> >> /Contents 6 0 R >>",
+		p.width, p.height, fontRegular, fontBold))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.Bytes()))
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -1,28 +1,120 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
 )
 
 type Config struct {
-	MongoURI      string
-	DatabaseName  string
-	JWTSecret     string
-	JWTExpiration time.Duration
-	ServerPort    string
-	Environment   string
-	StripeKey     string
-	StripeWebhook string
+	MongoURI     string
+	DatabaseName string
+	// MongoIndexMode is one of "ensure", "verify" or "skip"
+	MongoIndexMode string
+	// MongoStrictDecode fails list queries on a document that cannot be decoded instead
+	// of logging and skipping it
+	MongoStrictDecode bool
+	JWTSecret         string
+	// JWTAlgorithm is "HS256" to sign with JWTSecret or "RS256" to sign with the private
+	// key under JWTKeyID. JWTPublicKeys lists kid=path pairs of retired keys still accepted.
+	JWTAlgorithm      string
+	JWTPrivateKeyPath string
+	JWTKeyID          string
+	JWTPublicKeys     []string
+	JWTExpiration     time.Duration
+	// JWTRefreshExpiration is how long a refresh token can be used to obtain new access tokens
+	JWTRefreshExpiration time.Duration
+	ServerPort           string
+	// SuperAdminEmails are the admins allowed to impersonate users
+	SuperAdminEmails []string
+	// ImpersonationExpiration is how long an impersonation token is valid
+	ImpersonationExpiration time.Duration
+	// AuthRateLimitMax requests per AuthRateLimitWindow are allowed per IP and email on auth endpoints
+	AuthRateLimitMax    int
+	AuthRateLimitWindow time.Duration
+	// LoginAnomalyRequireOTP asks for an emailed code before completing a flagged login
+	LoginAnomalyRequireOTP bool
+	// LoginAnomalyIPAccounts distinct accounts logging in from one IP within a day flag the IP as shared
+	LoginAnomalyIPAccounts int
+	// LoginCountryHeader is the request header carrying the client country set by the CDN or proxy
+	LoginCountryHeader string
+	Environment        string
+	StripeKey          string
+	StripeWebhook      string
+	// StripeWebhookTolerance is how old a signed webhook may be before it is rejected as a replay
+	StripeWebhookTolerance time.Duration
+	// PayPal REST app credentials, the webhook ID verifies notifications and the API URL
+	// selects the sandbox or live environment
+	PayPalClientID  string
+	PayPalSecret    string
+	PayPalWebhookID string
+	PayPalAPIURL    string
+	// Razorpay API keys, used for checkouts in India, and the secret webhooks are signed with
+	RazorpayKeyID         string
+	RazorpaySecret        string
+	RazorpayWebhookSecret string
 	// AWS Configuration
 	AWSRegion          string
 	AWSAccessKeyID     string
 	AWSSecretAccessKey string
 	AWSBucketName      string
 	AWSThumbnailBucket string
+	// CDNEnabled serves videos through CloudFront signed URLs instead of S3 presigned URLs,
+	// signed with the key pair ID and PEM private key file registered for CDNDomain
+	CDNEnabled        bool
+	CDNDomain         string
+	CDNKeyPairID      string
+	CDNPrivateKeyPath string
+	// WatchURLExpiryHours is how long signed video and thumbnail watch URLs stay valid,
+	// UploadURLExpiryHours how long presigned upload URLs do. Both may be fractional.
+	WatchURLExpiryHours  float64
+	UploadURLExpiryHours float64
+	// PublicThumbnails skips presigning thumbnails when the thumbnail bucket is public
+	PublicThumbnails bool
+	// Thumbnail generation
+	AutoThumbnail bool
+	FFmpegPath    string
+	// SoftDeleteRetention is how long soft deleted users and courses are kept before
+	// being purged, zero disables purging. PurgeInterval is how often the purge runs.
+	SoftDeleteRetention time.Duration
+	PurgeInterval       time.Duration
+	// StaleUploadAge is how long a presigned upload may stay incomplete before its object
+	// is cleaned up, zero disables the cleanup. UploadCleanupInterval is how often it runs.
+	StaleUploadAge        time.Duration
+	UploadCleanupInterval time.Duration
+	// MaintenanceInterval is how often expired OTPs, orphaned watch history and multipart
+	// uploads open longer than StaleUploadAge are cleaned up
+	MaintenanceInterval time.Duration
+	// MaxVideoUploadSize is the largest video in bytes an upload may store
+	MaxVideoUploadSize int64
+	// Base64 encoded 32 byte key for encrypting subscription provider IDs, disabled when empty
+	SubscriptionEncryptionKey string
+	// CourseEditLockMode is "block" to reject publishing or reordering a course while its
+	// videos are processing, or "warn" to only warn
+	CourseEditLockMode string
+	// DefaultPricingRegion is used when a client's region has no pricing of its own
+	DefaultPricingRegion string
+	// Checkout redirect URLs and the extra hosts allowed for per-request overrides
+	FrontendSuccessURL    string
+	FrontendCancelURL     string
+	CheckoutRedirectHosts []string
+	// LiveEventsEnabled serves the server-sent events stream of watch progress and
+	// notifications, each open stream holds a connection. LiveEventsMaxSessions caps the
+	// streams a user can have open at once.
+	LiveEventsEnabled     bool
+	LiveEventsMaxSessions int
+	// SMTP Configuration, emails are only logged when SMTPHost is empty
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
 }
 
 var AppConfig Config
@@ -34,22 +126,95 @@ func Load() error {
 
 	// Set default values
 	AppConfig = Config{
-		MongoURI:      getEnv("MONGODB_URI", "mongodb://localhost:27017"),
-		DatabaseName:  getEnv("DB_NAME", "course-api"),
-		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
-		JWTExpiration: time.Duration(getEnvAsInt("JWT_EXPIRATION_HOURS", 24)) * time.Hour,
-		ServerPort:    getEnv("SERVER_PORT", "8080"),
-		Environment:   getEnv("ENVIRONMENT", "development"),
-		StripeKey:     getEnv("STRIPE_SECRET_KEY", ""),
-		StripeWebhook: getEnv("STRIPE_WEBHOOK_SECRET", ""),
+		MongoURI:                getEnv("MONGODB_URI", "mongodb://localhost:27017"),
+		DatabaseName:            getEnv("DB_NAME", "course-api"),
+		MongoIndexMode:          getEnv("MONGO_INDEX_MODE", "ensure"),
+		MongoStrictDecode:       getEnvAsBool("MONGO_STRICT_DECODE", false),
+		JWTSecret:               getEnv("JWT_SECRET", "your-secret-key"),
+		JWTAlgorithm:            getEnv("JWT_ALGORITHM", "HS256"),
+		JWTPrivateKeyPath:       getEnv("JWT_PRIVATE_KEY_PATH", ""),
+		JWTKeyID:                getEnv("JWT_KEY_ID", ""),
+		JWTPublicKeys:           getEnvAsSlice("JWT_PUBLIC_KEYS", nil),
+		JWTExpiration:           time.Duration(getEnvAsInt("JWT_EXPIRATION_HOURS", 24)) * time.Hour,
+		JWTRefreshExpiration:    time.Duration(getEnvAsInt("JWT_REFRESH_EXPIRATION_HOURS", 720)) * time.Hour,
+		ServerPort:              getEnv("SERVER_PORT", "8080"),
+		SuperAdminEmails:        getEnvAsSlice("SUPERADMIN_EMAILS", nil),
+		ImpersonationExpiration: time.Duration(getEnvAsInt("IMPERSONATION_EXPIRATION_MINUTES", 15)) * time.Minute,
+		AuthRateLimitMax:        getEnvAsInt("AUTH_RATE_LIMIT_MAX", 10),
+		AuthRateLimitWindow:     time.Duration(getEnvAsInt("AUTH_RATE_LIMIT_WINDOW_SECONDS", 60)) * time.Second,
+		LoginAnomalyRequireOTP:  getEnvAsBool("LOGIN_ANOMALY_REQUIRE_OTP", false),
+		LoginAnomalyIPAccounts:  getEnvAsInt("LOGIN_ANOMALY_IP_ACCOUNTS", 5),
+		LoginCountryHeader:      getEnv("LOGIN_COUNTRY_HEADER", "CF-IPCountry"),
+		Environment:             getEnv("ENVIRONMENT", "development"),
+		StripeKey:               getEnv("STRIPE_SECRET_KEY", ""),
+		StripeWebhook:           getEnv("STRIPE_WEBHOOK_SECRET", ""),
+		StripeWebhookTolerance:  time.Duration(getEnvAsInt("STRIPE_WEBHOOK_TOLERANCE_SECONDS", 300)) * time.Second,
+		PayPalClientID:          getEnv("PAYPAL_CLIENT_ID", ""),
+		PayPalSecret:            getEnv("PAYPAL_SECRET", ""),
+		PayPalWebhookID:         getEnv("PAYPAL_WEBHOOK_ID", ""),
+		PayPalAPIURL:            getEnv("PAYPAL_API_URL", "https://api-m.sandbox.paypal.com"),
+		RazorpayKeyID:           getEnv("RAZORPAY_KEY_ID", ""),
+		RazorpaySecret:          getEnv("RAZORPAY_SECRET", ""),
+		RazorpayWebhookSecret:   getEnv("RAZORPAY_WEBHOOK_SECRET", ""),
 		// AWS Configuration
 		AWSRegion:          getEnv("AWS_REGION", "us-east-1"),
 		AWSAccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
 		AWSSecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		AWSBucketName:      getEnv("AWS_BUCKET_NAME", ""),
 		AWSThumbnailBucket: getEnv("AWS_THUMBNAIL_BUCKET", ""),
+		PublicThumbnails:   getEnvAsBool("PUBLIC_THUMBNAILS", false),
+
+		CDNEnabled:        getEnvAsBool("CDN_ENABLED", false),
+		CDNDomain:         getEnv("CDN_DOMAIN", ""),
+		CDNKeyPairID:      getEnv("CDN_KEY_PAIR_ID", ""),
+		CDNPrivateKeyPath: getEnv("CDN_PRIVATE_KEY_PATH", ""),
+
+		WatchURLExpiryHours:  getEnvAsFloat("WATCH_URL_EXPIRY_HOURS", 12),
+		UploadURLExpiryHours: getEnvAsFloat("UPLOAD_URL_EXPIRY_HOURS", 1),
+
+		AutoThumbnail: getEnvAsBool("AUTO_THUMBNAIL", false),
+		FFmpegPath:    getEnv("FFMPEG_PATH", "ffmpeg"),
+
+		SubscriptionEncryptionKey: getEnv("SUBSCRIPTION_ENCRYPTION_KEY", ""),
+
+		SoftDeleteRetention: time.Duration(getEnvAsInt("SOFT_DELETE_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		PurgeInterval:       time.Duration(getEnvAsInt("PURGE_INTERVAL_MINUTES", 60)) * time.Minute,
+
+		StaleUploadAge:        time.Duration(getEnvAsInt("STALE_UPLOAD_HOURS", 24)) * time.Hour,
+		UploadCleanupInterval: time.Duration(getEnvAsInt("UPLOAD_CLEANUP_INTERVAL_MINUTES", 60)) * time.Minute,
+		MaintenanceInterval:   time.Duration(getEnvAsInt("MAINTENANCE_INTERVAL_MINUTES", 60)) * time.Minute,
+		MaxVideoUploadSize:    int64(getEnvAsInt("MAX_VIDEO_UPLOAD_MB", 50*1024)) * 1024 * 1024,
+
+		CourseEditLockMode: getEnv("COURSE_EDIT_LOCK_MODE", "block"),
+
+		DefaultPricingRegion: getEnv("DEFAULT_PRICING_REGION", "US"),
+
+		FrontendSuccessURL:    getEnv("FRONTEND_SUCCESS_URL", "http://localhost:3000/success?session_id={CHECKOUT_SESSION_ID}"),
+		FrontendCancelURL:     getEnv("FRONTEND_CANCEL_URL", "http://localhost:3000/cancel"),
+		CheckoutRedirectHosts: getEnvAsSlice("CHECKOUT_REDIRECT_HOSTS", nil),
+
+		LiveEventsEnabled:     getEnvAsBool("LIVE_EVENTS_ENABLED", false),
+		LiveEventsMaxSessions: getEnvAsInt("LIVE_EVENTS_MAX_SESSIONS", 5),
+
+		// SMTP Configuration
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", ""),
 	}
 
+	return AppConfig.validate()
+}
+
+// validate rejects settings the server cannot run with
+func (c Config) validate() error {
+	if c.WatchURLExpiryHours <= 0 {
+		return fmt.Errorf("WATCH_URL_EXPIRY_HOURS must be positive, got %v", c.WatchURLExpiryHours)
+	}
+	if c.UploadURLExpiryHours <= 0 {
+		return fmt.Errorf("UPLOAD_URL_EXPIRY_HOURS must be positive, got %v", c.UploadURLExpiryHours)
+	}
 	return nil
 }
 
@@ -70,3 +235,121 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// Helper function to get environment variable as float with a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// Helper function to get environment variable as boolean with a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// Helper function to get a comma separated environment variable as a slice
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// maskedSecret is logged in place of secrets that are set
+const maskedSecret = "********"
+
+// mask hides a secret while still showing whether it is configured
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return maskedSecret
+}
+
+// redactURI hides the password of a connection string, falling back to masking it entirely
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return mask(uri)
+	}
+	return u.Redacted()
+}
+
+// LogFields returns the effective configuration as log fields with every secret masked
+func (c Config) LogFields() logrus.Fields {
+	return logrus.Fields{
+		"mongodb_uri":                 redactURI(c.MongoURI),
+		"database_name":               c.DatabaseName,
+		"mongo_strict_decode":         c.MongoStrictDecode,
+		"server_port":                 c.ServerPort,
+		"environment":                 c.Environment,
+		"login_anomaly_require_otp":   c.LoginAnomalyRequireOTP,
+		"login_anomaly_ip_accounts":   c.LoginAnomalyIPAccounts,
+		"login_country_header":        c.LoginCountryHeader,
+		"jwt_secret":                  mask(c.JWTSecret),
+		"jwt_algorithm":               c.JWTAlgorithm,
+		"jwt_private_key_path":        c.JWTPrivateKeyPath,
+		"jwt_key_id":                  c.JWTKeyID,
+		"jwt_public_keys":             c.JWTPublicKeys,
+		"jwt_expiration":              c.JWTExpiration.String(),
+		"jwt_refresh_expiration":      c.JWTRefreshExpiration.String(),
+		"stripe_secret_key":           mask(c.StripeKey),
+		"stripe_webhook_secret":       mask(c.StripeWebhook),
+		"stripe_webhook_tolerance":    c.StripeWebhookTolerance.String(),
+		"paypal_client_id":            c.PayPalClientID,
+		"paypal_secret":               mask(c.PayPalSecret),
+		"paypal_webhook_id":           c.PayPalWebhookID,
+		"paypal_api_url":              c.PayPalAPIURL,
+		"razorpay_key_id":             c.RazorpayKeyID,
+		"razorpay_secret":             mask(c.RazorpaySecret),
+		"razorpay_webhook_secret":     mask(c.RazorpayWebhookSecret),
+		"aws_region":                  c.AWSRegion,
+		"aws_access_key_id":           mask(c.AWSAccessKeyID),
+		"aws_secret_access_key":       mask(c.AWSSecretAccessKey),
+		"aws_bucket_name":             c.AWSBucketName,
+		"aws_thumbnail_bucket":        c.AWSThumbnailBucket,
+		"cdn_enabled":                 c.CDNEnabled,
+		"cdn_domain":                  c.CDNDomain,
+		"cdn_key_pair_id":             c.CDNKeyPairID,
+		"cdn_private_key_path":        c.CDNPrivateKeyPath,
+		"watch_url_expiry_hours":      c.WatchURLExpiryHours,
+		"upload_url_expiry_hours":     c.UploadURLExpiryHours,
+		"auto_thumbnail":              c.AutoThumbnail,
+		"ffmpeg_path":                 c.FFmpegPath,
+		"subscription_encryption":     c.SubscriptionEncryptionKey != "",
+		"subscription_encryption_key": mask(c.SubscriptionEncryptionKey),
+		"soft_delete_retention":       c.SoftDeleteRetention.String(),
+		"purge_interval":              c.PurgeInterval.String(),
+		"stale_upload_age":            c.StaleUploadAge.String(),
+		"upload_cleanup_interval":     c.UploadCleanupInterval.String(),
+		"maintenance_interval":        c.MaintenanceInterval.String(),
+		"max_video_upload_size":       c.MaxVideoUploadSize,
+		"course_edit_lock_mode":       c.CourseEditLockMode,
+		"default_pricing_region":      c.DefaultPricingRegion,
+		"frontend_success_url":        c.FrontendSuccessURL,
+		"frontend_cancel_url":         c.FrontendCancelURL,
+		"checkout_redirect_hosts":     c.CheckoutRedirectHosts,
+		"live_events_enabled":         c.LiveEventsEnabled,
+		"live_events_max_sessions":    c.LiveEventsMaxSessions,
+		"smtp_host":                   c.SMTPHost,
+		"smtp_port":                   c.SMTPPort,
+		"smtp_username":               c.SMTPUsername,
+		"smtp_password":               mask(c.SMTPPassword),
+		"smtp_from":                   c.SMTPFrom,
+	}
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestVerifyIndexesReportsMissingIndex(t *testing.T) {
+	// The client is never used to reach a server, the lister below is faked
+	c, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer c.Disconnect(context.Background())
+
+	users := c.Database("test").Collection("users")
+	specs := []collectionIndexes{
+		{collection: users, models: []mongo.IndexModel{
+			{Keys: bson.D{{Key: "email", Value: 1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		}},
+	}
+
+	existing := []string{"_id_", "email_1"}
+	list := func(ctx context.Context, collection *mongo.Collection) ([]string, error) {
+		return existing, nil
+	}
+
+	err = verifyIndexes(context.Background(), specs, list)
+	if err == nil {
+		t.Fatal("expected an error for the missing index")
+	}
+	if !strings.Contains(err.Error(), "users.user_id_1_created_at_-1") {
+		t.Fatalf("expected the missing index to be named, got %v", err)
+	}
+
+	existing = append(existing, "user_id_1_created_at_-1")
+	if err := verifyIndexes(context.Background(), specs, list); err != nil {
+		t.Fatalf("expected no error once every index exists, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -22,12 +23,44 @@ var (
 	Payments        *mongo.Collection
 	RegionalPricing *mongo.Collection
 	OTPs            *mongo.Collection
+	OTPSends        *mongo.Collection
 	Subscriptions   *mongo.Collection
 	Products        *mongo.Collection
+	CourseStarts    *mongo.Collection
+	RefreshTokens   *mongo.Collection
+	Enrollments     *mongo.Collection
+	AuditLogs       *mongo.Collection
+	WebhookEvents   *mongo.Collection
+	RevokedTokens   *mongo.Collection
+	LoginEvents     *mongo.Collection
+	Coupons         *mongo.Collection
+	UploadIntents   *mongo.Collection
+	Categories      *mongo.Collection
+	Reviews         *mongo.Collection
+	Notifications   *mongo.Collection
+	Certificates    *mongo.Collection
 )
 
-// Connect establishes a connection to MongoDB
-func Connect(uri string, dbName string) error {
+// IndexMode controls how indexes are handled when connecting
+type IndexMode string
+
+const (
+	// IndexModeEnsure creates any missing indexes
+	IndexModeEnsure IndexMode = "ensure"
+	// IndexModeVerify fails to connect when an expected index is missing
+	IndexModeVerify IndexMode = "verify"
+	// IndexModeSkip leaves indexes to be managed outside the application
+	IndexModeSkip IndexMode = "skip"
+)
+
+// collectionIndexes pairs a collection with the indexes it should have
+type collectionIndexes struct {
+	collection *mongo.Collection
+	models     []mongo.IndexModel
+}
+
+// Connect establishes a connection to MongoDB and handles indexes according to indexMode
+func Connect(uri string, dbName string, indexMode IndexMode) error {
 	fmt.Println("URI => ", uri)
 	fmt.Println("DB Name => ", dbName)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -58,12 +91,26 @@ func Connect(uri string, dbName string) error {
 	Payments = database.Collection("payments")
 	RegionalPricing = database.Collection("regional_pricing")
 	OTPs = database.Collection("otps")
+	OTPSends = database.Collection("otp_sends")
 	Subscriptions = database.Collection("subscriptions")
 	Products = database.Collection("products")
+	CourseStarts = database.Collection("course_starts")
+	RefreshTokens = database.Collection("refresh_tokens")
+	Enrollments = database.Collection("enrollments")
+	AuditLogs = database.Collection("audit_logs")
+	WebhookEvents = database.Collection("webhook_events")
+	RevokedTokens = database.Collection("revoked_tokens")
+	LoginEvents = database.Collection("login_events")
+	Coupons = database.Collection("coupons")
+	UploadIntents = database.Collection("upload_intents")
+	Categories = database.Collection("categories")
+	Reviews = database.Collection("reviews")
+	Notifications = database.Collection("notifications")
+	Certificates = database.Collection("certificates")
 
-	// Create indexes
-	if err := createIndexes(); err != nil {
-		fmt.Println("Create indexes error => ", err)
+	// Create or verify indexes
+	if err := applyIndexMode(context.Background(), indexMode); err != nil {
+		fmt.Println("Index error => ", err)
 		return err
 	}
 
@@ -71,104 +118,460 @@ func Connect(uri string, dbName string) error {
 	return nil
 }
 
-// createIndexes creates necessary indexes for the collections
-func createIndexes() error {
-	ctx := context.Background()
-
-	// Users collection indexes
-	_, err := Users.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "email", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-		{
-			Keys: bson.D{{Key: "role", Value: 1}},
-		},
-		{
-			Keys: bson.D{{Key: "subscription.status", Value: 1}},
-		},
-	})
-	if err != nil {
-		return err
+// indexSpecs returns the indexes every collection is expected to have
+func indexSpecs() []collectionIndexes {
+	return []collectionIndexes{
+		// Users collection indexes
+		{collection: Users, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "role", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "subscription.status", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			},
+		}},
+
+		// OTPs collection indexes
+		{collection: OTPs, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "email", Value: 1},
+					{Key: "type", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		}},
+
+		// OTP sends only need to outlive the hourly send limit
+		{collection: OTPSends, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "email", Value: 1},
+					{Key: "type", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+			},
+			{
+				Keys:    bson.D{{Key: "created_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32((24 * time.Hour).Seconds())),
+			},
+		}},
+
+		// WatchHistory collection indexes
+		{collection: WatchHistory, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "video_id", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			// Per video aggregations such as the course completion funnel
+			{
+				Keys: bson.D{{Key: "video_id", Value: 1}},
+			},
+		}},
+
+		// RegionalPricing collection indexes
+		{collection: RegionalPricing, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "region_code", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		}},
+
+		// Subscriptions collection indexes
+		{collection: Subscriptions, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "status", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{{Key: "current_period_end", Value: 1}},
+			},
+			// A provider subscription is stored once. Subscriptions without one store an
+			// empty string rather than omitting the field, so a sparse index would still
+			// collide on them and the index only covers non-empty IDs instead. It is named
+			// so it can be created next to the earlier non-unique subscription_id_1 index.
+			{
+				Keys: bson.D{{Key: "subscription_id", Value: 1}},
+				Options: options.Index().
+					SetName("subscription_id_unique").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{"subscription_id": bson.M{"$gt": ""}}),
+			},
+		}},
+
+		// Products collection indexes
+		{collection: Products, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "product_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "status", Value: 1}},
+			},
+		}},
+
+		// Payments collection indexes
+		{collection: Payments, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "course_id", Value: 1},
+				},
+			},
+			// Webhooks record a transaction once, even when deliveries race
+			{
+				Keys:    bson.D{{Key: "transaction_id", Value: 1}},
+				Options: options.Index().SetUnique(true).SetSparse(true),
+			},
+			// Refund webhooks find the payment by its Stripe references
+			{
+				Keys:    bson.D{{Key: "payment_intent_id", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			},
+			{
+				Keys:    bson.D{{Key: "invoice_id", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			},
+		}},
+
+		// Courses collection indexes
+		{collection: Courses, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "title", Value: "text"},
+					{Key: "subtitle", Value: "text"},
+					{Key: "description", Value: "text"},
+				},
+			},
+			{
+				Keys: bson.D{{Key: "skills", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "category_id", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			},
+		}},
+
+		// CourseStarts collection indexes
+		{collection: CourseStarts, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "course_id", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "started_at", Value: -1},
+				},
+			},
+		}},
+
+		// RefreshTokens collection indexes
+		{collection: RefreshTokens, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "token_hash", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "user_id", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		}},
+
+		// Enrollments collection indexes
+		{collection: Enrollments, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "course_id", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "enrolled_at", Value: -1},
+				},
+			},
+		}},
+
+		// AuditLogs collection indexes
+		{collection: AuditLogs, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "target_id", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "actor_id", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+			},
+		}},
+
+		// WebhookEvents collection indexes. Events are kept well past Stripe's three
+		// day retry window.
+		{collection: WebhookEvents, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "event_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "claimed_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32((30 * 24 * time.Hour).Seconds())),
+			},
+		}},
+
+		// RevokedTokens collection indexes. Entries expire with the token they deny.
+		{collection: RevokedTokens, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "jti", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		}},
+
+		// LoginEvents collection indexes. Login history is kept for 90 days.
+		{collection: LoginEvents, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "outcome", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "ip", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "flags", Value: 1},
+					{Key: "reviewed", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+			},
+			{
+				Keys:    bson.D{{Key: "created_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32((90 * 24 * time.Hour).Seconds())),
+			},
+		}},
+
+		// Coupons collection indexes
+		{collection: Coupons, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "code", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		}},
+
+		// Categories collection indexes
+		{collection: Categories, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "name", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		}},
+
+		// Reviews collection indexes
+		{collection: Reviews, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "course_id", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "course_id", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+			},
+		}},
+
+		// UploadIntents collection indexes
+		{collection: UploadIntents, models: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "file_key", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "status", Value: 1},
+					{Key: "issued_at", Value: 1},
+				},
+			},
+		}},
+
+		// Notifications collection indexes. Notifications are kept for 180 days.
+		{collection: Notifications, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "read", Value: 1},
+				},
+			},
+			{
+				Keys:    bson.D{{Key: "created_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32((180 * 24 * time.Hour).Seconds())),
+			},
+		}},
+
+		// Certificates collection indexes, a user gets one certificate per course
+		{collection: Certificates, models: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "course_id", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+		}},
 	}
+}
 
-	// OTPs collection indexes
-	_, err = OTPs.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys: bson.D{
-				{Key: "email", Value: 1},
-				{Key: "type", Value: 1},
-				{Key: "created_at", Value: -1},
-			},
-		},
-		{
-			Keys:    bson.D{{Key: "expires_at", Value: 1}},
-			Options: options.Index().SetExpireAfterSeconds(0),
-		},
-	})
-	if err != nil {
-		return err
+// applyIndexMode ensures, verifies or skips the expected indexes
+func applyIndexMode(ctx context.Context, mode IndexMode) error {
+	switch mode {
+	case IndexModeEnsure, "":
+		log.Println("Index mode ensure: creating indexes")
+		return ensureIndexes(ctx, indexSpecs())
+	case IndexModeVerify:
+		log.Println("Index mode verify: checking indexes exist")
+		return verifyIndexes(ctx, indexSpecs(), listIndexNames)
+	case IndexModeSkip:
+		log.Println("Index mode skip: indexes are not checked")
+		return nil
+	default:
+		return fmt.Errorf("unknown index mode %q", mode)
 	}
+}
 
-	// WatchHistory collection indexes
-	_, err = WatchHistory.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys: bson.D{
-				{Key: "user_id", Value: 1},
-				{Key: "video_id", Value: 1},
-			},
-			Options: options.Index().SetUnique(true),
-		},
-	})
-	if err != nil {
-		return err
+// ensureIndexes creates the given indexes, existing ones are left untouched
+func ensureIndexes(ctx context.Context, specs []collectionIndexes) error {
+	for _, spec := range specs {
+		if _, err := spec.collection.Indexes().CreateMany(ctx, spec.models); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// RegionalPricing collection indexes
-	_, err = RegionalPricing.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "region_code", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-	})
+// indexLister returns the names of the indexes that exist on a collection
+type indexLister func(ctx context.Context, collection *mongo.Collection) ([]string, error)
+
+// listIndexNames lists the index names of a collection from the server
+func listIndexNames(ctx context.Context, collection *mongo.Collection) ([]string, error) {
+	specs, err := collection.Indexes().ListSpecifications(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Subscriptions collection indexes
-	_, err = Subscriptions.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys: bson.D{
-				{Key: "user_id", Value: 1},
-				{Key: "status", Value: 1},
-			},
-		},
-		{
-			Keys: bson.D{{Key: "current_period_end", Value: 1}},
-		},
-		{
-			Keys: bson.D{{Key: "subscription_id", Value: 1}},
-		},
-	})
-	if err != nil {
-		return err
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		names[i] = spec.Name
 	}
+	return names, nil
+}
 
-	// Products collection indexes
-	_, err = Products.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "product_id", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-		{
-			Keys: bson.D{{Key: "status", Value: 1}},
-		},
-	})
+// verifyIndexes returns an error naming every expected index that does not exist
+func verifyIndexes(ctx context.Context, specs []collectionIndexes, list indexLister) error {
+	var missing []string
+	for _, spec := range specs {
+		names, err := list(ctx, spec.collection)
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[string]bool, len(names))
+		for _, name := range names {
+			existing[name] = true
+		}
+
+		for _, model := range spec.models {
+			if name := indexName(model); !existing[name] {
+				missing = append(missing, spec.collection.Name()+"."+name)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing indexes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// indexName returns the name MongoDB gives an index, either the explicit name
+// or the default built from its keys such as "user_id_1_created_at_-1"
+func indexName(model mongo.IndexModel) string {
+	if model.Options != nil && model.Options.Name != nil {
+		return *model.Options.Name
+	}
+
+	keys, ok := model.Keys.(bson.D)
+	if !ok {
+		return ""
+	}
+
+	parts := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// WithTransaction runs fn inside a MongoDB transaction, committing when fn
+// returns nil. Transactions require a replica set or sharded cluster.
+func WithTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) error) error {
+	session, err := client.StartSession()
 	if err != nil {
 		return err
 	}
+	defer session.EndSession(ctx)
 
-	return nil
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
 }
 
 // Disconnect closes the MongoDB connection
@@ -0,0 +1,98 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// prefix marks values that were written by a FieldCipher, so plaintext rows
+// stored before encryption was enabled can still be read and migrated.
+const prefix = "enc:v1:"
+
+var ErrInvalidKey = errors.New("encryption key must be 32 bytes (base64 encoded)")
+
+// FieldCipher encrypts individual document fields with AES-256-GCM.
+//
+// The nonce is derived from an HMAC of the plaintext, so the same value always
+// encrypts to the same ciphertext. This leaks equality but keeps encrypted
+// fields usable in exact-match queries such as lookups by provider ID.
+type FieldCipher struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// NewFieldCipher creates a cipher from a base64 encoded 32 byte key
+func NewFieldCipher(encodedKey string) (*FieldCipher, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive a separate key for nonce generation
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("nonce"))
+
+	return &FieldCipher{
+		aead:   aead,
+		macKey: mac.Sum(nil),
+	}, nil
+}
+
+// Encrypt encrypts a value. Empty and already encrypted values are returned unchanged.
+func (f *FieldCipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+
+	mac := hmac.New(sha256.New, f.macKey)
+	mac.Write([]byte(plaintext))
+	nonce := mac.Sum(nil)[:f.aead.NonceSize()]
+
+	sealed := f.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt. Values without the
+// encryption prefix are treated as legacy plaintext and returned unchanged.
+func (f *FieldCipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", err
+	}
+
+	nonceSize := f.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("ciphertext too short")
+	}
+
+	plaintext, err := f.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether the value carries the encryption prefix
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
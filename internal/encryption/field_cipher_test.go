@@ -0,0 +1,62 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestEncryptRoundTrip(t *testing.T) {
+	fc, err := NewFieldCipher(testKey)
+	if err != nil {
+		t.Fatalf("NewFieldCipher() returned error: %v", err)
+	}
+
+	encrypted, err := fc.Encrypt("cus_12345")
+	if err != nil {
+		t.Fatalf("Encrypt() returned error: %v", err)
+	}
+	if strings.Contains(encrypted, "cus_12345") || !IsEncrypted(encrypted) {
+		t.Fatalf("expected ciphertext, got %q", encrypted)
+	}
+
+	decrypted, err := fc.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Decrypt() returned error: %v", err)
+	}
+	if decrypted != "cus_12345" {
+		t.Fatalf("expected cus_12345, got %q", decrypted)
+	}
+}
+
+func TestEncryptIsDeterministicAndIdempotent(t *testing.T) {
+	fc, _ := NewFieldCipher(testKey)
+
+	first, _ := fc.Encrypt("sub_abc")
+	second, _ := fc.Encrypt("sub_abc")
+	if first != second {
+		t.Fatal("expected identical plaintexts to produce identical ciphertexts")
+	}
+
+	again, _ := fc.Encrypt(first)
+	if again != first {
+		t.Fatal("expected encrypting a ciphertext to be a no-op")
+	}
+}
+
+func TestDecryptPlaintextPassthrough(t *testing.T) {
+	fc, _ := NewFieldCipher(testKey)
+
+	value, err := fc.Decrypt("pm_legacy")
+	if err != nil || value != "pm_legacy" {
+		t.Fatalf("expected legacy plaintext to pass through, got %q (%v)", value, err)
+	}
+}
+
+func TestNewFieldCipherRejectsShortKey(t *testing.T) {
+	if _, err := NewFieldCipher(base64.StdEncoding.EncodeToString([]byte("short"))); err != ErrInvalidKey {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+}
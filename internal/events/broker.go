@@ -0,0 +1,120 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event types pushed to connected clients
+const (
+	TypeWatchProgress = "watch_progress"
+	TypeNotification  = "notification"
+)
+
+// subscriberBuffer is how many events a subscriber can fall behind before new events are
+// dropped for it
+const subscriberBuffer = 16
+
+// Event is pushed to the connected sessions of a user
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// Broker is an in-process pub/sub of events keyed by user ID. Events only reach the
+// sessions connected to this process. A nil broker drops every event, so publishers do
+// not need to check whether live events are enabled.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[primitive.ObjectID]map[chan Event]struct{}
+	closed      bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[primitive.ObjectID]map[chan Event]struct{}),
+	}
+}
+
+// Subscribe registers a session of a user. The returned channel receives the events of
+// the user and is closed by unsubscribe or when the broker closes. unsubscribe must be
+// called once the session ends and may be called more than once.
+func (b *Broker) Subscribe(userID primitive.ObjectID) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan Event]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+
+	return ch, func() { b.unsubscribe(userID, ch) }
+}
+
+func (b *Broker) unsubscribe(userID primitive.ObjectID, ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sessions := b.subscribers[userID]
+	if _, ok := sessions[ch]; !ok {
+		return
+	}
+	delete(sessions, ch)
+	if len(sessions) == 0 {
+		delete(b.subscribers, userID)
+	}
+	close(ch)
+}
+
+// Publish sends an event to every connected session of a user without blocking. A
+// session that has fallen too far behind misses the event.
+func (b *Broker) Publish(userID primitive.ObjectID, event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+			logrus.WithField("user_id", userID).WithField("type", event.Type).Warn("Dropped live event for a slow session")
+		}
+	}
+}
+
+// Subscribers returns the number of connected sessions of a user
+func (b *Broker) Subscribers(userID primitive.ObjectID) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[userID])
+}
+
+// Close ends every session so open streams return, for example on shutdown. Later
+// subscriptions are closed immediately.
+func (b *Broker) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for userID, sessions := range b.subscribers {
+		for ch := range sessions {
+			close(ch)
+		}
+		delete(b.subscribers, userID)
+	}
+	b.closed = true
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBrokerPublishReachesOnlyTheUsersSessions(t *testing.T) {
+	b := NewBroker()
+	userID := primitive.NewObjectID()
+
+	phone, unsubscribePhone := b.Subscribe(userID)
+	laptop, unsubscribeLaptop := b.Subscribe(userID)
+	other, unsubscribeOther := b.Subscribe(primitive.NewObjectID())
+	defer unsubscribeLaptop()
+	defer unsubscribeOther()
+
+	b.Publish(userID, Event{Type: TypeWatchProgress, Data: 42})
+
+	for name, ch := range map[string]<-chan Event{"phone": phone, "laptop": laptop} {
+		select {
+		case event := <-ch:
+			if event.Type != TypeWatchProgress || event.Data != 42 {
+				t.Fatalf("%s: unexpected event %+v", name, event)
+			}
+		default:
+			t.Fatalf("%s: expected the event to be delivered", name)
+		}
+	}
+	select {
+	case event := <-other:
+		t.Fatalf("expected another user's session to get nothing, got %+v", event)
+	default:
+	}
+
+	unsubscribePhone()
+	unsubscribePhone()
+	if _, ok := <-phone; ok {
+		t.Fatal("expected the channel to be closed on unsubscribe")
+	}
+	if n := b.Subscribers(userID); n != 1 {
+		t.Fatalf("expected 1 session left, got %d", n)
+	}
+}
+
+func TestBrokerPublishDoesNotBlockOnSlowSessions(t *testing.T) {
+	b := NewBroker()
+	userID := primitive.NewObjectID()
+	ch, unsubscribe := b.Subscribe(userID)
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer*2; i++ {
+		b.Publish(userID, Event{Type: TypeNotification, Data: i})
+	}
+	if len(ch) != subscriberBuffer {
+		t.Fatalf("expected the buffer to fill and later events to drop, got %d queued", len(ch))
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker()
+	userID := primitive.NewObjectID()
+	ch, unsubscribe := b.Subscribe(userID)
+
+	b.Close()
+	if _, ok := <-ch; ok {
+		t.Fatal("expected close to end open sessions")
+	}
+	unsubscribe()
+
+	late, _ := b.Subscribe(userID)
+	if _, ok := <-late; ok {
+		t.Fatal("expected a subscription after close to be closed")
+	}
+
+	var disabled *Broker
+	disabled.Publish(userID, Event{Type: TypeNotification})
+	disabled.Close()
+}
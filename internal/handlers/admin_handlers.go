@@ -1,34 +1,29 @@
 package handlers
 
 import (
+	"cource-api/internal/config"
+	"cource-api/internal/middleware"
 	"cource-api/internal/models"
 	"cource-api/internal/repository"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // HandleListUsers lists all users with pagination and filtering
 func HandleListUsers(repo *repository.UserRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get pagination parameters
-		page, err := strconv.ParseInt(c.Query("page", "1"), 10, 64)
-		if err != nil || page < 1 {
-			page = 1
-		}
-		limit, err := strconv.ParseInt(c.Query("limit", "10"), 10, 64)
-		if err != nil || limit < 1 || limit > 100 {
-			limit = 10
-		}
+		pagination := parsePagination(c, defaultPageLimit)
 
 		// Get filter parameters
 		role := c.Query("role")
 		isVerified := c.Query("is_verified")
 		isBlocked := c.Query("is_blocked")
 		search := c.Query("search")
+		includeDeleted, _ := strconv.ParseBool(c.Query("include_deleted"))
 
 		// Build filter
 		filter := make(map[string]interface{})
@@ -55,45 +50,51 @@ func HandleListUsers(repo *repository.UserRepository) fiber.Handler {
 		}
 
 		// Get users
-		users, total, err := repo.ListWithFilter(c.Context(), filter, page, limit)
+		users, total, err := repo.ListWithFilter(c.Context(), filter, includeDeleted, pagination.Page, pagination.Limit)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to list users")
+			log(c).WithError(err).Error("Failed to list users")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve users")
 		}
 
-		return c.JSON(fiber.Map{
-			"users": users,
-			"total": total,
-			"page":  page,
-			"limit": limit,
-		})
+		return c.JSON(Paginate(users, total, pagination))
 	}
 }
 
+// ensureNotLastAdmin refuses to remove the admin role from target, by demotion or deletion,
+// when no other admin would be left to manage the platform
+func ensureNotLastAdmin(c *fiber.Ctx, repo *repository.UserRepository, target *models.User) error {
+	if target.Role != "admin" {
+		return nil
+	}
+
+	admins, err := repo.CountByRole(c.Context(), "admin")
+	if err != nil {
+		log(c).WithError(err).Error("Failed to count admins")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify remaining admins")
+	}
+	if admins <= 1 {
+		return fiber.NewError(fiber.StatusConflict, "Cannot remove the last admin")
+	}
+	return nil
+}
+
 // HandleUpdateUser updates a user's information
 func HandleUpdateUser(repo *repository.UserRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get user ID from params
-		userID := c.Params("id")
-		if userID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "User ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(userID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			logrus.WithError(err).WithField("user_id", userID).Error("Invalid user ID format")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID format")
+			return err
 		}
 
 		// Get existing user
 		user, err := repo.GetByID(c.Context(), objectID)
 		if err != nil {
-			logrus.WithError(err).WithField("user_id", userID).Error("Failed to get user")
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to get user")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve user")
 		}
 		if user == nil {
-			return fiber.NewError(fiber.StatusNotFound, "User not found")
+			return errUserNotFound
 		}
 
 		// Parse update data
@@ -104,11 +105,16 @@ func HandleUpdateUser(repo *repository.UserRepository) fiber.Handler {
 			IsVerified  bool   `json:"is_verified"`
 			Blocked     bool   `json:"blocked"`
 			NewPassword string `json:"new_password"`
+			// UpdatedAt is the version the admin edited, optional
+			UpdatedAt *time.Time `json:"updated_at"`
 		}
 
 		if err := c.BodyParser(&updateData); err != nil {
-			logrus.WithError(err).Error("Failed to parse update request body")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			log(c).WithError(err).Error("Failed to parse update request body")
+			return errInvalidBody
+		}
+		if err := checkUnmodified(updateData.UpdatedAt, user.UpdatedAt); err != nil {
+			return err
 		}
 
 		// Validate role if provided
@@ -116,6 +122,20 @@ func HandleUpdateUser(repo *repository.UserRepository) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid role")
 		}
 
+		// Guard against an admin locking themselves or everyone out
+		if updateData.Role != "" && updateData.Role != user.Role {
+			admin, err := GetUserFromContext(c)
+			if err != nil {
+				return err
+			}
+			if admin.ID == user.ID {
+				return fiber.NewError(fiber.StatusConflict, "Cannot change your own role")
+			}
+			if err := ensureNotLastAdmin(c, repo, user); err != nil {
+				return err
+			}
+		}
+
 		// Update user fields
 		if updateData.Name != "" {
 			user.Name = updateData.Name
@@ -124,7 +144,7 @@ func HandleUpdateUser(repo *repository.UserRepository) fiber.Handler {
 			// Check if email is already taken
 			existingUser, err := repo.GetByEmail(c.Context(), updateData.Email)
 			if err != nil {
-				logrus.WithError(err).Error("Failed to check email availability")
+				log(c).WithError(err).Error("Failed to check email availability")
 				return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify email")
 			}
 			if existingUser != nil && existingUser.ID != user.ID {
@@ -145,7 +165,7 @@ func HandleUpdateUser(repo *repository.UserRepository) fiber.Handler {
 			}
 			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(updateData.NewPassword), bcrypt.DefaultCost)
 			if err != nil {
-				logrus.WithError(err).Error("Failed to hash new password")
+				log(c).WithError(err).Error("Failed to hash new password")
 				return fiber.NewError(fiber.StatusInternalServerError, "Failed to update password")
 			}
 			user.PasswordHash = string(hashedPassword)
@@ -153,7 +173,10 @@ func HandleUpdateUser(repo *repository.UserRepository) fiber.Handler {
 
 		// Save updated user
 		if err := repo.Update(c.Context(), user); err != nil {
-			logrus.WithError(err).WithField("user_id", userID).Error("Failed to update user")
+			if staleErr := staleUpdateError(err); staleErr != nil {
+				return staleErr
+			}
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to update user")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update user")
 		}
 
@@ -161,48 +184,195 @@ func HandleUpdateUser(repo *repository.UserRepository) fiber.Handler {
 	}
 }
 
-// HandleDeleteUser deletes a user
+// HandleDeleteUser soft deletes a user. Admins cannot delete themselves or the last admin.
 func HandleDeleteUser(repo *repository.UserRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get user ID from params
-		userID := c.Params("id")
-		if userID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "User ID is required")
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
 		}
 
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(userID)
+		admin, err := GetUserFromContext(c)
 		if err != nil {
-			logrus.WithError(err).WithField("user_id", userID).Error("Invalid user ID format")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID format")
+			return err
+		}
+		if admin.ID == objectID {
+			return fiber.NewError(fiber.StatusConflict, "Cannot delete your own account")
 		}
 
-		// Get existing user
 		user, err := repo.GetByID(c.Context(), objectID)
 		if err != nil {
-			logrus.WithError(err).WithField("user_id", userID).Error("Failed to get user")
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve user")
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to get user")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete user")
 		}
 		if user == nil {
-			return fiber.NewError(fiber.StatusNotFound, "User not found")
+			return errUserNotFound
+		}
+		if err := ensureNotLastAdmin(c, repo, user); err != nil {
+			return err
 		}
 
-		// Delete user
-		if err := repo.Delete(c.Context(), objectID); err != nil {
-			logrus.WithError(err).WithField("user_id", userID).Error("Failed to delete user")
+		deleted, err := repo.Delete(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to delete user")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete user")
 		}
+		if !deleted {
+			return errUserNotFound
+		}
 
 		return c.SendStatus(fiber.StatusNoContent)
 	}
 }
 
+// HandleRestoreUser restores a soft deleted user
+func HandleRestoreUser(repo *repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		restored, err := repo.Restore(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to restore user")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to restore user")
+		}
+		if !restored {
+			return fiber.NewError(fiber.StatusNotFound, "Deleted user not found")
+		}
+
+		user, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to get user")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve user")
+		}
+
+		return c.JSON(user)
+	}
+}
+
+// HandleEraseUser permanently erases a user and their personal data for GDPR erasure
+// requests. The erasure itself is audited.
+func HandleEraseUser(repo *repository.UserRepository, auditRepo *repository.AuditRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		admin, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+		if admin.ID == objectID {
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot erase yourself")
+		}
+
+		erased, err := repo.HardDelete(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to erase user")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to erase user")
+		}
+		if !erased {
+			return errUserNotFound
+		}
+
+		entry := &models.AuditLog{
+			ActorID:    admin.ID,
+			Action:     "user.erase",
+			TargetType: "user",
+			TargetID:   objectID,
+		}
+		if err := auditRepo.Record(c.Context(), entry); err != nil {
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to record erasure audit entry")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// HandleImpersonateUser issues a short lived, read-only token that lets a superadmin
+// act as a user to reproduce support issues. Every issued token is audited.
+func HandleImpersonateUser(repo *repository.UserRepository, auditRepo *repository.AuditRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		admin, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+		if admin.ID == objectID {
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot impersonate yourself")
+		}
+
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+		if req.Reason == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Reason is required")
+		}
+
+		user, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get user")
+		}
+		if user == nil {
+			return errUserNotFound
+		}
+		if user.Role == "admin" {
+			return fiber.NewError(fiber.StatusForbidden, "Admins cannot be impersonated")
+		}
+
+		token, expiresAt, err := middleware.GenerateImpersonationToken(user, admin.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to generate impersonation token")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
+		}
+
+		// No token is handed out unless the impersonation is on record
+		entry := &models.AuditLog{
+			ActorID:    admin.ID,
+			Action:     "user.impersonate",
+			TargetType: "user",
+			TargetID:   user.ID,
+			Details: map[string]interface{}{
+				"reason":     req.Reason,
+				"expires_at": expiresAt,
+				"ip":         c.IP(),
+			},
+		}
+		if err := auditRepo.Record(c.Context(), entry); err != nil {
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to record impersonation audit entry")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to record impersonation")
+		}
+
+		log(c).WithFields(logrus.Fields{
+			"user_id":         user.ID,
+			"impersonated_by": admin.ID,
+		}).Warn("Impersonation token issued")
+
+		return c.JSON(fiber.Map{
+			"token":      token,
+			"expires_at": expiresAt,
+			"user":       user,
+		})
+	}
+}
+
 // HandleGetUserStats gets user statistics
 func HandleGetUserStats(repo *repository.UserRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		stats, err := repo.GetUserStats(c.Context())
 		if err != nil {
-			logrus.WithError(err).Error("Failed to get user statistics")
+			log(c).WithError(err).Error("Failed to get user statistics")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve user statistics")
 		}
 
@@ -210,6 +380,25 @@ func HandleGetUserStats(repo *repository.UserRepository) fiber.Handler {
 	}
 }
 
+// HandleGetRevenueStats returns revenue by currency, region and month for a date range
+// along with subscription counts and MRR (admin only)
+func HandleGetRevenueStats(repo *repository.PaymentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		from, to, err := parseDateRange(c)
+		if err != nil {
+			return err
+		}
+
+		stats, err := repo.RevenueStats(c.Context(), from, to)
+		if err != nil {
+			log(c).WithError(err).Error("Failed to get revenue statistics")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve revenue statistics")
+		}
+
+		return c.JSON(stats)
+	}
+}
+
 // HandleUpdateRegionalPricing updates pricing for a specific region (admin only)
 func HandleUpdateRegionalPricing(repo *repository.PaymentRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -219,31 +408,62 @@ func HandleUpdateRegionalPricing(repo *repository.PaymentRepository) fiber.Handl
 			return fiber.NewError(fiber.StatusBadRequest, "Region code is required")
 		}
 
-		// Parse pricing data
-		var pricing models.RegionalPricing
-		if err := c.BodyParser(&pricing); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		var req regionalPricingRequest
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
 		}
 
-		// Validate required fields
-		if pricing.Currency == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Currency is required")
-		}
-		if pricing.MonthlyPrice <= 0 {
-			return fiber.NewError(fiber.StatusBadRequest, "Monthly price must be greater than 0")
-		}
-		if pricing.YearlyPrice <= 0 {
-			return fiber.NewError(fiber.StatusBadRequest, "Yearly price must be greater than 0")
+		pricing, err := buildRegionalPricing(regionCode, req)
+		if err != nil {
+			return err
 		}
 
-		// Set region code
-		pricing.RegionCode = regionCode
-
 		// Update pricing
-		if err := repo.UpdateRegionalPricing(c.Context(), &pricing); err != nil {
+		if err := repo.UpdateRegionalPricing(c.Context(), pricing); err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update regional pricing")
 		}
 
 		return c.JSON(pricing)
 	}
 }
+
+// HandleAdminListRegionalPricing lists regional pricing, optionally filtered by currency (admin only)
+func HandleAdminListRegionalPricing(repo *repository.PaymentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pagination := parsePagination(c, defaultPageLimit)
+		currency := normalizeCurrency(c.Query("currency"))
+
+		pricing, total, err := repo.ListRegionalPricing(c.Context(), currency, pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).WithField("currency", currency).Error("Failed to list regional pricing")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve regional pricing")
+		}
+
+		return c.JSON(Paginate(pricing, total, pagination))
+	}
+}
+
+// HandleDeleteRegionalPricing removes the pricing of a region (admin only). The default
+// pricing region cannot be removed since other regions fall back to it.
+func HandleDeleteRegionalPricing(repo *repository.PaymentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		regionCode := c.Params("region")
+		if regionCode == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Region code is required")
+		}
+		if regionCode == config.AppConfig.DefaultPricingRegion {
+			return fiber.NewError(fiber.StatusConflict, "The default pricing region cannot be deleted")
+		}
+
+		deleted, err := repo.DeleteRegionalPricing(c.Context(), regionCode)
+		if err != nil {
+			log(c).WithError(err).WithField("region", regionCode).Error("Failed to delete regional pricing")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete regional pricing")
+		}
+		if !deleted {
+			return errPricingNotFound
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"cource-api/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHandleDeleteUserRejectsSelf(t *testing.T) {
+	adminID := primitive.NewObjectID()
+
+	app := fiber.New()
+	app.Delete("/admin/users/:id", func(c *fiber.Ctx) error {
+		c.Locals("user", &middleware.Claims{UserID: adminID, Role: "admin"})
+		return c.Next()
+	}, HandleDeleteUser(nil))
+
+	resp, err := app.Test(httptest.NewRequest("DELETE", "/admin/users/"+adminID.Hex(), nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Fatalf("expected status 409, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxTimeSeriesRange bounds how far apart from and to may be for an analytics query
+const maxTimeSeriesRange = 2 * 365 * 24 * time.Hour
+
+// parseAnalyticsDate parses a date query value as RFC3339 or YYYY-MM-DD
+func parseAnalyticsDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// parseDateRange reads the from and to query values, defaulting to the last 30 days
+func parseDateRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -30)
+
+	if v := c.Query("from"); v != "" {
+		t, err := parseAnalyticsDate(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fiber.NewError(fiber.StatusBadRequest, "Invalid from date")
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := parseAnalyticsDate(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fiber.NewError(fiber.StatusBadRequest, "Invalid to date")
+		}
+		to = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fiber.NewError(fiber.StatusBadRequest, "from must be before to")
+	}
+	if to.Sub(from) > maxTimeSeriesRange {
+		return time.Time{}, time.Time{}, fiber.NewError(fiber.StatusBadRequest, "Date range is too large")
+	}
+
+	return from, to, nil
+}
+
+// HandleGetTimeSeries returns a bucketed time series for a platform metric (admin only).
+// Revenue has a point per bucket and currency.
+func HandleGetTimeSeries(repo *repository.AnalyticsRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		metric := c.Query("metric")
+		interval := c.Query("interval", "day")
+
+		if interval != "day" && interval != "week" && interval != "month" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid interval, must be one of day, week, month")
+		}
+
+		from, to, err := parseDateRange(c)
+		if err != nil {
+			return err
+		}
+
+		var points []*models.TimeSeriesPoint
+
+		switch metric {
+		case "signups":
+			points, err = repo.SignupsTimeSeries(c.Context(), interval, from, to)
+		case "revenue":
+			points, err = repo.RevenueTimeSeries(c.Context(), interval, from, to)
+		case "active_subs":
+			points, err = repo.ActiveSubscriptionsTimeSeries(c.Context(), interval, from, to)
+		default:
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid metric, must be one of signups, revenue, active_subs")
+		}
+
+		if err != nil {
+			log(c).WithError(err).WithField("metric", metric).Error("Failed to get time series")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve analytics")
+		}
+
+		return c.JSON(fiber.Map{
+			"metric":   metric,
+			"interval": interval,
+			"from":     from,
+			"to":       to,
+			"points":   points,
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"cource-api/internal/config"
+	"cource-api/internal/mailer"
 	"cource-api/internal/middleware"
 	"cource-api/internal/models"
 	"cource-api/internal/repository"
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -25,6 +29,8 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// OTP is the emailed sign-in code, required only when a flagged login is challenged
+	OTP string `json:"otp"`
 }
 
 // validateEmail checks if the email is valid
@@ -56,12 +62,12 @@ func validatePassword(password string) error {
 }
 
 // HandleRegister handles user registration
-func HandleRegister(repo *repository.UserRepository, otpRepo *repository.OTPRepository) fiber.Handler {
+func HandleRegister(repo *repository.UserRepository, otpRepo *repository.OTPRepository, m mailer.Mailer) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var req RegisterRequest
 		if err := c.BodyParser(&req); err != nil {
-			logrus.WithError(err).Error("Failed to parse registration request body")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			log(c).WithError(err).Error("Failed to parse registration request body")
+			return errInvalidBody
 		}
 
 		// Validate email
@@ -78,13 +84,21 @@ func HandleRegister(repo *repository.UserRepository, otpRepo *repository.OTPRepo
 		existingUser, err := repo.GetByEmail(c.Context(), req.Email)
 		if err == nil && existingUser != nil {
 			if !existingUser.IsVerified {
-				otp, err := GenerateAndSaveOTP(c.Context(), otpRepo, req.Email, "registration")
+				// Registering again sends a new code, so it is limited like a resend
+				retryAfter, reason, err := otpSendRetryAfter(c.Context(), otpRepo, req.Email, models.OTPTypeRegistration)
 				if err != nil {
-					logrus.WithError(err).Error("Failed to generate OTP during registration")
+					log(c).WithError(err).Error("Failed to check OTP send limits during registration")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate verification code")
+				}
+				if retryAfter > 0 {
+					return otpRetryLater(c, reason, retryAfter)
+				}
+
+				if _, err := GenerateAndSaveOTP(c.Context(), otpRepo, m, req.Email, models.OTPTypeRegistration); err != nil {
+					log(c).WithError(err).Error("Failed to generate OTP during registration")
 					return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate verification code")
 				}
 
-				fmt.Println(otp)
 				return c.JSON(fiber.Map{
 					"message": "User already registered. Please verify your email with the OTP.",
 				})
@@ -95,7 +109,7 @@ func HandleRegister(repo *repository.UserRepository, otpRepo *repository.OTPRepo
 		// Hash password
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to hash password during registration")
+			log(c).WithError(err).Error("Failed to hash password during registration")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to process registration")
 		}
 
@@ -110,32 +124,30 @@ func HandleRegister(repo *repository.UserRepository, otpRepo *repository.OTPRepo
 		}
 
 		if err := repo.Create(c.Context(), user); err != nil {
-			logrus.WithError(err).WithField("email", req.Email).Error("Failed to create user during registration")
+			log(c).WithError(err).WithField("email", req.Email).Error("Failed to create user during registration")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create user")
 		}
 
 		// Generate and save OTP
-		otp, err := GenerateAndSaveOTP(c.Context(), otpRepo, req.Email, "registration")
-		if err != nil {
-			logrus.WithError(err).Error("Failed to generate OTP during registration")
+		if _, err := GenerateAndSaveOTP(c.Context(), otpRepo, m, req.Email, models.OTPTypeRegistration); err != nil {
+			log(c).WithError(err).Error("Failed to generate OTP during registration")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate verification code")
 		}
 
-		fmt.Println(otp)
-
 		return c.JSON(fiber.Map{
 			"message": "Registration successful. Please verify your email with the OTP.",
 		})
 	}
 }
 
-// HandleLogin handles user login
-func HandleLogin(repo *repository.UserRepository) fiber.Handler {
+// HandleLogin handles user login. Logins are recorded and checked for anomalies; when
+// LoginAnomalyRequireOTP is set, a flagged login must be completed with an emailed code.
+func HandleLogin(repo *repository.UserRepository, refreshRepo *repository.RefreshTokenRepository, loginRepo *repository.LoginEventRepository, otpRepo *repository.OTPRepository, m mailer.Mailer) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var req LoginRequest
 		if err := c.BodyParser(&req); err != nil {
-			logrus.WithError(err).Error("Failed to parse login request body")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			log(c).WithError(err).Error("Failed to parse login request body")
+			return errInvalidBody
 		}
 
 		// Validate email
@@ -150,12 +162,12 @@ func HandleLogin(repo *repository.UserRepository) fiber.Handler {
 		// Get user by email
 		user, err := repo.GetByEmail(c.Context(), req.Email)
 		if err != nil {
-			logrus.WithError(err).WithField("email", req.Email).Error("Failed to get user during login")
-			return fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
+			log(c).WithError(err).WithField("email", req.Email).Error("Failed to get user during login")
+			return errInvalidCredentials
 		}
 
 		if user == nil {
-			return fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
+			return errInvalidCredentials
 		}
 
 		if !user.IsVerified {
@@ -167,34 +179,184 @@ func HandleLogin(repo *repository.UserRepository) fiber.Handler {
 			return fiber.NewError(fiber.StatusForbidden, "Account is blocked")
 		}
 
+		// Refuse logins while the account is locked after repeated failures
+		if err := accountLockedError(c, user.LockedUntil, time.Now()); err != nil {
+			return err
+		}
+
 		// Verify password
 		if !user.VerifyPassword(req.Password) {
-			fmt.Println("Pass error")
-			return fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
+			lockedUntil, err := repo.IncrementFailedLogins(c.Context(), user.ID)
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to record failed login")
+				return errInvalidCredentials
+			}
+			if err := accountLockedError(c, lockedUntil, time.Now()); err != nil {
+				log(c).WithField("user_id", user.ID).Warn("Account locked after repeated failed logins")
+				return err
+			}
+			return errInvalidCredentials
+		}
+
+		if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+			if err := repo.ResetFailedLogins(c.Context(), user.ID); err != nil {
+				log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to reset failed logins")
+			}
 		}
 
+		// Flag logins from a new device or country, or from an IP shared by many accounts
+		event := newLoginEvent(c, user)
+		event.Outcome = models.LoginOutcomeSuccess
+		history, err := loadLoginHistory(c.Context(), loginRepo, event)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to load login history")
+		} else {
+			event.Flags = detectLoginAnomalies(event, history, config.AppConfig.LoginAnomalyIPAccounts)
+		}
+
+		if len(event.Flags) > 0 {
+			log(c).WithFields(logrus.Fields{
+				"user_id": user.ID,
+				"ip":      event.IP,
+				"flags":   event.Flags,
+			}).Warn("Login anomaly detected")
+
+			if config.AppConfig.LoginAnomalyRequireOTP {
+				if req.OTP == "" {
+					event.Outcome = models.LoginOutcomeOTPChallenge
+					recordLoginEvent(c.Context(), loginRepo, event)
+
+					if _, err := GenerateAndSaveOTP(c.Context(), otpRepo, m, user.Email, models.OTPTypeLogin); err != nil {
+						log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to generate login OTP")
+						return fiber.NewError(fiber.StatusInternalServerError, "Failed to send verification code")
+					}
+
+					return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+						"otp_required": true,
+						"message":      "Sign-in from a new device or location. Enter the code sent to your email to continue.",
+					})
+				}
+
+				if err := verifyLoginOTP(c.Context(), otpRepo, user.Email, req.OTP); err != nil {
+					return err
+				}
+			}
+		}
+
+		recordLoginEvent(c.Context(), loginRepo, event)
+
 		// Generate JWT token
 		token, err := generateToken(user)
 		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
+			log(c).WithError(err).WithFields(logrus.Fields{
 				"user_id": user.ID,
 				"email":   user.Email,
 			}).Error("Failed to generate token during login")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
 		}
 
+		refreshToken, err := issueRefreshToken(c.Context(), refreshRepo, user)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to issue refresh token during login")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
+		}
+
+		return c.JSON(fiber.Map{
+			"token":         token,
+			"refresh_token": refreshToken,
+			"user":          user,
+		})
+	}
+}
+
+// HandleRefreshToken exchanges a valid refresh token for a new access token.
+// The refresh token is rotated: the presented token is revoked and a new one is returned.
+// Presenting a revoked token again revokes every refresh token of its user.
+func HandleRefreshToken(userRepo *repository.UserRepository, refreshRepo *repository.RefreshTokenRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		if req.RefreshToken == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Refresh token is required")
+		}
+
+		// Rotate the refresh token, revoking it before anything is issued for it
+		tokenHash := hashRefreshToken(req.RefreshToken)
+		stored, err := refreshRepo.Rotate(c.Context(), tokenHash)
+		if err != nil {
+			log(c).WithError(err).Error("Failed to rotate refresh token")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to refresh token")
+		}
+		if stored == nil {
+			if err := revokeReusedRefreshToken(c, refreshRepo, tokenHash); err != nil {
+				return err
+			}
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired refresh token")
+		}
+		if time.Now().UTC().After(stored.ExpiresAt) {
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired refresh token")
+		}
+
+		user, err := userRepo.GetByID(c.Context(), stored.UserID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", stored.UserID).Error("Failed to get user during token refresh")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to refresh token")
+		}
+		if user == nil || user.Blocked {
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired refresh token")
+		}
+
+		refreshToken, err := issueRefreshToken(c.Context(), refreshRepo, user)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to issue refresh token")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to refresh token")
+		}
+
+		token, err := generateToken(user)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to generate token during refresh")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
+		}
+
 		return c.JSON(fiber.Map{
-			"token": token,
-			"user":  user,
+			"token":         token,
+			"refresh_token": refreshToken,
 		})
 	}
 }
 
+// revokeReusedRefreshToken revokes every refresh token of the owner of a token presented
+// after it was already revoked. Reuse means the token leaked or a refresh raced it, and
+// either way no token of the family can be trusted any more.
+func revokeReusedRefreshToken(c *fiber.Ctx, refreshRepo *repository.RefreshTokenRepository, tokenHash string) error {
+	reused, err := refreshRepo.GetByHash(c.Context(), tokenHash)
+	if err != nil {
+		log(c).WithError(err).Error("Failed to get refresh token")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to refresh token")
+	}
+	if reused == nil {
+		return nil
+	}
+
+	log(c).WithField("user_id", reused.UserID).Warn("Revoked refresh token reused, revoking all refresh tokens of the user")
+	if err := refreshRepo.RevokeAllForUser(c.Context(), reused.UserID); err != nil {
+		log(c).WithError(err).WithField("user_id", reused.UserID).Error("Failed to revoke refresh tokens")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to refresh token")
+	}
+	return nil
+}
+
 // GetUserFromContext extracts user from context
 func GetUserFromContext(c *fiber.Ctx) (*models.User, error) {
 	claims, ok := c.Locals("user").(*middleware.Claims)
 	if !ok {
-		logrus.Error("Failed to get user claims from context")
+		log(c).Error("Failed to get user claims from context")
 		return nil, fiber.NewError(fiber.StatusUnauthorized, "User not found in context")
 	}
 
@@ -217,6 +379,93 @@ func GetUserIDFromContext(c *fiber.Ctx) (string, error) {
 	return user.ID.Hex(), nil
 }
 
+// HandleLogout revokes the access token used for the request and, when given, the
+// refresh token so neither can be used again
+func HandleLogout(revokedRepo *repository.RevokedTokenRepository, refreshRepo *repository.RefreshTokenRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("user").(*middleware.Claims)
+		if !ok {
+			return fiber.NewError(fiber.StatusUnauthorized, "User not found in context")
+		}
+
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return errInvalidBody
+			}
+		}
+
+		if claims.ID != "" && claims.ExpiresAt != nil {
+			err := revokedRepo.Revoke(c.Context(), &models.RevokedToken{
+				JTI:       claims.ID,
+				UserID:    claims.UserID,
+				ExpiresAt: claims.ExpiresAt.Time,
+			})
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", claims.UserID).Error("Failed to revoke access token")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to log out")
+			}
+		}
+
+		if req.RefreshToken != "" {
+			stored, err := refreshRepo.GetByHash(c.Context(), hashRefreshToken(req.RefreshToken))
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", claims.UserID).Error("Failed to get refresh token")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to log out")
+			}
+			if stored != nil && stored.UserID == claims.UserID {
+				if err := refreshRepo.Revoke(c.Context(), stored.ID); err != nil {
+					log(c).WithError(err).WithField("user_id", claims.UserID).Error("Failed to revoke refresh token")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to log out")
+				}
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Logged out",
+		})
+	}
+}
+
+// verifyLoginOTP checks and consumes the sign-in code sent for a challenged login
+func verifyLoginOTP(ctx context.Context, otpRepo *repository.OTPRepository, email, code string) error {
+	otp, err := otpRepo.GetLatestOTP(ctx, email, models.OTPTypeLogin)
+	if err != nil {
+		logrus.WithError(err).WithField("email", email).Error("Failed to get login OTP")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify sign-in code")
+	}
+	if otp == nil || otp.Code != code {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired sign-in code")
+	}
+
+	if err := otpRepo.MarkAsUsed(ctx, otp.ID); err != nil {
+		logrus.WithError(err).WithField("email", email).Error("Failed to mark login OTP as used")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify sign-in code")
+	}
+	return nil
+}
+
+// recordLoginEvent stores a login event. Failures are logged and never block the login.
+func recordLoginEvent(ctx context.Context, repo *repository.LoginEventRepository, event *models.LoginEvent) {
+	if err := repo.Record(ctx, event); err != nil {
+		logrus.WithError(err).WithField("user_id", event.UserID).Error("Failed to record login event")
+	}
+}
+
+// accountLockedError returns a 423 error with a Retry-After header while lockedUntil is in the future
+func accountLockedError(c *fiber.Ctx, lockedUntil *time.Time, now time.Time) error {
+	if lockedUntil == nil || !now.Before(*lockedUntil) {
+		return nil
+	}
+
+	retryAfter := int(math.Ceil(lockedUntil.Sub(now).Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return fiber.NewError(fiber.StatusLocked,
+		fmt.Sprintf("Account is locked after too many failed login attempts, try again in %d seconds", retryAfter))
+}
+
 // generateToken generates a JWT token for the user
 func generateToken(user *models.User) (string, error) {
 	claims := &middleware.Claims{
@@ -224,28 +473,25 @@ func generateToken(user *models.User) (string, error) {
 		Email:  user.Email,
 		Role:   user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AppConfig.JWTExpiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        middleware.NewTokenID(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(config.AppConfig.JWTExpiration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		},
 	}
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Generate encoded token
-	return token.SignedString([]byte(config.AppConfig.JWTSecret))
+	return middleware.SignToken(claims)
 }
 
 // HandleRequestPasswordReset handles password reset request
-func HandleRequestPasswordReset(userRepo *repository.UserRepository, otpRepo *repository.OTPRepository) fiber.Handler {
+func HandleRequestPasswordReset(userRepo *repository.UserRepository, otpRepo *repository.OTPRepository, m mailer.Mailer) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var req struct {
 			Email string `json:"email"`
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			logrus.WithError(err).Error("Failed to parse password reset request body")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			log(c).WithError(err).Error("Failed to parse password reset request body")
+			return errInvalidBody
 		}
 
 		// Validate email
@@ -256,22 +502,16 @@ func HandleRequestPasswordReset(userRepo *repository.UserRepository, otpRepo *re
 		// Check if user exists
 		user, err := userRepo.GetByEmail(c.Context(), req.Email)
 		if err != nil {
-			logrus.WithError(err).WithField("email", req.Email).Error("Failed to get user during password reset request")
+			log(c).WithError(err).WithField("email", req.Email).Error("Failed to get user during password reset request")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to process password reset request")
 		}
 
 		// If user exists, generate and save OTP
 		if user != nil {
-			otp, err := GenerateAndSaveOTP(c.Context(), otpRepo, req.Email, "reset")
-			if err != nil {
-				logrus.WithError(err).WithField("email", req.Email).Error("Failed to generate OTP for password reset")
+			if _, err := GenerateAndSaveOTP(c.Context(), otpRepo, m, req.Email, models.OTPTypeReset); err != nil {
+				log(c).WithError(err).WithField("email", req.Email).Error("Failed to generate OTP for password reset")
 				return fiber.NewError(fiber.StatusInternalServerError, "Failed to process password reset request")
 			}
-
-			logrus.WithFields(logrus.Fields{
-				"email": req.Email,
-				"otp":   otp.Code,
-			}).Info("Generated password reset OTP")
 		}
 
 		// Always return success to prevent email enumeration
@@ -291,8 +531,8 @@ func HandleResetPassword(userRepo *repository.UserRepository, otpRepo *repositor
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			logrus.WithError(err).Error("Failed to parse password reset body")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			log(c).WithError(err).Error("Failed to parse password reset body")
+			return errInvalidBody
 		}
 
 		// Validate email
@@ -306,9 +546,9 @@ func HandleResetPassword(userRepo *repository.UserRepository, otpRepo *repositor
 		}
 
 		// Get latest OTP
-		otp, err := otpRepo.GetLatestOTP(c.Context(), req.Email, "reset")
+		otp, err := otpRepo.GetLatestOTP(c.Context(), req.Email, models.OTPTypeReset)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to get OTP")
+			log(c).WithError(err).Error("Failed to get OTP")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify reset code")
 		}
 
@@ -323,31 +563,31 @@ func HandleResetPassword(userRepo *repository.UserRepository, otpRepo *repositor
 
 		// Mark OTP as used
 		if err := otpRepo.MarkAsUsed(c.Context(), otp.ID); err != nil {
-			logrus.WithError(err).Error("Failed to mark OTP as used")
+			log(c).WithError(err).Error("Failed to mark OTP as used")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify reset code")
 		}
 
 		// Get user
 		user, err := userRepo.GetByEmail(c.Context(), req.Email)
 		if err != nil {
-			logrus.WithError(err).WithField("email", req.Email).Error("Failed to get user during password reset")
+			log(c).WithError(err).WithField("email", req.Email).Error("Failed to get user during password reset")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to reset password")
 		}
 		if user == nil {
-			return fiber.NewError(fiber.StatusNotFound, "User not found")
+			return errUserNotFound
 		}
 
 		// Hash new password
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to hash new password")
+			log(c).WithError(err).Error("Failed to hash new password")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to reset password")
 		}
 
 		// Update user's password
 		user.PasswordHash = string(hashedPassword)
 		if err := userRepo.Update(c.Context(), user); err != nil {
-			logrus.WithError(err).WithField("email", req.Email).Error("Failed to update user password")
+			log(c).WithError(err).WithField("email", req.Email).Error("Failed to update user password")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to reset password")
 		}
 
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cource-api/internal/config"
+	"cource-api/internal/database"
+	"cource-api/internal/mailer"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// postRefresh presents a refresh token and returns the status and decoded body
+func postRefresh(t *testing.T, app *fiber.App, refreshToken string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader(`{"refresh_token":"`+refreshToken+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestHandleRefreshTokenRotatesAndRevokesOnReuse(t *testing.T) {
+	connectTestDatabase(t)
+	original := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = original })
+	config.AppConfig.JWTSecret = "test-secret"
+	config.AppConfig.JWTExpiration = time.Hour
+	config.AppConfig.JWTRefreshExpiration = time.Hour
+
+	ctx := context.Background()
+	userRepo := repository.NewUserRepository()
+	refreshRepo := repository.NewRefreshTokenRepository()
+
+	user := &models.User{ID: primitive.NewObjectID(), Email: "jane@example.com", Role: "user"}
+	if _, err := database.Users.InsertOne(ctx, user); err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	first, err := issueRefreshToken(ctx, refreshRepo, user)
+	if err != nil {
+		t.Fatalf("failed to issue refresh token: %v", err)
+	}
+
+	app := fiber.New()
+	app.Post("/auth/refresh", HandleRefreshToken(userRepo, refreshRepo))
+
+	status, body := postRefresh(t, app, first)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected 200 for a valid refresh token, got %d: %v", status, body)
+	}
+	second, _ := body["refresh_token"].(string)
+	if body["token"] == "" || second == "" || second == first {
+		t.Fatalf("expected a new access token and a rotated refresh token, got %v", body)
+	}
+
+	if status, _ := postRefresh(t, app, "unknown"); status != fiber.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unknown refresh token, got %d", status)
+	}
+
+	// Reusing a rotated token means it leaked, so the whole family is revoked
+	if status, _ := postRefresh(t, app, first); status != fiber.StatusUnauthorized {
+		t.Fatalf("expected 401 when reusing a rotated refresh token, got %d", status)
+	}
+	if status, _ := postRefresh(t, app, second); status != fiber.StatusUnauthorized {
+		t.Fatalf("expected the rotated refresh token to be revoked after reuse, got %d", status)
+	}
+}
+
+func TestHandleRegisterLimitsCodesForUnverifiedEmail(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	otpRepo := repository.NewOTPRepository()
+
+	app := fiber.New()
+	app.Post("/auth/register", HandleRegister(repository.NewUserRepository(), otpRepo, mailer.NoopMailer{}))
+
+	register := func() *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/auth/register", strings.NewReader(`{"name":"Jane","email":"jane@example.com","password":"Secret123!"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	if resp := register(); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected 200 for the registration, got %d", resp.StatusCode)
+	}
+
+	// Registering the unverified email again right away is within the resend cooldown
+	resp := register()
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("expected 429 for the repeated registration, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+
+	sent, err := otpRepo.CountRecent(ctx, "jane@example.com", "registration", time.Now().UTC().Add(-time.Hour))
+	if err != nil || sent != 1 {
+		t.Fatalf("expected one code sent, got %d (%v)", sent, err)
+	}
+}
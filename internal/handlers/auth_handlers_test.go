@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAccountLockedError(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	locked := now.Add(90 * time.Second)
+	expired := now.Add(-time.Second)
+
+	app := fiber.New()
+	app.Get("/:state", func(c *fiber.Ctx) error {
+		lockedUntil := map[string]*time.Time{"locked": &locked, "expired": &expired, "none": nil}[c.Params("state")]
+		if err := accountLockedError(c, lockedUntil, now); err != nil {
+			return err
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	for state, want := range map[string]int{"locked": fiber.StatusLocked, "expired": fiber.StatusOK, "none": fiber.StatusOK} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/"+state, nil))
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", state, err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d", state, want, resp.StatusCode)
+		}
+		if state == "locked" && resp.Header.Get(fiber.HeaderRetryAfter) != "90" {
+			t.Errorf("expected Retry-After of 90 seconds, got %q", resp.Header.Get(fiber.HeaderRetryAfter))
+		}
+	}
+}
@@ -3,10 +3,15 @@ package handlers
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"math/big"
 	"time"
 
+	"cource-api/internal/config"
+	"cource-api/internal/mailer"
 	"cource-api/internal/models"
 	"cource-api/internal/repository"
 
@@ -18,8 +23,11 @@ var (
 	ErrPasswordTooShort = errors.New("password must be at least 8 characters long")
 )
 
-// GenerateAndSaveOTP generates a new OTP and saves it to the database
-func GenerateAndSaveOTP(ctx context.Context, otpRepo *repository.OTPRepository, email string, otpType string) (*models.OTP, error) {
+const otpValidity = 15 * time.Minute
+
+// GenerateAndSaveOTP generates a new OTP, saves it to the database and emails it.
+// A failed email is logged but does not fail the request, the user can ask for a resend.
+func GenerateAndSaveOTP(ctx context.Context, otpRepo *repository.OTPRepository, m mailer.Mailer, email string, otpType string) (*models.OTP, error) {
 	// Generate OTP
 	otpCode, err := generateOTP(6)
 	if err != nil {
@@ -28,29 +36,43 @@ func GenerateAndSaveOTP(ctx context.Context, otpRepo *repository.OTPRepository,
 	}
 
 	// Create OTP record
-	otp := &models.OTP{
-		Email:     email,
-		Code:      otpCode,
-		Type:      otpType,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(15 * time.Minute), // OTP expires in 15 minutes
-		Used:      false,
-	}
+	otp := newOTP(email, otpType, otpCode, time.Now())
 
 	if err := otpRepo.Create(ctx, otp); err != nil {
 		logrus.WithError(err).Error("Failed to save OTP")
 		return nil, err
 	}
 
-	// TODO: Send OTP via email
+	subject, body := mailer.OTPMessage(otpType, otpCode, int(otpValidity/time.Minute))
+	if err := m.Send(ctx, email, subject, body); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"email": email,
+			"type":  otpType,
+		}).Error("Failed to send OTP email")
+		return otp, nil
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"email": email,
-		"otp":   otpCode,
-	}).Info("OTP generated and saved")
+		"type":  otpType,
+	}).Info("OTP generated and sent")
 
 	return otp, nil
 }
 
+// newOTP builds an unused OTP record issued at now. Times are stored in UTC.
+func newOTP(email, otpType, code string, now time.Time) *models.OTP {
+	now = now.UTC()
+	return &models.OTP{
+		Email:     email,
+		Code:      code,
+		Type:      otpType,
+		CreatedAt: now,
+		ExpiresAt: now.Add(otpValidity),
+		Used:      false,
+	}
+}
+
 func generateOTP(length int) (string, error) {
 	const digits = "0123456789"
 	otp := make([]byte, length)
@@ -63,3 +85,29 @@ func generateOTP(length int) (string, error) {
 	}
 	return string(otp), nil
 }
+
+// hashRefreshToken returns the hex encoded SHA-256 hash under which a refresh token is stored
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueRefreshToken generates a new random refresh token for the user and stores its hash
+func issueRefreshToken(ctx context.Context, refreshRepo *repository.RefreshTokenRepository, user *models.User) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	record := &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: time.Now().UTC().Add(config.AppConfig.JWTRefreshExpiration),
+	}
+	if err := refreshRepo.Create(ctx, record); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
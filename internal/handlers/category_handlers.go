@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCategoryNameLength caps the length of a category name
+const maxCategoryNameLength = 64
+
+// categoryRequest is the body of the category create and update endpoints
+type categoryRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// UpdatedAt is the version the client edited, optional and only checked on update
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// applyCategoryRequest validates the request and copies it onto the category
+func applyCategoryRequest(category *models.Category, req categoryRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+	if len(name) > maxCategoryNameLength {
+		return fiber.NewError(fiber.StatusBadRequest, "Name must be at most 64 characters")
+	}
+	category.Name = name
+	category.Description = strings.TrimSpace(req.Description)
+	return nil
+}
+
+// resolveCourseCategory converts the category ID given for a course, rejecting IDs of
+// categories that do not exist. An empty value leaves the course without a category.
+func resolveCourseCategory(c *fiber.Ctx, repo *repository.CategoryRepository, value string) (*primitive.ObjectID, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	categoryID, err := toObjectID(value, "category_id")
+	if err != nil {
+		return nil, err
+	}
+
+	category, err := repo.GetByID(c.Context(), categoryID)
+	if err != nil {
+		log(c).WithError(err).WithField("category_id", categoryID).Error("Failed to get category")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to get category")
+	}
+	if category == nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Category not found")
+	}
+	return &categoryID, nil
+}
+
+// HandleListCategories lists every category
+func HandleListCategories(repo *repository.CategoryRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		categories, err := repo.List(c.Context())
+		if err != nil {
+			log(c).WithError(err).Error("Failed to list categories")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list categories")
+		}
+
+		return c.JSON(fiber.Map{
+			"categories": categories,
+		})
+	}
+}
+
+// HandleListCategoryCourses lists the public courses of a category with pagination
+func HandleListCategoryCourses(repo *repository.CategoryRepository, courseRepo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		category, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("category_id", objectID).Error("Failed to get category")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get category")
+		}
+		if category == nil {
+			return fiber.NewError(fiber.StatusNotFound, "Category not found")
+		}
+
+		pagination := parsePagination(c, defaultPageLimit)
+		courses, total, err := courseRepo.List(c.Context(), pagination.Page, pagination.Limit, true, repository.CourseFilter{CategoryID: &objectID})
+		if err != nil {
+			log(c).WithError(err).WithField("category_id", objectID).Error("Failed to list category courses")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses")
+		}
+
+		return c.JSON(Paginate(courses, total, pagination))
+	}
+}
+
+// HandleCreateCategory creates a category (admin only)
+func HandleCreateCategory(repo *repository.CategoryRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req categoryRequest
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		category := &models.Category{}
+		if err := applyCategoryRequest(category, req); err != nil {
+			return err
+		}
+
+		if err := repo.Create(c.Context(), category); err != nil {
+			if errors.Is(err, repository.ErrCategoryNameExists) {
+				return fiber.NewError(fiber.StatusConflict, "Category name already exists")
+			}
+			log(c).WithError(err).WithField("name", category.Name).Error("Failed to create category")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create category")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(category)
+	}
+}
+
+// HandleUpdateCategory updates a category (admin only)
+func HandleUpdateCategory(repo *repository.CategoryRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		category, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("category_id", objectID).Error("Failed to get category")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get category")
+		}
+		if category == nil {
+			return fiber.NewError(fiber.StatusNotFound, "Category not found")
+		}
+
+		var req categoryRequest
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+		if err := checkUnmodified(req.UpdatedAt, category.UpdatedAt); err != nil {
+			return err
+		}
+		if err := applyCategoryRequest(category, req); err != nil {
+			return err
+		}
+
+		if err := repo.Update(c.Context(), category); err != nil {
+			if errors.Is(err, repository.ErrCategoryNameExists) {
+				return fiber.NewError(fiber.StatusConflict, "Category name already exists")
+			}
+			if staleErr := staleUpdateError(err); staleErr != nil {
+				return staleErr
+			}
+			log(c).WithError(err).WithField("category_id", objectID).Error("Failed to update category")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update category")
+		}
+
+		return c.JSON(category)
+	}
+}
+
+// HandleDeleteCategory deletes a category no course is assigned to (admin only)
+func HandleDeleteCategory(repo *repository.CategoryRepository, courseRepo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		// Soft deleted courses count too, so restoring one never leaves a dangling category
+		_, assigned, err := courseRepo.List(c.Context(), 1, 1, false, repository.CourseFilter{CategoryID: &objectID, IncludeDeleted: true})
+		if err != nil {
+			log(c).WithError(err).WithField("category_id", objectID).Error("Failed to count category courses")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete category")
+		}
+		if assigned > 0 {
+			return fiber.NewError(fiber.StatusConflict, "Category is still assigned to courses")
+		}
+
+		if err := repo.Delete(c.Context(), objectID); err != nil {
+			log(c).WithError(err).WithField("category_id", objectID).Error("Failed to delete category")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete category")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
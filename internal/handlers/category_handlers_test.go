@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestApplyCategoryRequest(t *testing.T) {
+	category := &models.Category{}
+	if err := applyCategoryRequest(category, categoryRequest{Name: "  Backend  ", Description: " APIs "}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if category.Name != "Backend" || category.Description != "APIs" {
+		t.Fatalf("expected trimmed fields, got %+v", category)
+	}
+
+	for _, name := range []string{"", "   ", strings.Repeat("a", maxCategoryNameLength+1)} {
+		if err := applyCategoryRequest(&models.Category{}, categoryRequest{Name: name}); err == nil {
+			t.Errorf("expected name %q to be rejected", name)
+		}
+	}
+}
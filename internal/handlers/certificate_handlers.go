@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+
+	"cource-api/internal/certificate"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// courseCompleted reports whether every video of a course is completed. A course without
+// videos cannot be completed.
+func courseCompleted(progress *models.CourseProgress) bool {
+	return progress.TotalVideos > 0 && progress.CompletedVideos == progress.TotalVideos
+}
+
+// HandleGetCourseCertificate downloads the current user's completion certificate of a
+// course as a PDF. The certificate is issued on the first download once every video is
+// completed, later downloads return the same certificate.
+func HandleGetCourseCertificate(
+	repo *repository.CourseRepository,
+	certificateRepo *repository.CertificateRepository,
+	userRepo *repository.UserRepository,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+		fields := logrus.Fields{
+			"user_id":   user.ID,
+			"course_id": objectID,
+		}
+
+		course, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
+		}
+		if course == nil {
+			return errCourseNotFound
+		}
+
+		issued, err := certificateRepo.GetByUserAndCourse(c.Context(), user.ID, objectID)
+		if err != nil {
+			log(c).WithError(err).WithFields(fields).Error("Failed to get certificate")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get certificate")
+		}
+
+		if issued == nil {
+			progress, err := repo.GetCourseProgress(c.Context(), user.ID, objectID)
+			if err != nil {
+				log(c).WithError(err).WithFields(fields).Error("Failed to get course progress")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course progress")
+			}
+			if !courseCompleted(progress) {
+				return fiber.NewError(fiber.StatusForbidden, "Complete every video of the course to get a certificate")
+			}
+
+			owner, err := userRepo.GetByID(c.Context(), user.ID)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to get user")
+			}
+			if owner == nil {
+				return errUserNotFound
+			}
+
+			issued, err = certificateRepo.Issue(c.Context(), &models.Certificate{
+				UserID:        user.ID,
+				CourseID:      objectID,
+				RecipientName: owner.Name,
+				CourseTitle:   course.Title,
+			})
+			if err != nil {
+				log(c).WithError(err).WithFields(fields).Error("Failed to issue certificate")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to issue certificate")
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := certificate.New(issued).WritePDF(&buf); err != nil {
+			log(c).WithError(err).WithFields(fields).Error("Failed to render certificate")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to render certificate")
+		}
+
+		c.Attachment(fmt.Sprintf("certificate-%s.pdf", issued.ID.Hex()))
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		return c.Send(buf.Bytes())
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestCourseCompleted(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress models.CourseProgress
+		want     bool
+	}{
+		{"every video completed", models.CourseProgress{CompletedVideos: 3, TotalVideos: 3}, true},
+		{"a video left", models.CourseProgress{CompletedVideos: 2, TotalVideos: 3}, false},
+		{"no videos", models.CourseProgress{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := courseCompleted(&tt.progress); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"cource-api/internal/repository"
+)
+
+// checkUnmodified rejects an update made against an older version than the stored one.
+// expected is the updated_at the client read, clients that do not send it skip the check.
+func checkUnmodified(expected *time.Time, current time.Time) error {
+	if expected != nil && !expected.Truncate(time.Millisecond).Equal(current) {
+		return errStaleUpdate
+	}
+	return nil
+}
+
+// staleUpdateError maps ErrStaleUpdate to a 409, returning nil for any other error
+func staleUpdateError(err error) error {
+	if errors.Is(err, repository.ErrStaleUpdate) {
+		return errStaleUpdate
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckUnmodified(t *testing.T) {
+	current := time.Date(2025, 3, 1, 12, 0, 0, 123000000, time.UTC)
+	sameWithNanos := current.Add(456)
+	older := current.Add(-time.Second)
+
+	if err := checkUnmodified(nil, current); err != nil {
+		t.Fatalf("expected no check without a version, got %v", err)
+	}
+	if err := checkUnmodified(&sameWithNanos, current); err != nil {
+		t.Fatalf("expected the same millisecond to match, got %v", err)
+	}
+
+	if err := checkUnmodified(&older, current); err != errStaleUpdate {
+		t.Fatalf("expected a stale update error for an older version, got %v", err)
+	}
+
+	if staleUpdateError(repository.ErrCourseNotFound) != nil {
+		t.Fatal("expected other errors to pass through")
+	}
+	var fe *fiber.Error
+	if err := staleUpdateError(repository.ErrStaleUpdate); !errors.As(err, &fe) || fe.Code != fiber.StatusConflict {
+		t.Fatalf("expected ErrStaleUpdate to map to 409, got %v", err)
+	}
+}
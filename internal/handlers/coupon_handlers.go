@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/coupon"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// couponCodePattern matches a coupon code after normalization
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// couponRequest is the body of the coupon create and update endpoints
+type couponRequest struct {
+	Code           string     `json:"code"`
+	PercentOff     float64    `json:"percent_off"`
+	AmountOff      int64      `json:"amount_off"`
+	Currency       string     `json:"currency"`
+	MaxRedemptions int        `json:"max_redemptions"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+// normalizeCouponCode makes coupon codes case insensitive
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// validateCouponDefinition checks a coupon takes off either a percentage or a fixed
+// amount in a currency, never both
+func validateCouponDefinition(c *models.Coupon) error {
+	if !couponCodePattern.MatchString(c.Code) {
+		return errors.New("code must be 3 to 32 letters, digits, dashes or underscores")
+	}
+
+	switch {
+	case c.PercentOff != 0 && c.AmountOff != 0:
+		return errors.New("set either percent_off or amount_off, not both")
+	case c.PercentOff != 0:
+		if c.PercentOff < 0 || c.PercentOff > 100 {
+			return errors.New("percent_off must be between 0 and 100")
+		}
+		if c.Currency != "" {
+			return errors.New("currency only applies to amount_off")
+		}
+	case c.AmountOff != 0:
+		if c.AmountOff < 0 {
+			return errors.New("amount_off must be greater than 0")
+		}
+		if len(c.Currency) != 3 {
+			return errors.New("currency is required with amount_off")
+		}
+	default:
+		return errors.New("percent_off or amount_off is required")
+	}
+
+	if c.MaxRedemptions < 0 {
+		return errors.New("max_redemptions cannot be negative")
+	}
+	return nil
+}
+
+// checkCouponRedeemable returns the error to reject a checkout with when the coupon
+// cannot be applied to a charge in currency at now
+func checkCouponRedeemable(c *models.Coupon, currency string, now time.Time) error {
+	if c == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid coupon code")
+	}
+	if c.Expired(now) {
+		return fiber.NewError(fiber.StatusBadRequest, "Coupon has expired")
+	}
+	if !c.RedemptionsRemaining() {
+		return fiber.NewError(fiber.StatusBadRequest, "Coupon has been fully redeemed")
+	}
+	if c.AmountOff != 0 && !strings.EqualFold(c.Currency, currency) {
+		return fiber.NewError(fiber.StatusBadRequest, "Coupon does not apply to this currency")
+	}
+	return nil
+}
+
+// ensureStripeCoupon returns the Stripe coupon matching c, creating it on first use.
+// Redemption limits and expiry are enforced here, so the Stripe coupon carries only
+// the discount. stripe.Key must be set by the caller.
+func ensureStripeCoupon(ctx context.Context, repo *repository.CouponRepository, c *models.Coupon) (string, error) {
+	if c.StripeCouponID != "" {
+		return c.StripeCouponID, nil
+	}
+
+	params := &stripe.CouponParams{
+		Name:     stripe.String(c.Code),
+		Duration: stripe.String(string(stripe.CouponDurationOnce)),
+	}
+	if c.PercentOff != 0 {
+		params.PercentOff = stripe.Float64(c.PercentOff)
+	} else {
+		params.AmountOff = stripe.Int64(c.AmountOff)
+		params.Currency = stripe.String(strings.ToLower(c.Currency))
+	}
+
+	created, err := coupon.New(params)
+	if err != nil {
+		return "", err
+	}
+
+	if err := repo.SetStripeCouponID(ctx, c.ID, created.ID); err != nil {
+		return "", err
+	}
+	c.StripeCouponID = created.ID
+	return created.ID, nil
+}
+
+// redeemCoupon counts one redemption of the coupon with the given hex ID
+func redeemCoupon(ctx context.Context, repo *repository.CouponRepository, couponIDHex string) error {
+	couponID, err := primitive.ObjectIDFromHex(couponIDHex)
+	if err != nil {
+		return err
+	}
+	return repo.IncrementRedemptions(ctx, couponID)
+}
+
+// applyCouponRequest copies the request onto the coupon
+func applyCouponRequest(c *models.Coupon, req couponRequest) {
+	c.Code = normalizeCouponCode(req.Code)
+	c.PercentOff = req.PercentOff
+	c.AmountOff = req.AmountOff
+	c.Currency = strings.ToLower(strings.TrimSpace(req.Currency))
+	c.MaxRedemptions = req.MaxRedemptions
+	c.ExpiresAt = req.ExpiresAt
+}
+
+// HandleListCoupons lists coupons with pagination (admin only)
+func HandleListCoupons(repo *repository.CouponRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pagination := parsePagination(c, defaultPageLimit)
+
+		coupons, total, err := repo.List(c.Context(), pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).Error("Failed to list coupons")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list coupons")
+		}
+
+		return c.JSON(fiber.Map{
+			"coupons": coupons,
+			"total":   total,
+			"page":    pagination.Page,
+			"limit":   pagination.Limit,
+		})
+	}
+}
+
+// HandleCreateCoupon creates a coupon (admin only)
+func HandleCreateCoupon(repo *repository.CouponRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req couponRequest
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		coupon := &models.Coupon{}
+		applyCouponRequest(coupon, req)
+		if err := validateCouponDefinition(coupon); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		if err := repo.Create(c.Context(), coupon); err != nil {
+			if errors.Is(err, repository.ErrCouponCodeExists) {
+				return fiber.NewError(fiber.StatusConflict, "Coupon code already exists")
+			}
+			log(c).WithError(err).WithField("code", coupon.Code).Error("Failed to create coupon")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create coupon")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(coupon)
+	}
+}
+
+// HandleGetCoupon gets a coupon by ID (admin only)
+func HandleGetCoupon(repo *repository.CouponRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		coupon, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("coupon_id", objectID).Error("Failed to get coupon")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get coupon")
+		}
+		if coupon == nil {
+			return errCouponNotFound
+		}
+
+		return c.JSON(coupon)
+	}
+}
+
+// HandleUpdateCoupon updates a coupon (admin only). Changing the discount creates a new
+// Stripe coupon on next use since Stripe coupons cannot change their discount.
+func HandleUpdateCoupon(repo *repository.CouponRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		coupon, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("coupon_id", objectID).Error("Failed to get coupon")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get coupon")
+		}
+		if coupon == nil {
+			return errCouponNotFound
+		}
+
+		var req couponRequest
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		previous := *coupon
+		applyCouponRequest(coupon, req)
+		if err := validateCouponDefinition(coupon); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if coupon.PercentOff != previous.PercentOff || coupon.AmountOff != previous.AmountOff || coupon.Currency != previous.Currency {
+			coupon.StripeCouponID = ""
+		}
+
+		if err := repo.Update(c.Context(), coupon); err != nil {
+			if errors.Is(err, repository.ErrCouponCodeExists) {
+				return fiber.NewError(fiber.StatusConflict, "Coupon code already exists")
+			}
+			log(c).WithError(err).WithField("coupon_id", objectID).Error("Failed to update coupon")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update coupon")
+		}
+
+		return c.JSON(coupon)
+	}
+}
+
+// HandleDeleteCoupon deletes a coupon (admin only)
+func HandleDeleteCoupon(repo *repository.CouponRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		if err := repo.Delete(c.Context(), objectID); err != nil {
+			log(c).WithError(err).WithField("coupon_id", objectID).Error("Failed to delete coupon")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete coupon")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v76"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateCouponDefinition(t *testing.T) {
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		valid  bool
+	}{
+		{"percent off", models.Coupon{Code: "SPRING25", PercentOff: 25}, true},
+		{"amount off", models.Coupon{Code: "TENOFF", AmountOff: 1000, Currency: "usd"}, true},
+		{"both discounts", models.Coupon{Code: "BOTH", PercentOff: 10, AmountOff: 100, Currency: "usd"}, false},
+		{"no discount", models.Coupon{Code: "NONE"}, false},
+		{"percent over 100", models.Coupon{Code: "TOOMUCH", PercentOff: 150}, false},
+		{"amount without currency", models.Coupon{Code: "NOCUR", AmountOff: 500}, false},
+		{"percent with currency", models.Coupon{Code: "MIXED", PercentOff: 10, Currency: "usd"}, false},
+		{"bad code", models.Coupon{Code: "no spaces", PercentOff: 10}, false},
+		{"negative redemptions", models.Coupon{Code: "NEG", PercentOff: 10, MaxRedemptions: -1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCouponDefinition(&tt.coupon)
+			if (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestCheckCouponRedeemable(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		coupon   *models.Coupon
+		currency string
+		ok       bool
+	}{
+		{"unknown code", nil, "usd", false},
+		{"valid", &models.Coupon{PercentOff: 10, ExpiresAt: &future}, "usd", true},
+		{"expired", &models.Coupon{PercentOff: 10, ExpiresAt: &past}, "usd", false},
+		{"fully redeemed", &models.Coupon{PercentOff: 10, MaxRedemptions: 2, TimesRedeemed: 2}, "usd", false},
+		{"unlimited", &models.Coupon{PercentOff: 10, TimesRedeemed: 500}, "usd", true},
+		{"matching currency", &models.Coupon{AmountOff: 500, Currency: "usd"}, "USD", true},
+		{"other currency", &models.Coupon{AmountOff: 500, Currency: "usd"}, "eur", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCouponRedeemable(tt.coupon, tt.currency, now)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("expected coupon to be redeemable, got %v", err)
+				}
+				return
+			}
+			var fiberErr *fiber.Error
+			if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusBadRequest {
+				t.Fatalf("expected bad request, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPaymentFromCheckoutSessionRecordsCoupon(t *testing.T) {
+	session := &stripe.CheckoutSession{
+		ID:          "cs_123",
+		AmountTotal: 750,
+		Currency:    "usd",
+		Metadata: map[string]string{
+			"user_id":     primitive.NewObjectID().Hex(),
+			"coupon_id":   primitive.NewObjectID().Hex(),
+			"coupon_code": "SPRING25",
+		},
+	}
+
+	payment, err := paymentFromCheckoutSession(session)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payment.CouponCode != "SPRING25" {
+		t.Fatalf("expected coupon code on payment, got %q", payment.CouponCode)
+	}
+}
@@ -1,47 +1,106 @@
 package handlers
 
 import (
+	"context"
 	"cource-api/internal/aws"
+	"cource-api/internal/config"
+	"cource-api/internal/jobs"
 	"cource-api/internal/models"
 	"cource-api/internal/repository"
+	"errors"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// HandleListCourses lists all courses with pagination
-func HandleListCourses(repo *repository.CourseRepository) fiber.Handler {
+// parseCourseFilter reads the search, skills, is_paid and category query parameters
+func parseCourseFilter(c *fiber.Ctx) (repository.CourseFilter, error) {
+	filter := repository.CourseFilter{
+		Search: strings.TrimSpace(c.Query("search")),
+	}
+
+	for _, skill := range strings.Split(c.Query("skills"), ",") {
+		if skill = strings.TrimSpace(skill); skill != "" {
+			filter.Skills = append(filter.Skills, skill)
+		}
+	}
+
+	if isPaid := c.Query("is_paid"); isPaid != "" {
+		paid, err := strconv.ParseBool(isPaid)
+		if err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, "Invalid is_paid value")
+		}
+		filter.IsPaid = &paid
+	}
+
+	if category := c.Query("category"); category != "" {
+		categoryID, err := toObjectID(category, "category")
+		if err != nil {
+			return filter, err
+		}
+		filter.CategoryID = &categoryID
+	}
+
+	return filter, nil
+}
+
+// applyViewCounts fills the view count of the courses from their videos. Like ratings,
+// a failure is only logged.
+func applyViewCounts(ctx context.Context, videoRepo *repository.VideoRepository, courses ...*models.Course) {
+	ids := make([]primitive.ObjectID, len(courses))
+	for i, course := range courses {
+		ids[i] = course.ID
+	}
+
+	counts, err := videoRepo.GetViewCountsByCourse(ctx, ids)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get course view counts")
+		return
+	}
+	for _, course := range courses {
+		course.ViewCount = counts[course.ID]
+	}
+}
+
+// HandleListCourses lists all courses with pagination, search and filtering
+func HandleListCourses(
+	repo *repository.CourseRepository,
+	reviewRepo *repository.ReviewRepository,
+	videoRepo *repository.VideoRepository,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get pagination parameters
-		page, _ := strconv.ParseInt(c.Query("page", "1"), 10, 64)
-		limit, _ := strconv.ParseInt(c.Query("limit", "10"), 10, 64)
+		pagination := parsePagination(c, defaultPageLimit)
+
+		filter, err := parseCourseFilter(c)
+		if err != nil {
+			return err
+		}
 
 		// Get courses
-		courses, total, err := repo.List(c.Context(), page, limit, true)
+		courses, total, err := repo.List(c.Context(), pagination.Page, pagination.Limit, true, filter)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses")
 		}
+		applyRatings(c.Context(), reviewRepo, courses...)
+		applyViewCounts(c.Context(), videoRepo, courses...)
 
-		return c.JSON(fiber.Map{
-			"courses": courses,
-			"total":   total,
-			"page":    page,
-			"limit":   limit,
-		})
+		return c.JSON(Paginate(courses, total, pagination))
 	}
 }
 
-// HandleListCourses lists all courses with pagination
+// HandleAdminListCourses lists all courses with pagination, including soft deleted
+// courses when include_deleted is set
 func HandleAdminListCourses(repo *repository.CourseRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get pagination parameters
-		page, _ := strconv.ParseInt(c.Query("page", "1"), 10, 64)
-		limit, _ := strconv.ParseInt(c.Query("limit", "10"), 10, 64)
+		pagination := parsePagination(c, defaultPageLimit)
+		includeDeleted, _ := strconv.ParseBool(c.Query("include_deleted"))
 
 		// Get courses
-		courses, total, err := repo.List(c.Context(), page, limit, false)
+		courses, total, err := repo.List(c.Context(), pagination.Page, pagination.Limit, false, repository.CourseFilter{IncludeDeleted: includeDeleted})
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses")
 		}
@@ -49,14 +108,18 @@ func HandleAdminListCourses(repo *repository.CourseRepository) fiber.Handler {
 		return c.JSON(fiber.Map{
 			"courses": courses,
 			"total":   total,
-			"page":    page,
-			"limit":   limit,
+			"page":    pagination.Page,
+			"limit":   pagination.Limit,
 		})
 	}
 }
 
 // HandleCreateCourse creates a new course
-func HandleCreateCourse(repo *repository.CourseRepository) fiber.Handler {
+func HandleCreateCourse(
+	repo *repository.CourseRepository,
+	categoryRepo *repository.CategoryRepository,
+	announcer *jobs.CourseAnnouncer,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get current user
 		user, err := GetUserFromContext(c)
@@ -66,57 +129,77 @@ func HandleCreateCourse(repo *repository.CourseRepository) fiber.Handler {
 
 		// Parse request body
 		var req struct {
-			Title        string   `json:"title"`
-			SubTitle     string   `json:"subtitle"`
-			Description  string   `json:"description"`
-			IsPaid       bool     `json:"is_paid"`
-			Skills       []string `json:"skills"`
-			Author       string   `json:"author"`
-			ThumbnailURL string   `json:"thumbnail_url"`
-			IsPublic     bool     `json:"is_public"`
+			Title         string   `json:"title"`
+			SubTitle      string   `json:"subtitle"`
+			Description   string   `json:"description"`
+			IsPaid        bool     `json:"is_paid"`
+			Skills        []string `json:"skills"`
+			CategoryID    string   `json:"category_id"`
+			Author        string   `json:"author"`
+			ThumbnailURL  string   `json:"thumbnail_url"`
+			IsPublic      bool     `json:"is_public"`
+			IsPurchasable bool     `json:"is_purchasable"`
+			Price         int      `json:"price"`
+			Currency      string   `json:"currency"`
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
+		}
+
+		categoryID, err := resolveCourseCategory(c, categoryRepo, req.CategoryID)
+		if err != nil {
+			return err
 		}
 
 		//NOTE: handle thumbnail upload logic and add the thumbnail url to the course document
 
 		// Create course
 		course := &models.Course{
-			Title:        req.Title,
-			SubTitle:     req.SubTitle,
-			Description:  req.Description,
-			IsPaid:       req.IsPaid,
-			IsPublic:     req.IsPublic,
-			Skills:       req.Skills,
-			Author:       req.Author,
-			ThumbnailURL: req.ThumbnailURL,
-			CreatedBy:    user.ID,
-			VideoOrder:   []primitive.ObjectID{},
+			Title:         req.Title,
+			SubTitle:      req.SubTitle,
+			Description:   req.Description,
+			IsPaid:        req.IsPaid,
+			IsPublic:      req.IsPublic,
+			Skills:        req.Skills,
+			CategoryID:    categoryID,
+			Author:        req.Author,
+			ThumbnailURL:  req.ThumbnailURL,
+			IsPurchasable: req.IsPurchasable,
+			Price:         req.Price,
+			Currency:      req.Currency,
+			CreatedBy:     user.ID,
+			VideoOrder:    []primitive.ObjectID{},
+		}
+
+		if err := validateCoursePricing(course); err != nil {
+			return err
 		}
 
 		if err := repo.Create(c.Context(), course); err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create course")
 		}
 
+		// Subscribers are told about a course created already public in the background
+		if course.IsPublic {
+			announcer.Enqueue(course)
+		}
+
 		return c.JSON(course)
 	}
 }
 
 // HandleGetCourse gets a course by ID
-func HandleGetCourse(repo *repository.CourseRepository) fiber.Handler {
+func HandleGetCourse(
+	repo *repository.CourseRepository,
+	reviewRepo *repository.ReviewRepository,
+	videoRepo *repository.VideoRepository,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get course ID from params
-		courseID := c.Params("id")
-		if courseID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Course ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(courseID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid course ID format")
+			return err
 		}
 
 		// Get course
@@ -125,8 +208,10 @@ func HandleGetCourse(repo *repository.CourseRepository) fiber.Handler {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
 		}
 		if course == nil {
-			return fiber.NewError(fiber.StatusNotFound, "Course not found")
+			return errCourseNotFound
 		}
+		applyRatings(c.Context(), reviewRepo, course)
+		applyViewCounts(c.Context(), videoRepo, course)
 
 		// Get videos in order
 		videos, err := repo.GetVideosInOrder(c.Context(), objectID)
@@ -134,6 +219,13 @@ func HandleGetCourse(repo *repository.CourseRepository) fiber.Handler {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course videos")
 		}
 
+		for _, video := range videos {
+			if err := signThumbnailWithS3(video); err != nil {
+				log(c).WithError(err).WithField("video_id", video.ID).Error("Failed to generate pre-signed thumbnail URL")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate thumbnail URL")
+			}
+		}
+
 		// Add videos to response
 		response := fiber.Map{
 			"course": course,
@@ -144,19 +236,113 @@ func HandleGetCourse(repo *repository.CourseRepository) fiber.Handler {
 	}
 }
 
-// HandleUpdateCourse updates a course
-func HandleUpdateCourse(repo *repository.CourseRepository) fiber.Handler {
+// HandleUpdateCourse updates a course. Like HandlePatchCourse only the fields present
+// in the body are changed, so a client can never wipe a field it did not send.
+func HandleUpdateCourse(
+	repo *repository.CourseRepository,
+	categoryRepo *repository.CategoryRepository,
+	announcer *jobs.CourseAnnouncer,
+) fiber.Handler {
+	return HandlePatchCourse(repo, categoryRepo, announcer)
+}
+
+// coursePatch holds the fields of a partial course update. A nil field was
+// omitted from the request body and leaves the stored value untouched, while a
+// non-nil field (even an empty one) replaces it.
+type coursePatch struct {
+	Title       *string   `json:"title"`
+	SubTitle    *string   `json:"subtitle"`
+	Description *string   `json:"description"`
+	IsPaid      *bool     `json:"is_paid"`
+	IsPublic    *bool     `json:"is_public"`
+	Skills      *[]string `json:"skills"`
+	// CategoryID is resolved by the handler, an empty value removes the category
+	CategoryID   *string `json:"category_id"`
+	Author       *string `json:"author"`
+	ThumbnailURL *string `json:"thumbnail_url"`
+	// Individual purchase settings
+	IsPurchasable *bool   `json:"is_purchasable"`
+	Price         *int    `json:"price"`
+	Currency      *string `json:"currency"`
+	// UpdatedAt is the version the client edited, it is checked rather than applied
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// apply copies every provided field of the patch onto the course and returns them keyed
+// by their stored names, ready for a partial update. The category is resolved by the
+// handler and left out.
+func (p *coursePatch) apply(course *models.Course) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if p.Title != nil {
+		course.Title = *p.Title
+		fields["title"] = course.Title
+	}
+	if p.SubTitle != nil {
+		course.SubTitle = *p.SubTitle
+		fields["subtitle"] = course.SubTitle
+	}
+	if p.Description != nil {
+		course.Description = *p.Description
+		fields["description"] = course.Description
+	}
+	if p.IsPaid != nil {
+		course.IsPaid = *p.IsPaid
+		fields["is_paid"] = course.IsPaid
+	}
+	if p.IsPublic != nil {
+		course.IsPublic = *p.IsPublic
+		fields["is_public"] = course.IsPublic
+	}
+	if p.Skills != nil {
+		course.Skills = *p.Skills
+		fields["skills"] = course.Skills
+	}
+	if p.Author != nil {
+		course.Author = *p.Author
+		fields["author"] = course.Author
+	}
+	if p.ThumbnailURL != nil {
+		course.ThumbnailURL = *p.ThumbnailURL
+		fields["thumbnail_url"] = course.ThumbnailURL
+	}
+	if p.IsPurchasable != nil {
+		course.IsPurchasable = *p.IsPurchasable
+		fields["is_purchasable"] = course.IsPurchasable
+	}
+	if p.Price != nil {
+		course.Price = *p.Price
+		fields["price"] = course.Price
+	}
+	if p.Currency != nil {
+		course.Currency = *p.Currency
+		fields["currency"] = course.Currency
+	}
+	return fields
+}
+
+// validateCoursePricing ensures a course sold individually has a usable price
+func validateCoursePricing(course *models.Course) error {
+	if course.Price < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Price cannot be negative")
+	}
+	if course.IsPurchasable && (course.Price == 0 || course.Currency == "") {
+		return fiber.NewError(fiber.StatusBadRequest, "Purchasable courses require a price and currency")
+	}
+	return nil
+}
+
+// HandlePatchCourse partially updates a course, changing only the fields present in the
+// body. Active subscribers are notified when the update publishes the course.
+func HandlePatchCourse(
+	repo *repository.CourseRepository,
+	categoryRepo *repository.CategoryRepository,
+	announcer *jobs.CourseAnnouncer,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get course ID from params
-		courseID := c.Params("id")
-		if courseID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Course ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(courseID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid course ID format")
+			return err
 		}
 
 		// Get course
@@ -165,93 +351,205 @@ func HandleUpdateCourse(repo *repository.CourseRepository) fiber.Handler {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
 		}
 		if course == nil {
-			return fiber.NewError(fiber.StatusNotFound, "Course not found")
+			return errCourseNotFound
 		}
 
 		// Parse request body
-		var updateData struct {
-			Title        string   `json:"title"`
-			SubTitle     string   `json:"subtitle"`
-			Description  string   `json:"description"`
-			IsPaid       bool     `json:"is_paid"`
-			IsPublic     bool     `json:"is_public"`
-			Skills       []string `json:"skills"`
-			Author       string   `json:"author"`
-			ThumbnailURL string   `json:"thumbnail_url"`
+		var patch coursePatch
+		if err := c.BodyParser(&patch); err != nil {
+			return errInvalidBody
+		}
+		if err := checkUnmodified(patch.UpdatedAt, course.UpdatedAt); err != nil {
+			return err
 		}
 
-		if err := c.BodyParser(&updateData); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		if patch.Title != nil && *patch.Title == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Title cannot be empty")
+		}
+		if patch.CategoryID != nil {
+			course.CategoryID, err = resolveCourseCategory(c, categoryRepo, *patch.CategoryID)
+			if err != nil {
+				return err
+			}
 		}
 
-		//NOTE: handle the s3 thumbnail update logic and update the url in the course document
+		// Publishing is blocked while videos are still processing
+		if patch.IsPublic != nil && *patch.IsPublic && !course.IsPublic {
+			lock, err := checkCourseEditLock(c, repo, objectID)
+			if err != nil {
+				return err
+			}
+			if lock != nil {
+				return c.Status(fiber.StatusConflict).JSON(lock)
+			}
+		}
 
-		// Update course fields
-		if updateData.Title != "" {
-			course.Title = updateData.Title
+		oldThumbnail := course.ThumbnailURL
+		wasPublic := course.IsPublic
+		fields := patch.apply(course)
+		if patch.CategoryID != nil {
+			fields["category_id"] = course.CategoryID
 		}
-		course.SubTitle = updateData.SubTitle
-		course.Description = updateData.Description
-		if updateData.ThumbnailURL != course.ThumbnailURL {
-			if err := aws.S3C.DeleteFile(course.ThumbnailURL); err != nil {
-				logrus.Error(err)
-			}
-			course.ThumbnailURL = updateData.ThumbnailURL
+		if err := validateCoursePricing(course); err != nil {
+			return err
 		}
-		course.IsPaid = updateData.IsPaid
-		course.Skills = nil
-		course.Skills = updateData.Skills
-		course.Author = updateData.Author
-		course.IsPublic = updateData.IsPublic
 
-		// Update course
-		if err := repo.Update(c.Context(), course); err != nil {
+		// Update only the provided fields, unless another request changed the course
+		// since it was read
+		updated, err := repo.PartialUpdate(c.Context(), objectID, course.UpdatedAt, fields)
+		if err != nil {
+			if staleErr := staleUpdateError(err); staleErr != nil {
+				return staleErr
+			}
+			log(c).WithError(err).WithField("course_id", objectID).Error("Failed to update course")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update course")
 		}
 
-		return c.JSON(course)
+		// Remove the old thumbnail once a new one has replaced it
+		if updated.ThumbnailURL != oldThumbnail && oldThumbnail != "" {
+			if err := aws.S3C.DeleteThumbnail(oldThumbnail); err != nil {
+				log(c).Error(err)
+			}
+		}
+
+		// Only the update that publishes the course is announced, not later edits
+		if updated.IsPublic && !wasPublic {
+			announcer.Enqueue(updated)
+		}
+
+		return c.JSON(updated)
 	}
 }
 
-// HandleDeleteCourse deletes a course
+// HandleDeleteCourse soft deletes a course, its videos are kept for a restore
 func HandleDeleteCourse(repo *repository.CourseRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get course ID from params
-		courseID := c.Params("id")
-		if courseID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Course ID is required")
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
 		}
 
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(courseID)
+		if err := repo.Delete(c.Context(), objectID); err != nil {
+			if errors.Is(err, repository.ErrCourseNotFound) {
+				return errCourseNotFound
+			}
+			log(c).WithError(err).WithField("course_id", objectID).Error("Failed to delete course")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete course")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// HandleRestoreCourse restores a soft deleted course
+func HandleRestoreCourse(repo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid course ID format")
+			return err
 		}
 
-		//NOTE: Remove the couse reference from the corresponding videos as well
+		if err := repo.Restore(c.Context(), objectID); err != nil {
+			if errors.Is(err, repository.ErrCourseNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "Deleted course not found")
+			}
+			log(c).WithError(err).WithField("course_id", objectID).Error("Failed to restore course")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to restore course")
+		}
 
-		// Delete course
-		if err := repo.Delete(c.Context(), objectID); err != nil {
+		course, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
+		}
+
+		return c.JSON(course)
+	}
+}
+
+// HandleEraseCourse permanently deletes a course, soft deleted or not, together with
+// its videos, their watch history and the files in S3
+func HandleEraseCourse(repo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		// Delete course, its videos and their watch history
+		media, err := repo.HardDelete(c.Context(), objectID)
+		if err != nil {
+			if errors.Is(err, repository.ErrCourseNotFound) {
+				return errCourseNotFound
+			}
+			log(c).WithError(err).WithField("course_id", objectID).Error("Failed to delete course")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete course")
 		}
 
-		return c.SendStatus(fiber.StatusOK)
+		// Remove the files from S3 once the records are gone
+		for _, key := range media.VideoKeys {
+			if err := aws.S3C.DeleteFile(key); err != nil {
+				log(c).WithError(err).WithField("course_id", objectID).Error("Failed to delete video file from S3")
+			}
+		}
+		for _, key := range media.ThumbnailKeys {
+			if err := aws.S3C.DeleteThumbnail(key); err != nil {
+				log(c).WithError(err).WithField("course_id", objectID).Error("Failed to delete thumbnail from S3")
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"videos_removed": media.VideosRemoved,
+		})
+	}
+}
+
+// courseEditLock lists the videos that keep a course from being published or reordered
+type courseEditLock struct {
+	Error    string               `json:"error"`
+	VideoIDs []primitive.ObjectID `json:"video_ids"`
+}
+
+// resolveCourseEditLock returns the lock to reject the request with when any video is
+// still processing or failed. In "warn" mode the request is allowed with a Warning header.
+func resolveCourseEditLock(c *fiber.Ctx, notReady []*models.Video, mode string) *courseEditLock {
+	if len(notReady) == 0 {
+		return nil
+	}
+
+	lock := &courseEditLock{
+		Error:    "Course has videos that are still processing or failed",
+		VideoIDs: make([]primitive.ObjectID, len(notReady)),
+	}
+	for i, video := range notReady {
+		lock.VideoIDs[i] = video.ID
+	}
+
+	if mode == "warn" {
+		log(c).WithField("video_ids", lock.VideoIDs).Warn("Editing course with videos that are not ready")
+		c.Set(fiber.HeaderWarning, `199 - "`+lock.Error+`"`)
+		return nil
 	}
+	return lock
+}
+
+// checkCourseEditLock looks up the course's videos that are not ready and resolves the lock
+func checkCourseEditLock(c *fiber.Ctx, repo *repository.CourseRepository, courseID primitive.ObjectID) (*courseEditLock, error) {
+	notReady, err := repo.ListNotReadyVideos(c.Context(), courseID)
+	if err != nil {
+		log(c).WithError(err).WithField("course_id", courseID).Error("Failed to check video processing status")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to check video processing status")
+	}
+	return resolveCourseEditLock(c, notReady, config.AppConfig.CourseEditLockMode), nil
 }
 
 // HandleReorderVideos reorders videos in a course
 func HandleReorderVideos(repo *repository.CourseRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get course ID from params
-		courseID := c.Params("id")
-		if courseID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Course ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(courseID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid course ID format")
+			return err
 		}
 
 		// Parse request body
@@ -260,15 +558,23 @@ func HandleReorderVideos(repo *repository.CourseRepository) fiber.Handler {
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
+		}
+
+		lock, err := checkCourseEditLock(c, repo, objectID)
+		if err != nil {
+			return err
+		}
+		if lock != nil {
+			return c.Status(fiber.StatusConflict).JSON(lock)
 		}
 
 		// Convert video IDs to ObjectIDs
 		videoOrder := make([]primitive.ObjectID, len(req.VideoOrder))
 		for i, id := range req.VideoOrder {
-			videoID, err := primitive.ObjectIDFromHex(id)
+			videoID, err := toObjectID(id, "video_order")
 			if err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, "Invalid video ID format")
+				return err
 			}
 			videoOrder[i] = videoID
 		}
@@ -285,15 +591,9 @@ func HandleReorderVideos(repo *repository.CourseRepository) fiber.Handler {
 func HandleAddVideoToCourse(repo *repository.CourseRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get course ID from params
-		courseID := c.Params("id")
-		if courseID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Course ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(courseID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid course ID format")
+			return err
 		}
 
 		// Parse request body
@@ -303,17 +603,23 @@ func HandleAddVideoToCourse(repo *repository.CourseRepository) fiber.Handler {
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		// Convert video ID to ObjectID
-		videoID, err := primitive.ObjectIDFromHex(req.VideoID)
+		videoID, err := toObjectID(req.VideoID, "video_id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid video ID format")
+			return err
 		}
 
 		// Add video to course
 		if err := repo.AddVideoToCourse(c.Context(), objectID, videoID, req.Position); err != nil {
+			switch {
+			case errors.Is(err, repository.ErrCourseNotFound):
+				return errCourseNotFound
+			case errors.Is(err, repository.ErrInvalidVideoPosition):
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid position")
+			}
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to add video to course")
 		}
 
@@ -325,27 +631,15 @@ func HandleAddVideoToCourse(repo *repository.CourseRepository) fiber.Handler {
 func HandleRemoveVideoFromCourse(repo *repository.CourseRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get course ID from params
-		courseID := c.Params("id")
-		if courseID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Course ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(courseID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid course ID format")
+			return err
 		}
 
 		// Get video ID from params
-		videoID := c.Params("video_id")
-		if videoID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Video ID is required")
-		}
-
-		// Convert video ID to ObjectID
-		videoObjectID, err := primitive.ObjectIDFromHex(videoID)
+		videoObjectID, err := parseObjectID(c, "video_id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid video ID format")
+			return err
 		}
 
 		// Remove video from course
@@ -356,3 +650,198 @@ func HandleRemoveVideoFromCourse(repo *repository.CourseRepository) fiber.Handle
 		return c.SendStatus(fiber.StatusNoContent)
 	}
 }
+
+// accessibleCourse is a course annotated with whether the caller can watch it
+type accessibleCourse struct {
+	*models.Course
+	HasAccess bool `json:"has_access"`
+}
+
+// withAccessFlags marks each course as accessible when it is free, the caller
+// is an admin, the caller has an active subscription or bought the course
+func withAccessFlags(courses []*models.Course, role string, subscribed bool, purchased map[primitive.ObjectID]bool) []accessibleCourse {
+	result := make([]accessibleCourse, 0, len(courses))
+	for _, course := range courses {
+		result = append(result, accessibleCourse{
+			Course:    course,
+			HasAccess: !course.IsPaid || role == "admin" || subscribed || purchased[course.ID],
+		})
+	}
+	return result
+}
+
+// HandleListAccessibleCourses lists public courses with a has_access flag for the current user
+func HandleListAccessibleCourses(
+	repo *repository.CourseRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	paymentRepo *repository.PaymentRepository,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		pagination := parsePagination(c, defaultPageLimit)
+
+		courses, total, err := repo.List(c.Context(), pagination.Page, pagination.Limit, true, repository.CourseFilter{})
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses")
+		}
+
+		subscription, err := subscriptionRepo.GetActiveSubscription(c.Context(), user.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to get active subscription")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses")
+		}
+
+		purchasedIDs, err := paymentRepo.ListPurchasedCourseIDs(c.Context(), user.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list purchased courses")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses")
+		}
+		purchased := make(map[primitive.ObjectID]bool, len(purchasedIDs))
+		for _, id := range purchasedIDs {
+			purchased[id] = true
+		}
+
+		return c.JSON(fiber.Map{
+			"courses": withAccessFlags(courses, user.Role, subscription != nil, purchased),
+			"total":   total,
+			"page":    pagination.Page,
+			"limit":   pagination.Limit,
+		})
+	}
+}
+
+// HandleGetCourseProgress returns the current user's watch progress through a course
+func HandleGetCourseProgress(repo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		course, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
+		}
+		if course == nil {
+			return errCourseNotFound
+		}
+
+		progress, err := repo.GetCourseProgress(c.Context(), user.ID, objectID)
+		if err != nil {
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"user_id":   user.ID,
+				"course_id": objectID,
+			}).Error("Failed to get course progress")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course progress")
+		}
+
+		return c.JSON(progress)
+	}
+}
+
+// HandleContinueWatching lists the courses the current user watched recently with the
+// video to resume in each, most recently watched first
+func HandleContinueWatching(repo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		pagination := parsePagination(c, defaultPageLimit)
+		entries, total, err := repo.ListContinueWatching(c.Context(), user.ID, pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list continue watching")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list continue watching")
+		}
+
+		return c.JSON(Paginate(entries, total, pagination))
+	}
+}
+
+// HandleGetCourseFunnel returns how many users started and completed each video of a
+// course in order, showing where viewers drop off (admin only)
+func HandleGetCourseFunnel(repo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		funnel, err := repo.GetCompletionFunnel(c.Context(), objectID)
+		if err != nil {
+			if errors.Is(err, repository.ErrCourseNotFound) {
+				return errCourseNotFound
+			}
+			log(c).WithError(err).WithField("course_id", objectID).Error("Failed to get course funnel")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course funnel")
+		}
+
+		return c.JSON(funnel)
+	}
+}
+
+// HandleGetCourseAnalytics returns enrollment, viewer, completion and drop-off numbers of a course (admin only)
+func HandleGetCourseAnalytics(repo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		analytics, err := repo.GetCourseAnalytics(c.Context(), objectID)
+		if err != nil {
+			if errors.Is(err, repository.ErrCourseNotFound) {
+				return errCourseNotFound
+			}
+			log(c).WithError(err).WithField("course_id", objectID).Error("Failed to get course analytics")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course analytics")
+		}
+
+		return c.JSON(analytics)
+	}
+}
+
+// HandleSetCourseVideosPaid marks a course and every one of its videos as paid or free (admin only)
+func HandleSetCourseVideosPaid(repo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			IsPaid *bool `json:"is_paid"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+		if req.IsPaid == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "is_paid is required")
+		}
+
+		modified, err := repo.SetVideosPaid(c.Context(), objectID, *req.IsPaid)
+		if err != nil {
+			if errors.Is(err, repository.ErrCourseNotFound) {
+				return errCourseNotFound
+			}
+			log(c).WithError(err).WithField("course_id", objectID).Error("Failed to update course videos")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update course videos")
+		}
+
+		return c.JSON(fiber.Map{
+			"course_id":      objectID,
+			"is_paid":        *req.IsPaid,
+			"videos_updated": modified,
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCoursePatchOmittedFieldsUnchanged(t *testing.T) {
+	course := &models.Course{
+		Title:       "Go Basics",
+		SubTitle:    "Learn Go",
+		Description: "An introduction to Go",
+		Author:      "Jane",
+		IsPaid:      true,
+	}
+
+	var patch coursePatch
+	if err := json.Unmarshal([]byte(`{"title":"Go Fundamentals"}`), &patch); err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+	patch.apply(course)
+
+	if course.Title != "Go Fundamentals" {
+		t.Fatalf("expected title to be updated, got %q", course.Title)
+	}
+	if course.SubTitle != "Learn Go" || course.Description != "An introduction to Go" || course.Author != "Jane" {
+		t.Fatalf("expected omitted fields to be unchanged, got %+v", course)
+	}
+	if !course.IsPaid {
+		t.Fatal("expected is_paid to be unchanged")
+	}
+}
+
+func TestCoursePatchExplicitEmptyClears(t *testing.T) {
+	course := &models.Course{
+		Title:       "Go Basics",
+		SubTitle:    "Learn Go",
+		Description: "An introduction to Go",
+		Skills:      []string{"go"},
+		IsPaid:      true,
+	}
+
+	var patch coursePatch
+	if err := json.Unmarshal([]byte(`{"subtitle":"","description":"","skills":[],"is_paid":false}`), &patch); err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+	patch.apply(course)
+
+	if course.SubTitle != "" || course.Description != "" {
+		t.Fatalf("expected subtitle and description to be cleared, got %+v", course)
+	}
+	if len(course.Skills) != 0 {
+		t.Fatalf("expected skills to be cleared, got %v", course.Skills)
+	}
+	if course.IsPaid {
+		t.Fatal("expected is_paid to be cleared")
+	}
+	if course.Title != "Go Basics" {
+		t.Fatalf("expected title to be unchanged, got %q", course.Title)
+	}
+}
+
+func TestCoursePatchReturnsOnlyProvidedFields(t *testing.T) {
+	course := &models.Course{Title: "Go Basics", Author: "Jane", ThumbnailURL: "thumbs/old.png"}
+
+	var patch coursePatch
+	if err := json.Unmarshal([]byte(`{"description":"","price":500}`), &patch); err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+	fields := patch.apply(course)
+
+	if len(fields) != 2 || fields["description"] != "" || fields["price"] != 500 {
+		t.Fatalf("expected only description and price, got %v", fields)
+	}
+	if _, ok := fields["thumbnail_url"]; ok {
+		t.Fatal("expected an omitted thumbnail to be left out")
+	}
+}
+
+func TestVideoPatchOmittedFieldsUnchanged(t *testing.T) {
+	video := &models.Video{
+		Title:       "Intro",
+		Description: "First lesson",
+		Duration:    120,
+		IsPaid:      true,
+	}
+
+	var patch videoPatch
+	if err := json.Unmarshal([]byte(`{"description":""}`), &patch); err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+	patch.apply(video)
+
+	if video.Description != "" {
+		t.Fatalf("expected description to be cleared, got %q", video.Description)
+	}
+	if video.Title != "Intro" || video.Duration != 120 || !video.IsPaid {
+		t.Fatalf("expected omitted fields to be unchanged, got %+v", video)
+	}
+}
+
+func TestWithAccessFlagsSubscribedVsFree(t *testing.T) {
+	courses := []*models.Course{
+		{Title: "Free Course", IsPaid: false},
+		{Title: "Paid Course", IsPaid: true},
+	}
+
+	free := withAccessFlags(courses, "user", false, nil)
+	if !free[0].HasAccess {
+		t.Fatal("expected free user to access the free course")
+	}
+	if free[1].HasAccess {
+		t.Fatal("expected free user not to access the paid course")
+	}
+
+	subscribed := withAccessFlags(courses, "user", true, nil)
+	if !subscribed[0].HasAccess || !subscribed[1].HasAccess {
+		t.Fatalf("expected subscribed user to access every course, got %+v", subscribed)
+	}
+}
+
+func TestAccessibleCourseJSONIncludesCourseFields(t *testing.T) {
+	flagged := withAccessFlags([]*models.Course{{Title: "Paid Course", IsPaid: true}}, "user", false, nil)
+
+	data, err := json.Marshal(flagged[0])
+	if err != nil {
+		t.Fatalf("failed to encode course: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode course: %v", err)
+	}
+	if decoded["title"] != "Paid Course" || decoded["has_access"] != false {
+		t.Fatalf("unexpected encoding: %s", data)
+	}
+}
+
+func TestSetCourseVideosPaidRequiresFlag(t *testing.T) {
+	app := fiber.New()
+	app.Put("/courses/:id/videos/paid", HandleSetCourseVideosPaid(nil))
+
+	req := httptest.NewRequest("PUT", "/courses/"+primitive.NewObjectID().Hex()+"/videos/paid", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("expected status 400 when is_paid is missing, got %d", resp.StatusCode)
+	}
+}
+
+func TestResolveCourseEditLock(t *testing.T) {
+	processing := &models.Video{ID: primitive.NewObjectID(), Status: models.VideoStatusProcessing}
+	failed := &models.Video{ID: primitive.NewObjectID(), Status: models.VideoStatusFailed}
+
+	cases := []struct {
+		name        string
+		notReady    []*models.Video
+		mode        string
+		wantStatus  int
+		wantWarning bool
+	}{
+		{"all ready", nil, "block", fiber.StatusOK, false},
+		{"processing blocks", []*models.Video{processing}, "block", fiber.StatusConflict, false},
+		{"failed blocks", []*models.Video{processing, failed}, "block", fiber.StatusConflict, false},
+		{"warn allows", []*models.Video{processing}, "warn", fiber.StatusOK, true},
+	}
+
+	for _, tc := range cases {
+		app := fiber.New()
+		app.Post("/", func(c *fiber.Ctx) error {
+			if lock := resolveCourseEditLock(c, tc.notReady, tc.mode); lock != nil {
+				return c.Status(fiber.StatusConflict).JSON(lock)
+			}
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest("POST", "/", nil))
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.name, err)
+		}
+		if resp.StatusCode != tc.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.wantStatus, resp.StatusCode)
+		}
+		if got := resp.Header.Get(fiber.HeaderWarning) != ""; got != tc.wantWarning {
+			t.Errorf("%s: expected warning header %v, got %v", tc.name, tc.wantWarning, got)
+		}
+
+		if resp.StatusCode == fiber.StatusConflict {
+			var lock courseEditLock
+			if err := json.NewDecoder(resp.Body).Decode(&lock); err != nil {
+				t.Fatalf("%s: failed to decode body: %v", tc.name, err)
+			}
+			if len(lock.VideoIDs) != len(tc.notReady) {
+				t.Errorf("%s: expected %d offending videos, got %v", tc.name, len(tc.notReady), lock.VideoIDs)
+			}
+		}
+	}
+}
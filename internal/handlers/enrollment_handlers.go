@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// enrolledCourse is a course together with when the user enrolled in it
+type enrolledCourse struct {
+	*models.Course
+	EnrolledAt time.Time `json:"enrolled_at"`
+}
+
+// HandleEnrollCourse enrolls the current user in a course. Free courses are open
+// to everyone, paid courses require an active subscription or a course purchase.
+func HandleEnrollCourse(
+	courseRepo *repository.CourseRepository,
+	enrollmentRepo *repository.EnrollmentRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	paymentRepo *repository.PaymentRepository,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		courseID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		course, err := courseRepo.GetByID(c.Context(), courseID)
+		if err != nil {
+			log(c).WithError(err).WithField("course_id", courseID).Error("Failed to get course")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
+		}
+		if course == nil {
+			return errCourseNotFound
+		}
+
+		if course.IsPaid && user.Role != "admin" {
+			subscription, err := subscriptionRepo.GetActiveSubscription(c.Context(), user.ID)
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to get active subscription")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to enroll in course")
+			}
+			if subscription == nil {
+				purchased, err := paymentRepo.HasPurchasedCourse(c.Context(), user.ID, courseID)
+				if err != nil {
+					log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to check course purchase")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to enroll in course")
+				}
+				if !purchased {
+					return fiber.NewError(fiber.StatusForbidden, "An active subscription or course purchase is required for this course")
+				}
+			}
+		}
+
+		enrollment, err := enrollmentRepo.Enroll(c.Context(), user.ID, courseID)
+		if err != nil {
+			if errors.Is(err, repository.ErrAlreadyEnrolled) {
+				return fiber.NewError(fiber.StatusConflict, "Already enrolled in this course")
+			}
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"user_id":   user.ID,
+				"course_id": courseID,
+			}).Error("Failed to enroll in course")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to enroll in course")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(enrollment)
+	}
+}
+
+// HandleListMyCourses lists the courses the current user is enrolled in
+func HandleListMyCourses(enrollmentRepo *repository.EnrollmentRepository, courseRepo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		pagination := parsePagination(c, defaultPageLimit)
+
+		enrollments, total, err := enrollmentRepo.ListByUser(c.Context(), user.ID, pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list enrollments")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses")
+		}
+
+		courseIDs := make([]primitive.ObjectID, 0, len(enrollments))
+		for _, enrollment := range enrollments {
+			courseIDs = append(courseIDs, enrollment.CourseID)
+		}
+
+		courses, err := courseRepo.GetByIDs(c.Context(), courseIDs)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to get enrolled courses")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses")
+		}
+
+		return c.JSON(fiber.Map{
+			"courses": joinEnrollments(enrollments, courses),
+			"total":   total,
+			"page":    pagination.Page,
+			"limit":   pagination.Limit,
+		})
+	}
+}
+
+// joinEnrollments pairs enrollments with their courses, keeping enrollment order
+// and skipping courses that no longer exist
+func joinEnrollments(enrollments []*models.Enrollment, courses []*models.Course) []enrolledCourse {
+	byID := make(map[primitive.ObjectID]*models.Course, len(courses))
+	for _, course := range courses {
+		byID[course.ID] = course
+	}
+
+	result := make([]enrolledCourse, 0, len(enrollments))
+	for _, enrollment := range enrollments {
+		if course, ok := byID[enrollment.CourseID]; ok {
+			result = append(result, enrolledCourse{Course: course, EnrolledAt: enrollment.EnrolledAt})
+		}
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestJoinEnrollmentsKeepsOrderAndSkipsMissing(t *testing.T) {
+	first, second, deleted := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	enrolledAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	enrollments := []*models.Enrollment{
+		{CourseID: second, EnrolledAt: enrolledAt},
+		{CourseID: deleted, EnrolledAt: enrolledAt},
+		{CourseID: first, EnrolledAt: enrolledAt.Add(-time.Hour)},
+	}
+	courses := []*models.Course{
+		{ID: first, Title: "First"},
+		{ID: second, Title: "Second"},
+	}
+
+	joined := joinEnrollments(enrollments, courses)
+
+	if len(joined) != 2 {
+		t.Fatalf("expected 2 courses, got %d", len(joined))
+	}
+	if joined[0].Title != "Second" || joined[1].Title != "First" {
+		t.Fatalf("expected enrollment order, got %q then %q", joined[0].Title, joined[1].Title)
+	}
+	if !joined[0].EnrolledAt.Equal(enrolledAt) {
+		t.Fatalf("expected enrolled_at to be carried over, got %v", joined[0].EnrolledAt)
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// entitlementsMaxAge is how long clients may cache an entitlement snapshot
+const entitlementsMaxAge = 60
+
+// entitlementsCacheTTL is how long the server reuses a computed snapshot, kept below
+// entitlementsMaxAge so a purchase shows up within a client cache period
+const entitlementsCacheTTL = 30 * time.Second
+
+// subscriptionEntitlement is the part of an active subscription clients need for gating
+type subscriptionEntitlement struct {
+	Status    string    `json:"status"`
+	Plan      string    `json:"plan"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// entitlements is a compact snapshot of what a user can access
+type entitlements struct {
+	Role              string                   `json:"role"`
+	Subscription      *subscriptionEntitlement `json:"subscription"`
+	PurchasedCourses  []primitive.ObjectID     `json:"purchased_courses"`
+	AccessibleCourses []primitive.ObjectID     `json:"accessible_courses"`
+	Features          map[string]bool          `json:"features"`
+}
+
+// hasPaidAccess reports whether the role or an active subscription unlocks every paid course
+func hasPaidAccess(role string, subscription *models.Subscription) bool {
+	return role == "admin" || subscription != nil
+}
+
+// sortedCourseIDs merges the course ID lists into one without duplicates, sorted by hex
+func sortedCourseIDs(lists ...[]primitive.ObjectID) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool)
+	merged := []primitive.ObjectID{}
+	for _, list := range lists {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				merged = append(merged, id)
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Hex() < merged[j].Hex()
+	})
+	return merged
+}
+
+// buildEntitlements derives the snapshot from the user's role, active subscription
+// (nil when there is none), purchased and enrolled courses, and the public catalog the
+// role or subscription unlocks. Courses are sorted so the snapshot, and with it the
+// ETag, is stable.
+func buildEntitlements(role string, subscription *models.Subscription, purchased, enrolled, catalog []primitive.ObjectID) entitlements {
+	snapshot := entitlements{
+		Role:              role,
+		PurchasedCourses:  sortedCourseIDs(purchased),
+		AccessibleCourses: sortedCourseIDs(catalog, purchased, enrolled),
+		Features: map[string]bool{
+			"paid_videos": hasPaidAccess(role, subscription),
+			"admin_tools": role == "admin",
+		},
+	}
+
+	if subscription != nil {
+		snapshot.Subscription = &subscriptionEntitlement{
+			Status:    subscription.Status,
+			Plan:      subscription.Plan,
+			ExpiresAt: subscription.CurrentPeriodEnd,
+		}
+	}
+	return snapshot
+}
+
+type entitlementCacheEntry struct {
+	snapshot  entitlements
+	expiresAt time.Time
+}
+
+// entitlementCache is a concurrency-safe in-memory cache of entitlement snapshots keyed
+// by user ID and role, so a role change in a new token is never served a stale snapshot
+type entitlementCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]entitlementCacheEntry
+}
+
+func newEntitlementCache(ttl time.Duration) *entitlementCache {
+	return &entitlementCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]entitlementCacheEntry),
+	}
+}
+
+func entitlementCacheKey(userID primitive.ObjectID, role string) string {
+	return userID.Hex() + ":" + role
+}
+
+// get returns the cached snapshot of a user if it has not expired
+func (c *entitlementCache) get(userID primitive.ObjectID, role string) (entitlements, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[entitlementCacheKey(userID, role)]
+	c.mu.RUnlock()
+
+	if !ok || !c.now().Before(entry.expiresAt) {
+		return entitlements{}, false
+	}
+	return entry.snapshot, true
+}
+
+// set stores the snapshot of a user, dropping expired entries so the cache stays bounded
+// by the number of recently active users
+func (c *entitlementCache) set(userID primitive.ObjectID, role string, snapshot entitlements) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.entries[entitlementCacheKey(userID, role)] = entitlementCacheEntry{
+		snapshot:  snapshot,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// sendWithETag writes body as JSON with a content based ETag, answering 304 when
+// the client already has the same version
+func sendWithETag(c *fiber.Ctx, body interface{}, maxAge int) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(maxAge))
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(data)
+}
+
+// HandleGetEntitlements returns the current user's entitlement snapshot for client side
+// gating, including every course the user can access. Snapshots are cached briefly.
+func HandleGetEntitlements(
+	subscriptionRepo *repository.SubscriptionRepository,
+	paymentRepo *repository.PaymentRepository,
+	enrollmentRepo *repository.EnrollmentRepository,
+	courseRepo *repository.CourseRepository,
+) fiber.Handler {
+	cache := newEntitlementCache(entitlementsCacheTTL)
+
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		if snapshot, ok := cache.get(user.ID, user.Role); ok {
+			return sendWithETag(c, snapshot, entitlementsMaxAge)
+		}
+
+		subscription, err := subscriptionRepo.GetActiveSubscription(c.Context(), user.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to get active subscription")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get entitlements")
+		}
+
+		purchased, err := paymentRepo.ListPurchasedCourseIDs(c.Context(), user.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list purchased courses")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get entitlements")
+		}
+
+		enrolled, err := enrollmentRepo.ListCourseIDs(c.Context(), user.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list enrolled courses")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get entitlements")
+		}
+
+		// Everyone can access the free public courses, paid access unlocks the rest
+		filter := repository.CourseFilter{}
+		if !hasPaidAccess(user.Role, subscription) {
+			free := false
+			filter.IsPaid = &free
+		}
+		catalog, err := courseRepo.ListIDs(c.Context(), true, filter)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list accessible courses")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get entitlements")
+		}
+
+		snapshot := buildEntitlements(user.Role, subscription, purchased, enrolled, catalog)
+		cache.set(user.ID, user.Role, snapshot)
+
+		return sendWithETag(c, snapshot, entitlementsMaxAge)
+	}
+}
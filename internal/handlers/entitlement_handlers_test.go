@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBuildEntitlementsReflectsSubscriptionAndPurchases(t *testing.T) {
+	courseA, courseB := primitive.NewObjectID(), primitive.NewObjectID()
+	periodEnd := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	free := buildEntitlements("user", nil, nil, nil, nil)
+	if free.Subscription != nil || free.Features["paid_videos"] || len(free.PurchasedCourses) != 0 {
+		t.Fatalf("expected no entitlements for a free user, got %+v", free)
+	}
+
+	buyer := buildEntitlements("user", nil, []primitive.ObjectID{courseB, courseA}, nil, nil)
+	if buyer.Features["paid_videos"] || len(buyer.PurchasedCourses) != 2 {
+		t.Fatalf("expected two purchased courses and no subscription access, got %+v", buyer)
+	}
+
+	subscriber := buildEntitlements("user", &models.Subscription{
+		Status:           "active",
+		Plan:             "yearly",
+		CurrentPeriodEnd: periodEnd,
+	}, []primitive.ObjectID{courseA}, nil, nil)
+	if subscriber.Subscription == nil || subscriber.Subscription.Plan != "yearly" || !subscriber.Subscription.ExpiresAt.Equal(periodEnd) {
+		t.Fatalf("expected yearly subscription expiring %v, got %+v", periodEnd, subscriber.Subscription)
+	}
+	if !subscriber.Features["paid_videos"] || subscriber.Features["admin_tools"] {
+		t.Fatalf("unexpected features %v", subscriber.Features)
+	}
+}
+
+func TestBuildEntitlementsMergesAccessibleCourses(t *testing.T) {
+	free, purchased, enrolled := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	snapshot := buildEntitlements("user", nil,
+		[]primitive.ObjectID{purchased},
+		[]primitive.ObjectID{enrolled, purchased},
+		[]primitive.ObjectID{free},
+	)
+
+	if len(snapshot.AccessibleCourses) != 3 {
+		t.Fatalf("expected 3 accessible courses without duplicates, got %v", snapshot.AccessibleCourses)
+	}
+	for i := 1; i < len(snapshot.AccessibleCourses); i++ {
+		if snapshot.AccessibleCourses[i-1].Hex() >= snapshot.AccessibleCourses[i].Hex() {
+			t.Fatalf("expected accessible courses sorted, got %v", snapshot.AccessibleCourses)
+		}
+	}
+	if len(snapshot.PurchasedCourses) != 1 || snapshot.PurchasedCourses[0] != purchased {
+		t.Fatalf("expected only the purchased course, got %v", snapshot.PurchasedCourses)
+	}
+}
+
+func TestEntitlementCacheExpiresAndKeysByRole(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newEntitlementCache(30 * time.Second)
+	cache.now = func() time.Time { return now }
+
+	userID := primitive.NewObjectID()
+	cache.set(userID, "user", buildEntitlements("user", nil, nil, nil, nil))
+
+	if _, ok := cache.get(userID, "user"); !ok {
+		t.Fatal("expected a cached snapshot")
+	}
+	if _, ok := cache.get(userID, "admin"); ok {
+		t.Fatal("expected no snapshot for a different role")
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, ok := cache.get(userID, "user"); ok {
+		t.Fatal("expected the snapshot to expire")
+	}
+}
+
+func TestSendWithETagReturnsNotModified(t *testing.T) {
+	snapshot := buildEntitlements("user", nil, []primitive.ObjectID{primitive.NewObjectID()}, nil, nil)
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error { return sendWithETag(c, snapshot, entitlementsMaxAge) })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	etag := resp.Header.Get(fiber.HeaderETag)
+	if resp.StatusCode != fiber.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d %q", resp.StatusCode, etag)
+	}
+	if resp.Header.Get(fiber.HeaderCacheControl) != "private, max-age=60" {
+		t.Fatalf("unexpected Cache-Control %q", resp.Header.Get(fiber.HeaderCacheControl))
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderIfNoneMatch, etag)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotModified {
+		t.Fatalf("expected 304 for a matching ETag, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// APIError is an error response with a stable, machine readable code clients can branch
+// on and localize, alongside the HTTP status and a human readable message
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	// RetryAfter is how many seconds a rate limited client should wait, 0 when not limited
+	RetryAfter int
+}
+
+// NewAPIError creates an APIError
+func NewAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Unwrap exposes the error as a fiber.Error, so fiber's default error handling and
+// callers checking the status with errors.As keep working
+func (e *APIError) Unwrap() error {
+	return fiber.NewError(e.Status, e.Message)
+}
+
+// Errors returned by many handlers. Their codes are part of the API and must not change.
+var (
+	errInvalidBody          = NewAPIError(fiber.StatusBadRequest, "invalid_request_body", "Invalid request body")
+	errInvalidCredentials   = NewAPIError(fiber.StatusUnauthorized, "invalid_credentials", "Invalid credentials")
+	errSubscriptionRequired = NewAPIError(fiber.StatusForbidden, "subscription_required", "A subscription or course purchase is required to watch this video")
+	errPreviewLimitExceeded = NewAPIError(fiber.StatusForbidden, "preview_limit_exceeded", "A subscription or course purchase is required to watch past the preview")
+	errCourseNotFound       = NewAPIError(fiber.StatusNotFound, "course_not_found", "Course not found")
+	errUserNotFound         = NewAPIError(fiber.StatusNotFound, "user_not_found", "User not found")
+	errVideoNotFound        = NewAPIError(fiber.StatusNotFound, "video_not_found", "Video not found")
+	errSubscriptionNotFound = NewAPIError(fiber.StatusNotFound, "subscription_not_found", "Subscription not found")
+	errPaymentNotFound      = NewAPIError(fiber.StatusNotFound, "payment_not_found", "Payment not found")
+	errProductNotFound      = NewAPIError(fiber.StatusNotFound, "product_not_found", "Product not found")
+	errReviewNotFound       = NewAPIError(fiber.StatusNotFound, "review_not_found", "Review not found")
+	errCouponNotFound       = NewAPIError(fiber.StatusNotFound, "coupon_not_found", "Coupon not found")
+	errPricingNotFound      = NewAPIError(fiber.StatusNotFound, "pricing_not_found", "Pricing not found for region")
+	errCouponCoversPrice    = NewAPIError(fiber.StatusBadRequest, "coupon_covers_price", "The coupon covers the whole price, which this payment gateway cannot charge")
+	errStaleUpdate          = NewAPIError(fiber.StatusConflict, "stale_update", "The resource was modified by another request, reload it and try again")
+)
+
+// statusErrorCode derives a code from an HTTP status for errors without their own,
+// e.g. "not_found" for 404
+func statusErrorCode(status int) string {
+	message := utils.StatusMessage(status)
+	if message == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.ReplaceAll(message, " ", "_"))
+}
+
+// ErrorResponse returns the status and {error, code} body of the response for an error
+// returned by a handler, with retry_after_seconds for rate limited requests. Plain fiber
+// errors get a code derived from their status and any other error is an internal error.
+func ErrorResponse(err error) (int, fiber.Map) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		body := fiber.Map{"error": apiErr.Message, "code": apiErr.Code}
+		if apiErr.RetryAfter > 0 {
+			body["retry_after_seconds"] = apiErr.RetryAfter
+		}
+		return apiErr.Status, body
+	}
+
+	status := fiber.StatusInternalServerError
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	}
+	return status, fiber.Map{"error": err.Error(), "code": statusErrorCode(status)}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"typed", errCourseNotFound, fiber.StatusNotFound, "course_not_found"},
+		{"fiber", fiber.NewError(fiber.StatusConflict, "Already exists"), fiber.StatusConflict, "conflict"},
+		{"plain", errors.New("boom"), fiber.StatusInternalServerError, "internal_server_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := ErrorResponse(tt.err)
+			if status != tt.status || body["code"] != tt.code || body["error"] != tt.err.Error() {
+				t.Fatalf("expected %d %q, got %d %v", tt.status, tt.code, status, body)
+			}
+		})
+	}
+}
+
+func TestAPIErrorUnwrapsToFiberError(t *testing.T) {
+	var fiberErr *fiber.Error
+	if !errors.As(errInvalidBody, &fiberErr) || fiberErr.Code != fiber.StatusBadRequest {
+		t.Fatalf("expected a 400 fiber error, got %v", fiberErr)
+	}
+}
+
+func TestErrorResponseCarriesRetryAfter(t *testing.T) {
+	status, body := ErrorResponse(&APIError{Status: fiber.StatusTooManyRequests, Code: "otp_rate_limited", Message: "Slow down", RetryAfter: 42})
+	if status != fiber.StatusTooManyRequests || body["code"] != "otp_rate_limited" || body["retry_after_seconds"] != 42 {
+		t.Fatalf("expected a 429 with the retry delay, got %d %v", status, body)
+	}
+
+	if _, body := ErrorResponse(errCourseNotFound); body["retry_after_seconds"] != nil {
+		t.Fatalf("expected no retry delay, got %v", body)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cource-api/internal/config"
+	"cource-api/internal/events"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// liveEventsHeartbeat is how often a comment is sent on an idle stream, so proxies keep
+// it open and a client that went away is noticed
+const liveEventsHeartbeat = 25 * time.Second
+
+// writeLiveEvent writes an event in the server-sent events format
+func writeLiveEvent(w *bufio.Writer, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+// streamLiveEvents writes the events of a subscription to a client until the
+// subscription is closed or the client disconnects, which shows as a failed flush
+func streamLiveEvents(w *bufio.Writer, ch <-chan events.Event, heartbeat <-chan time.Time) error {
+	if _, err := w.WriteString(": connected\n\n"); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := writeLiveEvent(w, event); err != nil {
+				return err
+			}
+		case <-heartbeat:
+			if _, err := w.WriteString(": heartbeat\n\n"); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// HandleLiveEvents streams the current user's watch progress and notifications as
+// server-sent events, so every session of the user stays in sync. broker is nil when
+// live events are disabled.
+func HandleLiveEvents(broker *events.Broker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if broker == nil {
+			return fiber.NewError(fiber.StatusNotFound, "Live events are disabled")
+		}
+
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		if limit := config.AppConfig.LiveEventsMaxSessions; limit > 0 && broker.Subscribers(user.ID) >= limit {
+			return fiber.NewError(fiber.StatusTooManyRequests, "Too many open event streams")
+		}
+
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+		// Stops nginx from buffering the stream
+		c.Set("X-Accel-Buffering", "no")
+
+		logger := log(c).WithField("user_id", user.ID)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			ch, unsubscribe := broker.Subscribe(user.ID)
+			defer unsubscribe()
+
+			heartbeat := time.NewTicker(liveEventsHeartbeat)
+			defer heartbeat.Stop()
+
+			if err := streamLiveEvents(w, ch, heartbeat.C); err != nil {
+				logger.WithError(err).Debug("Live events client disconnected")
+			}
+		})
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cource-api/internal/events"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStreamLiveEvents(t *testing.T) {
+	var buf bytes.Buffer
+	ch := make(chan events.Event, 2)
+	heartbeat := make(chan time.Time, 1)
+
+	ch <- events.Event{Type: events.TypeWatchProgress, Data: map[string]int{"progress_seconds": 90}}
+	heartbeat <- time.Now()
+
+	done := make(chan error)
+	go func() { done <- streamLiveEvents(bufio.NewWriter(&buf), ch, heartbeat) }()
+
+	// Give the stream time to take both queued inputs before the subscription closes
+	time.Sleep(50 * time.Millisecond)
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		": connected\n\n",
+		"event: watch_progress\ndata: {\"progress_seconds\":90}\n\n",
+		": heartbeat\n\n",
+	} {
+		if !bytes.Contains([]byte(output), []byte(want)) {
+			t.Fatalf("expected %q in the stream, got %q", want, output)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("client went away")
+}
+
+func TestStreamLiveEventsStopsWhenClientDisconnects(t *testing.T) {
+	ch := make(chan events.Event)
+	if err := streamLiveEvents(bufio.NewWriter(failingWriter{}), ch, nil); err == nil {
+		t.Fatal("expected a failed flush to end the stream")
+	}
+}
+
+func TestHandleLiveEventsDisabled(t *testing.T) {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			status, body := ErrorResponse(err)
+			return c.Status(status).JSON(body)
+		},
+	})
+	app.Get("/events", HandleLiveEvents(nil))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/events", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("expected 404 when live events are disabled, got %d", resp.StatusCode)
+	}
+}
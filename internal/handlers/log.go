@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"cource-api/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// log returns a logger for the current request carrying its request ID and, once the
+// request is authenticated, the ID of the user making it
+func log(c *fiber.Ctx) *logrus.Entry {
+	fields := logrus.Fields{}
+	if id := middleware.GetRequestID(c); id != "" {
+		fields["request_id"] = id
+	}
+	if claims, ok := c.Locals("user").(*middleware.Claims); ok {
+		fields["user_id"] = claims.UserID.Hex()
+	}
+	return logrus.WithFields(fields)
+}
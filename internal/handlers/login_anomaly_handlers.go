@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cource-api/internal/config"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// loginSharedIPWindow is how far back logins from the same IP are counted
+const loginSharedIPWindow = 24 * time.Hour
+
+// loginHistory is what is known about a user's earlier logins and the requesting IP
+type loginHistory struct {
+	Devices      []string
+	Countries    []string
+	AccountsByIP []primitive.ObjectID
+}
+
+// newLoginEvent captures the metadata of a login request. The device is a fingerprint
+// of the X-Device-ID header, falling back to the user agent.
+func newLoginEvent(c *fiber.Ctx, user *models.User) *models.LoginEvent {
+	device := c.Get("X-Device-ID")
+	if device == "" {
+		device = c.Get(fiber.HeaderUserAgent)
+	}
+	sum := sha256.Sum256([]byte(device))
+
+	var country string
+	if config.AppConfig.LoginCountryHeader != "" {
+		country = strings.ToUpper(strings.TrimSpace(c.Get(config.AppConfig.LoginCountryHeader)))
+	}
+
+	return &models.LoginEvent{
+		UserID:    user.ID,
+		Email:     user.Email,
+		IP:        c.IP(),
+		Country:   country,
+		Device:    hex.EncodeToString(sum[:16]),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+}
+
+// detectLoginAnomalies returns the anomaly flags for a login given the user's history.
+// A user's first login has nothing to compare against and is never flagged as new.
+func detectLoginAnomalies(event *models.LoginEvent, history loginHistory, ipAccountLimit int) []string {
+	var flags []string
+
+	if len(history.Devices) > 0 && !slices.Contains(history.Devices, event.Device) {
+		flags = append(flags, models.LoginFlagNewDevice)
+	}
+	if event.Country != "" && len(history.Countries) > 0 && !slices.Contains(history.Countries, event.Country) {
+		flags = append(flags, models.LoginFlagNewCountry)
+	}
+
+	accounts := len(history.AccountsByIP)
+	if !slices.Contains(history.AccountsByIP, event.UserID) {
+		accounts++
+	}
+	if ipAccountLimit > 0 && accounts >= ipAccountLimit {
+		flags = append(flags, models.LoginFlagSharedIP)
+	}
+
+	return flags
+}
+
+// loadLoginHistory gathers the user's known devices and countries and the accounts seen from the IP
+func loadLoginHistory(ctx context.Context, repo *repository.LoginEventRepository, event *models.LoginEvent) (loginHistory, error) {
+	devices, countries, err := repo.KnownDevicesAndCountries(ctx, event.UserID)
+	if err != nil {
+		return loginHistory{}, err
+	}
+
+	accounts, err := repo.AccountsFromIP(ctx, event.IP, time.Now().UTC().Add(-loginSharedIPWindow))
+	if err != nil {
+		return loginHistory{}, err
+	}
+
+	return loginHistory{Devices: devices, Countries: countries, AccountsByIP: accounts}, nil
+}
+
+// HandleListLoginAnomalies lists flagged logins for review (admin only). The optional
+// reviewed query parameter filters by review state.
+func HandleListLoginAnomalies(repo *repository.LoginEventRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pagination := parsePagination(c, 20)
+
+		var reviewed *bool
+		if value := c.Query("reviewed"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "reviewed must be true or false")
+			}
+			reviewed = &parsed
+		}
+
+		events, total, err := repo.ListFlagged(c.Context(), reviewed, pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).Error("Failed to list login anomalies")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve login anomalies")
+		}
+
+		return c.JSON(fiber.Map{
+			"events": events,
+			"total":  total,
+			"page":   pagination.Page,
+			"limit":  pagination.Limit,
+		})
+	}
+}
+
+// HandleReviewLoginAnomaly marks a flagged login as reviewed by the current admin
+func HandleReviewLoginAnomaly(repo *repository.LoginEventRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		admin, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		event, err := repo.MarkReviewed(c.Context(), objectID, admin.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("event_id", objectID).Error("Failed to mark login anomaly reviewed")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to review login anomaly")
+		}
+		if event == nil {
+			return fiber.NewError(fiber.StatusNotFound, "Login event not found")
+		}
+
+		return c.JSON(event)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDetectLoginAnomaliesNewDevice(t *testing.T) {
+	userID := primitive.NewObjectID()
+	history := loginHistory{
+		Devices:      []string{"laptop"},
+		Countries:    []string{"US"},
+		AccountsByIP: []primitive.ObjectID{userID},
+	}
+
+	known := &models.LoginEvent{UserID: userID, Device: "laptop", Country: "US"}
+	if flags := detectLoginAnomalies(known, history, 5); len(flags) != 0 {
+		t.Fatalf("expected no flags for a known device, got %v", flags)
+	}
+
+	newDevice := &models.LoginEvent{UserID: userID, Device: "phone", Country: "US"}
+	flags := detectLoginAnomalies(newDevice, history, 5)
+	if !slices.Equal(flags, []string{models.LoginFlagNewDevice}) {
+		t.Fatalf("expected only the new device flag, got %v", flags)
+	}
+
+	abroad := &models.LoginEvent{UserID: userID, Device: "phone", Country: "FR"}
+	flags = detectLoginAnomalies(abroad, history, 5)
+	if !slices.Contains(flags, models.LoginFlagNewDevice) || !slices.Contains(flags, models.LoginFlagNewCountry) {
+		t.Fatalf("expected new device and country flags, got %v", flags)
+	}
+}
+
+func TestDetectLoginAnomaliesFirstLoginAndSharedIP(t *testing.T) {
+	userID := primitive.NewObjectID()
+
+	first := &models.LoginEvent{UserID: userID, Device: "laptop", Country: "US"}
+	if flags := detectLoginAnomalies(first, loginHistory{}, 5); len(flags) != 0 {
+		t.Fatalf("expected a first login not to be flagged, got %v", flags)
+	}
+
+	others := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	flags := detectLoginAnomalies(first, loginHistory{AccountsByIP: others}, 5)
+	if !slices.Equal(flags, []string{models.LoginFlagSharedIP}) {
+		t.Fatalf("expected the fifth account on an IP to be flagged, got %v", flags)
+	}
+}
+
+func TestNewLoginEventFingerprintsDevice(t *testing.T) {
+	app := fiber.New()
+	var events []*models.LoginEvent
+	app.Get("/", func(c *fiber.Ctx) error {
+		events = append(events, newLoginEvent(c, &models.User{ID: primitive.NewObjectID()}))
+		return nil
+	})
+
+	for _, device := range []string{"device-a", "device-a", "device-b"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Device-ID", device)
+		if _, err := app.Test(req); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	}
+
+	if events[0].Device != events[1].Device || events[0].Device == events[2].Device {
+		t.Fatalf("expected fingerprints to match only for the same device, got %q %q %q", events[0].Device, events[1].Device, events[2].Device)
+	}
+	if events[0].Device == "device-a" {
+		t.Fatal("expected the raw device ID not to be stored")
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"cource-api/internal/database"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+)
+
+// connectTestDatabase starts a single node replica set, so transactions work, and points
+// the database package at it. The test is skipped when no container can be started.
+func connectTestDatabase(t *testing.T) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	container, err := mongodb.Run(ctx, "mongo:latest", mongodb.WithReplicaSet("rs0"))
+	if err != nil {
+		t.Skipf("mongo container unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = container.Terminate(ctx) })
+
+	uri, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection string: %v", err)
+	}
+	if err := database.Connect(uri, "test", database.IndexModeEnsure); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Disconnect() })
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"cource-api/internal/events"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// notificationsResponse is a page of a user's notifications with their unread count
+type notificationsResponse struct {
+	PaginatedResponse
+	UnreadCount int64 `json:"unread_count"`
+}
+
+// notify adds a notification to a user's feed and pushes it to the user's connected
+// sessions. Notifications are a side effect of the request, so a failure is logged
+// rather than returned.
+func notify(
+	c *fiber.Ctx,
+	repo *repository.NotificationRepository,
+	broker *events.Broker,
+	userID primitive.ObjectID,
+	notificationType, title, body string,
+) {
+	notification := &models.Notification{
+		UserID: userID,
+		Type:   notificationType,
+		Title:  title,
+		Body:   body,
+	}
+	created, err := repo.Create(c.Context(), notification)
+	if err != nil {
+		log(c).WithError(err).WithField("user_id", userID).WithField("type", notificationType).Error("Failed to create notification")
+		return
+	}
+	if created {
+		broker.Publish(userID, events.Event{Type: events.TypeNotification, Data: notification})
+	}
+}
+
+// notifyPaymentSucceeded tells a user their payment was received
+func notifyPaymentSucceeded(c *fiber.Ctx, repo *repository.NotificationRepository, broker *events.Broker, payment *models.Payment) {
+	notify(c, repo, broker, payment.UserID, models.NotificationPaymentSucceeded,
+		"Payment received",
+		fmt.Sprintf("We received your payment of %s %s for the %s plan.",
+			formatPayPalAmount(int64(payment.Amount), payment.Currency), strings.ToUpper(payment.Currency), payment.Plan),
+	)
+}
+
+// normalizeMutedNotifications validates the notification types a user mutes and drops
+// duplicates
+func normalizeMutedNotifications(types []string) ([]string, error) {
+	muted := []string{}
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if !slices.Contains(models.NotificationTypes, t) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unknown notification type %q, expected one of %s", t, strings.Join(models.NotificationTypes, ", ")))
+		}
+		if !slices.Contains(muted, t) {
+			muted = append(muted, t)
+		}
+	}
+	return muted, nil
+}
+
+// HandleListNotifications returns the current user's notifications, newest first
+func HandleListNotifications(repo *repository.NotificationRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		pagination := parsePagination(c, defaultPageLimit)
+
+		notifications, total, unread, err := repo.ListByUser(c.Context(), user.ID, pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list notifications")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve notifications")
+		}
+
+		return c.JSON(notificationsResponse{
+			PaginatedResponse: Paginate(notifications, total, pagination),
+			UnreadCount:       unread,
+		})
+	}
+}
+
+// HandleMarkNotificationRead marks one of the current user's notifications read
+func HandleMarkNotificationRead(repo *repository.NotificationRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		found, err := repo.MarkRead(c.Context(), user.ID, objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("notification_id", objectID).Error("Failed to mark notification read")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update notification")
+		}
+		if !found {
+			return fiber.NewError(fiber.StatusNotFound, "Notification not found")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// HandleMarkAllNotificationsRead marks every notification of the current user read
+func HandleMarkAllNotificationsRead(repo *repository.NotificationRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		updated, err := repo.MarkAllRead(c.Context(), user.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to mark notifications read")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update notifications")
+		}
+
+		return c.JSON(fiber.Map{"updated": updated})
+	}
+}
+
+// HandleGetNotificationPreferences returns the notification types the current user muted
+func HandleGetNotificationPreferences(userRepo *repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		user, err = userRepo.GetByID(c.Context(), user.ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get user")
+		}
+		if user == nil {
+			return errUserNotFound
+		}
+
+		muted := user.MutedNotifications
+		if muted == nil {
+			muted = []string{}
+		}
+		return c.JSON(fiber.Map{
+			"muted": muted,
+			"types": models.NotificationTypes,
+		})
+	}
+}
+
+// HandleUpdateNotificationPreferences replaces the notification types the current user muted
+func HandleUpdateNotificationPreferences(userRepo *repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			Muted []string `json:"muted"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		muted, err := normalizeMutedNotifications(req.Muted)
+		if err != nil {
+			return err
+		}
+
+		found, err := userRepo.SetMutedNotifications(c.Context(), user.ID, muted)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to update notification preferences")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update notification preferences")
+		}
+		if !found {
+			return errUserNotFound
+		}
+
+		return c.JSON(fiber.Map{
+			"muted": muted,
+			"types": models.NotificationTypes,
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestNormalizeMutedNotifications(t *testing.T) {
+	muted, err := normalizeMutedNotifications([]string{" Course_Published ", models.NotificationSubscriptionRenewed, "course_published"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{models.NotificationCoursePublished, models.NotificationSubscriptionRenewed}
+	if !slices.Equal(muted, want) {
+		t.Fatalf("expected %v, got %v", want, muted)
+	}
+
+	muted, err = normalizeMutedNotifications(nil)
+	if err != nil || muted == nil || len(muted) != 0 {
+		t.Fatalf("expected an empty list, got %v (%v)", muted, err)
+	}
+
+	if _, err := normalizeMutedNotifications([]string{"newsletter"}); err == nil {
+		t.Fatal("expected an unknown notification type to be rejected")
+	}
+}
+
+func TestNotificationsResponseJSON(t *testing.T) {
+	resp := notificationsResponse{
+		PaginatedResponse: Paginate([]*models.Notification{}, 12, Pagination{Page: 1, Limit: 10}),
+		UnreadCount:       3,
+	}
+
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(encoded, &body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body["unread_count"] != float64(3) || body["total"] != float64(12) || body["has_next"] != true {
+		t.Fatalf("expected the page fields alongside the unread count, got %s", encoded)
+	}
+}
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"cource-api/internal/mailer"
+	"cource-api/internal/models"
 	"cource-api/internal/repository"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // HandleVerifyOTP verifies the OTP for registration
@@ -16,7 +21,7 @@ func HandleVerifyOTP(otpRepo *repository.OTPRepository, userRepo *repository.Use
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		// Validate email
@@ -25,9 +30,9 @@ func HandleVerifyOTP(otpRepo *repository.OTPRepository, userRepo *repository.Use
 		}
 
 		// Get latest OTP
-		otp, err := otpRepo.GetLatestOTP(c.Context(), req.Email, "registration")
+		otp, err := otpRepo.GetLatestOTP(c.Context(), req.Email, models.OTPTypeRegistration)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to get OTP")
+			log(c).WithError(err).Error("Failed to get OTP")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify OTP")
 		}
 
@@ -42,25 +47,25 @@ func HandleVerifyOTP(otpRepo *repository.OTPRepository, userRepo *repository.Use
 
 		// Mark OTP as used
 		if err := otpRepo.MarkAsUsed(c.Context(), otp.ID); err != nil {
-			logrus.WithError(err).Error("Failed to mark OTP as used")
+			log(c).WithError(err).Error("Failed to mark OTP as used")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify OTP")
 		}
 
 		// Get user by email
 		user, err := userRepo.GetByEmail(c.Context(), req.Email)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to get user")
+			log(c).WithError(err).Error("Failed to get user")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify user")
 		}
 
 		if user == nil {
-			return fiber.NewError(fiber.StatusNotFound, "User not found")
+			return errUserNotFound
 		}
 
 		// Update user verification status
 		user.IsVerified = true
 		if err := userRepo.Update(c.Context(), user); err != nil {
-			logrus.WithError(err).Error("Failed to update user verification status")
+			log(c).WithError(err).Error("Failed to update user verification status")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify user")
 		}
 
@@ -69,3 +74,192 @@ func HandleVerifyOTP(otpRepo *repository.OTPRepository, userRepo *repository.Use
 		})
 	}
 }
+
+const (
+	// otpResendCooldown is the minimum time between two OTPs for the same email and type
+	otpResendCooldown = 60 * time.Second
+	// otpHourlyLimit caps how many OTPs can be sent for the same email and type per otpSendWindow
+	otpHourlyLimit = 5
+	otpSendWindow  = time.Hour
+)
+
+// otpCooldownRemaining returns the whole seconds left before another OTP may be
+// sent, given when the last one was created. It returns 0 once resending is allowed.
+func otpCooldownRemaining(lastCreatedAt, now time.Time) int {
+	return secondsUntil(lastCreatedAt.Add(otpResendCooldown), now)
+}
+
+// otpHourlyLimitRemaining returns the whole seconds left before the oldest OTP sent
+// within the hour leaves the window, making room for another send
+func otpHourlyLimitRemaining(oldestSentAt, now time.Time) int {
+	return secondsUntil(oldestSentAt.Add(otpSendWindow), now)
+}
+
+// secondsUntil returns the whole seconds from now until t, or 0 once t has passed
+func secondsUntil(t, now time.Time) int {
+	remaining := t.Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	// Round up so clients never retry a fraction of a second too early
+	return int((remaining + time.Second - 1) / time.Second)
+}
+
+// otpRetryLater rejects an OTP request with a 429 telling the client when to retry
+func otpRetryLater(c *fiber.Ctx, message string, retryAfter int) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return &APIError{
+		Status:     fiber.StatusTooManyRequests,
+		Code:       "otp_rate_limited",
+		Message:    message,
+		RetryAfter: retryAfter,
+	}
+}
+
+// otpSendRetryAfter checks the cooldown and hourly limit for sending an email another OTP
+// of a type. It returns the whole seconds to wait and why, or 0 when a code may be sent.
+func otpSendRetryAfter(ctx context.Context, otpRepo *repository.OTPRepository, email, otpType string) (int, string, error) {
+	lastSentAt, err := otpRepo.LastSendAt(ctx, email, otpType)
+	if err != nil {
+		return 0, "", err
+	}
+	if lastSentAt != nil {
+		if retryAfter := otpCooldownRemaining(*lastSentAt, time.Now().UTC()); retryAfter > 0 {
+			return retryAfter, "Please wait before requesting another code", nil
+		}
+	}
+
+	windowStart := time.Now().UTC().Add(-otpSendWindow)
+	sentLastHour, err := otpRepo.CountRecent(ctx, email, otpType, windowStart)
+	if err != nil {
+		return 0, "", err
+	}
+	if sentLastHour < otpHourlyLimit {
+		return 0, "", nil
+	}
+
+	oldest, err := otpRepo.OldestSendSince(ctx, email, otpType, windowStart)
+	if err != nil {
+		return 0, "", err
+	}
+	// The oldest send can leave the window between the two queries
+	retryAfter := 1
+	if oldest != nil {
+		retryAfter = max(otpHourlyLimitRemaining(*oldest, time.Now().UTC()), 1)
+	}
+	return retryAfter, "Too many codes requested, please try again later", nil
+}
+
+// HandleResendOTP sends a new OTP of the requested type, enforcing a cooldown between
+// requests. Requests for ineligible emails are limited and answered the same way.
+func HandleResendOTP(otpRepo *repository.OTPRepository, userRepo *repository.UserRepository, m mailer.Mailer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			Email string `json:"email"`
+			Type  string `json:"type"`
+		}
+
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		// Validate email
+		if err := validateEmail(req.Email); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		if req.Type != models.OTPTypeRegistration && req.Type != models.OTPTypeReset {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid OTP type")
+		}
+
+		// Limits are checked against every request, which is recorded whether or not the
+		// email has an account so the 429 does not reveal which ones do
+		retryAfter, reason, err := otpSendRetryAfter(c.Context(), otpRepo, req.Email, req.Type)
+		if err != nil {
+			log(c).WithError(err).Error("Failed to check OTP send limits")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to resend OTP")
+		}
+		if retryAfter > 0 {
+			return otpRetryLater(c, reason, retryAfter)
+		}
+
+		// Only send when the request makes sense for the account, but always
+		// return the same response to prevent email enumeration
+		user, err := userRepo.GetByEmail(c.Context(), req.Email)
+		if err != nil {
+			log(c).WithError(err).WithField("email", req.Email).Error("Failed to get user during OTP resend")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to resend OTP")
+		}
+
+		if user != nil && (req.Type == models.OTPTypeReset || !user.IsVerified) {
+			if _, err := GenerateAndSaveOTP(c.Context(), otpRepo, m, req.Email, req.Type); err != nil {
+				log(c).WithError(err).WithField("email", req.Email).Error("Failed to generate OTP during resend")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to resend OTP")
+			}
+		} else if err := otpRepo.RecordSend(c.Context(), req.Email, req.Type); err != nil {
+			log(c).WithError(err).WithField("email", req.Email).Error("Failed to record OTP request")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to resend OTP")
+		}
+
+		return c.JSON(fiber.Map{
+			"message":             "If your email is eligible, a new code has been sent",
+			"retry_after_seconds": int(otpResendCooldown / time.Second),
+		})
+	}
+}
+
+// otpDebugView is an OTP record as shown to admins, without the code
+type otpDebugView struct {
+	ID        primitive.ObjectID `json:"id"`
+	Email     string             `json:"email"`
+	Type      string             `json:"type"`
+	CreatedAt time.Time          `json:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	Used      bool               `json:"used"`
+	Expired   bool               `json:"expired"`
+}
+
+// redactOTPs converts OTP records to views that never carry the code
+func redactOTPs(otps []*models.OTP, now time.Time) []otpDebugView {
+	views := make([]otpDebugView, 0, len(otps))
+	for _, otp := range otps {
+		views = append(views, otpDebugView{
+			ID:        otp.ID,
+			Email:     otp.Email,
+			Type:      otp.Type,
+			CreatedAt: otp.CreatedAt,
+			ExpiresAt: otp.ExpiresAt,
+			Used:      otp.Used,
+			Expired:   !now.Before(otp.ExpiresAt),
+		})
+	}
+	return views
+}
+
+// HandleAdminListOTPs lists recent OTP records for an email so support can check
+// delivery issues (admin only). Codes are never returned.
+func HandleAdminListOTPs(otpRepo *repository.OTPRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		email := c.Query("email")
+		if err := validateEmail(email); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		otpType := c.Query("type")
+		switch otpType {
+		case "", models.OTPTypeRegistration, models.OTPTypeReset, models.OTPTypeLogin:
+		default:
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid OTP type")
+		}
+
+		otps, err := otpRepo.ListRecent(c.Context(), email, otpType, parsePagination(c, 20).Limit)
+		if err != nil {
+			log(c).WithError(err).WithField("email", email).Error("Failed to list OTPs")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list OTPs")
+		}
+
+		return c.JSON(fiber.Map{
+			"otps": redactOTPs(otps, time.Now().UTC()),
+		})
+	}
+}
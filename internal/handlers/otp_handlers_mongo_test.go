@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHandleAdminListOTPsFiltersByType(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	otpRepo := repository.NewOTPRepository()
+
+	for _, otpType := range []string{models.OTPTypeRegistration, models.OTPTypeReset, models.OTPTypeLogin} {
+		if err := otpRepo.Create(ctx, newOTP("jane@example.com", otpType, "123456", time.Now())); err != nil {
+			t.Fatalf("failed to seed %s OTP: %v", otpType, err)
+		}
+	}
+
+	app := fiber.New()
+	app.Get("/otps", HandleAdminListOTPs(otpRepo))
+
+	cases := []struct {
+		otpType string
+		status  int
+		records int
+	}{
+		{"", fiber.StatusOK, 3},
+		{models.OTPTypeLogin, fiber.StatusOK, 1},
+		{models.OTPTypeReset, fiber.StatusOK, 1},
+		{"magic", fiber.StatusBadRequest, 0},
+	}
+	for _, tc := range cases {
+		resp, err := app.Test(httptest.NewRequest("GET", "/otps?email=jane@example.com&type="+tc.otpType, nil))
+		if err != nil {
+			t.Fatalf("type %q: request failed: %v", tc.otpType, err)
+		}
+		if resp.StatusCode != tc.status {
+			t.Fatalf("type %q: expected %d, got %d", tc.otpType, tc.status, resp.StatusCode)
+		}
+		if tc.status != fiber.StatusOK {
+			continue
+		}
+
+		var body struct {
+			OTPs []otpDebugView `json:"otps"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("type %q: failed to decode body: %v", tc.otpType, err)
+		}
+		if len(body.OTPs) != tc.records {
+			t.Fatalf("type %q: expected %d records, got %d", tc.otpType, tc.records, len(body.OTPs))
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestOTPCooldownRemainingDecreases(t *testing.T) {
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		elapsed time.Duration
+		want    int
+	}{
+		{0, 60},
+		{500 * time.Millisecond, 60},
+		{1 * time.Second, 59},
+		{30 * time.Second, 30},
+		{59*time.Second + 500*time.Millisecond, 1},
+		{60 * time.Second, 0},
+		{5 * time.Minute, 0},
+	}
+
+	for _, tc := range cases {
+		got := otpCooldownRemaining(created, created.Add(tc.elapsed))
+		if got != tc.want {
+			t.Errorf("after %v expected %d seconds remaining, got %d", tc.elapsed, tc.want, got)
+		}
+	}
+}
+
+func TestOTPHourlyLimitRemaining(t *testing.T) {
+	oldest := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := otpHourlyLimitRemaining(oldest, oldest.Add(45*time.Minute)); got != 15*60 {
+		t.Errorf("expected 900 seconds remaining, got %d", got)
+	}
+	if got := otpHourlyLimitRemaining(oldest, oldest.Add(time.Hour)); got != 0 {
+		t.Errorf("expected no wait once the oldest send left the window, got %d", got)
+	}
+}
+
+func TestRedactOTPsNeverReturnsCode(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	otps := []*models.OTP{
+		{Email: "jane@example.com", Code: "482915", Type: "registration", CreatedAt: now.Add(-time.Minute), ExpiresAt: now.Add(14 * time.Minute)},
+		{Email: "jane@example.com", Code: "730264", Type: "reset", CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-45 * time.Minute), Used: true},
+	}
+
+	views := redactOTPs(otps, now)
+	if len(views) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(views))
+	}
+	if views[0].Expired || !views[1].Expired {
+		t.Fatalf("unexpected expiry flags: %+v", views)
+	}
+
+	data, err := json.Marshal(fiber.Map{"otps": views})
+	if err != nil {
+		t.Fatalf("failed to encode OTPs: %v", err)
+	}
+	for _, otp := range otps {
+		if strings.Contains(string(data), otp.Code) {
+			t.Fatalf("response leaked OTP code %s: %s", otp.Code, data)
+		}
+	}
+	if strings.Contains(string(data), `"code"`) {
+		t.Fatalf("response contains a code field: %s", data)
+	}
+}
+
+func TestNewOTPExpiryInNonUTCZone(t *testing.T) {
+	original := time.Local
+	time.Local = time.FixedZone("IST", 5*60*60+30*60)
+	defer func() { time.Local = original }()
+
+	issued := time.Now()
+	otp := newOTP("jane@example.com", "registration", "123456", issued)
+
+	if otp.CreatedAt.Location() != time.UTC || otp.ExpiresAt.Location() != time.UTC {
+		t.Fatalf("expected UTC timestamps, got %v and %v", otp.CreatedAt.Location(), otp.ExpiresAt.Location())
+	}
+	if got := otp.ExpiresAt.Sub(otp.CreatedAt); got != otpValidity {
+		t.Fatalf("expected validity of %v, got %v", otpValidity, got)
+	}
+	if !otp.ExpiresAt.After(issued.Add(otpValidity - time.Minute)) {
+		t.Fatal("expected OTP to still be valid a minute before expiry")
+	}
+	if otp.ExpiresAt.After(issued.Add(otpValidity)) {
+		t.Fatal("expected OTP to be expired once the validity has passed")
+	}
+	if remaining := otpCooldownRemaining(otp.CreatedAt, issued.Add(30*time.Second)); remaining != 30 {
+		t.Fatalf("expected 30 seconds of cooldown, got %d", remaining)
+	}
+}
+
+func TestOTPRetryLaterResponse(t *testing.T) {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			status, body := ErrorResponse(err)
+			return c.Status(status).JSON(body)
+		},
+	})
+	app.Post("/otp", func(c *fiber.Ctx) error {
+		return otpRetryLater(c, "Please wait before requesting another code", 42)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/otp", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusTooManyRequests || resp.Header.Get(fiber.HeaderRetryAfter) != "42" {
+		t.Fatalf("expected a 429 with Retry-After 42, got %d %q", resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if body["code"] != "otp_rate_limited" || body["retry_after_seconds"] != float64(42) {
+		t.Fatalf("unexpected body: %v", body)
+	}
+}
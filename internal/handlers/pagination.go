@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// defaultPageLimit is the page size when none or an invalid one is requested
+	defaultPageLimit = 10
+	// maxPageLimit caps the page size a client can request
+	maxPageLimit = 100
+)
+
+// Pagination is the page a list endpoint was asked for
+type Pagination struct {
+	Page  int64
+	Limit int64
+}
+
+// parsePagination reads the page and limit query parameters. An invalid page falls back
+// to the first one, an invalid limit to defaultLimit and a limit over the maximum is
+// capped.
+func parsePagination(c *fiber.Ctx, defaultLimit int64) Pagination {
+	page, err := strconv.ParseInt(c.Query("page"), 10, 64)
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.ParseInt(c.Query("limit"), 10, 64)
+	if err != nil || limit < 1 {
+		limit = defaultLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return Pagination{Page: page, Limit: limit}
+}
+
+// PaginatedResponse is the body of the list endpoints
+type PaginatedResponse struct {
+	Data       interface{} `json:"data"`
+	Total      int64       `json:"total"`
+	Page       int64       `json:"page"`
+	Limit      int64       `json:"limit"`
+	TotalPages int64       `json:"total_pages"`
+	HasNext    bool        `json:"has_next"`
+}
+
+// Paginate builds the response for one page of data out of total results
+func Paginate(data interface{}, total int64, p Pagination) PaginatedResponse {
+	var totalPages int64
+	if p.Limit > 0 {
+		totalPages = (total + p.Limit - 1) / p.Limit
+	}
+	return PaginatedResponse{
+		Data:       data,
+		Total:      total,
+		Page:       p.Page,
+		Limit:      p.Limit,
+		TotalPages: totalPages,
+		HasNext:    p.Page < totalPages,
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Pagination
+	}{
+		{"", Pagination{Page: 1, Limit: 10}},
+		{"?page=3&limit=25", Pagination{Page: 3, Limit: 25}},
+		{"?page=0&limit=-5", Pagination{Page: 1, Limit: 10}},
+		{"?page=abc&limit=xyz", Pagination{Page: 1, Limit: 10}},
+		{"?limit=500", Pagination{Page: 1, Limit: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got Pagination
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				got = parsePagination(c, defaultPageLimit)
+				return nil
+			})
+			if _, err := app.Test(httptest.NewRequest("GET", "/"+tt.query, nil)); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		total      int64
+		page       int64
+		totalPages int64
+		hasNext    bool
+	}{
+		{0, 1, 0, false},
+		{10, 1, 1, false},
+		{11, 1, 2, true},
+		{25, 2, 3, true},
+		{25, 3, 3, false},
+	}
+
+	for _, tt := range tests {
+		got := Paginate([]string{}, tt.total, Pagination{Page: tt.page, Limit: 10})
+		if got.TotalPages != tt.totalPages || got.HasNext != tt.hasNext {
+			t.Errorf("total %d page %d: expected %d pages and has_next %v, got %d and %v",
+				tt.total, tt.page, tt.totalPages, tt.hasNext, got.TotalPages, got.HasNext)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// parseObjectID reads a route parameter and converts it to an ObjectID, returning
+// a standardized 400 error when it is missing or malformed
+func parseObjectID(c *fiber.Ctx, param string) (primitive.ObjectID, error) {
+	return toObjectID(c.Params(param), param)
+}
+
+// toObjectID converts a value from the query string or request body to an ObjectID,
+// naming the offending field in the standardized 400 error
+func toObjectID(value, field string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(value)
+	if err != nil {
+		return primitive.NilObjectID, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid %s: must be a valid ObjectID", field))
+	}
+	return objectID, nil
+}
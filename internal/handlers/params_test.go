@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMalformedObjectIDUniformError(t *testing.T) {
+	app := fiber.New()
+	app.Get("/courses/:id", HandleGetCourse(nil, nil, nil))
+	app.Get("/videos/:id", HandleGetVideo(nil, nil, nil, nil))
+	app.Get("/payments/:id", HandleGetPayment(nil))
+	app.Get("/products/:id", HandleGetProduct(nil))
+	app.Get("/subscriptions/:id", HandleGetSubscription(nil))
+	app.Delete("/admin/users/:id", HandleDeleteUser(nil))
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/courses/not-an-id"},
+		{"GET", "/videos/not-an-id"},
+		{"GET", "/payments/not-an-id"},
+		{"GET", "/products/not-an-id"},
+		{"GET", "/subscriptions/not-an-id"},
+		{"DELETE", "/admin/users/not-an-id"},
+	}
+
+	for _, route := range routes {
+		resp, err := app.Test(httptest.NewRequest(route.method, route.path, nil))
+		if err != nil {
+			t.Fatalf("%s %s: request failed: %v", route.method, route.path, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s %s: expected status 400, got %d", route.method, route.path, resp.StatusCode)
+		}
+		if string(body) != "Invalid id: must be a valid ObjectID" {
+			t.Errorf("%s %s: unexpected error body %q", route.method, route.path, body)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"cource-api/internal/config"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/checkout/session"
+	"github.com/stripe/stripe-go/v76/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment gateways a checkout can be made with, stored as Payment.Gateway
+const (
+	gatewayStripe   = "stripe"
+	gatewayPayPal   = "paypal"
+	gatewayRazorpay = "razorpay"
+)
+
+// CheckoutRequest is a subscription checkout to start with a payment gateway
+type CheckoutRequest struct {
+	User     *models.User
+	PlanType string
+	// Amount is the price of one plan period in the smallest currency unit
+	Amount     int64
+	Currency   string
+	SuccessURL string
+	CancelURL  string
+	TrialDays  int
+	// Coupon has already been checked to be redeemable, nil when none was given
+	Coupon *models.Coupon
+}
+
+// Checkout is a checkout started with a gateway, the client completes it at URL or, for
+// gateways with a client side checkout, by opening it with KeyID
+type Checkout struct {
+	SessionID string
+	URL       string
+	KeyID     string
+}
+
+// GatewayEvent is a webhook notification read by a gateway
+type GatewayEvent struct {
+	ID   string
+	Type string
+	// Data is the raw object the event is about
+	Data json.RawMessage
+}
+
+// PaymentGateway starts checkouts with a payment provider and reads its webhooks.
+// Errors that are *fiber.Error are meant to be returned to the client as is.
+type PaymentGateway interface {
+	CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error)
+	// VerifyWebhook checks the payload was sent by the provider, header looks up the
+	// headers of the webhook request
+	VerifyWebhook(ctx context.Context, payload []byte, header func(string) string) error
+	ParseEvent(payload []byte) (*GatewayEvent, error)
+}
+
+// checkoutGatewayName returns the gateway a checkout in region is made with. Checkouts
+// in India go through Razorpay when it is configured, unless another gateway was asked for.
+func checkoutGatewayName(requested, region string) string {
+	if strings.TrimSpace(requested) == "" &&
+		strings.EqualFold(strings.TrimSpace(region), razorpayRegion) &&
+		config.AppConfig.RazorpayKeyID != "" {
+		return gatewayRazorpay
+	}
+	return requested
+}
+
+// newPaymentGateway returns the gateway a checkout asked for, Stripe when none was given
+func newPaymentGateway(name string, couponRepo *repository.CouponRepository) (PaymentGateway, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", gatewayStripe:
+		return &stripeGateway{couponRepo: couponRepo}, nil
+	case gatewayPayPal:
+		return newPayPalGateway(), nil
+	case gatewayRazorpay:
+		return newRazorpayGateway(), nil
+	default:
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Unsupported payment gateway")
+	}
+}
+
+// verifyWebhookEvent checks a webhook request was sent by the gateway and reads its event
+func verifyWebhookEvent(c *fiber.Ctx, gateway PaymentGateway, payload []byte) (*GatewayEvent, error) {
+	header := func(key string) string { return c.Get(key) }
+	if err := gateway.VerifyWebhook(c.Context(), payload, header); err != nil {
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			return nil, err
+		}
+		log(c).WithError(err).Error("Invalid webhook signature")
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid webhook signature")
+	}
+
+	event, err := gateway.ParseEvent(payload)
+	if err != nil {
+		log(c).WithError(err).Error("Invalid webhook event")
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid webhook signature")
+	}
+	return event, nil
+}
+
+// orderMetadata is what a checkout through a gateway that charges once needs to know
+// when the gateway confirms the payment. It travels with the gateway order.
+type orderMetadata struct {
+	UserID     primitive.ObjectID
+	PlanType   string
+	CouponID   string
+	CouponCode string
+}
+
+func newOrderMetadata(req *CheckoutRequest) orderMetadata {
+	metadata := orderMetadata{UserID: req.User.ID, PlanType: req.PlanType}
+	if req.Coupon != nil {
+		metadata.CouponID = req.Coupon.ID.Hex()
+		metadata.CouponCode = req.Coupon.Code
+	}
+	return metadata
+}
+
+// encode packs the metadata into a single string for gateways with one free text field
+func (m orderMetadata) encode() string {
+	return strings.Join([]string{m.UserID.Hex(), m.PlanType, m.CouponID, m.CouponCode}, ":")
+}
+
+func decodeOrderMetadata(encoded string) (orderMetadata, error) {
+	parts := strings.Split(encoded, ":")
+	if len(parts) != 4 {
+		return orderMetadata{}, fmt.Errorf("invalid order metadata %q", encoded)
+	}
+	return orderMetadataFromNotes(map[string]string{
+		"user_id":     parts[0],
+		"plan_type":   parts[1],
+		"coupon_id":   parts[2],
+		"coupon_code": parts[3],
+	})
+}
+
+// notes returns the metadata as key value pairs for gateways that take them
+func (m orderMetadata) notes() map[string]string {
+	return map[string]string{
+		"user_id":     m.UserID.Hex(),
+		"plan_type":   m.PlanType,
+		"coupon_id":   m.CouponID,
+		"coupon_code": m.CouponCode,
+	}
+}
+
+func orderMetadataFromNotes(notes map[string]string) (orderMetadata, error) {
+	userID, err := primitive.ObjectIDFromHex(notes["user_id"])
+	if err != nil {
+		return orderMetadata{}, err
+	}
+	return orderMetadata{
+		UserID:     userID,
+		PlanType:   notes["plan_type"],
+		CouponID:   notes["coupon_id"],
+		CouponCode: notes["coupon_code"],
+	}, nil
+}
+
+// discountedAmount applies a coupon to an amount in the smallest currency unit, for
+// gateways that have no discounts of their own
+func discountedAmount(amount int64, coupon *models.Coupon) int64 {
+	if coupon == nil {
+		return amount
+	}
+	if coupon.PercentOff != 0 {
+		amount -= int64(math.Round(float64(amount) * coupon.PercentOff / 100))
+	} else {
+		amount -= coupon.AmountOff
+	}
+	if amount < 0 {
+		return 0
+	}
+	return amount
+}
+
+// stripeGateway takes payments through Stripe Checkout subscriptions
+type stripeGateway struct {
+	couponRepo *repository.CouponRepository
+}
+
+// CreateCheckout creates a Stripe customer for the user if needed and a subscription
+// checkout session for the plan, with the coupon as a discount
+func (g *stripeGateway) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	if config.AppConfig.StripeKey == "" {
+		logrus.Error("Stripe API key is not configured")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Payment system is not properly configured")
+	}
+	stripe.Key = config.AppConfig.StripeKey
+
+	stripeCustomer, err := getOrCreateStripeCustomer(req.User)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionParams := &stripe.CheckoutSessionParams{
+		Customer: stripe.String(stripeCustomer.ID),
+		PaymentMethodTypes: stripe.StringSlice([]string{
+			"card",
+		}),
+		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+					Currency: stripe.String(req.Currency),
+					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+						Name: stripe.String("Course Subscription"),
+					},
+					UnitAmount: stripe.Int64(req.Amount),
+					Recurring: &stripe.CheckoutSessionLineItemPriceDataRecurringParams{
+						Interval: stripe.String(planToStripeInterval(req.PlanType)),
+					},
+				},
+				Quantity: stripe.Int64(1),
+			},
+		},
+		SuccessURL: stripe.String(req.SuccessURL),
+		CancelURL:  stripe.String(req.CancelURL),
+	}
+	sessionParams.AddMetadata("plan_type", req.PlanType)
+
+	// The user on the subscription lets invoice events find the local subscription
+	sessionParams.SubscriptionData = &stripe.CheckoutSessionSubscriptionDataParams{
+		Metadata: map[string]string{"user_id": req.User.ID.Hex()},
+	}
+	// The trial is marked used from the webhook once Stripe creates the subscription
+	if req.TrialDays > 0 {
+		sessionParams.SubscriptionData.TrialPeriodDays = stripe.Int64(int64(req.TrialDays))
+	}
+
+	if req.Coupon != nil {
+		stripeCouponID, err := ensureStripeCoupon(ctx, g.couponRepo, req.Coupon)
+		if err != nil {
+			logrus.WithError(err).WithField("code", req.Coupon.Code).Error("Failed to create Stripe coupon")
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to apply coupon")
+		}
+		sessionParams.Discounts = []*stripe.CheckoutSessionDiscountParams{
+			{Coupon: stripe.String(stripeCouponID)},
+		}
+		// Redemptions are counted from the webhook once the checkout completes
+		sessionParams.AddMetadata("coupon_id", req.Coupon.ID.Hex())
+		sessionParams.AddMetadata("coupon_code", req.Coupon.Code)
+	}
+
+	created, err := session.New(sessionParams)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkout{SessionID: created.ID, URL: created.URL}, nil
+}
+
+// VerifyWebhook checks the Stripe-Signature header against the webhook secret. Webhooks
+// signed longer ago than the configured tolerance are rejected so a captured request
+// cannot be replayed later.
+func (g *stripeGateway) VerifyWebhook(ctx context.Context, payload []byte, header func(string) string) error {
+	if config.AppConfig.StripeWebhook == "" {
+		logrus.Error("Stripe webhook secret is not configured")
+		return fiber.NewError(fiber.StatusInternalServerError, "Webhook configuration is missing")
+	}
+
+	tolerance := config.AppConfig.StripeWebhookTolerance
+	if tolerance <= 0 {
+		tolerance = webhook.DefaultTolerance
+	}
+	err := webhook.ValidatePayloadWithTolerance(payload, header("Stripe-Signature"), config.AppConfig.StripeWebhook, tolerance)
+	if errors.Is(err, webhook.ErrTooOld) {
+		logrus.WithField("tolerance", tolerance.String()).Warn("Rejected Stripe webhook outside the timestamp tolerance")
+		return fiber.NewError(fiber.StatusBadRequest, "Webhook timestamp is outside the allowed tolerance")
+	}
+	return err
+}
+
+// ParseEvent reads a Stripe event, rejecting events of another API version than the
+// one stripe-go decodes
+func (g *stripeGateway) ParseEvent(payload []byte) (*GatewayEvent, error) {
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook body json: %w", err)
+	}
+	if event.APIVersion != stripe.APIVersion {
+		return nil, fmt.Errorf("received event with API version %s, expected %s", event.APIVersion, stripe.APIVersion)
+	}
+
+	gatewayEvent := &GatewayEvent{ID: event.ID, Type: string(event.Type)}
+	if event.Data != nil {
+		gatewayEvent.Data = event.Data.Raw
+	}
+	return gatewayEvent, nil
+}
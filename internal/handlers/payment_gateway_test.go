@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cource-api/internal/config"
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewPaymentGateway(t *testing.T) {
+	tests := []struct {
+		gateway string
+		paypal  bool
+	}{
+		{"", false},
+		{"stripe", false},
+		{" PayPal ", true},
+	}
+
+	for _, tt := range tests {
+		gateway, err := newPaymentGateway(tt.gateway, nil)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.gateway, err)
+		}
+		if _, ok := gateway.(*payPalGateway); ok != tt.paypal {
+			t.Fatalf("%q: got gateway %T", tt.gateway, gateway)
+		}
+	}
+
+	if _, err := newPaymentGateway("bitcoin", nil); err == nil {
+		t.Fatal("expected an unknown gateway to be rejected")
+	}
+}
+
+func TestStripeGatewayParseEvent(t *testing.T) {
+	g := &stripeGateway{}
+	payload := `{"id": "evt_1", "type": "charge.refunded", "api_version": "` + stripe.APIVersion + `", "data": {"object": {"id": "ch_1"}}}`
+
+	event, err := g.ParseEvent([]byte(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != "charge.refunded" || string(event.Data) != `{"id": "ch_1"}` {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	if _, err := g.ParseEvent([]byte(`{"id": "evt_2", "type": "charge.refunded", "api_version": "2019-01-01"}`)); err == nil {
+		t.Fatal("expected an event of another API version to be rejected")
+	}
+}
+
+func TestPayPalAmounts(t *testing.T) {
+	if got := formatPayPalAmount(1999, "usd"); got != "19.99" {
+		t.Fatalf("expected 19.99, got %s", got)
+	}
+	if got := formatPayPalAmount(1500, "JPY"); got != "1500" {
+		t.Fatalf("expected 1500, got %s", got)
+	}
+
+	amount, err := parsePayPalAmount(payPalAmount{CurrencyCode: "EUR", Value: "10.05"})
+	if err != nil || amount != 1005 {
+		t.Fatalf("expected 1005, got %d (%v)", amount, err)
+	}
+	amount, err = parsePayPalAmount(payPalAmount{CurrencyCode: "JPY", Value: "1500"})
+	if err != nil || amount != 1500 {
+		t.Fatalf("expected 1500, got %d (%v)", amount, err)
+	}
+}
+
+func TestDiscountedAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		coupon *models.Coupon
+		want   int64
+	}{
+		{"no coupon", nil, 1000},
+		{"percent off", &models.Coupon{PercentOff: 25}, 750},
+		{"amount off", &models.Coupon{AmountOff: 300}, 700},
+		{"more than the price", &models.Coupon{AmountOff: 5000}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discountedAmount(1000, tt.coupon); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPaymentFromPayPalCapture(t *testing.T) {
+	userID := primitive.NewObjectID()
+	metadata := orderMetadata{UserID: userID, PlanType: "yearly", CouponID: primitive.NewObjectID().Hex(), CouponCode: "SPRING25"}
+	capture := &payPalCapture{ID: "CAP-1", Amount: payPalAmount{CurrencyCode: "USD", Value: "75.00"}, CustomID: metadata.encode()}
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	payment, decoded, err := paymentFromPayPalCapture(capture, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded != metadata {
+		t.Fatalf("expected metadata %+v, got %+v", metadata, decoded)
+	}
+	if payment.Gateway != gatewayPayPal || payment.UserID != userID || payment.TransactionID != "CAP-1" ||
+		payment.Amount != 7500 || payment.Currency != "usd" || payment.Plan != "yearly" || payment.CouponCode != "SPRING25" {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+
+	subscription := oneOffSubscription(payment, "ORDER-1", now)
+	if subscription.AutoRenew || !subscription.CurrentPeriodEnd.Equal(now.AddDate(1, 0, 0)) || subscription.SubscriptionID != "ORDER-1" {
+		t.Fatalf("unexpected subscription %+v", subscription)
+	}
+
+	capture.CustomID = "not-a-user"
+	if _, _, err := paymentFromPayPalCapture(capture, now); err == nil {
+		t.Fatal("expected a capture without a user to be rejected")
+	}
+}
+
+func TestPayPalGatewayCreateCheckout(t *testing.T) {
+	var order map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "client" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"access_token": "token"}`))
+		case "/v2/checkout/orders":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&order)
+			w.Write([]byte(`{"id": "ORDER-1", "status": "CREATED", "links": [
+				{"href": "https://api.paypal.test/v2/checkout/orders/ORDER-1", "rel": "self"},
+				{"href": "https://paypal.test/checkoutnow?token=ORDER-1", "rel": "approve"}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	original := config.AppConfig
+	defer func() { config.AppConfig = original }()
+	config.AppConfig.PayPalAPIURL = server.URL
+	config.AppConfig.PayPalClientID = "client"
+	config.AppConfig.PayPalSecret = "secret"
+
+	checkout, err := newPayPalGateway().CreateCheckout(context.Background(), &CheckoutRequest{
+		User:       &models.User{ID: primitive.NewObjectID()},
+		PlanType:   "monthly",
+		Amount:     1000,
+		Currency:   "usd",
+		SuccessURL: "https://app.example.com/success",
+		CancelURL:  "https://app.example.com/cancel",
+		Coupon:     &models.Coupon{ID: primitive.NewObjectID(), Code: "TENOFF", PercentOff: 10},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checkout.SessionID != "ORDER-1" || checkout.URL != "https://paypal.test/checkoutnow?token=ORDER-1" {
+		t.Fatalf("unexpected checkout %+v", checkout)
+	}
+
+	unit := order["purchase_units"].([]interface{})[0].(map[string]interface{})
+	amount := unit["amount"].(map[string]interface{})
+	if amount["currency_code"] != "USD" || amount["value"] != "9.00" {
+		t.Fatalf("expected the discounted amount in USD, got %v", amount)
+	}
+}
+
+func TestStripeGatewayVerifyWebhookTolerance(t *testing.T) {
+	original := config.AppConfig
+	defer func() { config.AppConfig = original }()
+	config.AppConfig.StripeWebhook = "whsec_test"
+	config.AppConfig.StripeWebhookTolerance = time.Minute
+
+	payload := []byte(`{"id": "evt_1"}`)
+	signed := func(at time.Time) func(string) string {
+		header := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+			Payload:   payload,
+			Secret:    "whsec_test",
+			Timestamp: at,
+		}).Header
+		return func(string) string { return header }
+	}
+	g := &stripeGateway{}
+
+	if err := g.VerifyWebhook(context.Background(), payload, signed(time.Now().Add(-30*time.Second))); err != nil {
+		t.Fatalf("expected a recent webhook to verify, got %v", err)
+	}
+
+	err := g.VerifyWebhook(context.Background(), payload, signed(time.Now().Add(-2*time.Minute)))
+	var fiberErr *fiber.Error
+	if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusBadRequest {
+		t.Fatalf("expected a stale webhook to be rejected with 400, got %v", err)
+	}
+}
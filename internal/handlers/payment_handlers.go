@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"cource-api/internal/config"
+	"cource-api/internal/events"
+	"cource-api/internal/invoice"
+	"cource-api/internal/mailer"
 	"cource-api/internal/models"
 	"cource-api/internal/repository"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"strconv"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,123 +23,378 @@ import (
 	"github.com/stripe/stripe-go/v76"
 	"github.com/stripe/stripe-go/v76/checkout/session"
 	"github.com/stripe/stripe-go/v76/customer"
-	"github.com/stripe/stripe-go/v76/webhook"
+	"github.com/stripe/stripe-go/v76/refund"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// HandleCreatePayment creates a new payment session
-func HandleCreatePayment(repo *repository.PaymentRepository) fiber.Handler {
+// getOrCreateStripeCustomer finds the Stripe customer for the user's email or creates one.
+// stripe.Key must be set by the caller.
+func getOrCreateStripeCustomer(user *models.User) (*stripe.Customer, error) {
+	listParams := &stripe.CustomerListParams{
+		Email: stripe.String(user.Email),
+	}
+	iter := customer.List(listParams)
+	if iter.Next() {
+		if cust, ok := iter.Current().(*stripe.Customer); ok {
+			return cust, nil
+		}
+	}
+
+	custParams := &stripe.CustomerParams{
+		Email: stripe.String(user.Email),
+		Metadata: map[string]string{
+			"user_id": user.ID.Hex(),
+		},
+	}
+	stripeCustomer, err := customer.New(custParams)
+	if err != nil {
+		logrus.WithError(err).WithField("email", user.Email).Error("Failed to create Stripe customer")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to create customer account")
+	}
+	return stripeCustomer, nil
+}
+
+// allowedRedirectHost reports whether a checkout redirect may point at host.
+// The hosts of the configured frontend URLs are always allowed.
+func allowedRedirectHost(host string) bool {
+	allowed := append([]string{}, config.AppConfig.CheckoutRedirectHosts...)
+	for _, configured := range []string{config.AppConfig.FrontendSuccessURL, config.AppConfig.FrontendCancelURL} {
+		if u, err := url.Parse(configured); err == nil && u.Host != "" {
+			allowed = append(allowed, u.Host)
+		}
+	}
+
+	for _, candidate := range allowed {
+		if strings.EqualFold(candidate, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRedirectURL returns the override when it is an absolute http(s) URL on an
+// allowed host, or the configured fallback when no override is given
+func resolveRedirectURL(override, fallback string) (string, error) {
+	if override == "" {
+		return fallback, nil
+	}
+
+	u, err := url.Parse(override)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Redirect URL must be an absolute http(s) URL")
+	}
+	if !allowedRedirectHost(u.Host) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Redirect URL host is not allowed")
+	}
+	return override, nil
+}
+
+// checkoutRedirectURLs returns the success and cancel URLs for a checkout session
+func checkoutRedirectURLs(successOverride, cancelOverride string) (string, string, error) {
+	successURL, err := resolveRedirectURL(successOverride, config.AppConfig.FrontendSuccessURL)
+	if err != nil {
+		return "", "", err
+	}
+	cancelURL, err := resolveRedirectURL(cancelOverride, config.AppConfig.FrontendCancelURL)
+	if err != nil {
+		return "", "", err
+	}
+	return successURL, cancelURL, nil
+}
+
+// checkoutTrialDays returns the trial length to start a checkout with for the product,
+// zero when the product has no trial or the user already used theirs
+func checkoutTrialDays(
+	c *fiber.Ctx,
+	productRepo *repository.ProductRepository,
+	userRepo *repository.UserRepository,
+	productIDHex string,
+	userID primitive.ObjectID,
+) (int, error) {
+	productID, err := toObjectID(productIDHex, "product_id")
+	if err != nil {
+		return 0, err
+	}
+
+	product, err := productRepo.GetByID(c.Context(), productID)
+	if err != nil {
+		log(c).WithError(err).WithField("product_id", productID).Error("Failed to get product")
+		return 0, fiber.NewError(fiber.StatusInternalServerError, "Failed to get product")
+	}
+	if product == nil || !product.Status {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Invalid product")
+	}
+	if product.TrialDays <= 0 {
+		return 0, nil
+	}
+
+	account, err := userRepo.GetByID(c.Context(), userID)
+	if err != nil {
+		log(c).WithError(err).WithField("user_id", userID).Error("Failed to get user")
+		return 0, fiber.NewError(fiber.StatusInternalServerError, "Failed to get user")
+	}
+	if account == nil || account.TrialUsedAt != nil {
+		return 0, nil
+	}
+	return product.TrialDays, nil
+}
+
+// planIntervals maps the plan types a subscription checkout can be for to the Stripe
+// interval the plan is billed at
+var planIntervals = map[string]string{
+	"monthly": "month",
+	"yearly":  "year",
+}
+
+// planToStripeInterval returns the Stripe billing interval of a plan type
+func planToStripeInterval(plan string) string {
+	return planIntervals[plan]
+}
+
+// stripeIntervalToPlan returns the plan type billed at a Stripe interval, or the interval
+// itself when no plan is billed at it
+func stripeIntervalToPlan(interval string) string {
+	for plan, planInterval := range planIntervals {
+		if planInterval == interval {
+			return plan
+		}
+	}
+	return interval
+}
+
+// validateCheckoutPlan checks a checkout is for a known plan type and a two letter region
+// code, and returns the normalized region
+func validateCheckoutPlan(planType, region string) (string, error) {
+	if planType == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Plan type is required")
+	}
+	if _, ok := planIntervals[planType]; !ok {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Invalid plan type, expected monthly or yearly")
+	}
+
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if region == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Region is required")
+	}
+	if !regionCodePattern.MatchString(region) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Region must be a two letter country code")
+	}
+	return region, nil
+}
+
+// HandleCreatePayment creates a new payment session with the gateway in the request,
+// Razorpay by default in India and Stripe elsewhere. An optional coupon code is validated here and applied as a discount
+// by the gateway.
+func HandleCreatePayment(
+	repo *repository.PaymentRepository,
+	couponRepo *repository.CouponRepository,
+	productRepo *repository.ProductRepository,
+	userRepo *repository.UserRepository,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get current user
 		user, err := GetUserFromContext(c)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to get user from context")
+			log(c).WithError(err).Error("Failed to get user from context")
 			return fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
 		}
 
 		// Parse request body
 		var req struct {
-			PlanType string `json:"plan_type"`
-			Region   string `json:"region"`
+			PlanType   string `json:"plan_type"`
+			Region     string `json:"region"`
+			SuccessURL string `json:"success_url"`
+			CancelURL  string `json:"cancel_url"`
+			CouponCode string `json:"coupon_code"`
+			ProductID  string `json:"product_id"`
+			Gateway    string `json:"gateway"`
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			logrus.WithError(err).Error("Failed to parse payment request body")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			log(c).WithError(err).Error("Failed to parse payment request body")
+			return errInvalidBody
 		}
 
-		// Validate request
-		if req.PlanType == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Plan type is required")
+		successURL, cancelURL, err := checkoutRedirectURLs(req.SuccessURL, req.CancelURL)
+		if err != nil {
+			return err
 		}
-		if req.Region == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Region is required")
+
+		// Validate request before any lookup
+		req.Region, err = validateCheckoutPlan(req.PlanType, req.Region)
+		if err != nil {
+			return err
+		}
+
+		gateway, err := newPaymentGateway(checkoutGatewayName(req.Gateway, req.Region), couponRepo)
+		if err != nil {
+			return err
 		}
 
 		// Get pricing for region
 		pricing, err := repo.GetRegionalPricing(c.Context(), req.Region)
 		if err != nil {
-			logrus.WithError(err).WithField("region", req.Region).Error("Failed to get regional pricing")
+			log(c).WithError(err).WithField("region", req.Region).Error("Failed to get regional pricing")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get pricing information")
 		}
 		if pricing == nil {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid region or pricing not found")
 		}
 
-		// Set Stripe API key
-		if config.AppConfig.StripeKey == "" {
-			logrus.Error("Stripe API key is not configured")
-			return fiber.NewError(fiber.StatusInternalServerError, "Payment system is not properly configured")
-		}
-		stripe.Key = config.AppConfig.StripeKey
-
-		// Create or get Stripe customer
-		var stripeCustomer *stripe.Customer
-		listParams := &stripe.CustomerListParams{
-			Email: stripe.String(user.Email),
-		}
-		iter := customer.List(listParams)
-		if iter.Next() {
-			if cust, ok := iter.Current().(*stripe.Customer); ok {
-				stripeCustomer = cust
+		// Validate the coupon before touching the gateway
+		var appliedCoupon *models.Coupon
+		if code := normalizeCouponCode(req.CouponCode); code != "" {
+			appliedCoupon, err = couponRepo.GetByCode(c.Context(), code)
+			if err != nil {
+				log(c).WithError(err).WithField("code", code).Error("Failed to get coupon")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to validate coupon")
 			}
-		} else {
-			custParams := &stripe.CustomerParams{
-				Email: stripe.String(user.Email),
-				Metadata: map[string]string{
-					"user_id": user.ID.Hex(),
-				},
+			if err := checkCouponRedeemable(appliedCoupon, pricing.Currency, time.Now().UTC()); err != nil {
+				return err
 			}
-			stripeCustomer, err = customer.New(custParams)
+		}
+
+		// The trial comes from the product subscribed to, once per user
+		var trialDays int
+		if req.ProductID != "" {
+			trialDays, err = checkoutTrialDays(c, productRepo, userRepo, req.ProductID, user.ID)
 			if err != nil {
-				logrus.WithError(err).WithField("email", user.Email).Error("Failed to create Stripe customer")
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to create customer account")
+				return err
 			}
 		}
 
 		// Determine price based on plan type
-		var price int64
+		price := int64(pricing.MonthlyPrice)
 		if req.PlanType == "yearly" {
 			price = int64(pricing.YearlyPrice)
-		} else if req.PlanType == "monthly" {
-			price = int64(pricing.MonthlyPrice)
-		} else {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid plan type")
 		}
 
-		// Create checkout session
+		checkout, err := gateway.CreateCheckout(c.Context(), &CheckoutRequest{
+			User:       user,
+			PlanType:   req.PlanType,
+			Amount:     price,
+			Currency:   pricing.Currency,
+			SuccessURL: successURL,
+			CancelURL:  cancelURL,
+			TrialDays:  trialDays,
+			Coupon:     appliedCoupon,
+		})
+		if err != nil {
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				return err
+			}
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"user_id":   user.ID,
+				"plan_type": req.PlanType,
+				"region":    req.Region,
+				"gateway":   req.Gateway,
+			}).Error("Failed to create checkout session")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create payment session")
+		}
+
+		resp := fiber.Map{
+			"session_id": checkout.SessionID,
+			"url":        checkout.URL,
+		}
+		if checkout.KeyID != "" {
+			resp["key_id"] = checkout.KeyID
+		}
+		return c.JSON(resp)
+	}
+}
+
+// HandleCreateCoursePayment creates a one-time checkout session to buy a single course
+func HandleCreateCoursePayment(courseRepo *repository.CourseRepository, repo *repository.PaymentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		courseID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		course, err := courseRepo.GetByID(c.Context(), courseID)
+		if err != nil {
+			log(c).WithError(err).WithField("course_id", courseID).Error("Failed to get course")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
+		}
+		if course == nil {
+			return errCourseNotFound
+		}
+		if !course.IsPurchasable {
+			return fiber.NewError(fiber.StatusBadRequest, "Course cannot be purchased individually")
+		}
+
+		var req struct {
+			SuccessURL string `json:"success_url"`
+			CancelURL  string `json:"cancel_url"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return errInvalidBody
+			}
+		}
+
+		successURL, cancelURL, err := checkoutRedirectURLs(req.SuccessURL, req.CancelURL)
+		if err != nil {
+			return err
+		}
+
+		purchased, err := repo.HasPurchasedCourse(c.Context(), user.ID, courseID)
+		if err != nil {
+			log(c).WithError(err).WithField("course_id", courseID).Error("Failed to check course purchase")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create payment session")
+		}
+		if purchased {
+			return fiber.NewError(fiber.StatusConflict, "Course already purchased")
+		}
+
+		// Set Stripe API key
+		if config.AppConfig.StripeKey == "" {
+			log(c).Error("Stripe API key is not configured")
+			return fiber.NewError(fiber.StatusInternalServerError, "Payment system is not properly configured")
+		}
+		stripe.Key = config.AppConfig.StripeKey
+
+		stripeCustomer, err := getOrCreateStripeCustomer(user)
+		if err != nil {
+			return err
+		}
+
 		sessionParams := &stripe.CheckoutSessionParams{
 			Customer: stripe.String(stripeCustomer.ID),
 			PaymentMethodTypes: stripe.StringSlice([]string{
 				"card",
 			}),
-			Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+			Mode: stripe.String(string(stripe.CheckoutSessionModePayment)),
 			LineItems: []*stripe.CheckoutSessionLineItemParams{
 				{
 					PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-						Currency: stripe.String(pricing.Currency),
+						Currency: stripe.String(course.Currency),
 						ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-							Name: stripe.String("Course Subscription"),
-						},
-						UnitAmount: stripe.Int64(price),
-						Recurring: &stripe.CheckoutSessionLineItemPriceDataRecurringParams{
-							Interval: stripe.String(req.PlanType),
+							Name: stripe.String(course.Title),
 						},
+						UnitAmount: stripe.Int64(int64(course.Price)),
 					},
 					Quantity: stripe.Int64(1),
 				},
 			},
-			SuccessURL: stripe.String("http://localhost:3000/success?session_id={CHECKOUT_SESSION_ID}"),
-			CancelURL:  stripe.String("http://localhost:3000/cancel"),
+			SuccessURL: stripe.String(successURL),
+			CancelURL:  stripe.String(cancelURL),
 		}
+		sessionParams.AddMetadata("user_id", user.ID.Hex())
+		sessionParams.AddMetadata("course_id", courseID.Hex())
 
 		session, err := session.New(sessionParams)
 		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
+			log(c).WithError(err).WithFields(logrus.Fields{
 				"user_id":   user.ID,
-				"plan_type": req.PlanType,
-				"region":    req.Region,
-			}).Error("Failed to create checkout session")
+				"course_id": courseID,
+			}).Error("Failed to create course checkout session")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create payment session")
 		}
 
@@ -145,32 +409,25 @@ func HandleCreatePayment(repo *repository.PaymentRepository) fiber.Handler {
 func HandleGetPayment(repo *repository.PaymentRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get payment ID from params
-		paymentID := c.Params("id")
-		if paymentID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Payment ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(paymentID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			logrus.WithError(err).WithField("payment_id", paymentID).Error("Invalid payment ID format")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid payment ID format")
+			return err
 		}
 
 		// Get payment
 		payment, err := repo.GetByID(c.Context(), objectID)
 		if err != nil {
-			logrus.WithError(err).WithField("payment_id", paymentID).Error("Failed to get payment")
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to get payment")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve payment information")
 		}
 		if payment == nil {
-			return fiber.NewError(fiber.StatusNotFound, "Payment not found")
+			return errPaymentNotFound
 		}
 
 		// Verify ownership
 		user, err := GetUserFromContext(c)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to get user from context")
+			log(c).WithError(err).Error("Failed to get user from context")
 			return fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
 		}
 
@@ -182,167 +439,989 @@ func HandleGetPayment(repo *repository.PaymentRepository) fiber.Handler {
 	}
 }
 
+// receiptDescription says what a payment bought, course is nil for subscriptions or
+// when the course no longer exists
+func receiptDescription(payment *models.Payment, course *models.Course) string {
+	switch {
+	case course != nil:
+		return "Course: " + course.Title
+	case payment.CourseID != nil:
+		return "Course purchase"
+	case payment.Plan != "":
+		return strings.ToUpper(payment.Plan[:1]) + payment.Plan[1:] + " subscription"
+	}
+	return "Subscription"
+}
+
+// HandleGetPaymentInvoice downloads the receipt of a completed payment as an HTML document
+func HandleGetPaymentInvoice(repo *repository.PaymentRepository, userRepo *repository.UserRepository, courseRepo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		payment, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to get payment")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve payment information")
+		}
+		if payment == nil {
+			return errPaymentNotFound
+		}
+		if payment.UserID != user.ID && user.Role != "admin" {
+			return fiber.NewError(fiber.StatusForbidden, "Access denied")
+		}
+
+		owner, err := userRepo.GetByID(c.Context(), payment.UserID)
+		if err != nil {
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to get payment owner")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve payment information")
+		}
+		if owner == nil {
+			return errUserNotFound
+		}
+
+		var course *models.Course
+		if payment.CourseID != nil {
+			course, err = courseRepo.GetByID(c.Context(), *payment.CourseID)
+			if err != nil {
+				log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to get purchased course")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve payment information")
+			}
+		}
+
+		receipt, err := invoice.New(payment, invoice.Customer{Name: owner.Name, Email: owner.Email}, receiptDescription(payment, course))
+		if err != nil {
+			if errors.Is(err, invoice.ErrNotCompleted) {
+				return fiber.NewError(fiber.StatusConflict, "Receipts are only available for completed payments")
+			}
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to generate invoice")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate invoice")
+		}
+
+		var buf bytes.Buffer
+		if err := receipt.WriteHTML(&buf); err != nil {
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to render receipt")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to render receipt")
+		}
+
+		c.Attachment(fmt.Sprintf("receipt-%s.html", payment.ID.Hex()))
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.Send(buf.Bytes())
+	}
+}
+
+// sendPaymentReceipt emails the receipt for a payment to its owner
+func sendPaymentReceipt(ctx context.Context, m mailer.Mailer, owner *models.User, payment *models.Payment) error {
+	subject, body := mailer.ReceiptMessage(payment)
+	return m.Send(ctx, owner.Email, subject, body)
+}
+
+// HandleEmailPaymentReceipt re-sends the receipt of a payment to the user who made it
+func HandleEmailPaymentReceipt(repo *repository.PaymentRepository, userRepo *repository.UserRepository, m mailer.Mailer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		payment, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to get payment")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve payment information")
+		}
+		if payment == nil {
+			return errPaymentNotFound
+		}
+		if payment.UserID != user.ID && user.Role != "admin" {
+			return fiber.NewError(fiber.StatusForbidden, "Access denied")
+		}
+
+		owner, err := userRepo.GetByID(c.Context(), payment.UserID)
+		if err != nil {
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to get payment owner")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve payment information")
+		}
+		if owner == nil {
+			return errUserNotFound
+		}
+
+		if err := sendPaymentReceipt(c.Context(), m, owner, payment); err != nil {
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to send receipt email")
+			return fiber.NewError(fiber.StatusBadGateway, "Failed to send receipt email")
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Receipt sent",
+		})
+	}
+}
+
 // HandleListPayments lists all payments for the current user
 func HandleListPayments(repo *repository.PaymentRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get current user
 		user, err := GetUserFromContext(c)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to get user from context")
+			log(c).WithError(err).Error("Failed to get user from context")
 			return fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
 		}
 
-		// Get pagination parameters
-		page, err := strconv.ParseInt(c.Query("page", "1"), 10, 64)
+		pagination := parsePagination(c, defaultPageLimit)
+
+		// Get payments
+		payments, total, err := repo.ListByUser(c.Context(), user.ID, pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list payments")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve payment history")
+		}
+
+		return c.JSON(Paginate(payments, total, pagination))
+	}
+}
+
+// paymentFromCheckoutSession builds the payment record for a completed checkout.
+// The user comes from the customer metadata, falling back to the session metadata,
+// and a course_id in the session metadata marks a single course purchase.
+func paymentFromCheckoutSession(session *stripe.CheckoutSession) (*models.Payment, error) {
+	userIDHex := session.Metadata["user_id"]
+	if session.Customer != nil && session.Customer.Metadata["user_id"] != "" {
+		userIDHex = session.Customer.Metadata["user_id"]
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDHex)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &models.Payment{
+		UserID:        userID,
+		Gateway:       gatewayStripe,
+		TransactionID: session.ID,
+		Amount:        int(session.AmountTotal),
+		Currency:      string(session.Currency),
+		Status:        "completed",
+		Timestamp:     time.Now().UTC(),
+	}
+
+	if courseIDHex := session.Metadata["course_id"]; courseIDHex != "" {
+		courseID, err := primitive.ObjectIDFromHex(courseIDHex)
+		if err != nil {
+			return nil, err
+		}
+		payment.CourseID = &courseID
+	}
+	payment.Plan = session.Metadata["plan_type"]
+	payment.CouponCode = session.Metadata["coupon_code"]
+	if session.PaymentIntent != nil {
+		payment.PaymentIntentID = session.PaymentIntent.ID
+	}
+	if session.Invoice != nil {
+		payment.InvoiceID = session.Invoice.ID
+	}
+
+	return payment, nil
+}
+
+// refundReasons are the reasons Stripe accepts for a refund
+var refundReasons = map[string]bool{
+	string(stripe.RefundReasonDuplicate):           true,
+	string(stripe.RefundReasonFraudulent):          true,
+	string(stripe.RefundReasonRequestedByCustomer): true,
+}
+
+// resolveRefundAmount returns how much to refund, the whole remaining amount when
+// requested is zero
+func resolveRefundAmount(payment *models.Payment, requested int) (int, error) {
+	remaining := payment.Amount - payment.RefundedAmount
+	if remaining <= 0 {
+		return 0, fiber.NewError(fiber.StatusConflict, "Payment is already fully refunded")
+	}
+	if requested < 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Refund amount cannot be negative")
+	}
+	if requested == 0 {
+		return remaining, nil
+	}
+	if requested > remaining {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Refund amount exceeds the amount left to refund")
+	}
+	return requested, nil
+}
+
+// stripePaymentIntentID returns the payment intent that charged a payment. Payments
+// recorded before the intent was stored resolve it from their checkout session.
+// stripe.Key must be set by the caller.
+func stripePaymentIntentID(payment *models.Payment) (string, error) {
+	if payment.PaymentIntentID != "" {
+		return payment.PaymentIntentID, nil
+	}
+
+	params := &stripe.CheckoutSessionParams{}
+	params.AddExpand("invoice")
+	checkout, err := session.Get(payment.TransactionID, params)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case checkout.PaymentIntent != nil:
+		return checkout.PaymentIntent.ID, nil
+	case checkout.Invoice != nil && checkout.Invoice.PaymentIntent != nil:
+		return checkout.Invoice.PaymentIntent.ID, nil
+	}
+	return "", errors.New("checkout session has no payment intent")
+}
+
+// HandleRefundPayment refunds all or part of a Stripe payment (admin only). The refund is
+// recorded right away and confirmed again by the charge.refunded webhook.
+func HandleRefundPayment(repo *repository.PaymentRepository, auditRepo *repository.AuditRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		admin, err := GetUserFromContext(c)
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid page number")
+			return err
 		}
-		limit, err := strconv.ParseInt(c.Query("limit", "10"), 10, 64)
+
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid limit value")
+			return err
 		}
 
-		// Validate pagination parameters
-		if page < 1 {
-			page = 1
+		var req struct {
+			// Amount in the smallest currency unit, zero refunds everything left
+			Amount int    `json:"amount"`
+			Reason string `json:"reason"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
 		}
-		if limit < 1 || limit > 100 {
-			limit = 10
+		if req.Reason != "" && !refundReasons[req.Reason] {
+			return fiber.NewError(fiber.StatusBadRequest, "Reason must be duplicate, fraudulent or requested_by_customer")
 		}
 
-		// Get payments
-		payments, total, err := repo.ListByUser(c.Context(), user.ID, page, limit)
+		payment, err := repo.GetByID(c.Context(), objectID)
 		if err != nil {
-			logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to list payments")
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve payment history")
+			log(c).WithError(err).WithField("payment_id", objectID).Error("Failed to get payment")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get payment")
+		}
+		if payment == nil {
+			return errPaymentNotFound
+		}
+		if payment.Gateway != gatewayStripe {
+			return fiber.NewError(fiber.StatusBadRequest, "Only Stripe payments can be refunded")
+		}
+
+		amount, err := resolveRefundAmount(payment, req.Amount)
+		if err != nil {
+			return err
+		}
+
+		if config.AppConfig.StripeKey == "" {
+			log(c).Error("Stripe API key is not configured")
+			return fiber.NewError(fiber.StatusInternalServerError, "Payment system is not properly configured")
+		}
+		stripe.Key = config.AppConfig.StripeKey
+
+		paymentIntentID, err := stripePaymentIntentID(payment)
+		if err != nil {
+			log(c).WithError(err).WithField("payment_id", payment.ID).Error("Failed to resolve payment intent for refund")
+			return fiber.NewError(fiber.StatusBadGateway, "Failed to find the charge to refund")
+		}
+
+		params := &stripe.RefundParams{
+			PaymentIntent: stripe.String(paymentIntentID),
+			Amount:        stripe.Int64(int64(amount)),
+		}
+		if req.Reason != "" {
+			params.Reason = stripe.String(req.Reason)
+		}
+		params.AddMetadata("payment_id", payment.ID.Hex())
+		params.AddMetadata("admin_id", admin.ID.Hex())
+
+		result, err := refund.New(params)
+		if err != nil {
+			log(c).WithError(err).WithField("payment_id", payment.ID).Error("Failed to create Stripe refund")
+			return fiber.NewError(fiber.StatusBadGateway, "Failed to refund payment")
+		}
+
+		payment.RefundedAmount += int(result.Amount)
+		fullyRefunded := payment.RefundedAmount >= payment.Amount
+		if err := repo.MarkRefunded(c.Context(), payment.ID, payment.RefundedAmount, fullyRefunded); err != nil {
+			// Stripe has refunded already, the charge.refunded webhook records it on retry
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"payment_id": payment.ID,
+				"refund_id":  result.ID,
+			}).Error("Failed to record refund")
+		}
+		now := time.Now().UTC()
+		payment.RefundedAt = &now
+		if fullyRefunded {
+			payment.Status = "refunded"
+		}
+
+		entry := &models.AuditLog{
+			ActorID:    admin.ID,
+			Action:     "payment.refund",
+			TargetType: "payment",
+			TargetID:   payment.ID,
+			Details: map[string]interface{}{
+				"refund_id": result.ID,
+				"amount":    result.Amount,
+				"currency":  payment.Currency,
+				"reason":    req.Reason,
+			},
+		}
+		if err := auditRepo.Record(c.Context(), entry); err != nil {
+			log(c).WithError(err).WithField("payment_id", payment.ID).Error("Failed to record audit entry")
 		}
 
 		return c.JSON(fiber.Map{
-			"payments": payments,
-			"total":    total,
-			"page":     page,
-			"limit":    limit,
+			"refund_id":     result.ID,
+			"refund_status": result.Status,
+			"payment":       payment,
 		})
 	}
 }
 
-// HandleStripeWebhook handles Stripe webhook events
-func HandleStripeWebhook(repo *repository.PaymentRepository) fiber.Handler {
+// unixTimePtr converts a Stripe timestamp to a time pointer, nil when unset
+func unixTimePtr(ts int64) *time.Time {
+	if ts == 0 {
+		return nil
+	}
+	t := time.Unix(ts, 0).UTC()
+	return &t
+}
+
+// subscriptionFromStripe maps a Stripe subscription to a local subscription. The
+// user is taken from the customer metadata, falling back to the subscription metadata.
+func subscriptionFromStripe(sub *stripe.Subscription) (*models.Subscription, error) {
+	userIDHex := sub.Metadata["user_id"]
+	if sub.Customer != nil && sub.Customer.Metadata["user_id"] != "" {
+		userIDHex = sub.Customer.Metadata["user_id"]
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDHex)
+	if err != nil {
+		return nil, err
+	}
+
+	status := string(sub.Status)
+	if sub.Status == stripe.SubscriptionStatusTrialing {
+		status = "trial"
+	}
+
+	subscription := &models.Subscription{
+		UserID:             userID,
+		Status:             status,
+		Currency:           string(sub.Currency),
+		CurrentPeriodStart: time.Unix(sub.CurrentPeriodStart, 0).UTC(),
+		CurrentPeriodEnd:   time.Unix(sub.CurrentPeriodEnd, 0).UTC(),
+		CancelAtPeriodEnd:  sub.CancelAtPeriodEnd,
+		CanceledAt:         unixTimePtr(sub.CanceledAt),
+		TrialStart:         unixTimePtr(sub.TrialStart),
+		TrialEnd:           unixTimePtr(sub.TrialEnd),
+		SubscriptionID:     sub.ID,
+		AutoRenew:          !sub.CancelAtPeriodEnd,
+	}
+
+	if sub.Customer != nil {
+		subscription.CustomerID = sub.Customer.ID
+	}
+	if sub.DefaultPaymentMethod != nil {
+		subscription.PaymentMethodID = sub.DefaultPaymentMethod.ID
+	}
+	if sub.Items != nil && len(sub.Items.Data) > 0 && sub.Items.Data[0].Price != nil {
+		price := sub.Items.Data[0].Price
+		subscription.Amount = float64(price.UnitAmount) / 100
+		if price.Recurring != nil {
+			subscription.Plan = stripeIntervalToPlan(string(price.Recurring.Interval))
+		}
+	}
+
+	return subscription, nil
+}
+
+// invoicePaymentUpdate returns the changes to apply to a subscription once Stripe
+// reports the payment of one of its invoices. A failed payment makes the subscription
+// past due and a successful one makes it active again, except for the free first
+// invoice of a trial.
+func invoicePaymentUpdate(inv *stripe.Invoice, subscription *models.Subscription, paid bool, now time.Time) map[string]interface{} {
+	if !paid {
+		return map[string]interface{}{
+			"status":              "past_due",
+			"last_payment_status": "failed",
+		}
+	}
+
+	paidAt := now
+	if inv.StatusTransitions != nil && inv.StatusTransitions.PaidAt != 0 {
+		paidAt = time.Unix(inv.StatusTransitions.PaidAt, 0).UTC()
+	}
+	update := map[string]interface{}{
+		"last_payment_status": "succeeded",
+		"last_payment_date":   paidAt,
+	}
+	if subscription.Status != "trial" || inv.AmountPaid > 0 {
+		update["status"] = "active"
+	}
+
+	// The invoice bills the period starting now, so its end is the next billing date
+	if inv.Lines != nil {
+		for _, line := range inv.Lines.Data {
+			if line.Period != nil && line.Period.End != 0 {
+				update["next_billing_date"] = time.Unix(line.Period.End, 0).UTC()
+				break
+			}
+		}
+	}
+	return update
+}
+
+// syncStripeSubscription upserts the canonical subscription record keyed by the
+// Stripe subscription ID and refreshes the summary embedded in its owner's user document
+func syncStripeSubscription(
+	ctx context.Context,
+	repo *repository.PaymentRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	subscription *models.Subscription,
+) error {
+	if err := subscriptionRepo.UpsertByStripeID(ctx, subscription); err != nil {
+		return err
+	}
+
+	// Only the plan summary is embedded, provider IDs stay in the subscriptions collection
+	return repo.UpdateSubscription(ctx, subscription.UserID, models.Subscription{
+		Status:           subscription.Status,
+		Plan:             subscription.Plan,
+		CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+	})
+}
+
+// webhookEventLease is how long a delivery may handle an event before a redelivery can take
+// it over, it only expires early when the process handling the event died
+const webhookEventLease = 5 * time.Minute
+
+// handleWebhookOnce claims a verified webhook event and applies it. A delivery of an event
+// that is done or leased to another delivery is acknowledged without applying it again. The
+// claim is released when applying fails so the provider's retry can apply it, and the event
+// is only marked done once it was applied.
+func handleWebhookOnce(c *fiber.Ctx, eventRepo *repository.WebhookEventRepository, event *GatewayEvent, apply func() error) error {
+	claimed, err := eventRepo.Claim(c.Context(), event.ID, event.Type, webhookEventLease)
+	if err != nil {
+		log(c).WithError(err).WithField("event_id", event.ID).Error("Failed to claim webhook event")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to process webhook")
+	}
+	if !claimed {
+		log(c).WithFields(logrus.Fields{
+			"event_id": event.ID,
+			"type":     event.Type,
+		}).Info("Skipping already processed webhook event")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	if err := apply(); err != nil {
+		if releaseErr := eventRepo.Release(c.Context(), event.ID); releaseErr != nil {
+			log(c).WithError(releaseErr).WithField("event_id", event.ID).Error("Failed to release webhook event")
+		}
+		return err
+	}
+
+	// The event was applied, if it stays processing a redelivery after the lease
+	// applies it again, which the handlers tolerate
+	if err := eventRepo.Done(c.Context(), event.ID); err != nil {
+		log(c).WithError(err).WithField("event_id", event.ID).Error("Failed to mark webhook event done")
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// HandleStripeWebhook handles Stripe webhook events. Events are claimed before they are
+// handled, so retried or concurrent deliveries are acknowledged without being applied again.
+func HandleStripeWebhook(
+	repo *repository.PaymentRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	eventRepo *repository.WebhookEventRepository,
+	couponRepo *repository.CouponRepository,
+	userRepo *repository.UserRepository,
+	notificationRepo *repository.NotificationRepository,
+	broker *events.Broker,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Read request body
 		payload, err := io.ReadAll(c.Request().BodyStream())
 		if err != nil {
-			logrus.WithError(err).Error("Failed to read webhook payload")
+			log(c).WithError(err).Error("Failed to read webhook payload")
 			return fiber.NewError(fiber.StatusBadRequest, "Failed to read request body")
 		}
 
-		// Verify webhook signature
-		if config.AppConfig.StripeWebhook == "" {
-			logrus.Error("Stripe webhook secret is not configured")
-			return fiber.NewError(fiber.StatusInternalServerError, "Webhook configuration is missing")
+		event, err := verifyWebhookEvent(c, &stripeGateway{couponRepo: couponRepo}, payload)
+		if err != nil {
+			return err
 		}
 
-		event, err := webhook.ConstructEvent(payload, c.Get("Stripe-Signature"), config.AppConfig.StripeWebhook)
+		return handleWebhookOnce(c, eventRepo, event, func() error {
+			// Handle different event types
+			switch event.Type {
+			case "checkout.session.completed":
+				var session stripe.CheckoutSession
+				err := json.Unmarshal(event.Data, &session)
+				if err != nil {
+					log(c).WithError(err).Error("Failed to parse checkout session")
+					return fiber.NewError(fiber.StatusBadRequest, "Failed to parse session data")
+				}
+
+				// Create payment record
+				payment, err := paymentFromCheckoutSession(&session)
+				if err != nil {
+					log(c).WithError(err).WithField("metadata", session.Metadata).Error("Invalid metadata in checkout session")
+					return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID in metadata")
+				}
+
+				// The same session can arrive under a new event ID, so also dedupe on the transaction
+				existing, err := repo.GetByTransactionID(c.Context(), session.ID)
+				if err != nil {
+					log(c).WithError(err).WithField("transaction_id", session.ID).Error("Failed to check existing payment")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to record payment")
+				}
+
+				if existing == nil {
+					if err := repo.Create(c.Context(), payment); errors.Is(err, repository.ErrPaymentRecorded) {
+						// A concurrent delivery of the session recorded it first
+						break
+					} else if err != nil {
+						log(c).WithError(err).WithFields(logrus.Fields{
+							"user_id":        payment.UserID,
+							"transaction_id": session.ID,
+						}).Error("Failed to create payment record")
+						return fiber.NewError(fiber.StatusInternalServerError, "Failed to record payment")
+					}
+
+					// Counted only for the first record of the session so retries do not double count
+					if couponIDHex := session.Metadata["coupon_id"]; couponIDHex != "" {
+						if err := redeemCoupon(c.Context(), couponRepo, couponIDHex); err != nil {
+							log(c).WithError(err).WithFields(logrus.Fields{
+								"coupon_id":      couponIDHex,
+								"transaction_id": session.ID,
+							}).Error("Failed to count coupon redemption")
+						}
+					}
+
+					notifyPaymentSucceeded(c, notificationRepo, broker, payment)
+				}
+
+			case "charge.refunded":
+				var charge stripe.Charge
+				if err := json.Unmarshal(event.Data, &charge); err != nil {
+					log(c).WithError(err).Error("Failed to parse refunded charge")
+					return fiber.NewError(fiber.StatusBadRequest, "Failed to parse charge data")
+				}
+
+				var paymentIntentID, invoiceID string
+				if charge.PaymentIntent != nil {
+					paymentIntentID = charge.PaymentIntent.ID
+				}
+				if charge.Invoice != nil {
+					invoiceID = charge.Invoice.ID
+				}
+
+				payment, err := repo.GetByStripeReference(c.Context(), paymentIntentID, invoiceID)
+				if err != nil {
+					log(c).WithError(err).WithField("charge_id", charge.ID).Error("Failed to find refunded payment")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to record refund")
+				}
+				if payment == nil {
+					log(c).WithField("charge_id", charge.ID).Warn("Refunded charge does not match any payment")
+					break
+				}
+
+				if err := repo.MarkRefunded(c.Context(), payment.ID, int(charge.AmountRefunded), charge.Refunded); err != nil {
+					log(c).WithError(err).WithField("payment_id", payment.ID).Error("Failed to mark payment refunded")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to record refund")
+				}
+
+			case "invoice.payment_failed", "invoice.payment_succeeded":
+				var inv stripe.Invoice
+				if err := json.Unmarshal(event.Data, &inv); err != nil {
+					log(c).WithError(err).WithField("type", event.Type).Error("Failed to parse invoice")
+					return fiber.NewError(fiber.StatusBadRequest, "Failed to parse invoice data")
+				}
+				// One-off invoices have no subscription to update
+				if inv.Subscription == nil {
+					break
+				}
+
+				subscription, err := subscriptionRepo.GetByStripeID(c.Context(), inv.Subscription.ID)
+				if err != nil {
+					log(c).WithError(err).WithField("subscription_id", inv.Subscription.ID).Error("Failed to get subscription")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to update subscription")
+				}
+				if subscription == nil {
+					log(c).WithField("subscription_id", inv.Subscription.ID).Warn("Invoice does not match any subscription")
+					break
+				}
+				if inv.SubscriptionDetails != nil {
+					if userIDHex := inv.SubscriptionDetails.Metadata["user_id"]; userIDHex != "" && userIDHex != subscription.UserID.Hex() {
+						log(c).WithFields(logrus.Fields{
+							"subscription_id": inv.Subscription.ID,
+							"user_id":         userIDHex,
+						}).Warn("Invoice user does not match the subscription owner")
+						break
+					}
+				}
+
+				update := invoicePaymentUpdate(&inv, subscription, event.Type == "invoice.payment_succeeded", time.Now().UTC())
+				if err := subscriptionRepo.UpdatePaymentInfo(c.Context(), subscription.ID, update); err != nil {
+					log(c).WithError(err).WithField("subscription_id", subscription.ID).Error("Failed to update subscription payment")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to update subscription")
+				}
+
+				if status, ok := update["status"].(string); ok {
+					if err := repo.UpdateSubscription(c.Context(), subscription.UserID, models.Subscription{
+						Status:           status,
+						Plan:             subscription.Plan,
+						CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+					}); err != nil {
+						log(c).WithError(err).WithField("user_id", subscription.UserID).Error("Failed to update user subscription")
+						return fiber.NewError(fiber.StatusInternalServerError, "Failed to update subscription")
+					}
+				}
+
+				if event.Type == "invoice.payment_succeeded" && inv.BillingReason == stripe.InvoiceBillingReasonSubscriptionCycle {
+					notify(c, notificationRepo, broker, subscription.UserID, models.NotificationSubscriptionRenewed,
+						"Subscription renewed",
+						fmt.Sprintf("Your %s subscription has been renewed.", subscription.Plan),
+					)
+				}
+
+			case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+				var sub stripe.Subscription
+				err := json.Unmarshal(event.Data, &sub)
+				if err != nil {
+					log(c).WithError(err).WithField("type", event.Type).Error("Failed to parse subscription event")
+					return fiber.NewError(fiber.StatusBadRequest, "Failed to parse subscription data")
+				}
+
+				subscription, err := subscriptionFromStripe(&sub)
+				if err != nil {
+					log(c).WithError(err).WithField("subscription_id", sub.ID).Error("Invalid user ID in metadata")
+					return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID in metadata")
+				}
+				if event.Type == "customer.subscription.deleted" {
+					subscription.Status = "canceled"
+					subscription.AutoRenew = false
+					if subscription.CanceledAt == nil {
+						now := time.Now().UTC()
+						subscription.CanceledAt = &now
+					}
+				}
+
+				if err := syncStripeSubscription(c.Context(), repo, subscriptionRepo, subscription); err != nil {
+					log(c).WithError(err).WithFields(logrus.Fields{
+						"user_id":         subscription.UserID,
+						"subscription_id": sub.ID,
+						"status":          subscription.Status,
+					}).Error("Failed to sync subscription")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to update subscription")
+				}
+
+				if event.Type == "customer.subscription.created" && subscription.TrialStart != nil {
+					if _, err := userRepo.ClaimTrial(c.Context(), subscription.UserID); err != nil {
+						log(c).WithError(err).WithField("user_id", subscription.UserID).Error("Failed to record trial usage")
+					}
+				}
+				if event.Type == "customer.subscription.deleted" {
+					notify(c, notificationRepo, broker, subscription.UserID, models.NotificationSubscriptionCanceled,
+						"Subscription canceled",
+						fmt.Sprintf("Your %s subscription has been canceled.", subscription.Plan),
+					)
+				}
+			}
+
+			return nil
+		})
+	}
+}
+
+// paymentFromPayPalCapture builds the payment record for a completed PayPal capture,
+// along with the checkout metadata of its order
+func paymentFromPayPalCapture(capture *payPalCapture, now time.Time) (*models.Payment, orderMetadata, error) {
+	metadata, err := decodeOrderMetadata(capture.CustomID)
+	if err != nil {
+		return nil, metadata, err
+	}
+	amount, err := parsePayPalAmount(capture.Amount)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	return &models.Payment{
+		UserID:        metadata.UserID,
+		Gateway:       gatewayPayPal,
+		TransactionID: capture.ID,
+		Amount:        amount,
+		Currency:      strings.ToLower(capture.Amount.CurrencyCode),
+		Status:        "completed",
+		Plan:          metadata.PlanType,
+		CouponCode:    metadata.CouponCode,
+		Timestamp:     now,
+	}, metadata, nil
+}
+
+// paymentFromRazorpay builds the payment record for a captured Razorpay payment, along
+// with the checkout metadata of its order
+func paymentFromRazorpay(payment *razorpayPayment, now time.Time) (*models.Payment, orderMetadata, error) {
+	metadata, err := orderMetadataFromNotes(payment.Notes)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	return &models.Payment{
+		UserID:        metadata.UserID,
+		Gateway:       gatewayRazorpay,
+		TransactionID: payment.ID,
+		Amount:        payment.Amount,
+		Currency:      strings.ToLower(payment.Currency),
+		Status:        "completed",
+		Plan:          metadata.PlanType,
+		CouponCode:    metadata.CouponCode,
+		Timestamp:     now,
+	}, metadata, nil
+}
+
+// oneOffSubscription is the subscription bought by a payment through a gateway that
+// charges once, like PayPal or Razorpay orders. It runs for a single period of the plan
+// and does not renew. reference is the gateway order the payment was made for.
+func oneOffSubscription(payment *models.Payment, reference string, now time.Time) *models.Subscription {
+	end := now.AddDate(0, 1, 0)
+	if payment.Plan == "yearly" {
+		end = now.AddDate(1, 0, 0)
+	}
+	return &models.Subscription{
+		UserID:             payment.UserID,
+		Status:             "active",
+		Plan:               payment.Plan,
+		Currency:           payment.Currency,
+		Amount:             float64(payment.Amount) / 100,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   end,
+		CancelAtPeriodEnd:  true,
+		SubscriptionID:     reference,
+		LastPaymentStatus:  "succeeded",
+		LastPaymentDate:    &now,
+		AutoRenew:          false,
+	}
+}
+
+// fulfillOneOffPayment records a payment confirmed by a gateway webhook together with the
+// subscription it bought, then counts its coupon. A payment already recorded under the same
+// transaction is left alone, so redelivered events are not applied twice.
+func fulfillOneOffPayment(
+	c *fiber.Ctx,
+	subscriptionRepo *repository.SubscriptionRepository,
+	couponRepo *repository.CouponRepository,
+	notificationRepo *repository.NotificationRepository,
+	broker *events.Broker,
+	payment *models.Payment,
+	couponID string,
+	reference string,
+) error {
+	subscription := oneOffSubscription(payment, reference, payment.Timestamp)
+	fulfilled, err := subscriptionRepo.FulfillOneOff(c.Context(), payment, subscription)
+	if err != nil {
+		log(c).WithError(err).WithFields(logrus.Fields{
+			"user_id":        payment.UserID,
+			"transaction_id": payment.TransactionID,
+		}).Error("Failed to record payment and subscription")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record payment")
+	}
+	if !fulfilled {
+		return nil
+	}
+
+	if couponID != "" {
+		if err := redeemCoupon(c.Context(), couponRepo, couponID); err != nil {
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"coupon_id":      couponID,
+				"transaction_id": payment.TransactionID,
+			}).Error("Failed to count coupon redemption")
+		}
+	}
+
+	notifyPaymentSucceeded(c, notificationRepo, broker, payment)
+	return nil
+}
+
+// HandlePayPalWebhook handles PayPal webhook events. Approved orders are captured and a
+// completed capture records the payment and starts the subscription it paid for. Like
+// Stripe events they are claimed before they are handled so retries are not applied twice.
+func HandlePayPalWebhook(
+	subscriptionRepo *repository.SubscriptionRepository,
+	eventRepo *repository.WebhookEventRepository,
+	couponRepo *repository.CouponRepository,
+	notificationRepo *repository.NotificationRepository,
+	broker *events.Broker,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		payload, err := io.ReadAll(c.Request().BodyStream())
 		if err != nil {
-			logrus.WithError(err).Error("Invalid webhook signature")
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook signature")
+			log(c).WithError(err).Error("Failed to read webhook payload")
+			return fiber.NewError(fiber.StatusBadRequest, "Failed to read request body")
 		}
 
-		// Handle different event types
-		switch event.Type {
-		case "checkout.session.completed":
-			var session stripe.CheckoutSession
-			err := json.Unmarshal(event.Data.Raw, &session)
-			if err != nil {
-				logrus.WithError(err).Error("Failed to parse checkout session")
-				return fiber.NewError(fiber.StatusBadRequest, "Failed to parse session data")
-			}
+		gateway := newPayPalGateway()
+		event, err := verifyWebhookEvent(c, gateway, payload)
+		if err != nil {
+			return err
+		}
 
-			// Create payment record
-			userID, err := primitive.ObjectIDFromHex(session.Customer.Metadata["user_id"])
-			if err != nil {
-				logrus.WithError(err).WithField("metadata", session.Customer.Metadata).Error("Invalid user ID in metadata")
-				return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID in metadata")
-			}
+		return handleWebhookOnce(c, eventRepo, event, func() error {
+			switch event.Type {
+			case "CHECKOUT.ORDER.APPROVED":
+				var order payPalOrder
+				if err := json.Unmarshal(event.Data, &order); err != nil {
+					log(c).WithError(err).Error("Failed to parse approved order")
+					return fiber.NewError(fiber.StatusBadRequest, "Failed to parse order data")
+				}
+				if err := gateway.CaptureOrder(c.Context(), order.ID); err != nil {
+					log(c).WithError(err).WithField("order_id", order.ID).Error("Failed to capture PayPal order")
+					return fiber.NewError(fiber.StatusBadGateway, "Failed to capture payment")
+				}
 
-			payment := &models.Payment{
-				UserID:        userID,
-				Gateway:       "stripe",
-				TransactionID: session.ID,
-				Amount:        int(session.AmountTotal),
-				Currency:      string(session.Currency),
-				Status:        "completed",
-				Timestamp:     time.Now(),
-			}
+			case "PAYMENT.CAPTURE.COMPLETED":
+				var capture payPalCapture
+				if err := json.Unmarshal(event.Data, &capture); err != nil {
+					log(c).WithError(err).Error("Failed to parse capture")
+					return fiber.NewError(fiber.StatusBadRequest, "Failed to parse capture data")
+				}
 
-			if err := repo.Create(c.Context(), payment); err != nil {
-				logrus.WithError(err).WithFields(logrus.Fields{
-					"user_id":        userID,
-					"transaction_id": session.ID,
-				}).Error("Failed to create payment record")
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to record payment")
-			}
+				payment, metadata, err := paymentFromPayPalCapture(&capture, time.Now().UTC())
+				if err != nil {
+					log(c).WithError(err).WithField("custom_id", capture.CustomID).Error("Invalid metadata in PayPal capture")
+					return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID in metadata")
+				}
 
-		case "customer.subscription.updated":
-			var sub stripe.Subscription
-			err := json.Unmarshal(event.Data.Raw, &sub)
-			if err != nil {
-				logrus.WithError(err).Error("Failed to parse subscription update")
-				return fiber.NewError(fiber.StatusBadRequest, "Failed to parse subscription data")
+				if err := fulfillOneOffPayment(c, subscriptionRepo, couponRepo, notificationRepo, broker, payment, metadata.CouponID, capture.SupplementaryData.RelatedIDs.OrderID); err != nil {
+					return err
+				}
 			}
 
-			// Update user's subscription status
-			userID, err := primitive.ObjectIDFromHex(sub.Customer.Metadata["user_id"])
-			if err != nil {
-				logrus.WithError(err).WithField("metadata", sub.Customer.Metadata).Error("Invalid user ID in metadata")
-				return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID in metadata")
-			}
+			return nil
+		})
+	}
+}
 
-			subscription := models.Subscription{
-				Status:           string(sub.Status),
-				Plan:             string(sub.Items.Data[0].Price.Recurring.Interval),
-				CurrentPeriodEnd: time.Unix(sub.CurrentPeriodEnd, 0),
-			}
+// HandleRazorpayWebhook handles Razorpay webhook events. A captured payment is recorded
+// and starts the subscription it paid for, other events are acknowledged and ignored.
+func HandleRazorpayWebhook(
+	subscriptionRepo *repository.SubscriptionRepository,
+	eventRepo *repository.WebhookEventRepository,
+	couponRepo *repository.CouponRepository,
+	notificationRepo *repository.NotificationRepository,
+	broker *events.Broker,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		payload, err := io.ReadAll(c.Request().BodyStream())
+		if err != nil {
+			log(c).WithError(err).Error("Failed to read webhook payload")
+			return fiber.NewError(fiber.StatusBadRequest, "Failed to read request body")
+		}
 
-			if err := repo.UpdateSubscription(c.Context(), userID, subscription); err != nil {
-				logrus.WithError(err).WithFields(logrus.Fields{
-					"user_id": userID,
-					"status":  sub.Status,
-				}).Error("Failed to update subscription")
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to update subscription")
-			}
+		event, err := verifyWebhookEvent(c, newRazorpayGateway(), payload)
+		if err != nil {
+			return err
+		}
+		if event.Type != "payment.captured" {
+			return c.SendStatus(fiber.StatusOK)
+		}
 
-		case "customer.subscription.deleted":
-			var sub stripe.Subscription
-			err := json.Unmarshal(event.Data.Raw, &sub)
-			if err != nil {
-				logrus.WithError(err).Error("Failed to parse subscription deletion")
-				return fiber.NewError(fiber.StatusBadRequest, "Failed to parse subscription data")
+		return handleWebhookOnce(c, eventRepo, event, func() error {
+			var captured razorpayPayment
+			if err := json.Unmarshal(event.Data, &captured); err != nil {
+				log(c).WithError(err).Error("Failed to parse captured payment")
+				return fiber.NewError(fiber.StatusBadRequest, "Failed to parse payment data")
 			}
 
-			// Update user's subscription status
-			userID, err := primitive.ObjectIDFromHex(sub.Customer.Metadata["user_id"])
+			payment, metadata, err := paymentFromRazorpay(&captured, time.Now().UTC())
 			if err != nil {
-				logrus.WithError(err).WithField("metadata", sub.Customer.Metadata).Error("Invalid user ID in metadata")
+				log(c).WithError(err).WithField("notes", captured.Notes).Error("Invalid notes in Razorpay payment")
 				return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID in metadata")
 			}
 
-			subscription := models.Subscription{
-				Status:           "canceled",
-				Plan:             string(sub.Items.Data[0].Price.Recurring.Interval),
-				CurrentPeriodEnd: time.Unix(sub.CurrentPeriodEnd, 0),
-			}
+			return fulfillOneOffPayment(c, subscriptionRepo, couponRepo, notificationRepo, broker, payment, metadata.CouponID, captured.OrderID)
+		})
+	}
+}
+
+// regionCodePattern matches a two letter ISO 3166 region code after normalization
+var regionCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// regionValidation describes whether a region has pricing and which pricing applies
+type regionValidation struct {
+	Region         string `json:"region"`
+	HasPricing     bool   `json:"has_pricing"`
+	ResolvedRegion string `json:"resolved_region,omitempty"`
+	Currency       string `json:"currency,omitempty"`
+	CurrencySymbol string `json:"currency_symbol,omitempty"`
+	UsedFallback   bool   `json:"used_fallback"`
+}
+
+// validateRegion normalizes a region code and resolves its pricing, falling back to
+// the fallback region when the region has none
+func validateRegion(
+	ctx context.Context,
+	input string,
+	fallback string,
+	lookup func(ctx context.Context, region string) (*models.RegionalPricing, error),
+) (*regionValidation, error) {
+	region := strings.ToUpper(strings.TrimSpace(input))
+	if !regionCodePattern.MatchString(region) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Region must be a two letter country code")
+	}
 
-			if err := repo.UpdateSubscription(c.Context(), userID, subscription); err != nil {
-				logrus.WithError(err).WithFields(logrus.Fields{
-					"user_id": userID,
-					"status":  "canceled",
-				}).Error("Failed to update subscription")
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to update subscription")
+	result := &regionValidation{Region: region}
+	pricing, err := lookup(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	if pricing != nil {
+		result.HasPricing = true
+	} else if fallback != "" && fallback != region {
+		pricing, err = lookup(ctx, fallback)
+		if err != nil {
+			return nil, err
+		}
+		result.UsedFallback = pricing != nil
+	}
+
+	if pricing != nil {
+		result.ResolvedRegion = pricing.RegionCode
+		result.Currency = pricing.Currency
+		result.CurrencySymbol = pricing.CurrencySymbol
+	}
+	return result, nil
+}
+
+// HandleValidateRegion normalizes a region code and reports the pricing that applies to it
+func HandleValidateRegion(repo *repository.PaymentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		result, err := validateRegion(c.Context(), c.Query("region"), config.AppConfig.DefaultPricingRegion, repo.GetRegionalPricing)
+		if err != nil {
+			if _, ok := err.(*fiber.Error); ok {
+				return err
 			}
+			log(c).WithError(err).WithField("region", c.Query("region")).Error("Failed to validate region")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get pricing information")
 		}
 
-		return c.SendStatus(fiber.StatusOK)
+		return c.JSON(result)
 	}
 }
 
@@ -358,13 +1437,33 @@ func HandleGetRegionalPricing(repo *repository.PaymentRepository) fiber.Handler
 		// Get pricing
 		pricing, err := repo.GetRegionalPricing(c.Context(), regionCode)
 		if err != nil {
-			logrus.WithError(err).WithField("region", regionCode).Error("Failed to get regional pricing")
+			log(c).WithError(err).WithField("region", regionCode).Error("Failed to get regional pricing")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get pricing information")
 		}
 		if pricing == nil {
-			return fiber.NewError(fiber.StatusNotFound, "Pricing not found for region")
+			return errPricingNotFound
+		}
+
+		return c.JSON(withYearlySavings(pricing))
+	}
+}
+
+// HandleListAllRegionalPricing lists the pricing of every region, a page at a time
+func HandleListAllRegionalPricing(repo *repository.PaymentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pagination := parsePagination(c, maxPageLimit)
+
+		pricing, total, err := repo.ListRegionalPricing(c.Context(), "", pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).Error("Failed to list regional pricing")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get pricing information")
+		}
+
+		resp := make([]regionalPricingResponse, len(pricing))
+		for i, p := range pricing {
+			resp[i] = withYearlySavings(p)
 		}
 
-		return c.JSON(pricing)
+		return c.JSON(Paginate(resp, total, pagination))
 	}
 }
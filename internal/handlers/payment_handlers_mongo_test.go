@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cource-api/internal/config"
+	"cource-api/internal/database"
+	"cource-api/internal/events"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newStripeWebhookApp connects a test database and serves the Stripe webhook handler with
+// real repositories
+func newStripeWebhookApp(t *testing.T) *fiber.App {
+	t.Helper()
+	connectTestDatabase(t)
+	original := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = original })
+	config.AppConfig.StripeWebhook = "whsec_test"
+
+	app := fiber.New()
+	app.Post("/webhook/stripe", HandleStripeWebhook(
+		repository.NewPaymentRepository(),
+		repository.NewSubscriptionRepository(nil),
+		repository.NewWebhookEventRepository(),
+		repository.NewCouponRepository(),
+		repository.NewUserRepository(),
+		repository.NewNotificationRepository(),
+		events.NewBroker(),
+	))
+	return app
+}
+
+// deliverStripeEvent signs and posts a Stripe event wrapping object, returning the status
+func deliverStripeEvent(t *testing.T, app *fiber.App, eventID, eventType string, object any) int {
+	t.Helper()
+	payload, err := json.Marshal(map[string]any{
+		"id":          eventID,
+		"object":      "event",
+		"api_version": stripe.APIVersion,
+		"type":        eventType,
+		"data":        map[string]any{"object": object},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    "whsec_test",
+		Timestamp: time.Now(),
+	})
+
+	req := httptest.NewRequest("POST", "/webhook/stripe", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Stripe-Signature", signed.Header)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// seedWebhookUser inserts a user webhook events can be for
+func seedWebhookUser(t *testing.T, email string) primitive.ObjectID {
+	t.Helper()
+	user := &models.User{ID: primitive.NewObjectID(), Email: email, Role: "user"}
+	if _, err := database.Users.InsertOne(context.Background(), user); err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	return user.ID
+}
+
+func checkoutSessionObject(sessionID string, userID primitive.ObjectID) map[string]any {
+	return map[string]any{
+		"id":           sessionID,
+		"object":       "checkout.session",
+		"amount_total": 1000,
+		"currency":     "usd",
+		"metadata":     map[string]any{"user_id": userID.Hex(), "plan_type": "monthly"},
+	}
+}
+
+// stripeSubscriptionObject is a Stripe subscription whose metadata names userID
+func stripeSubscriptionObject(subscriptionID string, userID primitive.ObjectID, status string) map[string]any {
+	now := time.Now().UTC()
+	return map[string]any{
+		"id":                   subscriptionID,
+		"object":               "subscription",
+		"status":               status,
+		"currency":             "usd",
+		"current_period_start": now.Unix(),
+		"current_period_end":   now.Add(30 * 24 * time.Hour).Unix(),
+		"metadata":             map[string]any{"user_id": userID.Hex()},
+	}
+}
+
+// webhookEventStatus returns the stored status of an event
+func webhookEventStatus(t *testing.T, eventID string) string {
+	t.Helper()
+	var event models.WebhookEvent
+	if err := database.WebhookEvents.FindOne(context.Background(), bson.M{"event_id": eventID}).Decode(&event); err != nil {
+		t.Fatalf("failed to get webhook event: %v", err)
+	}
+	return event.Status
+}
+
+func TestStripeWebhookDuplicateCheckoutRecordsOnePayment(t *testing.T) {
+	app := newStripeWebhookApp(t)
+	ctx := context.Background()
+	userID := seedWebhookUser(t, "payer@example.com")
+	session := checkoutSessionObject("cs_dup", userID)
+
+	for i := range 2 {
+		if status := deliverStripeEvent(t, app, "evt_checkout", "checkout.session.completed", session); status != fiber.StatusOK {
+			t.Fatalf("delivery %d: expected 200, got %d", i+1, status)
+		}
+	}
+
+	count, err := database.Payments.CountDocuments(ctx, bson.M{"transaction_id": "cs_dup"})
+	if err != nil {
+		t.Fatalf("failed to count payments: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected one payment for a duplicate delivery, got %d", count)
+	}
+	if status := webhookEventStatus(t, "evt_checkout"); status != models.WebhookEventDone {
+		t.Fatalf("expected the event to be done, got %q", status)
+	}
+}
+
+func TestStripeWebhookDuplicateSubscriptionUpdateAppliedOnce(t *testing.T) {
+	app := newStripeWebhookApp(t)
+	ctx := context.Background()
+	userID := seedWebhookUser(t, "payer@example.com")
+	sub := stripeSubscriptionObject("sub_dup", userID, "active")
+
+	if status := deliverStripeEvent(t, app, "evt_sub_updated", "customer.subscription.updated", sub); status != fiber.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+
+	// A change made after the event was handled must survive its redelivery
+	if _, err := database.Subscriptions.UpdateOne(ctx, bson.M{"subscription_id": "sub_dup"}, bson.M{"$set": bson.M{"status": "canceled"}}); err != nil {
+		t.Fatalf("failed to update subscription: %v", err)
+	}
+	if status := deliverStripeEvent(t, app, "evt_sub_updated", "customer.subscription.updated", sub); status != fiber.StatusOK {
+		t.Fatalf("expected 200 for the redelivery, got %d", status)
+	}
+
+	var stored []models.Subscription
+	cursor, err := database.Subscriptions.Find(ctx, bson.M{"subscription_id": "sub_dup"})
+	if err != nil {
+		t.Fatalf("failed to find subscriptions: %v", err)
+	}
+	if err := cursor.All(ctx, &stored); err != nil {
+		t.Fatalf("failed to decode subscriptions: %v", err)
+	}
+	if len(stored) != 1 || stored[0].Status != "canceled" {
+		t.Fatalf("expected the redelivery to be skipped, got %+v", stored)
+	}
+}
+
+func TestStripeWebhookTakesOverExpiredLease(t *testing.T) {
+	app := newStripeWebhookApp(t)
+	ctx := context.Background()
+	userID := seedWebhookUser(t, "payer@example.com")
+	now := time.Now().UTC()
+
+	// The process handling these events died after claiming them. Only the expired
+	// lease may be taken over by a redelivery.
+	for eventID, leaseExpiresAt := range map[string]time.Time{
+		"evt_crashed": now.Add(-time.Minute),
+		"evt_running": now.Add(time.Minute),
+	} {
+		if _, err := database.WebhookEvents.InsertOne(ctx, &models.WebhookEvent{
+			EventID:        eventID,
+			Type:           "checkout.session.completed",
+			Status:         models.WebhookEventProcessing,
+			ClaimedAt:      now.Add(-webhookEventLease),
+			LeaseExpiresAt: leaseExpiresAt,
+		}); err != nil {
+			t.Fatalf("failed to seed webhook event: %v", err)
+		}
+	}
+
+	deliverStripeEvent(t, app, "evt_crashed", "checkout.session.completed", checkoutSessionObject("cs_crashed", userID))
+	deliverStripeEvent(t, app, "evt_running", "checkout.session.completed", checkoutSessionObject("cs_running", userID))
+
+	for transactionID, want := range map[string]int64{"cs_crashed": 1, "cs_running": 0} {
+		count, err := database.Payments.CountDocuments(ctx, bson.M{"transaction_id": transactionID})
+		if err != nil {
+			t.Fatalf("failed to count payments: %v", err)
+		}
+		if count != want {
+			t.Fatalf("expected %d payments for %s, got %d", want, transactionID, count)
+		}
+	}
+	if status := webhookEventStatus(t, "evt_crashed"); status != models.WebhookEventDone {
+		t.Fatalf("expected the taken over event to be done, got %q", status)
+	}
+}
+
+func TestStripeWebhookKeepsOwnerAfterMerge(t *testing.T) {
+	app := newStripeWebhookApp(t)
+	ctx := context.Background()
+	sourceID := seedWebhookUser(t, "old@example.com")
+	targetID := seedWebhookUser(t, "new@example.com")
+
+	if status := deliverStripeEvent(t, app, "evt_created", "customer.subscription.created", stripeSubscriptionObject("sub_merged", sourceID, "active")); status != fiber.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if _, err := repository.NewUserRepository().MergeInto(ctx, sourceID, targetID); err != nil {
+		t.Fatalf("failed to merge users: %v", err)
+	}
+
+	// Stripe still names the source until its metadata is updated
+	if status := deliverStripeEvent(t, app, "evt_updated", "customer.subscription.updated", stripeSubscriptionObject("sub_merged", sourceID, "past_due")); status != fiber.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+
+	var subscription models.Subscription
+	if err := database.Subscriptions.FindOne(ctx, bson.M{"subscription_id": "sub_merged"}).Decode(&subscription); err != nil {
+		t.Fatalf("failed to get subscription: %v", err)
+	}
+	if subscription.UserID != targetID || subscription.Status != "past_due" {
+		t.Fatalf("expected the update applied to the target's subscription, got %+v", subscription)
+	}
+
+	var target models.User
+	if err := database.Users.FindOne(ctx, bson.M{"_id": targetID}).Decode(&target); err != nil {
+		t.Fatalf("failed to get target: %v", err)
+	}
+	if target.Subscription.Status != "past_due" {
+		t.Fatalf("expected the target's plan summary to be updated, got %+v", target.Subscription)
+	}
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"cource-api/internal/config"
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v76"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const subscriptionCreatedEvent = `{
+	"id": "evt_test",
+	"type": "customer.subscription.created",
+	"data": {
+		"object": {
+			"id": "sub_123",
+			"object": "subscription",
+			"status": "active",
+			"currency": "usd",
+			"current_period_start": 1717200000,
+			"current_period_end": 1719792000,
+			"cancel_at_period_end": false,
+			"customer": {
+				"id": "cus_123",
+				"object": "customer",
+				"metadata": {"user_id": "665f1b2c3d4e5f6a7b8c9d0e"}
+			},
+			"default_payment_method": "pm_123",
+			"items": {
+				"object": "list",
+				"data": [
+					{
+						"id": "si_123",
+						"price": {
+							"id": "price_123",
+							"unit_amount": 1999,
+							"currency": "usd",
+							"recurring": {"interval": "month"}
+						}
+					}
+				]
+			}
+		}
+	}
+}`
+
+func TestSubscriptionFromStripeCreatedEvent(t *testing.T) {
+	var event stripe.Event
+	if err := json.Unmarshal([]byte(subscriptionCreatedEvent), &event); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+
+	var sub stripe.Subscription
+	if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+		t.Fatalf("failed to decode subscription: %v", err)
+	}
+
+	subscription, err := subscriptionFromStripe(&sub)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if subscription.UserID.Hex() != "665f1b2c3d4e5f6a7b8c9d0e" {
+		t.Errorf("expected user from customer metadata, got %s", subscription.UserID.Hex())
+	}
+	if subscription.SubscriptionID != "sub_123" || subscription.CustomerID != "cus_123" || subscription.PaymentMethodID != "pm_123" {
+		t.Errorf("unexpected provider IDs: %+v", subscription)
+	}
+	if subscription.Status != "active" || subscription.Plan != "monthly" || subscription.Amount != 19.99 {
+		t.Errorf("unexpected plan details: %+v", subscription)
+	}
+	if !subscription.CurrentPeriodEnd.Equal(time.Unix(1719792000, 0)) {
+		t.Errorf("unexpected period end: %v", subscription.CurrentPeriodEnd)
+	}
+	if subscription.TrialStart != nil || subscription.CanceledAt != nil {
+		t.Errorf("expected unset timestamps to be nil, got %+v", subscription)
+	}
+}
+
+func TestSubscriptionFromStripeMissingUser(t *testing.T) {
+	sub := &stripe.Subscription{ID: "sub_123", Customer: &stripe.Customer{ID: "cus_123"}}
+
+	if _, err := subscriptionFromStripe(sub); err == nil {
+		t.Fatal("expected an error when no user ID is present")
+	}
+}
+
+func TestCoursePurchaseGrantsAccessToPaidVideos(t *testing.T) {
+	courseID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+
+	session := &stripe.CheckoutSession{
+		ID:          "cs_123",
+		AmountTotal: 4999,
+		Currency:    "usd",
+		Customer:    &stripe.Customer{ID: "cus_123"},
+		Metadata: map[string]string{
+			"user_id":   userID.Hex(),
+			"course_id": courseID.Hex(),
+		},
+	}
+
+	payment, err := paymentFromCheckoutSession(session)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payment.UserID != userID {
+		t.Fatalf("expected user from session metadata, got %s", payment.UserID.Hex())
+	}
+	if payment.CourseID == nil || *payment.CourseID != courseID {
+		t.Fatalf("expected payment to record the purchased course, got %v", payment.CourseID)
+	}
+	if payment.Status != "completed" || payment.Amount != 4999 {
+		t.Fatalf("unexpected payment: %+v", payment)
+	}
+
+	paidVideo := &models.Video{IsPaid: true, CourseID: courseID}
+	if videoAccessible(paidVideo, "user", false, false) {
+		t.Fatal("expected paid video to be locked without a purchase")
+	}
+	if !videoAccessible(paidVideo, "user", false, true) {
+		t.Fatal("expected course purchase to unlock paid video")
+	}
+	if !videoAccessible(&models.Video{IsPaid: false}, "user", false, false) {
+		t.Fatal("expected free video to be accessible")
+	}
+}
+
+func TestWithAccessFlagsCoursePurchase(t *testing.T) {
+	bought := &models.Course{ID: primitive.NewObjectID(), IsPaid: true}
+	other := &models.Course{ID: primitive.NewObjectID(), IsPaid: true}
+
+	flagged := withAccessFlags([]*models.Course{bought, other}, "user", false, map[primitive.ObjectID]bool{bought.ID: true})
+	if !flagged[0].HasAccess || flagged[1].HasAccess {
+		t.Fatalf("expected only the purchased course to be accessible, got %+v", flagged)
+	}
+}
+
+func TestCheckoutRedirectURLs(t *testing.T) {
+	original := config.AppConfig
+	defer func() { config.AppConfig = original }()
+
+	config.AppConfig.FrontendSuccessURL = "https://app.example.com/success?session_id={CHECKOUT_SESSION_ID}"
+	config.AppConfig.FrontendCancelURL = "https://app.example.com/cancel"
+	config.AppConfig.CheckoutRedirectHosts = []string{"m.example.com"}
+
+	success, cancel, err := checkoutRedirectURLs("", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if success != config.AppConfig.FrontendSuccessURL || cancel != config.AppConfig.FrontendCancelURL {
+		t.Fatalf("expected configured defaults, got %q and %q", success, cancel)
+	}
+
+	success, _, err = checkoutRedirectURLs("https://m.example.com/done", "")
+	if err != nil || success != "https://m.example.com/done" {
+		t.Fatalf("expected allowlisted override to be used, got %q, %v", success, err)
+	}
+
+	for _, override := range []string{
+		"https://evil.example.net/phish",
+		"javascript:alert(1)",
+		"/relative/path",
+		"//evil.example.net",
+	} {
+		if _, _, err := checkoutRedirectURLs("", override); err == nil {
+			t.Errorf("expected %q to be rejected", override)
+		}
+	}
+}
+
+type recordingMailer struct {
+	to, subject, body string
+}
+
+func (m *recordingMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.to, m.subject, m.body = to, subject, body
+	return nil
+}
+
+func TestSendPaymentReceiptDispatchesPaymentDetails(t *testing.T) {
+	owner := &models.User{ID: primitive.NewObjectID(), Email: "jane@example.com"}
+	payment := &models.Payment{
+		ID:            primitive.NewObjectID(),
+		UserID:        owner.ID,
+		TransactionID: "cs_test_receipt",
+		Amount:        1250,
+		Currency:      "eur",
+		Status:        "completed",
+		Timestamp:     time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	m := &recordingMailer{}
+	if err := sendPaymentReceipt(context.Background(), m, owner, payment); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if m.to != owner.Email {
+		t.Fatalf("expected receipt to be sent to %s, got %s", owner.Email, m.to)
+	}
+	if !strings.Contains(m.subject, payment.ID.Hex()) {
+		t.Fatalf("expected subject to reference the payment, got %q", m.subject)
+	}
+	for _, want := range []string{"cs_test_receipt", "12.50 EUR", "completed"} {
+		if !strings.Contains(m.body, want) {
+			t.Errorf("expected receipt body to contain %q, got %q", want, m.body)
+		}
+	}
+}
+
+func TestValidateRegion(t *testing.T) {
+	pricing := map[string]*models.RegionalPricing{
+		"IN": {RegionCode: "IN", Currency: "inr", CurrencySymbol: "₹"},
+		"US": {RegionCode: "US", Currency: "usd", CurrencySymbol: "$"},
+	}
+	lookup := func(ctx context.Context, region string) (*models.RegionalPricing, error) {
+		return pricing[region], nil
+	}
+
+	known, err := validateRegion(context.Background(), "  in ", "US", lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if known.Region != "IN" || !known.HasPricing || known.UsedFallback || known.Currency != "inr" {
+		t.Fatalf("expected IN pricing, got %+v", known)
+	}
+
+	unknown, err := validateRegion(context.Background(), "fr", "US", lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if unknown.HasPricing || !unknown.UsedFallback || unknown.ResolvedRegion != "US" || unknown.CurrencySymbol != "$" {
+		t.Fatalf("expected fallback to US pricing, got %+v", unknown)
+	}
+
+	for _, input := range []string{"", "USA", "1N", "u-s"} {
+		_, err := validateRegion(context.Background(), input, "US", lookup)
+		if e, ok := err.(*fiber.Error); !ok || e.Code != fiber.StatusBadRequest {
+			t.Errorf("expected %q to be rejected with 400, got %v", input, err)
+		}
+	}
+}
+
+func TestPaymentFromCheckoutSessionStoresStripeReferences(t *testing.T) {
+	session := &stripe.CheckoutSession{
+		ID:            "cs_123",
+		PaymentIntent: &stripe.PaymentIntent{ID: "pi_123"},
+		Invoice:       &stripe.Invoice{ID: "in_123"},
+		Metadata:      map[string]string{"user_id": primitive.NewObjectID().Hex()},
+	}
+
+	payment, err := paymentFromCheckoutSession(session)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payment.PaymentIntentID != "pi_123" || payment.InvoiceID != "in_123" {
+		t.Fatalf("expected Stripe references to be stored, got %+v", payment)
+	}
+}
+
+func TestResolveRefundAmount(t *testing.T) {
+	tests := []struct {
+		name      string
+		refunded  int
+		requested int
+		want      int
+		status    int
+	}{
+		{"full refund", 0, 0, 1000, 0},
+		{"partial refund", 0, 400, 400, 0},
+		{"rest after partial", 400, 0, 600, 0},
+		{"more than remaining", 400, 700, 0, fiber.StatusBadRequest},
+		{"negative", 0, -1, 0, fiber.StatusBadRequest},
+		{"already refunded", 1000, 0, 0, fiber.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := &models.Payment{Amount: 1000, RefundedAmount: tt.refunded}
+			got, err := resolveRefundAmount(payment, tt.requested)
+			if tt.status != 0 {
+				fiberErr, ok := err.(*fiber.Error)
+				if !ok || fiberErr.Code != tt.status {
+					t.Fatalf("expected status %d, got %v", tt.status, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("expected %d, got %d (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestReceiptDescription(t *testing.T) {
+	courseID := primitive.NewObjectID()
+	tests := []struct {
+		name    string
+		payment *models.Payment
+		course  *models.Course
+		want    string
+	}{
+		{"course", &models.Payment{CourseID: &courseID}, &models.Course{Title: "Go Basics"}, "Course: Go Basics"},
+		{"deleted course", &models.Payment{CourseID: &courseID}, nil, "Course purchase"},
+		{"yearly plan", &models.Payment{Plan: "yearly"}, nil, "Yearly subscription"},
+		{"unknown plan", &models.Payment{}, nil, "Subscription"},
+	}
+
+	for _, tt := range tests {
+		if got := receiptDescription(tt.payment, tt.course); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestInvoicePaymentUpdate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	inv := &stripe.Invoice{
+		AmountPaid:        1999,
+		StatusTransitions: &stripe.InvoiceStatusTransitions{PaidAt: now.Add(-time.Minute).Unix()},
+		Lines: &stripe.InvoiceLineItemList{
+			Data: []*stripe.InvoiceLineItem{{Period: &stripe.Period{End: periodEnd.Unix()}}},
+		},
+	}
+
+	failed := invoicePaymentUpdate(inv, &models.Subscription{Status: "active"}, false, now)
+	if failed["status"] != "past_due" || failed["last_payment_status"] != "failed" {
+		t.Fatalf("expected failed payment to mark past due, got %v", failed)
+	}
+
+	paid := invoicePaymentUpdate(inv, &models.Subscription{Status: "past_due"}, true, now)
+	if paid["status"] != "active" || paid["last_payment_status"] != "succeeded" {
+		t.Fatalf("expected paid invoice to reactivate, got %v", paid)
+	}
+	if paid["last_payment_date"] != now.Add(-time.Minute) || paid["next_billing_date"] != periodEnd {
+		t.Fatalf("unexpected billing dates: %v", paid)
+	}
+
+	// The free invoice opening a trial leaves the trial in place
+	trial := invoicePaymentUpdate(&stripe.Invoice{}, &models.Subscription{Status: "trial"}, true, now)
+	if _, ok := trial["status"]; ok {
+		t.Fatalf("expected trial status to be kept, got %v", trial)
+	}
+}
+
+func TestValidateCheckoutPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		planType string
+		region   string
+		want     string
+		valid    bool
+	}{
+		{"monthly", "monthly", "US", "US", true},
+		{"yearly lowercase region", "yearly", " in ", "IN", true},
+		{"missing plan", "", "US", "", false},
+		{"stripe interval as plan", "month", "US", "", false},
+		{"missing region", "monthly", "", "", false},
+		{"long region", "monthly", "USA", "", false},
+		{"numeric region", "monthly", "12", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			region, err := validateCheckoutPlan(tt.planType, tt.region)
+			if (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+			if region != tt.want {
+				t.Fatalf("expected region %q, got %q", tt.want, region)
+			}
+		})
+	}
+}
+
+func TestStripeIntervalMapping(t *testing.T) {
+	for plan, interval := range map[string]string{"monthly": "month", "yearly": "year"} {
+		if got := planToStripeInterval(plan); got != interval {
+			t.Errorf("expected %s to bill every %s, got %q", plan, interval, got)
+		}
+		if got := stripeIntervalToPlan(interval); got != plan {
+			t.Errorf("expected interval %s to be the %s plan, got %q", interval, plan, got)
+		}
+	}
+
+	if got := stripeIntervalToPlan("week"); got != "week" {
+		t.Errorf("expected an interval without a plan to be kept, got %q", got)
+	}
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cource-api/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// payPalRequestTimeout bounds each call to the PayPal REST API
+const payPalRequestTimeout = 15 * time.Second
+
+// zeroDecimalCurrencies are the currencies whose smallest unit is the whole unit, their
+// amounts are sent to PayPal without decimals
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true,
+	"KRW": true, "MGA": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+	"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// payPalGateway takes payments through PayPal orders. An order charges once, so a PayPal
+// checkout buys a single period of the plan without renewal or trial.
+type payPalGateway struct {
+	client    *http.Client
+	baseURL   string
+	clientID  string
+	secret    string
+	webhookID string
+}
+
+func newPayPalGateway() *payPalGateway {
+	return &payPalGateway{
+		client:    &http.Client{Timeout: payPalRequestTimeout},
+		baseURL:   strings.TrimRight(config.AppConfig.PayPalAPIURL, "/"),
+		clientID:  config.AppConfig.PayPalClientID,
+		secret:    config.AppConfig.PayPalSecret,
+		webhookID: config.AppConfig.PayPalWebhookID,
+	}
+}
+
+// payPalAmount is an amount as PayPal represents it, a decimal string in a currency
+type payPalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+// payPalLink is a HATEOAS link of a PayPal resource
+type payPalLink struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+}
+
+// payPalOrder is the part of a PayPal order the checkout uses
+type payPalOrder struct {
+	ID     string       `json:"id"`
+	Status string       `json:"status"`
+	Links  []payPalLink `json:"links"`
+}
+
+// payPalCapture is the resource of a PAYMENT.CAPTURE.COMPLETED event
+type payPalCapture struct {
+	ID                string       `json:"id"`
+	Status            string       `json:"status"`
+	Amount            payPalAmount `json:"amount"`
+	CustomID          string       `json:"custom_id"`
+	SupplementaryData struct {
+		RelatedIDs struct {
+			OrderID string `json:"order_id"`
+		} `json:"related_ids"`
+	} `json:"supplementary_data"`
+}
+
+// formatPayPalAmount converts an amount in the smallest currency unit to PayPal's decimal string
+func formatPayPalAmount(amount int64, currency string) string {
+	if zeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return strconv.FormatInt(amount, 10)
+	}
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
+
+// parsePayPalAmount converts a PayPal amount back to the smallest currency unit
+func parsePayPalAmount(amount payPalAmount) (int, error) {
+	value, err := strconv.ParseFloat(amount.Value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if zeroDecimalCurrencies[strings.ToUpper(amount.CurrencyCode)] {
+		return int(math.Round(value)), nil
+	}
+	return int(math.Round(value * 100)), nil
+}
+
+// do sends an authenticated request to the PayPal REST API and decodes the JSON response into out
+func (g *payPalGateway) do(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return g.send(req, out)
+}
+
+// accessToken exchanges the app credentials for an OAuth access token
+func (g *payPalGateway) accessToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/v1/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(g.clientID, g.secret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := g.send(req, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// send performs a request and decodes a successful JSON response into out
+func (g *payPalGateway) send(req *http.Request, out interface{}) error {
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("paypal %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, body)
+	}
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+// CreateCheckout creates a PayPal order for one period of the plan, with the coupon taken
+// off the amount, and returns the link the buyer approves it at
+func (g *payPalGateway) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	if g.clientID == "" || g.secret == "" {
+		logrus.Error("PayPal credentials are not configured")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Payment system is not properly configured")
+	}
+
+	amount := discountedAmount(req.Amount, req.Coupon)
+	if amount <= 0 {
+		return nil, errCouponCoversPrice
+	}
+
+	// PayPal copies the custom_id of the purchase unit to the capture
+	metadata := newOrderMetadata(req)
+
+	body := map[string]interface{}{
+		"intent": "CAPTURE",
+		"purchase_units": []map[string]interface{}{
+			{
+				"custom_id":   metadata.encode(),
+				"description": fmt.Sprintf("Course Subscription (%s)", req.PlanType),
+				"amount": payPalAmount{
+					CurrencyCode: strings.ToUpper(req.Currency),
+					Value:        formatPayPalAmount(amount, req.Currency),
+				},
+			},
+		},
+		"application_context": map[string]string{
+			"return_url":          req.SuccessURL,
+			"cancel_url":          req.CancelURL,
+			"user_action":         "PAY_NOW",
+			"shipping_preference": "NO_SHIPPING",
+		},
+	}
+
+	var order payPalOrder
+	if err := g.do(ctx, http.MethodPost, "/v2/checkout/orders", body, &order); err != nil {
+		return nil, err
+	}
+
+	for _, link := range order.Links {
+		if link.Rel == "approve" || link.Rel == "payer-action" {
+			return &Checkout{SessionID: order.ID, URL: link.Href}, nil
+		}
+	}
+	return nil, fmt.Errorf("paypal order %s has no approval link", order.ID)
+}
+
+// CaptureOrder charges an order the buyer approved. PayPal confirms the charge with a
+// PAYMENT.CAPTURE.COMPLETED event.
+func (g *payPalGateway) CaptureOrder(ctx context.Context, orderID string) error {
+	return g.do(ctx, http.MethodPost, "/v2/checkout/orders/"+orderID+"/capture", nil, nil)
+}
+
+// VerifyWebhook asks PayPal to check the transmission signature of a webhook against the
+// configured webhook ID
+func (g *payPalGateway) VerifyWebhook(ctx context.Context, payload []byte, header func(string) string) error {
+	if g.webhookID == "" || g.clientID == "" || g.secret == "" {
+		logrus.Error("PayPal webhook is not configured")
+		return fiber.NewError(fiber.StatusInternalServerError, "Webhook configuration is missing")
+	}
+
+	body := map[string]interface{}{
+		"auth_algo":         header("Paypal-Auth-Algo"),
+		"cert_url":          header("Paypal-Cert-Url"),
+		"transmission_id":   header("Paypal-Transmission-Id"),
+		"transmission_sig":  header("Paypal-Transmission-Sig"),
+		"transmission_time": header("Paypal-Transmission-Time"),
+		"webhook_id":        g.webhookID,
+		"webhook_event":     json.RawMessage(payload),
+	}
+
+	var result struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	if err := g.do(ctx, http.MethodPost, "/v1/notifications/verify-webhook-signature", body, &result); err != nil {
+		return err
+	}
+	if result.VerificationStatus != "SUCCESS" {
+		return fmt.Errorf("paypal webhook verification status %q", result.VerificationStatus)
+	}
+	return nil
+}
+
+// ParseEvent reads a PayPal webhook event, its resource becomes the event data
+func (g *payPalGateway) ParseEvent(payload []byte) (*GatewayEvent, error) {
+	var event struct {
+		ID        string          `json:"id"`
+		EventType string          `json:"event_type"`
+		Resource  json.RawMessage `json:"resource"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	if event.ID == "" || event.EventType == "" {
+		return nil, fmt.Errorf("paypal webhook event without id or type")
+	}
+	return &GatewayEvent{ID: event.ID, Type: event.EventType, Data: event.Resource}, nil
+}
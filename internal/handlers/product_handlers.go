@@ -3,27 +3,50 @@ package handlers
 import (
 	"cource-api/internal/models"
 	"cource-api/internal/repository"
+	"errors"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // HandleListProducts returns a paginated list of products
 func HandleListProducts(repo *repository.ProductRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		page := c.QueryInt("page", 1)
-		limit := c.QueryInt("limit", 10)
+		pagination := parsePagination(c, defaultPageLimit)
 
-		products, total, err := repo.List(c.Context(), int64(page), int64(limit))
+		products, total, err := repo.List(c.Context(), pagination.Page, pagination.Limit)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list products")
+		}
+		for _, product := range products {
+			product.ComputeDiscount()
+		}
+
+		return c.JSON(Paginate(products, total, pagination))
+	}
+}
+
+// onSaleProducts returns the discounted products with their discount computed
+func onSaleProducts(products []*models.Product) []*models.Product {
+	onSale := []*models.Product{}
+	for _, product := range products {
+		if product.OnSale() {
+			product.ComputeDiscount()
+			onSale = append(onSale, product)
+		}
+	}
+	return onSale
+}
+
+// HandleListOnSaleProducts lists the active products priced below their original price
+func HandleListOnSaleProducts(repo *repository.ProductRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		products, err := repo.ListActive(c.Context())
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list products")
 		}
 
 		return c.JSON(fiber.Map{
-			"products": products,
-			"total":    total,
-			"page":     page,
-			"limit":    limit,
+			"products": onSaleProducts(products),
 		})
 	}
 }
@@ -33,31 +56,65 @@ func HandleCreateProduct(repo *repository.ProductRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var product models.Product
 		if err := c.BodyParser(&product); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		if err := repo.Create(c.Context(), &product); err != nil {
+			if errors.Is(err, repository.ErrProductIDExists) {
+				return fiber.NewError(fiber.StatusConflict, "Product with this product ID already exists")
+			}
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create product")
 		}
 
+		product.ComputeDiscount()
 		return c.Status(fiber.StatusCreated).JSON(product)
 	}
 }
 
+// HandleUpsertProductByExternalID creates or updates a product identified by its external product ID
+func HandleUpsertProductByExternalID(repo *repository.ProductRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		productID := c.Params("productID")
+		if productID == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Product ID is required")
+		}
+
+		var product models.Product
+		if err := c.BodyParser(&product); err != nil {
+			return errInvalidBody
+		}
+
+		product.ProductID = productID
+		created, err := repo.UpsertByProductID(c.Context(), &product)
+		if err != nil {
+			if errors.Is(err, repository.ErrProductIDExists) {
+				return fiber.NewError(fiber.StatusConflict, "Product is being saved by another request, try again")
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to save product")
+		}
+
+		product.ComputeDiscount()
+		if created {
+			return c.Status(fiber.StatusCreated).JSON(product)
+		}
+		return c.JSON(product)
+	}
+}
+
 // HandleGetProduct retrieves a product by ID
 func HandleGetProduct(repo *repository.ProductRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid product ID")
+			return err
 		}
 
 		product, err := repo.GetByID(c.Context(), objectID)
-		if err != nil {
-			return fiber.NewError(fiber.StatusNotFound, "Product not found")
+		if err != nil || product == nil {
+			return errProductNotFound
 		}
 
+		product.ComputeDiscount()
 		return c.JSON(product)
 	}
 }
@@ -65,15 +122,14 @@ func HandleGetProduct(repo *repository.ProductRepository) fiber.Handler {
 // HandleUpdateProduct updates an existing product
 func HandleUpdateProduct(repo *repository.ProductRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid product ID")
+			return err
 		}
 
 		var product models.Product
 		if err := c.BodyParser(&product); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		product.ID = objectID
@@ -81,6 +137,7 @@ func HandleUpdateProduct(repo *repository.ProductRepository) fiber.Handler {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update product")
 		}
 
+		product.ComputeDiscount()
 		return c.JSON(product)
 	}
 }
@@ -88,10 +145,9 @@ func HandleUpdateProduct(repo *repository.ProductRepository) fiber.Handler {
 // HandleDeleteProduct deletes a product
 func HandleDeleteProduct(repo *repository.ProductRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid product ID")
+			return err
 		}
 
 		if err := repo.Delete(c.Context(), objectID); err != nil {
@@ -105,10 +161,9 @@ func HandleDeleteProduct(repo *repository.ProductRepository) fiber.Handler {
 // HandleUpdateProductPrice updates a product's price
 func HandleUpdateProductPrice(repo *repository.ProductRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid product ID")
+			return err
 		}
 
 		var request struct {
@@ -116,7 +171,7 @@ func HandleUpdateProductPrice(repo *repository.ProductRepository) fiber.Handler
 			OriginalPrice float64 `json:"original_price"`
 		}
 		if err := c.BodyParser(&request); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		if err := repo.UpdatePrice(c.Context(), objectID, request.Price, request.OriginalPrice); err != nil {
@@ -130,17 +185,16 @@ func HandleUpdateProductPrice(repo *repository.ProductRepository) fiber.Handler
 // HandleUpdateProductStatus updates a product's status
 func HandleUpdateProductStatus(repo *repository.ProductRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid product ID")
+			return err
 		}
 
 		var request struct {
 			Status bool `json:"status"`
 		}
 		if err := c.BodyParser(&request); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		if err := repo.UpdateStatus(c.Context(), objectID, request.Status); err != nil {
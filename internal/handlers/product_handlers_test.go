@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestProductComputeDiscount(t *testing.T) {
+	cases := []struct {
+		name          string
+		price, orig   float64
+		wantAmount    float64
+		wantPercent   float64
+		wantOnSaleNow bool
+	}{
+		{"discounted", 79.99, 99.99, 20, 20, true},
+		{"third off", 20, 30, 10, 33.33, true},
+		{"no original price", 49, 0, 0, 0, false},
+		{"same price", 49, 49, 0, 0, false},
+		{"original below price", 49, 39, 0, 0, false},
+	}
+
+	for _, tc := range cases {
+		product := &models.Product{Price: tc.price, OriginalPrice: tc.orig}
+		product.ComputeDiscount()
+		if product.DiscountAmount != tc.wantAmount || product.DiscountPercent != tc.wantPercent {
+			t.Errorf("%s: expected %v off (%v%%), got %v off (%v%%)", tc.name, tc.wantAmount, tc.wantPercent, product.DiscountAmount, product.DiscountPercent)
+		}
+		if product.OnSale() != tc.wantOnSaleNow {
+			t.Errorf("%s: expected on sale %v", tc.name, tc.wantOnSaleNow)
+		}
+	}
+}
+
+func TestOnSaleProductsFiltersUndiscounted(t *testing.T) {
+	products := []*models.Product{
+		{ProductID: "full", Price: 10, OriginalPrice: 10},
+		{ProductID: "sale", Price: 5, OriginalPrice: 10},
+		{ProductID: "unset", Price: 10},
+	}
+
+	onSale := onSaleProducts(products)
+	if len(onSale) != 1 || onSale[0].ProductID != "sale" {
+		t.Fatalf("expected only the discounted product, got %+v", onSale)
+	}
+	if onSale[0].DiscountPercent != 50 {
+		t.Fatalf("expected a 50%% discount, got %v", onSale[0].DiscountPercent)
+	}
+}
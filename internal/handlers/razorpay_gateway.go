@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cource-api/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// razorpayAPIURL is the base URL of the Razorpay REST API
+	razorpayAPIURL = "https://api.razorpay.com"
+	// razorpayRequestTimeout bounds each call to the Razorpay API
+	razorpayRequestTimeout = 15 * time.Second
+	// razorpayRegion is the region whose checkouts go through Razorpay unless the client
+	// asks for another gateway
+	razorpayRegion = "IN"
+)
+
+// razorpayGateway takes payments through Razorpay orders, paid in the Razorpay Checkout
+// widget opened by the client. An order charges once, so a Razorpay checkout buys a single
+// period of the plan without renewal or trial.
+type razorpayGateway struct {
+	client        *http.Client
+	baseURL       string
+	keyID         string
+	secret        string
+	webhookSecret string
+}
+
+func newRazorpayGateway() *razorpayGateway {
+	return &razorpayGateway{
+		client:        &http.Client{Timeout: razorpayRequestTimeout},
+		baseURL:       razorpayAPIURL,
+		keyID:         config.AppConfig.RazorpayKeyID,
+		secret:        config.AppConfig.RazorpaySecret,
+		webhookSecret: config.AppConfig.RazorpayWebhookSecret,
+	}
+}
+
+// razorpayNotes are the notes of a Razorpay entity. Razorpay sends an empty array rather
+// than an object when there are none.
+type razorpayNotes map[string]string
+
+func (n *razorpayNotes) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("[]")) {
+		*n = razorpayNotes{}
+		return nil
+	}
+	return json.Unmarshal(data, (*map[string]string)(n))
+}
+
+// razorpayPayment is the payment entity of a payment.captured event
+type razorpayPayment struct {
+	ID       string        `json:"id"`
+	OrderID  string        `json:"order_id"`
+	Amount   int           `json:"amount"`
+	Currency string        `json:"currency"`
+	Status   string        `json:"status"`
+	Notes    razorpayNotes `json:"notes"`
+}
+
+// CreateCheckout creates a Razorpay order for one period of the plan, with the coupon
+// taken off the amount. The client opens Razorpay Checkout with the order ID and key ID.
+func (g *razorpayGateway) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	if g.keyID == "" || g.secret == "" {
+		logrus.Error("Razorpay keys are not configured")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Payment system is not properly configured")
+	}
+
+	amount := discountedAmount(req.Amount, req.Coupon)
+	if amount <= 0 {
+		return nil, errCouponCoversPrice
+	}
+
+	// Razorpay copies the notes of the order to its payments
+	body := map[string]interface{}{
+		"amount":          amount,
+		"currency":        strings.ToUpper(req.Currency),
+		"receipt":         req.User.ID.Hex(),
+		"notes":           newOrderMetadata(req).notes(),
+		"payment_capture": 1,
+	}
+
+	var order struct {
+		ID string `json:"id"`
+	}
+	if err := g.do(ctx, http.MethodPost, "/v1/orders", body, &order); err != nil {
+		return nil, err
+	}
+	return &Checkout{SessionID: order.ID, KeyID: g.keyID}, nil
+}
+
+// do sends a request authenticated with the API keys and decodes the JSON response into out
+func (g *razorpayGateway) do(ctx context.Context, method, path string, body, out interface{}) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.keyID, g.secret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("razorpay %s %s: %s: %s", method, path, resp.Status, respBody)
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// razorpaySignature is the hex HMAC-SHA256 of a payload Razorpay signs with the secret
+func razorpaySignature(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the X-Razorpay-Signature header is the signature of the payload
+// with the webhook secret
+func (g *razorpayGateway) VerifyWebhook(ctx context.Context, payload []byte, header func(string) string) error {
+	if g.webhookSecret == "" {
+		logrus.Error("Razorpay webhook secret is not configured")
+		return fiber.NewError(fiber.StatusInternalServerError, "Webhook configuration is missing")
+	}
+
+	signature := header("X-Razorpay-Signature")
+	if signature == "" {
+		return errors.New("missing razorpay signature")
+	}
+	if !hmac.Equal([]byte(signature), []byte(razorpaySignature(payload, g.webhookSecret))) {
+		return errors.New("razorpay signature mismatch")
+	}
+	return nil
+}
+
+// ParseEvent reads a Razorpay webhook event, the payment it is about becomes the event
+// data. Razorpay events carry no ID in the body, so payment events are identified by their
+// type and payment and other events have no ID.
+func (g *razorpayGateway) ParseEvent(payload []byte) (*GatewayEvent, error) {
+	var event struct {
+		Event   string `json:"event"`
+		Payload struct {
+			Payment struct {
+				Entity json.RawMessage `json:"entity"`
+			} `json:"payment"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	if event.Event == "" {
+		return nil, errors.New("razorpay webhook event without a type")
+	}
+
+	gatewayEvent := &GatewayEvent{Type: event.Event, Data: event.Payload.Payment.Entity}
+	if len(event.Payload.Payment.Entity) > 0 {
+		var payment struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(event.Payload.Payment.Entity, &payment); err != nil {
+			return nil, err
+		}
+		gatewayEvent.ID = event.Event + ":" + payment.ID
+	}
+	return gatewayEvent, nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cource-api/internal/config"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckoutGatewayName(t *testing.T) {
+	original := config.AppConfig
+	defer func() { config.AppConfig = original }()
+	config.AppConfig.RazorpayKeyID = "rzp_test"
+
+	tests := []struct {
+		requested string
+		region    string
+		want      string
+	}{
+		{"", "IN", gatewayRazorpay},
+		{"", " in ", gatewayRazorpay},
+		{"", "US", ""},
+		{"stripe", "IN", "stripe"},
+		{"paypal", "IN", "paypal"},
+	}
+	for _, tt := range tests {
+		if got := checkoutGatewayName(tt.requested, tt.region); got != tt.want {
+			t.Errorf("checkoutGatewayName(%q, %q) = %q, want %q", tt.requested, tt.region, got, tt.want)
+		}
+	}
+
+	config.AppConfig.RazorpayKeyID = ""
+	if got := checkoutGatewayName("", "IN"); got != "" {
+		t.Fatalf("expected Stripe when Razorpay is not configured, got %q", got)
+	}
+}
+
+func TestRazorpayGatewayVerifyWebhook(t *testing.T) {
+	g := &razorpayGateway{webhookSecret: "whsec"}
+	payload := []byte(`{"event": "payment.captured"}`)
+	headers := func(signature string) func(string) string {
+		return func(key string) string {
+			if key == "X-Razorpay-Signature" {
+				return signature
+			}
+			return ""
+		}
+	}
+
+	if err := g.VerifyWebhook(context.Background(), payload, headers(razorpaySignature(payload, "whsec"))); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	if err := g.VerifyWebhook(context.Background(), payload, headers(razorpaySignature(payload, "other"))); err == nil {
+		t.Fatal("expected a signature with another secret to be rejected")
+	}
+	if err := g.VerifyWebhook(context.Background(), payload, headers("")); err == nil {
+		t.Fatal("expected a missing signature to be rejected")
+	}
+}
+
+func TestRazorpayGatewayParseEvent(t *testing.T) {
+	userID := primitive.NewObjectID()
+	payload := `{
+		"entity": "event",
+		"event": "payment.captured",
+		"payload": {"payment": {"entity": {
+			"id": "pay_1", "order_id": "order_1", "amount": 49900, "currency": "INR", "status": "captured",
+			"notes": {"user_id": "` + userID.Hex() + `", "plan_type": "monthly", "coupon_id": "", "coupon_code": ""}
+		}}}
+	}`
+
+	event, err := (&razorpayGateway{}).ParseEvent([]byte(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.ID != "payment.captured:pay_1" || event.Type != "payment.captured" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	var captured razorpayPayment
+	if err := json.Unmarshal(event.Data, &captured); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	payment, metadata, err := paymentFromRazorpay(&captured, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payment.Gateway != gatewayRazorpay || payment.TransactionID != "pay_1" || payment.UserID != userID ||
+		payment.Amount != 49900 || payment.Currency != "inr" || metadata.PlanType != "monthly" {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+}
+
+func TestRazorpayPaymentWithoutNotes(t *testing.T) {
+	var captured razorpayPayment
+	if err := json.Unmarshal([]byte(`{"id": "pay_2", "notes": []}`), &captured); err != nil {
+		t.Fatalf("expected empty notes to parse, got %v", err)
+	}
+	if _, _, err := paymentFromRazorpay(&captured, time.Now().UTC()); err == nil {
+		t.Fatal("expected a payment without a user to be rejected")
+	}
+}
+
+func TestRazorpayGatewayCreateCheckout(t *testing.T) {
+	var order map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "rzp_test" || pass != "secret" || r.URL.Path != "/v1/orders" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&order)
+		w.Write([]byte(`{"id": "order_1", "status": "created"}`))
+	}))
+	defer server.Close()
+
+	g := &razorpayGateway{client: server.Client(), baseURL: server.URL, keyID: "rzp_test", secret: "secret"}
+	userID := primitive.NewObjectID()
+	checkout, err := g.CreateCheckout(context.Background(), &CheckoutRequest{
+		User:     &models.User{ID: userID},
+		PlanType: "yearly",
+		Amount:   499900,
+		Currency: "inr",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checkout.SessionID != "order_1" || checkout.KeyID != "rzp_test" {
+		t.Fatalf("unexpected checkout %+v", checkout)
+	}
+
+	notes := order["notes"].(map[string]interface{})
+	if order["amount"] != float64(499900) || order["currency"] != "INR" || notes["user_id"] != userID.Hex() || notes["plan_type"] != "yearly" {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// currencySymbols lists the ISO 4217 currencies regional pricing may be set in, with the
+// symbols accepted for each. The first symbol is used when none is given.
+var currencySymbols = map[string][]string{
+	"USD": {"$", "US$"},
+	"EUR": {"€"},
+	"GBP": {"£"},
+	"INR": {"₹", "Rs"},
+	"JPY": {"¥", "円"},
+	"CNY": {"¥", "元"},
+	"CAD": {"$", "CA$"},
+	"AUD": {"$", "A$"},
+	"NZD": {"$", "NZ$"},
+	"SGD": {"$", "S$"},
+	"HKD": {"$", "HK$"},
+	"CHF": {"CHF", "Fr."},
+	"SEK": {"kr"},
+	"NOK": {"kr"},
+	"DKK": {"kr."},
+	"PLN": {"zł"},
+	"CZK": {"Kč"},
+	"BRL": {"R$"},
+	"MXN": {"$", "MX$"},
+	"ZAR": {"R"},
+	"KRW": {"₩"},
+	"IDR": {"Rp"},
+	"PHP": {"₱"},
+	"THB": {"฿"},
+	"MYR": {"RM"},
+	"TRY": {"₺"},
+	"AED": {"د.إ", "AED"},
+	"SAR": {"﷼", "SAR"},
+	"ILS": {"₪"},
+	"NGN": {"₦"},
+}
+
+// regionalPricingRequest is the body of the regional pricing update endpoint
+type regionalPricingRequest struct {
+	Currency       string `json:"currency"`
+	MonthlyPrice   int    `json:"monthly_price"`
+	YearlyPrice    int    `json:"yearly_price"`
+	CurrencySymbol string `json:"currency_symbol"`
+	// AllowCheaperYearly accepts a yearly price below the monthly one
+	AllowCheaperYearly bool `json:"allow_cheaper_yearly"`
+}
+
+// normalizeCurrency makes currency codes case insensitive
+func normalizeCurrency(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+// buildRegionalPricing validates a pricing update for a region and returns the pricing to
+// store, with the currency normalized and the symbol defaulted from it
+func buildRegionalPricing(regionCode string, req regionalPricingRequest) (*models.RegionalPricing, error) {
+	currency := normalizeCurrency(req.Currency)
+	if currency == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Currency is required")
+	}
+	symbols, ok := currencySymbols[currency]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Currency %q is not a supported ISO 4217 code", req.Currency))
+	}
+
+	symbol := strings.TrimSpace(req.CurrencySymbol)
+	if symbol == "" {
+		symbol = symbols[0]
+	} else if !slices.Contains(symbols, symbol) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Currency symbol %q does not match %s, expected one of %s", symbol, currency, strings.Join(symbols, " ")))
+	}
+
+	if req.MonthlyPrice <= 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Monthly price must be greater than 0")
+	}
+	if req.YearlyPrice <= 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Yearly price must be greater than 0")
+	}
+	if req.YearlyPrice < req.MonthlyPrice && !req.AllowCheaperYearly {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Yearly price %d is less than monthly price %d, set allow_cheaper_yearly if this is intended", req.YearlyPrice, req.MonthlyPrice))
+	}
+
+	return &models.RegionalPricing{
+		RegionCode:     regionCode,
+		Currency:       currency,
+		MonthlyPrice:   req.MonthlyPrice,
+		YearlyPrice:    req.YearlyPrice,
+		CurrencySymbol: symbol,
+	}, nil
+}
+
+// regionalPricingResponse is regional pricing as served to clients, with the savings of
+// the yearly plan derived from the stored prices
+type regionalPricingResponse struct {
+	*models.RegionalPricing
+	// YearlyMonthlyPrice is the yearly price spread over twelve months, rounded to the
+	// smallest currency unit
+	YearlyMonthlyPrice int `json:"yearly_monthly_price"`
+	// YearlySavingsPercent is how much less the yearly plan costs than twelve monthly
+	// payments, rounded to one decimal and never negative
+	YearlySavingsPercent float64 `json:"yearly_savings_percent"`
+}
+
+// withYearlySavings derives the effective monthly cost of the yearly plan and the
+// percentage it saves over paying monthly
+func withYearlySavings(pricing *models.RegionalPricing) regionalPricingResponse {
+	resp := regionalPricingResponse{
+		RegionalPricing:    pricing,
+		YearlyMonthlyPrice: int(math.Round(float64(pricing.YearlyPrice) / 12)),
+	}
+	if pricing.MonthlyPrice <= 0 {
+		return resp
+	}
+
+	saved := 1 - float64(pricing.YearlyPrice)/float64(12*pricing.MonthlyPrice)
+	if saved > 0 {
+		resp.YearlySavingsPercent = math.Round(saved*1000) / 10
+	}
+	return resp
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestBuildRegionalPricing(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    regionalPricingRequest
+		valid  bool
+		symbol string
+	}{
+		{"valid", regionalPricingRequest{Currency: "USD", MonthlyPrice: 1000, YearlyPrice: 10000, CurrencySymbol: "$"}, true, "$"},
+		{"lowercase currency", regionalPricingRequest{Currency: " eur ", MonthlyPrice: 900, YearlyPrice: 9000}, true, "€"},
+		{"alternate symbol", regionalPricingRequest{Currency: "INR", MonthlyPrice: 500, YearlyPrice: 5000, CurrencySymbol: "Rs"}, true, "Rs"},
+		{"unknown currency", regionalPricingRequest{Currency: "USX", MonthlyPrice: 1000, YearlyPrice: 10000}, false, ""},
+		{"missing currency", regionalPricingRequest{MonthlyPrice: 1000, YearlyPrice: 10000}, false, ""},
+		{"mismatched symbol", regionalPricingRequest{Currency: "GBP", MonthlyPrice: 1000, YearlyPrice: 10000, CurrencySymbol: "$"}, false, ""},
+		{"zero monthly", regionalPricingRequest{Currency: "USD", YearlyPrice: 10000}, false, ""},
+		{"cheaper yearly", regionalPricingRequest{Currency: "USD", MonthlyPrice: 1000, YearlyPrice: 500}, false, ""},
+		{"cheaper yearly allowed", regionalPricingRequest{Currency: "USD", MonthlyPrice: 1000, YearlyPrice: 500, AllowCheaperYearly: true}, true, "$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pricing, err := buildRegionalPricing("US", tt.req)
+			if (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+			if !tt.valid {
+				return
+			}
+			if pricing.RegionCode != "US" || pricing.CurrencySymbol != tt.symbol || pricing.Currency != normalizeCurrency(tt.req.Currency) {
+				t.Fatalf("unexpected pricing %+v", pricing)
+			}
+		})
+	}
+}
+
+func TestWithYearlySavings(t *testing.T) {
+	tests := []struct {
+		name    string
+		pricing models.RegionalPricing
+		monthly int
+		percent float64
+	}{
+		{"two months free", models.RegionalPricing{MonthlyPrice: 1000, YearlyPrice: 10000}, 833, 16.7},
+		{"no discount", models.RegionalPricing{MonthlyPrice: 1000, YearlyPrice: 12000}, 1000, 0},
+		{"yearly costs more", models.RegionalPricing{MonthlyPrice: 1000, YearlyPrice: 13000}, 1083, 0},
+		{"zero monthly", models.RegionalPricing{YearlyPrice: 6000}, 500, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := withYearlySavings(&tt.pricing)
+			if resp.YearlyMonthlyPrice != tt.monthly || resp.YearlySavingsPercent != tt.percent {
+				t.Fatalf("expected %d %.1f%%, got %d %.1f%%", tt.monthly, tt.percent, resp.YearlyMonthlyPrice, resp.YearlySavingsPercent)
+			}
+		})
+	}
+}
+
+func TestRegionalPricingResponseJSON(t *testing.T) {
+	pricing := &models.RegionalPricing{RegionCode: "US", Currency: "USD", MonthlyPrice: 1000, YearlyPrice: 10000}
+	body, err := json.Marshal(withYearlySavings(pricing))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["region_code"] != "US" || got["monthly_price"] != float64(1000) || got["yearly_savings_percent"] != 16.7 {
+		t.Fatalf("unexpected response %s", body)
+	}
+}
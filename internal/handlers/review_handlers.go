@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxReviewCommentLength caps the length of a review comment
+const maxReviewCommentLength = 2000
+
+// reviewRequest is the body of the review create and update endpoints
+type reviewRequest struct {
+	Rating  int    `json:"rating"`
+	Comment string `json:"comment"`
+}
+
+// applyReviewRequest validates the request and copies it onto the review
+func applyReviewRequest(review *models.Review, req reviewRequest) error {
+	if req.Rating < 1 || req.Rating > 5 {
+		return fiber.NewError(fiber.StatusBadRequest, "Rating must be between 1 and 5")
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if len(comment) > maxReviewCommentLength {
+		return fiber.NewError(fiber.StatusBadRequest, "Comment must be at most 2000 characters")
+	}
+	review.Rating = req.Rating
+	review.Comment = comment
+	return nil
+}
+
+// applyRatings fills the average rating and review count of the courses. Ratings are
+// secondary to the course data, so a failure is only logged.
+func applyRatings(ctx context.Context, reviewRepo *repository.ReviewRepository, courses ...*models.Course) {
+	ids := make([]primitive.ObjectID, len(courses))
+	for i, course := range courses {
+		ids[i] = course.ID
+	}
+
+	summaries, err := reviewRepo.GetAverages(ctx, ids)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get course ratings")
+		return
+	}
+	for _, course := range courses {
+		if summary, ok := summaries[course.ID]; ok {
+			course.AverageRating = summary.AverageRating
+			course.ReviewCount = summary.ReviewCount
+		}
+	}
+}
+
+// getReviewableCourse returns the course being reviewed, 404 when it does not exist
+func getReviewableCourse(c *fiber.Ctx, courseRepo *repository.CourseRepository) (*models.Course, error) {
+	courseID, err := parseObjectID(c, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	course, err := courseRepo.GetByID(c.Context(), courseID)
+	if err != nil {
+		log(c).WithError(err).WithField("course_id", courseID).Error("Failed to get course")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
+	}
+	if course == nil {
+		return nil, errCourseNotFound
+	}
+	return course, nil
+}
+
+// HandleCreateReview rates a course the current user is enrolled in
+func HandleCreateReview(
+	courseRepo *repository.CourseRepository,
+	reviewRepo *repository.ReviewRepository,
+	enrollmentRepo *repository.EnrollmentRepository,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		course, err := getReviewableCourse(c, courseRepo)
+		if err != nil {
+			return err
+		}
+
+		var req reviewRequest
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+		review := &models.Review{UserID: user.ID, CourseID: course.ID}
+		if err := applyReviewRequest(review, req); err != nil {
+			return err
+		}
+
+		enrolled, err := enrollmentRepo.IsEnrolled(c.Context(), user.ID, course.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to check enrollment")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create review")
+		}
+		if !enrolled {
+			return fiber.NewError(fiber.StatusForbidden, "Only enrolled users can review this course")
+		}
+
+		if err := reviewRepo.Create(c.Context(), review); err != nil {
+			if errors.Is(err, repository.ErrAlreadyReviewed) {
+				return fiber.NewError(fiber.StatusConflict, "You have already reviewed this course")
+			}
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"user_id":   user.ID,
+				"course_id": course.ID,
+			}).Error("Failed to create review")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create review")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(review)
+	}
+}
+
+// HandleListReviews lists the reviews of a course with pagination, newest first
+func HandleListReviews(courseRepo *repository.CourseRepository, reviewRepo *repository.ReviewRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		course, err := getReviewableCourse(c, courseRepo)
+		if err != nil {
+			return err
+		}
+
+		pagination := parsePagination(c, defaultPageLimit)
+		reviews, total, err := reviewRepo.ListByCourse(c.Context(), course.ID, pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).WithField("course_id", course.ID).Error("Failed to list reviews")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list reviews")
+		}
+
+		return c.JSON(Paginate(reviews, total, pagination))
+	}
+}
+
+// HandleUpdateReview changes the current user's review of a course
+func HandleUpdateReview(reviewRepo *repository.ReviewRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		courseID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		review, err := reviewRepo.GetByUserAndCourse(c.Context(), user.ID, courseID)
+		if err != nil {
+			log(c).WithError(err).WithField("course_id", courseID).Error("Failed to get review")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update review")
+		}
+		if review == nil {
+			return errReviewNotFound
+		}
+
+		var req reviewRequest
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+		if err := applyReviewRequest(review, req); err != nil {
+			return err
+		}
+
+		if err := reviewRepo.Update(c.Context(), review); err != nil {
+			log(c).WithError(err).WithField("review_id", review.ID).Error("Failed to update review")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update review")
+		}
+
+		return c.JSON(review)
+	}
+}
+
+// HandleDeleteReview deletes the current user's review of a course
+func HandleDeleteReview(reviewRepo *repository.ReviewRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		courseID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		deleted, err := reviewRepo.Delete(c.Context(), user.ID, courseID)
+		if err != nil {
+			log(c).WithError(err).WithField("course_id", courseID).Error("Failed to delete review")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete review")
+		}
+		if !deleted {
+			return errReviewNotFound
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
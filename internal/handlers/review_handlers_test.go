@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestApplyReviewRequest(t *testing.T) {
+	review := &models.Review{}
+	if err := applyReviewRequest(review, reviewRequest{Rating: 4, Comment: "  Great course  "}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if review.Rating != 4 || review.Comment != "Great course" {
+		t.Fatalf("expected rating and trimmed comment, got %+v", review)
+	}
+
+	invalid := []reviewRequest{
+		{Rating: 0},
+		{Rating: 6},
+		{Rating: 3, Comment: strings.Repeat("a", maxReviewCommentLength+1)},
+	}
+	for _, req := range invalid {
+		if err := applyReviewRequest(&models.Review{}, req); err == nil {
+			t.Errorf("expected %+v to be rejected", req)
+		}
+	}
+}
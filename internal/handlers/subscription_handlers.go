@@ -1,37 +1,102 @@
 package handlers
 
 import (
+	"time"
+
+	"cource-api/internal/config"
 	"cource-api/internal/models"
 	"cource-api/internal/repository"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/customer"
+	stripeinvoice "github.com/stripe/stripe-go/v76/invoice"
+	stripesubscription "github.com/stripe/stripe-go/v76/subscription"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// checkNoActiveSubscription rejects with 409 when the user already has a running
+// subscription other than excludeID
+func checkNoActiveSubscription(c *fiber.Ctx, repo *repository.SubscriptionRepository, userID, excludeID primitive.ObjectID) error {
+	existing, err := repo.GetConflictingActive(c.Context(), userID, excludeID)
+	if err != nil {
+		log(c).WithError(err).WithField("user_id", userID).Error("Failed to check active subscriptions")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to check active subscriptions")
+	}
+	if existing != nil {
+		return fiber.NewError(fiber.StatusConflict, "User already has an active subscription")
+	}
+	return nil
+}
+
+// checkSubscriptionOwner rejects a missing subscription with 404 and one of another user
+// with 403, action naming what the user tried to do with it
+func checkSubscriptionOwner(subscription *models.Subscription, userID primitive.ObjectID, action string) error {
+	if subscription == nil {
+		return errSubscriptionNotFound
+	}
+	if subscription.UserID != userID {
+		return fiber.NewError(fiber.StatusForbidden, "Not authorized to "+action+" this subscription")
+	}
+	return nil
+}
+
+// getOwnedSubscription gets a subscription of the user by ID, see checkSubscriptionOwner
+func getOwnedSubscription(c *fiber.Ctx, repo *repository.SubscriptionRepository, id, userID primitive.ObjectID, action string) (*models.Subscription, error) {
+	subscription, err := repo.GetByID(c.Context(), id)
+	if err != nil {
+		log(c).WithError(err).WithField("subscription_id", id).Error("Failed to get subscription")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to get subscription")
+	}
+	if err := checkSubscriptionOwner(subscription, userID, action); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// startTrial puts a new subscription on a trial of trialDays from now, the trial being
+// its first period
+func startTrial(subscription *models.Subscription, trialDays int, now time.Time) {
+	trialEnd := now.AddDate(0, 0, trialDays)
+	subscription.Status = "trial"
+	subscription.TrialStart = &now
+	subscription.TrialEnd = &trialEnd
+	subscription.CurrentPeriodStart = now
+	subscription.CurrentPeriodEnd = trialEnd
+}
+
 // HandleCreateSubscription creates a new subscription
-func HandleCreateSubscription(subRepo *repository.SubscriptionRepository, productRepo *repository.ProductRepository) fiber.Handler {
+func HandleCreateSubscription(subRepo *repository.SubscriptionRepository, productRepo *repository.ProductRepository, userRepo *repository.UserRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var request struct {
 			ProductID       string `json:"product_id"`
 			PaymentMethodID string `json:"payment_method_id"`
 		}
 		if err := c.BodyParser(&request); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
-		productID, err := primitive.ObjectIDFromHex(request.ProductID)
+		productID, err := toObjectID(request.ProductID, "product_id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid product ID")
+			return err
 		}
 
 		product, err := productRepo.GetByID(c.Context(), productID)
+		if err != nil || product == nil {
+			return errProductNotFound
+		}
+
+		user, err := GetUserFromContext(c)
 		if err != nil {
-			return fiber.NewError(fiber.StatusNotFound, "Product not found")
+			return err
+		}
+
+		if err := checkNoActiveSubscription(c, subRepo, user.ID, primitive.NilObjectID); err != nil {
+			return err
 		}
 
-		userID := c.Locals("user_id").(primitive.ObjectID)
 		subscription := &models.Subscription{
-			UserID:          userID,
+			UserID:          user.ID,
 			ProductID:       productID,
 			Status:          "active",
 			Plan:            product.Type,
@@ -41,6 +106,18 @@ func HandleCreateSubscription(subRepo *repository.SubscriptionRepository, produc
 			AutoRenew:       true,
 		}
 
+		if product.TrialDays > 0 {
+			claimed, err := userRepo.ClaimTrial(c.Context(), user.ID)
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to claim trial")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to create subscription")
+			}
+			// Users who already had a trial subscribe straight away
+			if claimed {
+				startTrial(subscription, product.TrialDays, time.Now().UTC())
+			}
+		}
+
 		if err := subRepo.Create(c.Context(), subscription); err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create subscription")
 		}
@@ -52,21 +129,19 @@ func HandleCreateSubscription(subRepo *repository.SubscriptionRepository, produc
 // HandleGetSubscription retrieves a subscription by ID
 func HandleGetSubscription(repo *repository.SubscriptionRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		user, err := GetUserFromContext(c)
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+			return err
 		}
 
-		subscription, err := repo.GetByID(c.Context(), objectID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusNotFound, "Subscription not found")
+			return err
 		}
 
-		// Verify ownership
-		userID := c.Locals("user_id").(primitive.ObjectID)
-		if subscription.UserID != userID {
-			return fiber.NewError(fiber.StatusForbidden, "Not authorized to access this subscription")
+		subscription, err := getOwnedSubscription(c, repo, objectID, user.ID, "access")
+		if err != nil {
+			return err
 		}
 
 		return c.JSON(subscription)
@@ -76,42 +151,37 @@ func HandleGetSubscription(repo *repository.SubscriptionRepository) fiber.Handle
 // HandleListSubscriptions returns a paginated list of subscriptions for the current user
 func HandleListSubscriptions(repo *repository.SubscriptionRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		page := c.QueryInt("page", 1)
-		limit := c.QueryInt("limit", 10)
-		userID := c.Locals("user_id").(primitive.ObjectID)
+		pagination := parsePagination(c, defaultPageLimit)
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
 
-		subscriptions, total, err := repo.ListByUser(c.Context(), userID, int64(page), int64(limit))
+		subscriptions, total, err := repo.ListByUser(c.Context(), user.ID, pagination.Page, pagination.Limit)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list subscriptions")
 		}
 
-		return c.JSON(fiber.Map{
-			"subscriptions": subscriptions,
-			"total":         total,
-			"page":          page,
-			"limit":         limit,
-		})
+		return c.JSON(Paginate(subscriptions, total, pagination))
 	}
 }
 
 // HandleCancelSubscription cancels a subscription
 func HandleCancelSubscription(repo *repository.SubscriptionRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		user, err := GetUserFromContext(c)
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+			return err
 		}
 
-		subscription, err := repo.GetByID(c.Context(), objectID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusNotFound, "Subscription not found")
+			return err
 		}
 
-		// Verify ownership
-		userID := c.Locals("user_id").(primitive.ObjectID)
-		if subscription.UserID != userID {
-			return fiber.NewError(fiber.StatusForbidden, "Not authorized to cancel this subscription")
+		subscription, err := getOwnedSubscription(c, repo, objectID, user.ID, "cancel")
+		if err != nil {
+			return err
 		}
 
 		subscription.Status = "canceled"
@@ -127,28 +197,25 @@ func HandleCancelSubscription(repo *repository.SubscriptionRepository) fiber.Han
 // HandleUpdatePaymentMethod updates the payment method for a subscription
 func HandleUpdatePaymentMethod(repo *repository.SubscriptionRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		user, err := GetUserFromContext(c)
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+			return err
+		}
+
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
 		}
 
 		var request struct {
 			PaymentMethodID string `json:"payment_method_id"`
 		}
 		if err := c.BodyParser(&request); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
-		subscription, err := repo.GetByID(c.Context(), objectID)
-		if err != nil {
-			return fiber.NewError(fiber.StatusNotFound, "Subscription not found")
-		}
-
-		// Verify ownership
-		userID := c.Locals("user_id").(primitive.ObjectID)
-		if subscription.UserID != userID {
-			return fiber.NewError(fiber.StatusForbidden, "Not authorized to update this subscription")
+		if _, err := getOwnedSubscription(c, repo, objectID, user.ID, "update"); err != nil {
+			return err
 		}
 
 		updates := map[string]interface{}{
@@ -165,21 +232,23 @@ func HandleUpdatePaymentMethod(repo *repository.SubscriptionRepository) fiber.Ha
 // HandleReactivateSubscription reactivates a canceled subscription
 func HandleReactivateSubscription(repo *repository.SubscriptionRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		objectID, err := primitive.ObjectIDFromHex(id)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+			return err
 		}
 
-		subscription, err := repo.GetByID(c.Context(), objectID)
+		user, err := GetUserFromContext(c)
 		if err != nil {
-			return fiber.NewError(fiber.StatusNotFound, "Subscription not found")
+			return err
 		}
 
-		// Verify ownership
-		userID := c.Locals("user_id").(primitive.ObjectID)
-		if subscription.UserID != userID {
-			return fiber.NewError(fiber.StatusForbidden, "Not authorized to reactivate this subscription")
+		subscription, err := getOwnedSubscription(c, repo, objectID, user.ID, "reactivate")
+		if err != nil {
+			return err
+		}
+
+		if err := checkNoActiveSubscription(c, repo, user.ID, subscription.ID); err != nil {
+			return err
 		}
 
 		subscription.Status = "active"
@@ -191,3 +260,284 @@ func HandleReactivateSubscription(repo *repository.SubscriptionRepository) fiber
 		return c.JSON(subscription)
 	}
 }
+
+// prorationCreateProrations credits unused time on the old plan and charges the new
+// plan's remaining time on the next invoice
+const prorationCreateProrations = "create_prorations"
+
+// validatePlanChange checks that a subscription can move to the target product
+func validatePlanChange(subscription *models.Subscription, product *models.Product) error {
+	if subscription.Status == "canceled" || subscription.Status == "expired" {
+		return fiber.NewError(fiber.StatusConflict, "Canceled subscriptions cannot change plan")
+	}
+	if subscription.SubscriptionID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Subscription is not billed through Stripe")
+	}
+	if product == nil {
+		return errProductNotFound
+	}
+	if !product.Status || product.PriceID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Product is not available for subscription")
+	}
+	if product.ID == subscription.ProductID {
+		return fiber.NewError(fiber.StatusBadRequest, "Subscription is already on this plan")
+	}
+	return nil
+}
+
+// prorationAmount sums the proration lines of an invoice, in the smallest currency unit
+func prorationAmount(inv *stripe.Invoice) int64 {
+	var total int64
+	if inv.Lines == nil {
+		return total
+	}
+	for _, line := range inv.Lines.Data {
+		if line.Proration {
+			total += line.Amount
+		}
+	}
+	return total
+}
+
+// HandleChangeSubscriptionPlan switches a subscription to another product, prorating the
+// difference. With ?preview=true it only returns the prorated cost.
+func HandleChangeSubscriptionPlan(repo *repository.SubscriptionRepository, productRepo *repository.ProductRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var request struct {
+			ProductID string `json:"product_id"`
+		}
+		if err := c.BodyParser(&request); err != nil {
+			return errInvalidBody
+		}
+		productID, err := toObjectID(request.ProductID, "product_id")
+		if err != nil {
+			return err
+		}
+
+		subscription, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("subscription_id", objectID).Error("Failed to get subscription")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get subscription")
+		}
+		if subscription == nil {
+			return errSubscriptionNotFound
+		}
+		if subscription.UserID != user.ID {
+			return fiber.NewError(fiber.StatusForbidden, "Not authorized to change this subscription")
+		}
+
+		product, err := productRepo.GetByID(c.Context(), productID)
+		if err != nil {
+			log(c).WithError(err).WithField("product_id", productID).Error("Failed to get product")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get product")
+		}
+		if err := validatePlanChange(subscription, product); err != nil {
+			return err
+		}
+
+		if config.AppConfig.StripeKey == "" {
+			log(c).Error("Stripe API key is not configured")
+			return fiber.NewError(fiber.StatusInternalServerError, "Payment system is not properly configured")
+		}
+		stripe.Key = config.AppConfig.StripeKey
+
+		stripeSub, err := stripesubscription.Get(subscription.SubscriptionID, nil)
+		if err != nil {
+			log(c).WithError(err).WithField("subscription_id", objectID).Error("Failed to get Stripe subscription")
+			return fiber.NewError(fiber.StatusBadGateway, "Failed to change plan")
+		}
+		if stripeSub.Items == nil || len(stripeSub.Items.Data) == 0 {
+			log(c).WithField("subscription_id", objectID).Error("Stripe subscription has no items")
+			return fiber.NewError(fiber.StatusBadGateway, "Failed to change plan")
+		}
+		items := []*stripe.SubscriptionItemsParams{
+			{
+				ID:    stripe.String(stripeSub.Items.Data[0].ID),
+				Price: stripe.String(product.PriceID),
+			},
+		}
+
+		if c.QueryBool("preview") {
+			upcoming, err := stripeinvoice.Upcoming(&stripe.InvoiceUpcomingParams{
+				Customer:                      stripe.String(subscription.CustomerID),
+				Subscription:                  stripe.String(subscription.SubscriptionID),
+				SubscriptionItems:             items,
+				SubscriptionProrationBehavior: stripe.String(prorationCreateProrations),
+				SubscriptionProrationDate:     stripe.Int64(time.Now().Unix()),
+			})
+			if err != nil {
+				log(c).WithError(err).WithField("subscription_id", objectID).Error("Failed to preview plan change")
+				return fiber.NewError(fiber.StatusBadGateway, "Failed to preview plan change")
+			}
+
+			return c.JSON(fiber.Map{
+				"preview":         true,
+				"product_id":      product.ID,
+				"prorated_amount": prorationAmount(upcoming),
+				"amount_due":      upcoming.AmountDue,
+				"currency":        upcoming.Currency,
+			})
+		}
+
+		_, err = stripesubscription.Update(subscription.SubscriptionID, &stripe.SubscriptionParams{
+			Items:             items,
+			ProrationBehavior: stripe.String(prorationCreateProrations),
+		})
+		if err != nil {
+			log(c).WithError(err).WithField("subscription_id", objectID).Error("Failed to change Stripe subscription plan")
+			return fiber.NewError(fiber.StatusBadGateway, "Failed to change plan")
+		}
+
+		if err := repo.ChangePlan(c.Context(), subscription.ID, product.ID, product.Interval, product.Price); err != nil {
+			// Stripe has switched already, the subscription webhook resyncs the plan and amount
+			log(c).WithError(err).WithField("subscription_id", objectID).Error("Failed to record plan change")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to record plan change")
+		}
+		subscription.ProductID = product.ID
+		subscription.Plan = product.Interval
+		subscription.Amount = product.Price
+
+		return c.JSON(subscription)
+	}
+}
+
+// setStripeCustomerOwner points the user_id metadata of a Stripe customer at another user
+func setStripeCustomerOwner(customerID string, userID primitive.ObjectID) error {
+	params := &stripe.CustomerParams{}
+	params.AddMetadata("user_id", userID.Hex())
+	_, err := customer.Update(customerID, params)
+	return err
+}
+
+// setStripeSubscriptionOwner points the user_id metadata of a Stripe subscription at
+// another user, so its webhooks and invoices name the new owner
+func setStripeSubscriptionOwner(subscriptionID string, userID primitive.ObjectID) error {
+	params := &stripe.SubscriptionParams{}
+	params.AddMetadata("user_id", userID.Hex())
+	_, err := stripesubscription.Update(subscriptionID, params)
+	return err
+}
+
+// validateSubscriptionTransfer checks that a subscription can be moved to the target user
+func validateSubscriptionTransfer(subscription *models.Subscription, target *models.User, targetActive *models.Subscription) error {
+	if target == nil {
+		return fiber.NewError(fiber.StatusNotFound, "Target user not found")
+	}
+	if subscription.UserID == target.ID {
+		return fiber.NewError(fiber.StatusBadRequest, "Subscription already belongs to the target user")
+	}
+	if targetActive != nil && targetActive.ID != subscription.ID {
+		return fiber.NewError(fiber.StatusConflict, "Target user already has an active subscription")
+	}
+	return nil
+}
+
+// HandleTransferSubscription moves a subscription to another user and records an audit entry (admin only)
+func HandleTransferSubscription(
+	subRepo *repository.SubscriptionRepository,
+	userRepo *repository.UserRepository,
+	auditRepo *repository.AuditRepository,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		subscriptionID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		admin, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			TargetUserID string `json:"target_user_id"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		targetUserID, err := toObjectID(req.TargetUserID, "target_user_id")
+		if err != nil {
+			return err
+		}
+
+		subscription, err := subRepo.GetByID(c.Context(), subscriptionID)
+		if err != nil {
+			log(c).WithError(err).WithField("subscription_id", subscriptionID).Error("Failed to get subscription")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to transfer subscription")
+		}
+		if subscription == nil {
+			return errSubscriptionNotFound
+		}
+
+		target, err := userRepo.GetByID(c.Context(), targetUserID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", targetUserID).Error("Failed to get target user")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to transfer subscription")
+		}
+
+		var targetActive *models.Subscription
+		if target != nil {
+			targetActive, err = subRepo.GetActiveSubscription(c.Context(), target.ID)
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", targetUserID).Error("Failed to get target subscription")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to transfer subscription")
+			}
+		}
+
+		if err := validateSubscriptionTransfer(subscription, target, targetActive); err != nil {
+			return err
+		}
+
+		// Point the Stripe customer and subscription at the new user so future webhooks and
+		// invoices name them
+		if subscription.CustomerID != "" {
+			if config.AppConfig.StripeKey == "" {
+				log(c).WithField("subscription_id", subscriptionID).Warn("Stripe is not configured, customer metadata was not updated")
+			} else {
+				stripe.Key = config.AppConfig.StripeKey
+				if err := setStripeCustomerOwner(subscription.CustomerID, target.ID); err != nil {
+					log(c).WithError(err).WithField("customer_id", subscription.CustomerID).Error("Failed to update Stripe customer")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to update payment provider")
+				}
+				if err := setStripeSubscriptionOwner(subscription.SubscriptionID, target.ID); err != nil {
+					log(c).WithError(err).WithField("subscription_id", subscriptionID).Error("Failed to update Stripe subscription")
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to update payment provider")
+				}
+			}
+		}
+
+		previousUserID := subscription.UserID
+		if err := subRepo.TransferToUser(c.Context(), subscriptionID, target.ID); err != nil {
+			log(c).WithError(err).WithField("subscription_id", subscriptionID).Error("Failed to transfer subscription")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to transfer subscription")
+		}
+		subscription.UserID = target.ID
+
+		entry := &models.AuditLog{
+			ActorID:    admin.ID,
+			Action:     "subscription.transfer",
+			TargetType: "subscription",
+			TargetID:   subscriptionID,
+			Details: map[string]interface{}{
+				"from_user_id": previousUserID,
+				"to_user_id":   target.ID,
+			},
+		}
+		if err := auditRepo.Record(c.Context(), entry); err != nil {
+			log(c).WithError(err).WithField("subscription_id", subscriptionID).Error("Failed to record audit entry")
+		}
+
+		return c.JSON(subscription)
+	}
+}
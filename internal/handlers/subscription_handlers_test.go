@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cource-api/internal/middleware"
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v76"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateSubscriptionTransfer(t *testing.T) {
+	owner := primitive.NewObjectID()
+	subscription := &models.Subscription{ID: primitive.NewObjectID(), UserID: owner, Status: "active"}
+	target := &models.User{ID: primitive.NewObjectID()}
+
+	if err := validateSubscriptionTransfer(subscription, target, nil); err != nil {
+		t.Fatalf("expected valid transfer, got %v", err)
+	}
+
+	conflicting := &models.Subscription{ID: primitive.NewObjectID(), UserID: target.ID, Status: "active"}
+	err := validateSubscriptionTransfer(subscription, target, conflicting)
+	var fiberErr *fiber.Error
+	if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusConflict {
+		t.Fatalf("expected 409 for a target with an active subscription, got %v", err)
+	}
+
+	err = validateSubscriptionTransfer(subscription, nil, nil)
+	if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusNotFound {
+		t.Fatalf("expected 404 for a missing target, got %v", err)
+	}
+
+	err = validateSubscriptionTransfer(subscription, &models.User{ID: owner}, nil)
+	if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusBadRequest {
+		t.Fatalf("expected 400 when transferring to the current owner, got %v", err)
+	}
+}
+
+func TestValidatePlanChange(t *testing.T) {
+	monthly := &models.Product{ID: primitive.NewObjectID(), Status: true, PriceID: "price_monthly"}
+	yearly := &models.Product{ID: primitive.NewObjectID(), Status: true, PriceID: "price_yearly"}
+	active := func() *models.Subscription {
+		return &models.Subscription{Status: "active", ProductID: monthly.ID, SubscriptionID: "sub_123"}
+	}
+
+	tests := []struct {
+		name         string
+		subscription *models.Subscription
+		product      *models.Product
+		status       int
+	}{
+		{"valid", active(), yearly, 0},
+		{"canceled", &models.Subscription{Status: "canceled", ProductID: monthly.ID, SubscriptionID: "sub_123"}, yearly, fiber.StatusConflict},
+		{"not on stripe", &models.Subscription{Status: "active", ProductID: monthly.ID}, yearly, fiber.StatusBadRequest},
+		{"missing product", active(), nil, fiber.StatusNotFound},
+		{"inactive product", active(), &models.Product{ID: primitive.NewObjectID(), PriceID: "price_old"}, fiber.StatusBadRequest},
+		{"same plan", active(), monthly, fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePlanChange(tt.subscription, tt.product)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("expected valid plan change, got %v", err)
+				}
+				return
+			}
+			var fiberErr *fiber.Error
+			if !errors.As(err, &fiberErr) || fiberErr.Code != tt.status {
+				t.Fatalf("expected status %d, got %v", tt.status, err)
+			}
+		})
+	}
+}
+
+func TestProrationAmountSumsProrationLines(t *testing.T) {
+	inv := &stripe.Invoice{Lines: &stripe.InvoiceLineItemList{Data: []*stripe.InvoiceLineItem{
+		{Amount: -500, Proration: true},
+		{Amount: 4000, Proration: true},
+		{Amount: 9900},
+	}}}
+	if got := prorationAmount(inv); got != 3500 {
+		t.Fatalf("expected 3500, got %d", got)
+	}
+}
+
+func TestStartTrial(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	subscription := &models.Subscription{Status: "active"}
+
+	startTrial(subscription, 14, now)
+
+	wantEnd := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	if subscription.Status != "trial" {
+		t.Fatalf("expected trial status, got %q", subscription.Status)
+	}
+	if subscription.TrialStart == nil || !subscription.TrialStart.Equal(now) {
+		t.Fatalf("expected trial to start now, got %v", subscription.TrialStart)
+	}
+	if subscription.TrialEnd == nil || !subscription.TrialEnd.Equal(wantEnd) || !subscription.CurrentPeriodEnd.Equal(wantEnd) {
+		t.Fatalf("expected trial and period to end %v, got %v and %v", wantEnd, subscription.TrialEnd, subscription.CurrentPeriodEnd)
+	}
+}
+
+func TestSubscriptionFromStripeMapsTrialing(t *testing.T) {
+	sub := &stripe.Subscription{
+		ID:       "sub_123",
+		Status:   stripe.SubscriptionStatusTrialing,
+		Metadata: map[string]string{"user_id": primitive.NewObjectID().Hex()},
+	}
+
+	subscription, err := subscriptionFromStripe(sub)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if subscription.Status != "trial" {
+		t.Fatalf("expected trialing to map to trial, got %q", subscription.Status)
+	}
+}
+
+func TestCheckSubscriptionOwner(t *testing.T) {
+	owner := primitive.NewObjectID()
+	subscription := &models.Subscription{ID: primitive.NewObjectID(), UserID: owner}
+
+	if err := checkSubscriptionOwner(subscription, owner, "access"); err != nil {
+		t.Fatalf("expected the owner to be allowed, got %v", err)
+	}
+
+	var fiberErr *fiber.Error
+	err := checkSubscriptionOwner(subscription, primitive.NewObjectID(), "access")
+	if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusForbidden {
+		t.Fatalf("expected 403 for another user, got %v", err)
+	}
+
+	var apiErr *APIError
+	err = checkSubscriptionOwner(nil, owner, "access")
+	if !errors.As(err, &apiErr) || apiErr.Status != fiber.StatusNotFound {
+		t.Fatalf("expected 404 for a missing subscription, got %v", err)
+	}
+}
+
+func TestSubscriptionHandlersReadUserFromClaims(t *testing.T) {
+	userID := primitive.NewObjectID()
+	handlers := []struct {
+		method  string
+		path    string
+		handler fiber.Handler
+	}{
+		{"GET", "/subscriptions/:id", HandleGetSubscription(nil)},
+		{"POST", "/subscriptions/:id/cancel", HandleCancelSubscription(nil)},
+		{"PUT", "/subscriptions/:id/payment-method", HandleUpdatePaymentMethod(nil)},
+	}
+
+	for _, h := range handlers {
+		t.Run(h.method+" "+h.path, func(t *testing.T) {
+			path := strings.Replace(h.path, ":id", "not-an-id", 1)
+
+			anonymous := fiber.New()
+			anonymous.Add(h.method, h.path, h.handler)
+			resp, err := anonymous.Test(httptest.NewRequest(h.method, path, nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusUnauthorized {
+				t.Fatalf("expected status 401 without claims, got %d", resp.StatusCode)
+			}
+
+			app := fiber.New()
+			app.Add(h.method, h.path, func(c *fiber.Ctx) error {
+				// The auth middleware only sets the claims
+				c.Locals("user", &middleware.Claims{UserID: userID, Role: "user"})
+				return c.Next()
+			}, h.handler)
+
+			// An invalid ID is rejected after the user is read, before any lookup
+			resp, err = app.Test(httptest.NewRequest(h.method, path, nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", resp.StatusCode)
+			}
+		})
+	}
+}
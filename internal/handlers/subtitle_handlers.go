@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"cource-api/internal/aws"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// languageTagPattern matches BCP 47 style tags: a 2-3 letter language followed by
+// optional script, region or variant subtags, e.g. "en", "pt-BR", "zh-Hant-TW"
+var languageTagPattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// normalizeLanguageTag validates a language tag and returns it in canonical case so
+// "EN-us" and "en-US" are treated as the same language
+func normalizeLanguageTag(tag string) (string, error) {
+	if !languageTagPattern.MatchString(tag) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Invalid language code")
+	}
+
+	parts := strings.Split(tag, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch {
+		case len(parts[i]) == 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case len(parts[i]) == 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// HandleAddSubtitle adds a caption track to a video (admin only). The subtitle file
+// must already be uploaded to the main bucket.
+func HandleAddSubtitle(repo *repository.VideoRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			Language string `json:"language"`
+			Key      string `json:"key"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		language, err := normalizeLanguageTag(req.Language)
+		if err != nil {
+			return err
+		}
+		if req.Key == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Subtitle key is required")
+		}
+
+		video, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get video")
+		}
+		if video == nil {
+			return errVideoNotFound
+		}
+
+		exists, err := aws.S3C.FileExists(req.Key)
+		if err != nil {
+			log(c).WithError(err).Error("Failed to verify subtitle file existence")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify subtitle file")
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusBadRequest, "Subtitle file not found in S3")
+		}
+
+		subtitle := models.Subtitle{Language: language, Key: req.Key}
+		if err := repo.AddSubtitle(c.Context(), objectID, subtitle); err != nil {
+			if errors.Is(err, repository.ErrDuplicateSubtitle) {
+				return fiber.NewError(fiber.StatusConflict, "Video already has a subtitle for this language")
+			}
+			log(c).WithError(err).WithField("video_id", objectID).Error("Failed to add subtitle")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to add subtitle")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(subtitle)
+	}
+}
+
+// HandleDeleteSubtitle removes the caption track of a video in a language (admin only).
+// The file itself is left in S3.
+func HandleDeleteSubtitle(repo *repository.VideoRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		language, err := normalizeLanguageTag(c.Params("lang"))
+		if err != nil {
+			return err
+		}
+
+		if err := repo.RemoveSubtitle(c.Context(), objectID, language); err != nil {
+			if errors.Is(err, repository.ErrSubtitleNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "Subtitle not found")
+			}
+			log(c).WithError(err).WithField("video_id", objectID).Error("Failed to remove subtitle")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to remove subtitle")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestNormalizeLanguageTag(t *testing.T) {
+	valid := map[string]string{
+		"en":         "en",
+		"EN-us":      "en-US",
+		"pt-br":      "pt-BR",
+		"zh-hant-tw": "zh-Hant-TW",
+		"es-419":     "es-419",
+	}
+	for input, want := range valid {
+		got, err := normalizeLanguageTag(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: expected %q, got %q", input, want, got)
+		}
+	}
+
+	for _, input := range []string{"", "e", "english", "en_US", "en-", "en-US-", "../en"} {
+		if _, err := normalizeLanguageTag(input); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestSignVideoMediaSignsSubtitles(t *testing.T) {
+	video := &models.Video{
+		URL: "videos/intro.mp4",
+		Subtitles: []models.Subtitle{
+			{Language: "en", Key: "subtitles/intro.en.vtt"},
+			{Language: "fr", Key: "subtitles/intro.fr.vtt"},
+		},
+	}
+
+	err := signVideoMedia(video, func(key string) (string, error) { return "https://signed/" + key, nil })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, subtitle := range video.Subtitles {
+		if subtitle.Key != "https://signed/subtitles/intro."+subtitle.Language+".vtt" {
+			t.Errorf("expected %s subtitle to be signed, got %q", subtitle.Language, subtitle.Key)
+		}
+	}
+}
@@ -2,15 +2,91 @@ package handlers
 
 import (
 	"cource-api/internal/aws"
+	"cource-api/internal/config"
+	"cource-api/internal/jobs"
+	"cource-api/internal/models"
 	"cource-api/internal/repository"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// recordUploadIntent tracks an issued upload URL until the upload is completed
+func recordUploadIntent(c *fiber.Ctx, intents *repository.UploadIntentRepository, userID primitive.ObjectID, fileKey, kind, contentType string) error {
+	intent := &models.UploadIntent{
+		FileKey:     fileKey,
+		UserID:      userID,
+		Kind:        kind,
+		ContentType: contentType,
+	}
+	if err := intents.Record(c.Context(), intent); err != nil {
+		log(c).WithError(err).WithField("file_key", fileKey).Error("Failed to record upload intent")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate upload URL")
+	}
+	return nil
+}
+
+// allowedVideoTypes lists the content types accepted for video uploads
+var allowedVideoTypes = []string{"video/mp4", "video/quicktime", "video/webm", "video/x-matroska"}
+
+// checkUploadedObject rejects a stored object whose content type or size breaks the
+// upload policy. Presigned PUTs let the client pick both, so they are checked once the
+// object is in S3.
+func checkUploadedObject(info *aws.ObjectInfo, allowedTypes []string, maxSize int64) error {
+	mediaType, _, _ := strings.Cut(info.ContentType, ";")
+	if !slices.Contains(allowedTypes, strings.ToLower(strings.TrimSpace(mediaType))) {
+		return fiber.NewError(fiber.StatusBadRequest, "Unsupported content type")
+	}
+	if info.Size <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Uploaded file is empty")
+	}
+	if info.Size > maxSize {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("File must be at most %d bytes", maxSize))
+	}
+	return nil
+}
+
+// verifyUpload checks a stored upload against the policy of its kind, video or
+// thumbnail, and deletes the object when it breaks the policy
+func verifyUpload(s3Client *aws.S3Client, kind, fileKey string) error {
+	head, remove := s3Client.HeadFile, s3Client.DeleteFile
+	allowedTypes, maxSize := allowedVideoTypes, config.AppConfig.MaxVideoUploadSize
+	if kind == "thumbnail" {
+		head, remove = s3Client.HeadThumbnail, s3Client.DeleteThumbnail
+		allowedTypes, maxSize = allowedThumbnailTypes, maxThumbnailSize
+	}
+
+	info, err := head(fileKey)
+	if err != nil {
+		logrus.WithError(err).WithField("file_key", fileKey).Error("Failed to verify file existence")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify upload")
+	}
+	if info == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "File not found in S3")
+	}
+
+	if err := checkUploadedObject(info, allowedTypes, maxSize); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"file_key":     fileKey,
+			"content_type": info.ContentType,
+			"size":         info.Size,
+		}).Warn("Deleting upload that breaks the upload policy")
+		if err := remove(fileKey); err != nil {
+			logrus.WithError(err).WithField("file_key", fileKey).Error("Failed to delete rejected upload")
+		}
+		return err
+	}
+	return nil
+}
+
 // HandleGeneratePresignedURL generates a pre-signed URL for video/thumbnail upload
-func HandleVideoGeneratePresignedURL() fiber.Handler {
+func HandleVideoGeneratePresignedURL(intents *repository.UploadIntentRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get current user
 		user, err := GetUserFromContext(c)
@@ -26,7 +102,7 @@ func HandleVideoGeneratePresignedURL() fiber.Handler {
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		// Validate request
@@ -39,6 +115,9 @@ func HandleVideoGeneratePresignedURL() fiber.Handler {
 		if req.ContentType == "" {
 			return fiber.NewError(fiber.StatusBadRequest, "Content type is required")
 		}
+		if !slices.Contains(allowedVideoTypes, req.ContentType) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unsupported video content type")
+		}
 
 		fmt.Printf("%+v\n", user)
 
@@ -46,11 +125,14 @@ func HandleVideoGeneratePresignedURL() fiber.Handler {
 		fileKey := fmt.Sprintf("%s/%s/%s", req.FileType, user.ID.Hex(), req.FileName)
 
 		// Generate pre-signed URL
-		presignedURL, err := aws.S3C.GeneratePresignedURL(fileKey, req.ContentType, 1)
+		presignedURL, err := aws.S3C.GeneratePresignedURL(fileKey, req.ContentType, config.AppConfig.UploadURLExpiryHours)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to generate pre-signed URL")
+			log(c).WithError(err).Error("Failed to generate pre-signed URL")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate upload URL")
 		}
+		if err := recordUploadIntent(c, intents, user.ID, fileKey, "video", req.ContentType); err != nil {
+			return err
+		}
 
 		return c.JSON(fiber.Map{
 			"upload_url": presignedURL,
@@ -59,8 +141,120 @@ func HandleVideoGeneratePresignedURL() fiber.Handler {
 	}
 }
 
-// HandleGeneratePresignedURL generates a pre-signed URL for video/thumbnail upload
-func HandleThumbnailGeneratePresignedURL() fiber.Handler {
+// maxBatchUploadItems caps the number of files a single batch presign request may contain
+const maxBatchUploadItems = 50
+
+// batchUploadItem is a single file in a batch presign request
+type batchUploadItem struct {
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+}
+
+// batchUploadResult is the presign outcome for a single file. Error is set
+// instead of UploadURL/FileKey when the item failed validation or signing.
+type batchUploadResult struct {
+	FileName  string `json:"file_name"`
+	UploadURL string `json:"upload_url,omitempty"`
+	FileKey   string `json:"file_key,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// presignBatch validates and presigns each item independently so one bad item
+// does not fail the whole batch
+func presignBatch(items []batchUploadItem, fileType, userID string, presign func(fileKey, contentType string) (string, error)) []batchUploadResult {
+	results := make([]batchUploadResult, len(items))
+	for i, item := range items {
+		results[i].FileName = item.FileName
+
+		if item.FileName == "" {
+			results[i].Error = "File name is required"
+			continue
+		}
+		if item.ContentType == "" {
+			results[i].Error = "Content type is required"
+			continue
+		}
+		if !slices.Contains(allowedVideoTypes, item.ContentType) {
+			results[i].Error = "Unsupported video content type"
+			continue
+		}
+
+		fileKey := fmt.Sprintf("%s/%s/%s", fileType, userID, item.FileName)
+		uploadURL, err := presign(fileKey, item.ContentType)
+		if err != nil {
+			logrus.WithError(err).WithField("file_key", fileKey).Error("Failed to generate pre-signed URL")
+			results[i].Error = "Failed to generate upload URL"
+			continue
+		}
+
+		results[i].UploadURL = uploadURL
+		results[i].FileKey = fileKey
+	}
+	return results
+}
+
+// HandleVideoGeneratePresignedURLs generates pre-signed upload URLs for several videos at once
+func HandleVideoGeneratePresignedURLs(intents *repository.UploadIntentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Get current user
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		// Parse request body
+		var req struct {
+			FileType string            `json:"file_type"`
+			Files    []batchUploadItem `json:"files"`
+		}
+
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		// Validate request
+		if len(req.Files) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "At least one file is required")
+		}
+		if len(req.Files) > maxBatchUploadItems {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("A batch may contain at most %d files", maxBatchUploadItems))
+		}
+		if req.FileType == "" {
+			req.FileType = "video"
+		}
+
+		results := presignBatch(req.Files, req.FileType, user.ID.Hex(), func(fileKey, contentType string) (string, error) {
+			uploadURL, err := aws.S3C.GeneratePresignedURL(fileKey, contentType, config.AppConfig.UploadURLExpiryHours)
+			if err != nil {
+				return "", err
+			}
+			intent := &models.UploadIntent{
+				FileKey:     fileKey,
+				UserID:      user.ID,
+				Kind:        "video",
+				ContentType: contentType,
+			}
+			if err := intents.Record(c.Context(), intent); err != nil {
+				return "", err
+			}
+			return uploadURL, nil
+		})
+
+		return c.JSON(fiber.Map{
+			"uploads": results,
+		})
+	}
+}
+
+// maxThumbnailSize is the largest thumbnail S3 will accept through a presigned upload
+const maxThumbnailSize = 5 * 1024 * 1024
+
+// allowedThumbnailTypes lists the content types accepted for thumbnail uploads
+var allowedThumbnailTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// HandleThumbnailGeneratePresignedURL generates a pre-signed POST policy for thumbnail upload.
+// The size and content type limits are enforced by S3 and echoed back to the client.
+func HandleThumbnailGeneratePresignedURL(intents *repository.UploadIntentRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get current user
 		user, err := GetUserFromContext(c)
@@ -76,7 +270,7 @@ func HandleThumbnailGeneratePresignedURL() fiber.Handler {
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		// Validate request
@@ -89,33 +283,42 @@ func HandleThumbnailGeneratePresignedURL() fiber.Handler {
 		if req.ContentType == "" {
 			return fiber.NewError(fiber.StatusBadRequest, "Content type is required")
 		}
+		if !slices.Contains(allowedThumbnailTypes, req.ContentType) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unsupported thumbnail content type")
+		}
 
 		// Generate a unique file key
 		fileKey := fmt.Sprintf("%s/%s/%s", req.FileType, user.ID.Hex(), req.FileName)
 
-		// Generate pre-signed URL for upload
-		presignedURL, err := aws.S3C.GenerateThumbnailUploadURL(fileKey, req.ContentType, 1)
+		// Generate pre-signed POST policy for upload
+		uploadURL, fields, err := aws.S3C.GenerateThumbnailUploadPost(fileKey, req.ContentType, maxThumbnailSize, config.AppConfig.UploadURLExpiryHours)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to generate pre-signed URL")
+			log(c).WithError(err).Error("Failed to generate pre-signed POST policy")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate upload URL")
 		}
+		if err := recordUploadIntent(c, intents, user.ID, fileKey, "thumbnail", req.ContentType); err != nil {
+			return err
+		}
 
 		// Generate the public URL for the thumbnail
 		publicURL := aws.S3C.GetThumbnailURL(fileKey)
 
 		return c.JSON(fiber.Map{
-			"upload_url": presignedURL,
-			"file_key":   fileKey,
-			"public_url": publicURL,
+			"upload_url":            uploadURL,
+			"fields":                fields,
+			"file_key":              fileKey,
+			"public_url":            publicURL,
+			"max_size_bytes":        maxThumbnailSize,
+			"allowed_content_types": allowedThumbnailTypes,
 		})
 	}
 }
 
 // HandleUploadComplete handles the notification of upload completion
-func HandleUploadComplete(repo *repository.VideoRepository) fiber.Handler {
+func HandleUploadComplete(repo *repository.VideoRepository, intents *repository.UploadIntentRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get current user
-		_, err := GetUserFromContext(c)
+		user, err := GetUserFromContext(c)
 		if err != nil {
 			return err
 		}
@@ -127,7 +330,7 @@ func HandleUploadComplete(repo *repository.VideoRepository) fiber.Handler {
 		}
 
 		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		// Validate request
@@ -137,26 +340,31 @@ func HandleUploadComplete(repo *repository.VideoRepository) fiber.Handler {
 		if req.Type == "" {
 			return fiber.NewError(fiber.StatusBadRequest, "Type is required")
 		}
+		if req.Type != "video" && req.Type != "thumbnail" {
+			return fiber.NewError(fiber.StatusBadRequest, "Type must be video or thumbnail")
+		}
 
-		// Create S3 client
-		s3Client, err := aws.NewS3Client()
-		if err != nil {
-			logrus.WithError(err).Error("Failed to create S3 client")
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify upload")
+		// Only the uploader may complete, and so possibly delete, an upload
+		if !ownsUploadKey(req.FileKey, user.ID) {
+			return fiber.NewError(fiber.StatusForbidden, "Upload belongs to another user")
 		}
 
-		// Verify file exists in S3
-		exists, err := s3Client.FileExists(req.FileKey)
-		if err != nil {
-			logrus.WithError(err).Error("Failed to verify file existence")
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify upload")
+		// Verify the file exists in the bucket of its type and matches the upload policy
+		if err := verifyUpload(aws.S3C, req.Type, req.FileKey); err != nil {
+			return err
 		}
-		if !exists {
-			return fiber.NewError(fiber.StatusBadRequest, "File not found in S3")
+
+		// Uploads issued before intents were tracked have none to complete
+		if _, err := intents.MarkCompleted(c.Context(), req.FileKey, user.ID); err != nil {
+			log(c).WithError(err).WithField("file_key", req.FileKey).Error("Failed to mark upload intent completed")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify upload")
 		}
 
 		// Generate the public URL for the file
-		fileURL := s3Client.GetPublicURL(req.FileKey)
+		fileURL := aws.S3C.GetPublicURL(req.FileKey)
+		if req.Type == "thumbnail" {
+			fileURL = aws.S3C.GetThumbnailURL(req.FileKey)
+		}
 
 		return c.JSON(fiber.Map{
 			"file_url": fileURL,
@@ -164,3 +372,309 @@ func HandleUploadComplete(repo *repository.VideoRepository) fiber.Handler {
 		})
 	}
 }
+
+// HandleListStaleUploads lists uploads still pending after older_than_hours, which
+// defaults to the configured stale upload age (admin only)
+func HandleListStaleUploads(intents *repository.UploadIntentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		maxAge := config.AppConfig.StaleUploadAge
+		if hours := c.Query("older_than_hours"); hours != "" {
+			n, err := strconv.Atoi(hours)
+			if err != nil || n < 1 {
+				return fiber.NewError(fiber.StatusBadRequest, "older_than_hours must be a positive number")
+			}
+			maxAge = time.Duration(n) * time.Hour
+		}
+
+		pagination := parsePagination(c, 20)
+
+		stale, total, err := intents.ListStale(c.Context(), time.Now().UTC().Add(-maxAge), pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).Error("Failed to list stale uploads")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list stale uploads")
+		}
+
+		return c.JSON(fiber.Map{
+			"uploads": stale,
+			"total":   total,
+			"page":    pagination.Page,
+			"limit":   pagination.Limit,
+		})
+	}
+}
+
+// HandleRevokeUpload deletes the object of a pending upload and revokes its intent.
+// Uploads in use by a video or course are kept and marked completed (admin only).
+func HandleRevokeUpload(intents *repository.UploadIntentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		intent, err := intents.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("intent_id", objectID).Error("Failed to get upload intent")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get upload")
+		}
+		if intent == nil {
+			return fiber.NewError(fiber.StatusNotFound, "Upload not found")
+		}
+		if intent.Status != models.UploadIntentPending {
+			return fiber.NewError(fiber.StatusConflict, "Only pending uploads can be revoked")
+		}
+
+		revoked, err := jobs.RevokeUpload(c.Context(), intents, aws.S3C, intent)
+		if err != nil {
+			log(c).WithError(err).WithField("file_key", intent.FileKey).Error("Failed to revoke upload")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke upload")
+		}
+		if !revoked {
+			return fiber.NewError(fiber.StatusConflict, "Upload is in use or was completed")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// Multipart upload limits. S3 requires every part but the last to be at least 5 MiB and
+// allows at most 10,000 parts.
+const (
+	minMultipartPartSize = 5 * 1024 * 1024
+	maxMultipartParts    = 10000
+)
+
+// planMultipartUpload picks the part size and count for a file of at most maxSize bytes,
+// growing the part size past the minimum when the file would otherwise need more parts
+// than S3 allows
+func planMultipartUpload(fileSize, maxSize int64) (int64, int32, error) {
+	if fileSize <= 0 {
+		return 0, 0, fiber.NewError(fiber.StatusBadRequest, "File size is required")
+	}
+	if fileSize > maxSize {
+		return 0, 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("File size must be at most %d bytes", maxSize))
+	}
+
+	partSize := max(int64(minMultipartPartSize), (fileSize+maxMultipartParts-1)/maxMultipartParts)
+	partCount := (fileSize + partSize - 1) / partSize
+	return partSize, int32(partCount), nil
+}
+
+// validatePartNumber rejects part numbers S3 does not accept
+func validatePartNumber(partNumber int32) error {
+	if partNumber < 1 || partNumber > maxMultipartParts {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Part number must be between 1 and %d", maxMultipartParts))
+	}
+	return nil
+}
+
+// validateCompletedParts checks the parts listed to complete an upload are in ascending
+// order without duplicates, each with the ETag S3 returned for it
+func validateCompletedParts(parts []aws.CompletedPart) error {
+	if len(parts) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one part is required")
+	}
+	if len(parts) > maxMultipartParts {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("An upload may have at most %d parts", maxMultipartParts))
+	}
+
+	for i, part := range parts {
+		if err := validatePartNumber(part.PartNumber); err != nil {
+			return err
+		}
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return fiber.NewError(fiber.StatusBadRequest, "Parts must be in ascending order without duplicates")
+		}
+		if part.ETag == "" {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Part %d is missing its ETag", part.PartNumber))
+		}
+	}
+	return nil
+}
+
+// ownsUploadKey reports whether a file key was issued to the user, keys are laid out
+// as <file type>/<user ID>/<file name>
+func ownsUploadKey(fileKey string, userID primitive.ObjectID) bool {
+	segments := strings.SplitN(fileKey, "/", 3)
+	return len(segments) == 3 && segments[1] == userID.Hex() && segments[2] != ""
+}
+
+// multipartRequest identifies a multipart upload started by the current user
+type multipartRequest struct {
+	FileKey  string `json:"file_key"`
+	UploadID string `json:"upload_id"`
+}
+
+// check rejects a request that does not name an upload of the user
+func (r multipartRequest) check(userID primitive.ObjectID) error {
+	if r.FileKey == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "File key is required")
+	}
+	if r.UploadID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Upload ID is required")
+	}
+	if !ownsUploadKey(r.FileKey, userID) {
+		return fiber.NewError(fiber.StatusForbidden, "Upload belongs to another user")
+	}
+	return nil
+}
+
+// HandleInitMultipartUpload starts a multipart upload for a large video and returns the
+// part size and number of parts the client should upload
+func HandleInitMultipartUpload(intents *repository.UploadIntentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			FileName    string `json:"file_name"`
+			FileType    string `json:"file_type"`
+			ContentType string `json:"content_type"`
+			FileSize    int64  `json:"file_size"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		if req.FileName == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "File name is required")
+		}
+		if req.ContentType == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Content type is required")
+		}
+		if !slices.Contains(allowedVideoTypes, req.ContentType) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unsupported video content type")
+		}
+		if req.FileType == "" {
+			req.FileType = "video"
+		}
+		partSize, partCount, err := planMultipartUpload(req.FileSize, config.AppConfig.MaxVideoUploadSize)
+		if err != nil {
+			return err
+		}
+
+		fileKey := fmt.Sprintf("%s/%s/%s", req.FileType, user.ID.Hex(), req.FileName)
+
+		uploadID, err := aws.S3C.CreateMultipartUpload(fileKey, req.ContentType)
+		if err != nil {
+			log(c).WithError(err).WithField("file_key", fileKey).Error("Failed to create multipart upload")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to start upload")
+		}
+		if err := recordUploadIntent(c, intents, user.ID, fileKey, "video", req.ContentType); err != nil {
+			_ = aws.S3C.AbortMultipartUpload(fileKey, uploadID)
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"upload_id":  uploadID,
+			"file_key":   fileKey,
+			"part_size":  partSize,
+			"part_count": partCount,
+		})
+	}
+}
+
+// HandleMultipartPartURL generates a pre-signed URL for uploading one part of a multipart upload
+func HandleMultipartPartURL() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			multipartRequest
+			PartNumber int32 `json:"part_number"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+		if err := req.check(user.ID); err != nil {
+			return err
+		}
+		if err := validatePartNumber(req.PartNumber); err != nil {
+			return err
+		}
+
+		uploadURL, err := aws.S3C.PresignUploadPart(req.FileKey, req.UploadID, req.PartNumber, config.AppConfig.UploadURLExpiryHours)
+		if err != nil {
+			log(c).WithError(err).WithField("file_key", req.FileKey).Error("Failed to generate part upload URL")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate upload URL")
+		}
+
+		return c.JSON(fiber.Map{
+			"upload_url":  uploadURL,
+			"part_number": req.PartNumber,
+		})
+	}
+}
+
+// HandleCompleteMultipartUpload assembles the uploaded parts and marks the upload completed
+func HandleCompleteMultipartUpload(intents *repository.UploadIntentRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			multipartRequest
+			Parts []aws.CompletedPart `json:"parts"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+		if err := req.check(user.ID); err != nil {
+			return err
+		}
+		if err := validateCompletedParts(req.Parts); err != nil {
+			return err
+		}
+
+		if err := aws.S3C.CompleteMultipartUpload(req.FileKey, req.UploadID, req.Parts); err != nil {
+			log(c).WithError(err).WithField("file_key", req.FileKey).Error("Failed to complete multipart upload")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to complete upload")
+		}
+		if err := verifyUpload(aws.S3C, "video", req.FileKey); err != nil {
+			return err
+		}
+
+		if _, err := intents.MarkCompleted(c.Context(), req.FileKey, user.ID); err != nil {
+			log(c).WithError(err).WithField("file_key", req.FileKey).Error("Failed to mark upload intent completed")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to complete upload")
+		}
+
+		return c.JSON(fiber.Map{
+			"file_key": req.FileKey,
+			"file_url": aws.S3C.GetPublicURL(req.FileKey),
+		})
+	}
+}
+
+// HandleAbortMultipartUpload cancels a multipart upload so S3 discards its parts. The
+// pending upload intent is left for the stale upload cleanup.
+func HandleAbortMultipartUpload() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var req multipartRequest
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+		if err := req.check(user.ID); err != nil {
+			return err
+		}
+
+		if err := aws.S3C.AbortMultipartUpload(req.FileKey, req.UploadID); err != nil {
+			log(c).WithError(err).WithField("file_key", req.FileKey).Error("Failed to abort multipart upload")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to abort upload")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cource-api/internal/aws"
+	"cource-api/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPresignBatchWithInvalidItem(t *testing.T) {
+	items := []batchUploadItem{
+		{FileName: "intro.mp4", ContentType: "video/mp4"},
+		{FileName: "", ContentType: "video/mp4"},
+		{FileName: "outro.mp4", ContentType: "video/mp4"},
+	}
+
+	var signed []string
+	results := presignBatch(items, "video", "user1", func(fileKey, contentType string) (string, error) {
+		signed = append(signed, fileKey)
+		return "https://example.com/" + fileKey, nil
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].FileKey != "video/user1/intro.mp4" || results[0].Error != "" {
+		t.Fatalf("expected first item to be signed, got %+v", results[0])
+	}
+	if results[1].Error == "" || results[1].UploadURL != "" {
+		t.Fatalf("expected second item to fail validation, got %+v", results[1])
+	}
+	if results[2].FileKey != "video/user1/outro.mp4" || results[2].Error != "" {
+		t.Fatalf("expected third item to be signed, got %+v", results[2])
+	}
+	if len(signed) != 2 {
+		t.Fatalf("expected only valid items to be signed, got %v", signed)
+	}
+}
+
+func TestPlanMultipartUpload(t *testing.T) {
+	const maxSize = 50 * 1024 * 1024 * 1024
+	tests := []struct {
+		size      int64
+		partSize  int64
+		partCount int32
+	}{
+		{1, minMultipartPartSize, 1},
+		{12 * 1024 * 1024, minMultipartPartSize, 3},
+		{maxSize, (maxSize + maxMultipartParts - 1) / maxMultipartParts, maxMultipartParts},
+	}
+	for _, tt := range tests {
+		partSize, partCount, err := planMultipartUpload(tt.size, maxSize)
+		if err != nil {
+			t.Fatalf("size %d: unexpected error: %v", tt.size, err)
+		}
+		if partSize != tt.partSize || partCount != tt.partCount {
+			t.Errorf("size %d: expected %d parts of %d bytes, got %d of %d", tt.size, tt.partCount, tt.partSize, partCount, partSize)
+		}
+	}
+
+	for _, size := range []int64{0, -1, maxSize + 1} {
+		if _, _, err := planMultipartUpload(size, maxSize); err == nil {
+			t.Errorf("expected size %d to be rejected", size)
+		}
+	}
+}
+
+func TestValidateCompletedParts(t *testing.T) {
+	valid := []aws.CompletedPart{{PartNumber: 1, ETag: "a"}, {PartNumber: 2, ETag: "b"}}
+	if err := validateCompletedParts(valid); err != nil {
+		t.Fatalf("expected valid parts, got %v", err)
+	}
+
+	invalid := [][]aws.CompletedPart{
+		nil,
+		{{PartNumber: 0, ETag: "a"}},
+		{{PartNumber: maxMultipartParts + 1, ETag: "a"}},
+		{{PartNumber: 2, ETag: "a"}, {PartNumber: 1, ETag: "b"}},
+		{{PartNumber: 1, ETag: "a"}, {PartNumber: 1, ETag: "b"}},
+		{{PartNumber: 1}},
+	}
+	for _, parts := range invalid {
+		if err := validateCompletedParts(parts); err == nil {
+			t.Errorf("expected %+v to be rejected", parts)
+		}
+	}
+}
+
+func TestOwnsUploadKey(t *testing.T) {
+	userID := primitive.NewObjectID()
+	if !ownsUploadKey("video/"+userID.Hex()+"/intro.mp4", userID) {
+		t.Fatal("expected the user's key to be owned")
+	}
+	for _, key := range []string{"video/" + primitive.NewObjectID().Hex() + "/intro.mp4", "video/" + userID.Hex() + "/", userID.Hex()} {
+		if ownsUploadKey(key, userID) {
+			t.Errorf("expected %q not to be owned", key)
+		}
+	}
+}
+
+func TestCheckUploadedObject(t *testing.T) {
+	allowed := []string{"video/mp4"}
+	if err := checkUploadedObject(&aws.ObjectInfo{ContentType: "video/mp4; codecs=avc1", Size: 100}, allowed, 100); err != nil {
+		t.Fatalf("expected object to be accepted, got %v", err)
+	}
+
+	invalid := []aws.ObjectInfo{
+		{ContentType: "application/x-msdownload", Size: 100},
+		{ContentType: "video/mp4", Size: 0},
+		{ContentType: "video/mp4", Size: 101},
+	}
+	for _, info := range invalid {
+		if err := checkUploadedObject(&info, allowed, 100); err == nil {
+			t.Errorf("expected %+v to be rejected", info)
+		}
+	}
+}
+
+func TestHandleUploadCompleteRejectsForeignKey(t *testing.T) {
+	userID := primitive.NewObjectID()
+
+	app := fiber.New()
+	app.Post("/upload-complete", func(c *fiber.Ctx) error {
+		c.Locals("user", &middleware.Claims{UserID: userID, Role: "admin"})
+		return c.Next()
+	}, HandleUploadComplete(nil, nil))
+
+	// The key belongs to another user, so the object must not be checked or deleted
+	body := `{"file_key":"video/` + primitive.NewObjectID().Hex() + `/intro.mp4","type":"video"}`
+	req := httptest.NewRequest("POST", "/upload-complete", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxBulkUsers caps how many users a single bulk action may target
+const maxBulkUsers = 500
+
+// bulkUserUpdates maps each bulk action other than delete to the fields it sets
+var bulkUserUpdates = map[string]map[string]interface{}{
+	"block":   {"blocked": true},
+	"unblock": {"blocked": false},
+	"verify":  {"is_verified": true},
+}
+
+// bulkUserResult is the outcome of a bulk action for one of the requested IDs
+type bulkUserResult struct {
+	UserID  string `json:"user_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// planBulkUserAction resolves the requested IDs into the users to act on and a result per
+// requested ID, in request order. Invalid IDs fail right away, as does the admin's own
+// account for block and delete. Repeated IDs share the outcome of their first occurrence.
+func planBulkUserAction(userIDs []string, action string, adminID primitive.ObjectID) ([]bulkUserResult, []primitive.ObjectID, map[primitive.ObjectID][]int) {
+	results := make([]bulkUserResult, len(userIDs))
+	targets := make([]primitive.ObjectID, 0, len(userIDs))
+	positions := make(map[primitive.ObjectID][]int, len(userIDs))
+
+	for i, value := range userIDs {
+		results[i].UserID = value
+
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			results[i].Error = "Invalid user ID"
+			continue
+		}
+		if id == adminID && (action == "block" || action == "delete") {
+			results[i].Error = "Cannot " + action + " your own account"
+			continue
+		}
+
+		if _, seen := positions[id]; !seen {
+			targets = append(targets, id)
+		}
+		positions[id] = append(positions[id], i)
+	}
+
+	return results, targets, positions
+}
+
+// HandleBulkUserAction blocks, unblocks, verifies or soft deletes many users at once and
+// reports the outcome per ID (admin only)
+func HandleBulkUserAction(repo *repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		admin, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			Action  string   `json:"action"`
+			UserIDs []string `json:"user_ids"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		update, ok := bulkUserUpdates[req.Action]
+		if !ok && req.Action != "delete" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid action, must be one of block, unblock, verify, delete")
+		}
+		if len(req.UserIDs) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "user_ids is required")
+		}
+		if len(req.UserIDs) > maxBulkUsers {
+			return fiber.NewError(fiber.StatusBadRequest, "At most 500 users can be updated at once")
+		}
+
+		results, targets, positions := planBulkUserAction(req.UserIDs, req.Action, admin.ID)
+
+		var updated []primitive.ObjectID
+		if req.Action == "delete" {
+			updated, err = repo.BulkDelete(c.Context(), targets)
+		} else {
+			updated, err = repo.BulkUpdate(c.Context(), targets, update)
+		}
+		if err != nil {
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"action": req.Action,
+				"users":  len(targets),
+			}).Error("Failed to apply bulk user action")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update users")
+		}
+
+		for _, id := range updated {
+			for _, i := range positions[id] {
+				results[i].Success = true
+			}
+			delete(positions, id)
+		}
+		for _, missing := range positions {
+			for _, i := range missing {
+				results[i].Error = "User not found"
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"action":  req.Action,
+			"updated": len(updated),
+			"results": results,
+		})
+	}
+}
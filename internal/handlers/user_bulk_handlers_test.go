@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlanBulkUserAction(t *testing.T) {
+	admin := primitive.NewObjectID()
+	user := primitive.NewObjectID()
+	ids := []string{user.Hex(), "not-an-id", admin.Hex(), user.Hex()}
+
+	results, targets, positions := planBulkUserAction(ids, "block", admin)
+
+	if len(targets) != 1 || targets[0] != user {
+		t.Fatalf("expected only the other user as target, got %v", targets)
+	}
+	if got := positions[user]; len(got) != 2 || got[0] != 0 || got[1] != 3 {
+		t.Fatalf("expected repeated ID at positions 0 and 3, got %v", got)
+	}
+	if results[1].Error != "Invalid user ID" {
+		t.Errorf("expected invalid ID error, got %q", results[1].Error)
+	}
+	if results[2].Error != "Cannot block your own account" {
+		t.Errorf("expected self block error, got %q", results[2].Error)
+	}
+	for i, result := range results {
+		if result.UserID != ids[i] || result.Success {
+			t.Errorf("result %d: unexpected %+v", i, result)
+		}
+	}
+
+	// Verifying yourself is harmless, so the admin stays a target
+	_, targets, _ = planBulkUserAction([]string{admin.Hex()}, "verify", admin)
+	if len(targets) != 1 || targets[0] != admin {
+		t.Fatalf("expected the admin as target for verify, got %v", targets)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userExportTimeout bounds how long streaming a data export may take
+const userExportTimeout = 30 * time.Second
+
+// exportProfile is the user profile as included in a data export, without the password hash
+type exportProfile struct {
+	ID           string              `json:"id"`
+	Name         string              `json:"name"`
+	Email        string              `json:"email"`
+	Role         string              `json:"role"`
+	IsVerified   bool                `json:"is_verified"`
+	Subscription models.Subscription `json:"subscription"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+// newExportProfile copies the exportable fields of a user
+func newExportProfile(user *models.User) exportProfile {
+	return exportProfile{
+		ID:           user.ID.Hex(),
+		Name:         user.Name,
+		Email:        user.Email,
+		Role:         user.Role,
+		IsVerified:   user.IsVerified,
+		Subscription: user.Subscription,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+	}
+}
+
+// exportSection is one list of records in a data export. stream passes each record to
+// emit as it is read, so the export never holds a whole collection in memory.
+type exportSection struct {
+	name   string
+	stream func(ctx context.Context, emit func(record any) error) error
+}
+
+// writeJSONArray writes the records a section streams as a JSON array
+func writeJSONArray(ctx context.Context, w io.Writer, section exportSection) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	first := true
+	err := section.stream(ctx, func(record any) error {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", section.name, err)
+	}
+	_, err = io.WriteString(w, "]")
+	return err
+}
+
+// writeUserExport writes the export as a JSON object, the profile followed by every
+// section streamed one record at a time
+func writeUserExport(ctx context.Context, w io.Writer, exportedAt time.Time, profile exportProfile, sections []exportSection) error {
+	header, err := json.Marshal(struct {
+		ExportedAt time.Time     `json:"exported_at"`
+		Profile    exportProfile `json:"profile"`
+	}{exportedAt, profile})
+	if err != nil {
+		return err
+	}
+
+	// Reopen the header object to append the record sections
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		if _, err := fmt.Fprintf(w, ",%q:", section.name); err != nil {
+			return err
+		}
+		if err := writeJSONArray(ctx, w, section); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "}")
+	return err
+}
+
+// eachRecord adapts a repository's per-user iteration to an export section
+func eachRecord[T any](each func(ctx context.Context, userID primitive.ObjectID, fn func(T) error) error, userID primitive.ObjectID) func(ctx context.Context, emit func(record any) error) error {
+	return func(ctx context.Context, emit func(record any) error) error {
+		return each(ctx, userID, func(record T) error { return emit(record) })
+	}
+}
+
+// HandleExportUserData streams everything held on the current user as a downloadable
+// JSON file. Every section is read from a query scoped to the user while it is written.
+func HandleExportUserData(
+	userRepo *repository.UserRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	paymentRepo *repository.PaymentRepository,
+	videoRepo *repository.VideoRepository,
+	enrollmentRepo *repository.EnrollmentRepository,
+	certificateRepo *repository.CertificateRepository,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		current, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		user, err := userRepo.GetByID(c.Context(), current.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", current.ID).Error("Failed to get user for export")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to export data")
+		}
+		if user == nil {
+			return errUserNotFound
+		}
+
+		sections := []exportSection{
+			{name: "subscriptions", stream: eachRecord(subscriptionRepo.EachByUser, user.ID)},
+			{name: "payments", stream: eachRecord(paymentRepo.EachByUser, user.ID)},
+			{name: "watch_history", stream: eachRecord(videoRepo.EachWatchHistory, user.ID)},
+			{name: "enrollments", stream: eachRecord(enrollmentRepo.EachByUser, user.ID)},
+			{name: "certificates", stream: eachRecord(certificateRepo.EachByUser, user.ID)},
+		}
+		exportedAt := time.Now().UTC()
+		profile := newExportProfile(user)
+
+		c.Attachment(fmt.Sprintf("user-data-%s.json", user.ID.Hex()))
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		// The body is streamed after the handler returns, when c may already be reused.
+		// A failure midway can no longer change the status, it leaves the JSON truncated.
+		logger := log(c)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			ctx, cancel := context.WithTimeout(context.Background(), userExportTimeout)
+			defer cancel()
+			if err := writeUserExport(ctx, w, exportedAt, profile, sections); err != nil {
+				logger.WithError(err).WithField("user_id", user.ID).Error("Failed to stream user data export")
+			}
+		})
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestExportProfileOmitsPasswordHash(t *testing.T) {
+	user := &models.User{ID: primitive.NewObjectID(), Email: "a@example.com", PasswordHash: "secret-hash"}
+
+	data, err := json.Marshal(newExportProfile(user))
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "secret-hash") || strings.Contains(string(data), "password") {
+		t.Fatalf("expected no password hash in %s", data)
+	}
+}
+
+// fakeSection streams records as a repository iteration would
+func fakeSection[T any](name string, records []T, err error) exportSection {
+	return exportSection{name: name, stream: func(ctx context.Context, emit func(record any) error) error {
+		for _, record := range records {
+			if err := emit(record); err != nil {
+				return err
+			}
+		}
+		return err
+	}}
+}
+
+func TestWriteUserExportStreamsSections(t *testing.T) {
+	caller := primitive.NewObjectID()
+	courseID := primitive.NewObjectID()
+
+	sections := []exportSection{
+		fakeSection("subscriptions", []*models.Subscription{{ID: primitive.NewObjectID(), UserID: caller, Plan: "monthly"}}, nil),
+		fakeSection("payments", []*models.Payment{{ID: primitive.NewObjectID(), UserID: caller}, {ID: primitive.NewObjectID(), UserID: caller}}, nil),
+		fakeSection("watch_history", []*models.WatchHistory{}, nil),
+		fakeSection("enrollments", []*models.Enrollment{{ID: primitive.NewObjectID(), UserID: caller}}, nil),
+		fakeSection("certificates", []*models.Certificate{{ID: primitive.NewObjectID(), UserID: caller, CourseID: courseID, CourseTitle: "Go"}}, nil),
+	}
+
+	var buf strings.Builder
+	profile := newExportProfile(&models.User{ID: caller, Email: "me@example.com"})
+	if err := writeUserExport(context.Background(), &buf, time.Now().UTC(), profile, sections); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	var archive struct {
+		Profile struct {
+			ID string `json:"id"`
+		} `json:"profile"`
+		Subscriptions []json.RawMessage `json:"subscriptions"`
+		Payments      []json.RawMessage `json:"payments"`
+		WatchHistory  []json.RawMessage `json:"watch_history"`
+		Enrollments   []json.RawMessage `json:"enrollments"`
+		Certificates  []struct {
+			CourseID    primitive.ObjectID `json:"course_id"`
+			CourseTitle string             `json:"course_title"`
+		} `json:"certificates"`
+	}
+	if err := json.Unmarshal([]byte(buf.String()), &archive); err != nil {
+		t.Fatalf("expected valid JSON, got %v: %s", err, buf.String())
+	}
+
+	if archive.Profile.ID != caller.Hex() {
+		t.Fatalf("expected the caller's profile, got %q", archive.Profile.ID)
+	}
+	if len(archive.Subscriptions) != 1 || len(archive.Payments) != 2 || archive.WatchHistory == nil || len(archive.WatchHistory) != 0 || len(archive.Enrollments) != 1 {
+		t.Fatalf("expected every streamed record, got %s", buf.String())
+	}
+	if len(archive.Certificates) != 1 || archive.Certificates[0].CourseID != courseID || archive.Certificates[0].CourseTitle != "Go" {
+		t.Fatalf("expected the certificate to be exported, got %+v", archive.Certificates)
+	}
+}
+
+func TestWriteUserExportNamesFailedSection(t *testing.T) {
+	sections := []exportSection{
+		fakeSection("payments", []*models.Payment{{ID: primitive.NewObjectID()}}, nil),
+		fakeSection("certificates", []*models.Certificate{}, errors.New("cursor closed")),
+	}
+
+	var buf strings.Builder
+	err := writeUserExport(context.Background(), &buf, time.Now().UTC(), exportProfile{}, sections)
+	if err == nil || !strings.Contains(err.Error(), "certificates: cursor closed") {
+		t.Fatalf("expected the failed section to be named, got %v", err)
+	}
+}
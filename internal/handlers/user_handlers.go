@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"cource-api/internal/models"
 	"cource-api/internal/repository"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,8 +15,30 @@ func SetUserRepository(repo *repository.UserRepository) {
 	userRepo = repo
 }
 
-// HandleGetCurrentUser returns the current user's information
-func HandleGetCurrentUser(repo *repository.UserRepository) fiber.Handler {
+// liveSubscriptionSummary overlays the live active subscription on the summary embedded
+// in the user document, which is only refreshed by webhooks and may lag behind. Without a
+// live subscription an embedded summary still claiming access has lapsed.
+func liveSubscriptionSummary(embedded models.Subscription, live *models.Subscription, now time.Time) models.Subscription {
+	if live != nil {
+		embedded.Status = live.Status
+		embedded.Plan = live.Plan
+		embedded.CurrentPeriodEnd = live.CurrentPeriodEnd
+		return embedded
+	}
+
+	if embedded.Status == "active" || embedded.Status == "trial" {
+		if embedded.CurrentPeriodEnd.IsZero() || !embedded.CurrentPeriodEnd.After(now) {
+			embedded.Status = "expired"
+		} else {
+			embedded.Status = "canceled"
+		}
+	}
+	return embedded
+}
+
+// HandleGetCurrentUser returns the current user's information with the subscription
+// summary resolved from the live active subscription
+func HandleGetCurrentUser(repo *repository.UserRepository, subscriptionRepo *repository.SubscriptionRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		user, err := GetUserFromContext(c)
 		if err != nil {
@@ -27,8 +51,15 @@ func HandleGetCurrentUser(repo *repository.UserRepository) fiber.Handler {
 		}
 
 		if user == nil {
-			return fiber.NewError(fiber.StatusNotFound, "User not found")
+			return errUserNotFound
+		}
+
+		live, err := subscriptionRepo.GetActiveSubscription(c.Context(), user.ID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to get active subscription")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get user")
 		}
+		user.Subscription = liveSubscriptionSummary(user.Subscription, live, time.Now().UTC())
 
 		return c.JSON(user)
 	}
@@ -44,23 +75,65 @@ func HandleUpdateCurrentUser(repo *repository.UserRepository) fiber.Handler {
 
 		var updateData struct {
 			Name string `json:"name"`
+			// UpdatedAt is the version the client edited, optional
+			UpdatedAt *time.Time `json:"updated_at"`
 		}
 
 		if err := c.BodyParser(&updateData); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		if updateData.Name == "" || len(updateData.Name) > 50 {
 			return fiber.NewError(fiber.StatusForbidden, "Invalid input")
 		}
 
+		// Load the stored user, the token only carries the ID, email and role
+		user, err = repo.GetByID(c.Context(), user.ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get user")
+		}
+		if user == nil {
+			return errUserNotFound
+		}
+		if err := checkUnmodified(updateData.UpdatedAt, user.UpdatedAt); err != nil {
+			return err
+		}
+
 		user.Name = updateData.Name
 
 		// Update in database
 		if err := repo.Update(c.Context(), user); err != nil {
+			if staleErr := staleUpdateError(err); staleErr != nil {
+				return staleErr
+			}
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update user")
 		}
 
 		return c.JSON(user)
 	}
 }
+
+// HandleGetActivity returns the current user's activity feed, newest first
+func HandleGetActivity(repo *repository.ActivityRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		pagination := parsePagination(c, 20)
+
+		events, total, err := repo.ListActivity(c.Context(), user.ID, pagination.Page, pagination.Limit)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", user.ID).Error("Failed to list activity")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve activity")
+		}
+
+		return c.JSON(fiber.Map{
+			"activity": events,
+			"total":    total,
+			"page":     pagination.Page,
+			"limit":    pagination.Limit,
+		})
+	}
+}
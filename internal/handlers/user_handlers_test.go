@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+)
+
+func TestLiveSubscriptionSummaryPrefersLiveSubscription(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	embedded := models.Subscription{Status: "trial", Plan: "monthly", CurrentPeriodEnd: now.Add(-24 * time.Hour)}
+	live := &models.Subscription{Status: "active", Plan: "yearly", CurrentPeriodEnd: now.Add(365 * 24 * time.Hour)}
+
+	got := liveSubscriptionSummary(embedded, live, now)
+	if got.Status != "active" || got.Plan != "yearly" || !got.CurrentPeriodEnd.Equal(live.CurrentPeriodEnd) {
+		t.Fatalf("expected live subscription to win, got %+v", got)
+	}
+}
+
+func TestLiveSubscriptionSummaryWithoutLiveSubscription(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		embedded models.Subscription
+		want     string
+	}{
+		{"stale active past period end", models.Subscription{Status: "active", CurrentPeriodEnd: now.Add(-time.Hour)}, "expired"},
+		{"stale active within period", models.Subscription{Status: "active", CurrentPeriodEnd: now.Add(time.Hour)}, "canceled"},
+		{"already canceled", models.Subscription{Status: "canceled"}, "canceled"},
+		{"never subscribed", models.Subscription{}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := liveSubscriptionSummary(tt.embedded, nil, now); got.Status != tt.want {
+			t.Errorf("%s: expected status %q, got %q", tt.name, tt.want, got.Status)
+		}
+	}
+}
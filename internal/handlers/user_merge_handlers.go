@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+
+	"cource-api/internal/config"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/stripe-go/v76"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validateAccountMerge checks that the source user can be merged into the target. Two
+// active subscriptions cannot be combined, so one must be canceled first.
+func validateAccountMerge(source, target *models.User, sourceActive, targetActive *models.Subscription) error {
+	if source == nil {
+		return fiber.NewError(fiber.StatusNotFound, "Source user not found")
+	}
+	if target == nil {
+		return fiber.NewError(fiber.StatusNotFound, "Target user not found")
+	}
+	if source.ID == target.ID {
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot merge a user into itself")
+	}
+	if sourceActive != nil && targetActive != nil {
+		return fiber.NewError(fiber.StatusConflict, "Both users have an active subscription")
+	}
+	return nil
+}
+
+// HandleMergeUsers merges a duplicate account into another, moving its subscriptions,
+// payments, watch history, enrollments, certificates, reviews and notifications before
+// soft deleting it (admin only)
+func HandleMergeUsers(
+	userRepo *repository.UserRepository,
+	subRepo *repository.SubscriptionRepository,
+	auditRepo *repository.AuditRepository,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		admin, err := GetUserFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		var req struct {
+			SourceUserID string `json:"source_user_id"`
+			TargetUserID string `json:"target_user_id"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		sourceID, err := toObjectID(req.SourceUserID, "source_user_id")
+		if err != nil {
+			return err
+		}
+		targetID, err := toObjectID(req.TargetUserID, "target_user_id")
+		if err != nil {
+			return err
+		}
+
+		users := make(map[primitive.ObjectID]*models.User, 2)
+		active := make(map[primitive.ObjectID]*models.Subscription, 2)
+		for _, id := range []primitive.ObjectID{sourceID, targetID} {
+			user, err := userRepo.GetByID(c.Context(), id)
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", id).Error("Failed to get user")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to merge users")
+			}
+			if user == nil {
+				continue
+			}
+			users[id] = user
+
+			active[id], err = subRepo.GetConflictingActive(c.Context(), id, primitive.NilObjectID)
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", id).Error("Failed to get active subscription")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to merge users")
+			}
+		}
+
+		if err := validateAccountMerge(users[sourceID], users[targetID], active[sourceID], active[targetID]); err != nil {
+			return err
+		}
+
+		// Listed before the merge so their Stripe customers can be repointed afterwards
+		sourceSubscriptions, _, err := subRepo.ListByUser(c.Context(), sourceID, 1, 0)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", sourceID).Error("Failed to list subscriptions")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to merge users")
+		}
+
+		result, err := userRepo.MergeInto(c.Context(), sourceID, targetID)
+		if err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				return errUserNotFound
+			}
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"source_user_id": sourceID,
+				"target_user_id": targetID,
+			}).Error("Failed to merge users")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to merge users")
+		}
+
+		// Point the moved Stripe customers and subscriptions at the target so their
+		// webhooks and invoices name it. Only Stripe subscriptions have a customer.
+		if config.AppConfig.StripeKey != "" {
+			stripe.Key = config.AppConfig.StripeKey
+			updated := make(map[string]bool)
+			for _, subscription := range sourceSubscriptions {
+				if subscription.CustomerID == "" {
+					continue
+				}
+				if !updated[subscription.CustomerID] {
+					updated[subscription.CustomerID] = true
+					if err := setStripeCustomerOwner(subscription.CustomerID, targetID); err != nil {
+						log(c).WithError(err).WithField("customer_id", subscription.CustomerID).Error("Failed to update Stripe customer")
+					}
+				}
+				if subscription.SubscriptionID != "" {
+					if err := setStripeSubscriptionOwner(subscription.SubscriptionID, targetID); err != nil {
+						log(c).WithError(err).WithField("subscription_id", subscription.SubscriptionID).Error("Failed to update Stripe subscription")
+					}
+				}
+			}
+		} else if len(sourceSubscriptions) > 0 {
+			log(c).WithField("source_user_id", sourceID).Warn("Stripe is not configured, customer and subscription metadata was not updated")
+		}
+
+		entry := &models.AuditLog{
+			ActorID:    admin.ID,
+			Action:     "user.merge",
+			TargetType: "user",
+			TargetID:   targetID,
+			Details: map[string]interface{}{
+				"source_user_id": sourceID,
+				"source_email":   users[sourceID].Email,
+				"merged":         result,
+			},
+		}
+		if err := auditRepo.Record(c.Context(), entry); err != nil {
+			log(c).WithError(err).WithField("user_id", targetID).Error("Failed to record audit entry")
+		}
+
+		return c.JSON(fiber.Map{
+			"target_user_id": targetID,
+			"source_user_id": sourceID,
+			"merged":         result,
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateAccountMergeClean(t *testing.T) {
+	source := &models.User{ID: primitive.NewObjectID()}
+	target := &models.User{ID: primitive.NewObjectID()}
+	sourceActive := &models.Subscription{ID: primitive.NewObjectID(), UserID: source.ID, Status: "active"}
+
+	if err := validateAccountMerge(source, target, sourceActive, nil); err != nil {
+		t.Fatalf("expected merge to be allowed, got %v", err)
+	}
+	if err := validateAccountMerge(source, target, nil, nil); err != nil {
+		t.Fatalf("expected merge without subscriptions to be allowed, got %v", err)
+	}
+}
+
+func TestValidateAccountMergeConflicts(t *testing.T) {
+	source := &models.User{ID: primitive.NewObjectID()}
+	target := &models.User{ID: primitive.NewObjectID()}
+	sourceActive := &models.Subscription{ID: primitive.NewObjectID(), UserID: source.ID, Status: "active"}
+	targetActive := &models.Subscription{ID: primitive.NewObjectID(), UserID: target.ID, Status: "trial"}
+
+	tests := []struct {
+		name         string
+		source       *models.User
+		target       *models.User
+		sourceActive *models.Subscription
+		targetActive *models.Subscription
+		status       int
+	}{
+		{"both active", source, target, sourceActive, targetActive, fiber.StatusConflict},
+		{"same user", source, source, nil, nil, fiber.StatusBadRequest},
+		{"missing source", nil, target, nil, nil, fiber.StatusNotFound},
+		{"missing target", source, nil, nil, nil, fiber.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAccountMerge(tt.source, tt.target, tt.sourceActive, tt.targetActive)
+			var fiberErr *fiber.Error
+			if !errors.As(err, &fiberErr) || fiberErr.Code != tt.status {
+				t.Fatalf("expected status %d, got %v", tt.status, err)
+			}
+		})
+	}
+}
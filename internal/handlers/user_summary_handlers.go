@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// summaryListLimit caps the subscriptions and payments returned in a user summary
+const summaryListLimit = 20
+
+// userSummary is everything support needs to know about a user in one response
+type userSummary struct {
+	User                *models.User           `json:"user"`
+	ActiveSubscriptions []*models.Subscription `json:"active_subscriptions"`
+	PastSubscriptions   []*models.Subscription `json:"past_subscriptions"`
+	RecentPayments      []*models.Payment      `json:"recent_payments"`
+	Courses             []*models.CourseStart  `json:"courses"`
+	LastActivity        *models.ActivityEvent  `json:"last_activity"`
+}
+
+// isSubscriptionActive mirrors the active check of SubscriptionRepository.GetActiveSubscription
+func isSubscriptionActive(subscription *models.Subscription, now time.Time) bool {
+	return (subscription.Status == "active" || subscription.Status == "trial") &&
+		subscription.CurrentPeriodEnd.After(now)
+}
+
+// buildUserSummary splits subscriptions into active and past and assembles the summary
+func buildUserSummary(
+	user *models.User,
+	subscriptions []*models.Subscription,
+	payments []*models.Payment,
+	courses []*models.CourseStart,
+	activity []*models.ActivityEvent,
+	now time.Time,
+) *userSummary {
+	summary := &userSummary{
+		User:                user,
+		ActiveSubscriptions: []*models.Subscription{},
+		PastSubscriptions:   []*models.Subscription{},
+		RecentPayments:      payments,
+		Courses:             courses,
+	}
+
+	for _, subscription := range subscriptions {
+		if isSubscriptionActive(subscription, now) {
+			summary.ActiveSubscriptions = append(summary.ActiveSubscriptions, subscription)
+		} else {
+			summary.PastSubscriptions = append(summary.PastSubscriptions, subscription)
+		}
+	}
+
+	if summary.RecentPayments == nil {
+		summary.RecentPayments = []*models.Payment{}
+	}
+	if summary.Courses == nil {
+		summary.Courses = []*models.CourseStart{}
+	}
+	if len(activity) > 0 {
+		summary.LastActivity = activity[0]
+	}
+
+	return summary
+}
+
+// HandleGetUserSummary returns a user with their subscriptions, payments, courses and last activity (admin only)
+func HandleGetUserSummary(
+	userRepo *repository.UserRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	paymentRepo *repository.PaymentRepository,
+	activityRepo *repository.ActivityRepository,
+) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		user, err := userRepo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("user_id", objectID).Error("Failed to get user")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve user")
+		}
+		if user == nil {
+			return errUserNotFound
+		}
+
+		var (
+			wg            sync.WaitGroup
+			subscriptions []*models.Subscription
+			payments      []*models.Payment
+			courses       []*models.CourseStart
+			activity      []*models.ActivityEvent
+			subErr        error
+			paymentErr    error
+			courseErr     error
+			activityErr   error
+		)
+
+		ctx := c.Context()
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			subscriptions, _, subErr = subscriptionRepo.ListByUser(ctx, objectID, 1, summaryListLimit)
+		}()
+		go func() {
+			defer wg.Done()
+			payments, _, paymentErr = paymentRepo.ListByUser(ctx, objectID, 1, summaryListLimit)
+		}()
+		go func() {
+			defer wg.Done()
+			courses, courseErr = activityRepo.ListStartedCourses(ctx, objectID)
+		}()
+		go func() {
+			defer wg.Done()
+			activity, _, activityErr = activityRepo.ListActivity(ctx, objectID, 1, 1)
+		}()
+		wg.Wait()
+
+		for _, err := range []error{subErr, paymentErr, courseErr, activityErr} {
+			if err != nil {
+				log(c).WithError(err).WithField("user_id", objectID).Error("Failed to build user summary")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve user summary")
+			}
+		}
+
+		return c.JSON(buildUserSummary(user, subscriptions, payments, courses, activity, time.Now().UTC()))
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+)
+
+func TestBuildUserSummaryShape(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	user := &models.User{Email: "jane@example.com", Name: "Jane"}
+
+	subscriptions := []*models.Subscription{
+		{Status: "active", Plan: "monthly", CurrentPeriodEnd: now.Add(24 * time.Hour)},
+		{Status: "canceled", Plan: "monthly", CurrentPeriodEnd: now.Add(-24 * time.Hour)},
+		{Status: "active", Plan: "yearly", CurrentPeriodEnd: now.Add(-time.Hour)},
+	}
+	payments := []*models.Payment{{Amount: 999, Currency: "usd", Status: "completed"}}
+	courses := []*models.CourseStart{{StartedAt: now.Add(-time.Hour)}}
+	activity := []*models.ActivityEvent{{Type: "video_watched", OccurredAt: now.Add(-time.Minute)}}
+
+	summary := buildUserSummary(user, subscriptions, payments, courses, activity, now)
+
+	if len(summary.ActiveSubscriptions) != 1 || summary.ActiveSubscriptions[0].Plan != "monthly" {
+		t.Fatalf("expected one active monthly subscription, got %+v", summary.ActiveSubscriptions)
+	}
+	if len(summary.PastSubscriptions) != 2 {
+		t.Fatalf("expected two past subscriptions, got %d", len(summary.PastSubscriptions))
+	}
+	if summary.LastActivity == nil || summary.LastActivity.Type != "video_watched" {
+		t.Fatalf("expected last activity to be set, got %+v", summary.LastActivity)
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("failed to encode summary: %v", err)
+	}
+
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	for _, key := range []string{"user", "active_subscriptions", "past_subscriptions", "recent_payments", "courses", "last_activity"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("expected summary to contain %q", key)
+		}
+	}
+}
+
+func TestBuildUserSummaryEmptyListsEncodeAsArrays(t *testing.T) {
+	summary := buildUserSummary(&models.User{}, nil, nil, nil, nil, time.Now())
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("failed to encode summary: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	for _, key := range []string{"active_subscriptions", "past_subscriptions", "recent_payments", "courses"} {
+		if _, ok := decoded[key].([]interface{}); !ok {
+			t.Errorf("expected %q to encode as an array, got %v", key, decoded[key])
+		}
+	}
+	if decoded["last_activity"] != nil {
+		t.Errorf("expected last_activity to be null, got %v", decoded["last_activity"])
+	}
+}
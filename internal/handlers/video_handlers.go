@@ -2,9 +2,15 @@ package handlers
 
 import (
 	"cource-api/internal/aws"
+	"cource-api/internal/config"
+	"cource-api/internal/events"
+	"cource-api/internal/jobs"
 	"cource-api/internal/models"
 	"cource-api/internal/repository"
-	"strconv"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,65 +21,115 @@ import (
 // HandleListVideos lists all videos with pagination
 func HandleListVideos(repo *repository.VideoRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get pagination parameters
-		page, _ := strconv.ParseInt(c.Query("page", "1"), 10, 64)
-		limit, _ := strconv.ParseInt(c.Query("limit", "10"), 10, 64)
+		pagination := parsePagination(c, defaultPageLimit)
 
-		// Get course ID from query params if provided
+		// Videos are always listed per course
 		courseID := c.Query("course_id")
-		var videos []*models.Video
-		var total int64
-		var err error
+		if courseID == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "course_id is required")
+		}
 
-		if courseID != "" {
-			// Convert course ID to ObjectID
-			objectID, err := primitive.ObjectIDFromHex(courseID)
-			if err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, "Invalid course ID format")
-			}
-			videos, total, err = repo.ListByCourse(c.Context(), objectID, page, limit)
+		objectID, err := toObjectID(courseID, "course_id")
+		if err != nil {
+			return err
 		}
 
+		videos, total, err := repo.ListByCourse(c.Context(), objectID, pagination.Page, pagination.Limit)
 		if err != nil {
+			log(c).WithError(err).WithField("course_id", objectID).Error("Failed to list videos")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list videos")
 		}
 
-		return c.JSON(fiber.Map{
-			"videos": videos,
-			"total":  total,
-			"page":   page,
-			"limit":  limit,
-		})
+		return c.JSON(Paginate(videos, total, pagination))
+	}
+}
+
+// videoRequest is the body of a video creation, shared by single and bulk creation
+type videoRequest struct {
+	Title        string             `json:"title"`
+	Description  string             `json:"description"`
+	VideoURL     string             `json:"video_url"`     // Direct S3 URL for video
+	ThumbnailURL string             `json:"thumbnail_url"` // Direct S3 URL for thumbnail
+	Duration     int                `json:"duration"`
+	IsPaid       bool               `json:"is_paid"`
+	CourseID     primitive.ObjectID `json:"course_id"`
+	// PreviewSeconds is how much of a paid video users without access may watch
+	PreviewSeconds int `json:"preview_seconds"`
+	// Renditions maps quality to S3 key for adaptive streaming
+	Renditions     map[string]string `json:"renditions"`
+	MasterPlaylist string            `json:"master_playlist"`
+	Status         string            `json:"status"`
+}
+
+// validateVideoRequest checks the fields every new video needs, apart from its course.
+// A thumbnail is only required when none can be generated.
+func validateVideoRequest(req *videoRequest, canGenerateThumbnail bool) error {
+	if req.Title == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Title is required")
+	}
+	if req.VideoURL == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Video URL is required")
+	}
+	if req.ThumbnailURL == "" && !canGenerateThumbnail {
+		return fiber.NewError(fiber.StatusBadRequest, "Thumbnail URL is required")
+	}
+	if err := checkVideoMedia(req.VideoURL, req.Renditions); err != nil {
+		return err
+	}
+	if req.Status != "" && !validVideoStatus(req.Status) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid video status")
+	}
+	return validatePreviewSeconds(req.PreviewSeconds, req.Duration)
+}
+
+// validatePreviewSeconds checks a preview length against the video's duration, which is
+// unknown when zero
+func validatePreviewSeconds(preview, duration int) error {
+	if preview < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Preview seconds cannot be negative")
+	}
+	if duration > 0 && preview > duration {
+		return fiber.NewError(fiber.StatusBadRequest, "Preview seconds cannot exceed the video duration")
+	}
+	return nil
+}
+
+// newVideo builds the video to store for a request in a course. Without a thumbnail in
+// the request the thumbnail is marked pending when one will be generated.
+func newVideo(req *videoRequest, courseID primitive.ObjectID, generateThumbnail bool) *models.Video {
+	return &models.Video{
+		Title:       req.Title,
+		Description: req.Description,
+		URL:         req.VideoURL,
+		Thumbnail:   req.ThumbnailURL,
+
+		ThumbnailPending: req.ThumbnailURL == "" && generateThumbnail,
+		Duration:         req.Duration,
+		IsPaid:           req.IsPaid,
+		CourseID:         courseID,
+		CreatedAt:        time.Now().UTC(),
+
+		PreviewSeconds: req.PreviewSeconds,
+
+		Renditions:     req.Renditions,
+		MasterPlaylist: req.MasterPlaylist,
+		Status:         req.Status,
 	}
 }
 
-// HandleCreateVideo creates a new video
-func HandleCreateVideo(repo *repository.VideoRepository, courseRepo *repository.CourseRepository) fiber.Handler {
+// HandleCreateVideo creates a new video. When thumbnails is non-nil a missing
+// thumbnail is generated from the uploaded video in the background.
+func HandleCreateVideo(courseRepo *repository.CourseRepository, thumbnails *jobs.ThumbnailWorker) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Parse request body
-		var req struct {
-			Title        string             `json:"title"`
-			Description  string             `json:"description"`
-			VideoURL     string             `json:"video_url"`     // Direct S3 URL for video
-			ThumbnailURL string             `json:"thumbnail_url"` // Direct S3 URL for thumbnail
-			Duration     int                `json:"duration"`
-			IsPaid       bool               `json:"is_paid"`
-			CourseID     primitive.ObjectID `json:"course_id"`
-		}
-
+		var req videoRequest
 		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
 		}
 
 		// Validate required fields
-		if req.Title == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Title is required")
-		}
-		if req.VideoURL == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Video URL is required")
-		}
-		if req.ThumbnailURL == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Thumbnail URL is required")
+		if err := validateVideoRequest(&req, thumbnails != nil); err != nil {
+			return err
 		}
 		if req.CourseID.IsZero() {
 			return fiber.NewError(fiber.StatusBadRequest, "Course ID is required")
@@ -85,50 +141,324 @@ func HandleCreateVideo(repo *repository.VideoRepository, courseRepo *repository.
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify course")
 		}
 		if course == nil {
-			return fiber.NewError(fiber.StatusNotFound, "Course not found")
+			return errCourseNotFound
 		}
 
 		// Create video object
-		video := &models.Video{
-			Title:       req.Title,
-			Description: req.Description,
-			URL:         req.VideoURL,
-			Thumbnail:   req.ThumbnailURL,
-			Duration:    req.Duration,
-			IsPaid:      req.IsPaid,
-			CourseID:    req.CourseID,
-			CreatedAt:   time.Now(),
-		}
-
-		// Create video
-		if err := repo.Create(c.Context(), video); err != nil {
+		video := newVideo(&req, req.CourseID, thumbnails != nil)
+
+		// Create the video and append it to the course's video order in one transaction,
+		// so a failed attachment never leaves an orphan video behind
+		if err := courseRepo.CreateVideoInCourse(c.Context(), video); err != nil {
+			if errors.Is(err, repository.ErrCourseNotFound) {
+				return errCourseNotFound
+			}
+			log(c).WithError(err).WithField("course_id", video.CourseID).Error("Failed to create video")
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create video")
 		}
 
-		// Add video to course's video order
-		if err := courseRepo.AddVideoToCourse(c.Context(), video.CourseID, video.ID, len(course.VideoOrder)); err != nil {
-			// If adding to course fails, delete the video
-			_ = repo.Delete(c.Context(), video.ID)
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to add video to course")
+		if video.ThumbnailPending {
+			thumbnails.Enqueue(c.Context(), video)
 		}
 
 		return c.Status(fiber.StatusCreated).JSON(video)
 	}
 }
 
-// HandleGetVideo gets a specific video by ID
-func HandleGetVideo(repo *repository.VideoRepository) fiber.Handler {
+// maxBulkVideos caps how many videos a single bulk creation accepts
+const maxBulkVideos = 100
+
+// bulkCreatedVideo is a video created in bulk with its position in the course video order
+type bulkCreatedVideo struct {
+	*models.Video
+	Position int `json:"position"`
+}
+
+// validateBulkVideos checks every video of a bulk creation, naming the index of the
+// first invalid one in the error
+func validateBulkVideos(reqs []videoRequest, canGenerateThumbnail bool) error {
+	if len(reqs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one video is required")
+	}
+	if len(reqs) > maxBulkVideos {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("At most %d videos can be created at once", maxBulkVideos))
+	}
+
+	for i := range reqs {
+		if err := validateVideoRequest(&reqs[i], canGenerateThumbnail); err != nil {
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				return fiber.NewError(fiberErr.Code, fmt.Sprintf("videos[%d]: %s", i, fiberErr.Message))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleBulkCreateVideos creates several videos in one course and appends them to its
+// video order. Either every video is created or none is. Missing thumbnails are
+// generated in the background when thumbnails is non-nil.
+func HandleBulkCreateVideos(courseRepo *repository.CourseRepository, thumbnails *jobs.ThumbnailWorker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			CourseID primitive.ObjectID `json:"course_id"`
+			Videos   []videoRequest     `json:"videos"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return errInvalidBody
+		}
+
+		if req.CourseID.IsZero() {
+			return fiber.NewError(fiber.StatusBadRequest, "Course ID is required")
+		}
+		if err := validateBulkVideos(req.Videos, thumbnails != nil); err != nil {
+			return err
+		}
+
+		course, err := courseRepo.GetByID(c.Context(), req.CourseID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify course")
+		}
+		if course == nil {
+			return errCourseNotFound
+		}
+
+		videos := make([]*models.Video, len(req.Videos))
+		for i := range req.Videos {
+			videos[i] = newVideo(&req.Videos[i], course.ID, thumbnails != nil)
+		}
+
+		start, err := courseRepo.CreateVideosInCourse(c.Context(), course.ID, videos)
+		if err != nil {
+			if errors.Is(err, repository.ErrCourseNotFound) {
+				return errCourseNotFound
+			}
+			log(c).WithError(err).WithField("course_id", course.ID).Error("Failed to create videos")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create videos")
+		}
+
+		created := make([]bulkCreatedVideo, len(videos))
+		for i, video := range videos {
+			if video.ThumbnailPending {
+				thumbnails.Enqueue(c.Context(), video)
+			}
+			created[i] = bulkCreatedVideo{Video: video, Position: start + i}
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"videos": created,
+		})
+	}
+}
+
+// signThumbnail replaces a video's thumbnail key with a signed URL. Thumbnails are left
+// untouched when the bucket is public or the stored value is already a full URL.
+func signThumbnail(video *models.Video, public bool, sign func(key string) (string, error)) error {
+	if video.Thumbnail == "" || public ||
+		strings.HasPrefix(video.Thumbnail, "https://") || strings.HasPrefix(video.Thumbnail, "http://") {
+		return nil
+	}
+
+	signed, err := sign(video.Thumbnail)
+	if err != nil {
+		return err
+	}
+	video.Thumbnail = signed
+	return nil
+}
+
+// signThumbnailWithS3 signs a video thumbnail against the thumbnail bucket for as long as watch URLs stay valid
+func signThumbnailWithS3(video *models.Video) error {
+	return signThumbnail(video, config.AppConfig.PublicThumbnails, func(key string) (string, error) {
+		return aws.S3C.GenerateThumbnailWatchURL(key, config.AppConfig.WatchURLExpiryHours)
+	})
+}
+
+// validVideoStatus reports whether status is a known video processing status
+func validVideoStatus(status string) bool {
+	switch status {
+	case models.VideoStatusProcessing, models.VideoStatusReady, models.VideoStatusFailed:
+		return true
+	}
+	return false
+}
+
+// checkVideoMedia rejects a request whose original key or renditions could not be stored
+func checkVideoMedia(originalKey string, renditions map[string]string) error {
+	if err := repository.ValidateVideoMedia(&models.Video{URL: originalKey, Renditions: renditions}); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// watchURLSigner signs video watch URLs through CloudFront when the CDN is enabled,
+// otherwise with S3 presigned URLs
+func watchURLSigner() func(key string) (string, error) {
+	if config.AppConfig.CDNEnabled && aws.CFSigner != nil {
+		return func(key string) (string, error) {
+			return aws.CFSigner.GenerateWatchURL(key, config.AppConfig.WatchURLExpiryHours)
+		}
+	}
+	return func(key string) (string, error) {
+		return aws.S3C.GenerateWatchURL(key, config.AppConfig.WatchURLExpiryHours)
+	}
+}
+
+// signVideoMedia replaces the S3 keys of a video with signed watch URLs. Subtitles,
+// renditions and the master playlist are signed as well when the video has them.
+func signVideoMedia(video *models.Video, sign func(key string) (string, error)) error {
+	signedURL, err := sign(video.URL)
+	if err != nil {
+		return err
+	}
+	video.URL = signedURL
+
+	for i, subtitle := range video.Subtitles {
+		signed, err := sign(subtitle.Key)
+		if err != nil {
+			return err
+		}
+		video.Subtitles[i].Key = signed
+	}
+
+	if len(video.Renditions) == 0 {
+		return nil
+	}
+
+	renditions := make(map[string]string, len(video.Renditions))
+	for quality, key := range video.Renditions {
+		signed, err := sign(key)
+		if err != nil {
+			return err
+		}
+		renditions[quality] = signed
+	}
+	video.Renditions = renditions
+
+	if video.MasterPlaylist != "" {
+		signed, err := sign(video.MasterPlaylist)
+		if err != nil {
+			return err
+		}
+		video.MasterPlaylist = signed
+	}
+	return nil
+}
+
+// videoAccessible reports whether a video can be watched given the caller's
+// role, subscription and purchase of the video's course
+func videoAccessible(video *models.Video, role string, subscribed, purchased bool) bool {
+	return !video.IsPaid || role == "admin" || subscribed || purchased
+}
+
+// canWatchVideo checks the caller's entitlement to a video, only querying the
+// subscription and purchase records when the video is paid
+func canWatchVideo(
+	c *fiber.Ctx,
+	video *models.Video,
+	user *models.User,
+	subscriptionRepo *repository.SubscriptionRepository,
+	paymentRepo *repository.PaymentRepository,
+) (bool, error) {
+	if videoAccessible(video, user.Role, false, false) {
+		return true, nil
+	}
+
+	subscription, err := subscriptionRepo.GetActiveSubscription(c.Context(), user.ID)
+	if err != nil {
+		return false, err
+	}
+	if subscription != nil {
+		return true, nil
+	}
+
+	if video.CourseID.IsZero() {
+		return false, nil
+	}
+	purchased, err := paymentRepo.HasPurchasedCourse(c.Context(), user.ID, video.CourseID)
+	if err != nil {
+		return false, err
+	}
+	return videoAccessible(video, user.Role, false, purchased), nil
+}
+
+// previewAvailable reports whether users without access may watch the start of a video
+func previewAvailable(video *models.Video) bool {
+	return video.IsPaid && video.PreviewSeconds > 0
+}
+
+// checkWatchProgress rejects progress a user may not record on a video. Without access
+// only a preview can be watched, and not beyond its end.
+func checkWatchProgress(video *models.Video, entitled bool, progressSeconds int) error {
+	if entitled {
+		return nil
+	}
+	if !previewAvailable(video) {
+		return errSubscriptionRequired
+	}
+	if progressSeconds > video.PreviewSeconds {
+		return errPreviewLimitExceeded
+	}
+	return nil
+}
+
+// videoResponse is a video with the caller's entitlement to it. Players stop a video
+// without entitlement after its preview_seconds. When served in the context of a
+// course it also carries the video's place in the course, so players can offer
+// previous and next buttons.
+type videoResponse struct {
+	*models.Video
+	IsEntitled bool `json:"is_entitled"`
+	*videoNavigation
+}
+
+// videoNavigation is the place of a video in a course's video order. Index is zero
+// based and the neighbour IDs are null at either end of the course.
+type videoNavigation struct {
+	PreviousVideoID *primitive.ObjectID `json:"previous_video_id"`
+	NextVideoID     *primitive.ObjectID `json:"next_video_id"`
+	Index           int                 `json:"index"`
+	Total           int                 `json:"total"`
+}
+
+// courseNavigation finds a video in a course's video order. It reports false when the
+// video is not part of the course.
+func courseNavigation(order []primitive.ObjectID, videoID primitive.ObjectID) (videoNavigation, bool) {
+	index := slices.Index(order, videoID)
+	if index < 0 {
+		return videoNavigation{}, false
+	}
+
+	nav := videoNavigation{Index: index, Total: len(order)}
+	if index > 0 {
+		nav.PreviousVideoID = &order[index-1]
+	}
+	if index < len(order)-1 {
+		nav.NextVideoID = &order[index+1]
+	}
+	return nav, true
+}
+
+// HandleGetVideo gets a specific video by ID. Users without access to a paid video
+// with a preview get it with is_entitled false. With a course_id query parameter the
+// response also places the video in that course.
+func HandleGetVideo(
+	repo *repository.VideoRepository,
+	courseRepo *repository.CourseRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	paymentRepo *repository.PaymentRepository,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get video ID from params
-		videoID := c.Params("id")
-		if videoID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Video ID is required")
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
 		}
 
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(videoID)
+		user, err := GetUserFromContext(c)
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid video ID format")
+			return err
 		}
 
 		// Get video
@@ -137,34 +467,63 @@ func HandleGetVideo(repo *repository.VideoRepository) fiber.Handler {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get video")
 		}
 		if video == nil {
-			return fiber.NewError(fiber.StatusNotFound, "Video not found")
+			return errVideoNotFound
+		}
+
+		var nav *videoNavigation
+		if courseIDHex := c.Query("course_id"); courseIDHex != "" {
+			courseID, err := toObjectID(courseIDHex, "course_id")
+			if err != nil {
+				return err
+			}
+			course, err := courseRepo.GetByID(c.Context(), courseID)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to get course")
+			}
+			if course == nil {
+				return errCourseNotFound
+			}
+
+			found, ok := courseNavigation(course.VideoOrder, objectID)
+			if !ok {
+				return fiber.NewError(fiber.StatusBadRequest, "Video does not belong to the course")
+			}
+			nav = &found
 		}
 
-		presignedURL, err := aws.S3C.GenerateWatchURL(video.URL, 12)
+		allowed, err := canWatchVideo(c, video, user, subscriptionRepo, paymentRepo)
 		if err != nil {
-			logrus.WithError(err).Error("Failed to generate pre-signed URL")
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate upload URL")
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"video_id": objectID,
+			}).Error("Failed to check video entitlement")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get video")
+		}
+		if !allowed && !previewAvailable(video) {
+			return errSubscriptionRequired
 		}
 
-		video.URL = presignedURL
+		err = signVideoMedia(video, watchURLSigner())
+		if err != nil {
+			log(c).WithError(err).Error("Failed to generate pre-signed URL")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate upload URL")
+		}
+		if err := signThumbnailWithS3(video); err != nil {
+			log(c).WithError(err).Error("Failed to generate pre-signed thumbnail URL")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate thumbnail URL")
+		}
 
-		return c.JSON(video)
+		return c.JSON(videoResponse{Video: video, IsEntitled: allowed, videoNavigation: nav})
 	}
 }
 
-// HandleUpdateVideo updates a video
+// HandleUpdateVideo updates a video. Empty strings and omitted fields keep their stored value.
 func HandleUpdateVideo(repo *repository.VideoRepository, courseRepo *repository.CourseRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get video ID from params
-		videoID := c.Params("id")
-		if videoID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Video ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(videoID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid video ID format")
+			return err
 		}
 
 		// Get existing video
@@ -173,49 +532,31 @@ func HandleUpdateVideo(repo *repository.VideoRepository, courseRepo *repository.
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get video")
 		}
 		if video == nil {
-			return fiber.NewError(fiber.StatusNotFound, "Video not found")
+			return errVideoNotFound
 		}
 
 		// Parse update data
 		var updateData struct {
-			Title        string             `json:"title"`
-			Description  string             `json:"description"`
-			VideoURL     string             `json:"video_url"`     // Direct S3 URL for video
-			ThumbnailURL string             `json:"thumbnail_url"` // Direct S3 URL for thumbnail
-			Duration     int                `json:"duration"`
-			IsPaid       bool               `json:"is_paid"`
-			CourseID     primitive.ObjectID `json:"course_id"`
+			Title        string              `json:"title"`
+			Description  string              `json:"description"`
+			VideoURL     string              `json:"video_url"`     // Direct S3 URL for video
+			ThumbnailURL string              `json:"thumbnail_url"` // Direct S3 URL for thumbnail
+			Duration     int                 `json:"duration"`
+			IsPaid       *bool               `json:"is_paid"`
+			CourseID     *primitive.ObjectID `json:"course_id"`
+			// PreviewSeconds of zero removes the preview
+			PreviewSeconds *int `json:"preview_seconds"`
+			// Renditions replaces the stored renditions when present
+			Renditions     map[string]string `json:"renditions"`
+			MasterPlaylist string            `json:"master_playlist"`
 		}
 
 		if err := c.BodyParser(&updateData); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
-		}
-
-		// Handle course change if needed
-		if video.CourseID != updateData.CourseID {
-			course, err := courseRepo.GetByID(c.Context(), updateData.CourseID)
-			if err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify course")
-			}
-			if course == nil {
-				return fiber.NewError(fiber.StatusNotFound, "Course not found")
-			}
-
-			//NOTE: Solve the issue of remove and add video to new course
-			if err := courseRepo.RemoveVideoFromCourse(c.Context(), video.CourseID, video.ID); err != nil {
-				logrus.Error(err)
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to remove video from old course")
-			}
-
-			// Add video to new course
-			if err := courseRepo.AddVideoToCourse(c.Context(), updateData.CourseID, video.ID, len(course.VideoOrder)); err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to add video to new course")
-			}
-
-			video.CourseID = updateData.CourseID
+			return errInvalidBody
 		}
 
 		// Update video fields
+		fromCourseID := video.CourseID
 		if updateData.Title != "" {
 			video.Title = updateData.Title
 		}
@@ -227,34 +568,171 @@ func HandleUpdateVideo(repo *repository.VideoRepository, courseRepo *repository.
 		}
 		if updateData.ThumbnailURL != "" {
 			video.Thumbnail = updateData.ThumbnailURL
+			video.ThumbnailPending = false
 		}
 		if updateData.Duration > 0 {
 			video.Duration = updateData.Duration
 		}
-		video.IsPaid = updateData.IsPaid
+		if updateData.IsPaid != nil {
+			video.IsPaid = *updateData.IsPaid
+		}
+		if updateData.PreviewSeconds != nil {
+			video.PreviewSeconds = *updateData.PreviewSeconds
+		}
+		if updateData.CourseID != nil {
+			video.CourseID = *updateData.CourseID
+		}
+		if updateData.Renditions != nil {
+			video.Renditions = updateData.Renditions
+		}
+		if updateData.MasterPlaylist != "" {
+			video.MasterPlaylist = updateData.MasterPlaylist
+		}
 
-		// Update video
-		if err := repo.Update(c.Context(), video); err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update video")
+		if err := checkVideoMedia(video.URL, video.Renditions); err != nil {
+			return err
+		}
+		if err := validatePreviewSeconds(video.PreviewSeconds, video.Duration); err != nil {
+			return err
 		}
 
-		return c.JSON(video)
+		return saveVideo(c, courseRepo, video, fromCourseID)
 	}
 }
 
-// HandleDeleteVideo deletes a video
-func HandleDeleteVideo(repo *repository.VideoRepository, courseRepo *repository.CourseRepository) fiber.Handler {
+// saveVideo stores an edited video, moving it to its new course when the course changed
+// from fromCourseID, and responds with it
+func saveVideo(c *fiber.Ctx, courseRepo *repository.CourseRepository, video *models.Video, fromCourseID primitive.ObjectID) error {
+	if err := courseRepo.UpdateVideoInCourse(c.Context(), video, fromCourseID); err != nil {
+		if errors.Is(err, repository.ErrCourseNotFound) {
+			return errCourseNotFound
+		}
+		log(c).WithError(err).WithFields(logrus.Fields{
+			"video_id":  video.ID,
+			"course_id": video.CourseID,
+		}).Error("Failed to update video")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update video")
+	}
+
+	return c.JSON(video)
+}
+
+// videoPatch holds the fields of a partial video update. A nil field was
+// omitted from the request body and leaves the stored value untouched.
+type videoPatch struct {
+	Title        *string             `json:"title"`
+	Description  *string             `json:"description"`
+	VideoURL     *string             `json:"video_url"`
+	ThumbnailURL *string             `json:"thumbnail_url"`
+	Duration     *int                `json:"duration"`
+	IsPaid       *bool               `json:"is_paid"`
+	CourseID     *primitive.ObjectID `json:"course_id"`
+	// PreviewSeconds of zero removes the preview
+	PreviewSeconds *int `json:"preview_seconds"`
+	// Renditions replaces the stored renditions when present, an empty object clears them
+	Renditions     map[string]string `json:"renditions"`
+	MasterPlaylist *string           `json:"master_playlist"`
+	Status         *string           `json:"status"`
+}
+
+// apply copies every provided field of the patch onto the video, including its course.
+// Moving the video between the courses' video orders is left to the caller.
+func (p *videoPatch) apply(video *models.Video) {
+	if p.Title != nil {
+		video.Title = *p.Title
+	}
+	if p.Description != nil {
+		video.Description = *p.Description
+	}
+	if p.VideoURL != nil {
+		video.URL = *p.VideoURL
+	}
+	if p.ThumbnailURL != nil {
+		video.Thumbnail = *p.ThumbnailURL
+		video.ThumbnailPending = false
+	}
+	if p.Duration != nil {
+		video.Duration = *p.Duration
+	}
+	if p.IsPaid != nil {
+		video.IsPaid = *p.IsPaid
+	}
+	if p.PreviewSeconds != nil {
+		video.PreviewSeconds = *p.PreviewSeconds
+	}
+	if p.Renditions != nil {
+		video.Renditions = p.Renditions
+	}
+	if p.MasterPlaylist != nil {
+		video.MasterPlaylist = *p.MasterPlaylist
+	}
+	if p.Status != nil {
+		video.Status = *p.Status
+	}
+	if p.CourseID != nil {
+		video.CourseID = *p.CourseID
+	}
+}
+
+// HandlePatchVideo partially updates a video, changing only the fields present in the body
+func HandlePatchVideo(repo *repository.VideoRepository, courseRepo *repository.CourseRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get video ID from params
-		videoID := c.Params("id")
-		if videoID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Video ID is required")
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
 		}
 
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(videoID)
+		// Get existing video
+		video, err := repo.GetByID(c.Context(), objectID)
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid video ID format")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get video")
+		}
+		if video == nil {
+			return errVideoNotFound
+		}
+
+		// Parse patch data
+		var patch videoPatch
+		if err := c.BodyParser(&patch); err != nil {
+			return errInvalidBody
+		}
+
+		// Validate required fields that cannot be cleared
+		if patch.Title != nil && *patch.Title == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Title cannot be empty")
+		}
+		if patch.VideoURL != nil && *patch.VideoURL == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Video URL cannot be empty")
+		}
+		if patch.Duration != nil && *patch.Duration < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Duration cannot be negative")
+		}
+		if patch.Status != nil && !validVideoStatus(*patch.Status) {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid video status")
+		}
+		fromCourseID := video.CourseID
+		patch.apply(video)
+
+		// Validate the video as it will be stored, with the patched URL
+		if err := checkVideoMedia(video.URL, video.Renditions); err != nil {
+			return err
+		}
+		if err := validatePreviewSeconds(video.PreviewSeconds, video.Duration); err != nil {
+			return err
+		}
+
+		return saveVideo(c, courseRepo, video, fromCourseID)
+	}
+}
+
+// HandleDeleteVideo deletes a video
+func HandleDeleteVideo(repo *repository.VideoRepository, courseRepo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Get video ID from params
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
 		}
 
 		// Get existing video
@@ -263,18 +741,18 @@ func HandleDeleteVideo(repo *repository.VideoRepository, courseRepo *repository.
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get video")
 		}
 		if video == nil {
-			return fiber.NewError(fiber.StatusNotFound, "Video not found")
+			return errVideoNotFound
 		}
 
 		// Delete video file from S3
 		if err := aws.S3C.DeleteFile(video.URL); err != nil {
-			logrus.WithError(err).WithField("video_id", videoID).Error("Failed to delete video file from S3")
+			log(c).WithError(err).WithField("video_id", objectID).Error("Failed to delete video file from S3")
 			// Continue with deletion even if S3 deletion fails
 		}
 
 		// Delete thumbnail from S3
 		if err := aws.S3C.DeleteThumbnail(video.Thumbnail); err != nil {
-			logrus.WithError(err).WithField("video_id", videoID).Error("Failed to delete thumbnail from S3")
+			log(c).WithError(err).WithField("video_id", objectID).Error("Failed to delete thumbnail from S3")
 			// Continue with deletion even if S3 deletion fails
 		}
 
@@ -285,7 +763,7 @@ func HandleDeleteVideo(repo *repository.VideoRepository, courseRepo *repository.
 
 		// Remove video from course's video order
 		if err := courseRepo.RemoveVideoFromCourse(c.Context(), video.CourseID, video.ID); err != nil {
-			logrus.WithError(err).WithField("video_id", videoID).Error("Failed to remove video from course")
+			log(c).WithError(err).WithField("video_id", objectID).Error("Failed to remove video from course")
 			// Continue even if removing from course fails
 		}
 
@@ -293,8 +771,15 @@ func HandleDeleteVideo(repo *repository.VideoRepository, courseRepo *repository.
 	}
 }
 
-// HandleUpdateWatchHistory updates or creates a watch history entry
-func HandleUpdateWatchHistory(repo *repository.VideoRepository) fiber.Handler {
+// HandleUpdateWatchHistory updates or creates a watch history entry and marks the video's course as started.
+// Users without access to a paid video can only record progress within its preview.
+func HandleUpdateWatchHistory(
+	repo *repository.VideoRepository,
+	activityRepo *repository.ActivityRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	paymentRepo *repository.PaymentRepository,
+	broker *events.Broker,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get current user
 		user, err := GetUserFromContext(c)
@@ -303,15 +788,9 @@ func HandleUpdateWatchHistory(repo *repository.VideoRepository) fiber.Handler {
 		}
 
 		// Get video ID from params
-		videoID := c.Params("id")
-		if videoID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "Video ID is required")
-		}
-
-		// Convert string ID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(videoID)
+		objectID, err := parseObjectID(c, "id")
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid video ID format")
+			return err
 		}
 
 		// Parse request body
@@ -320,22 +799,61 @@ func HandleUpdateWatchHistory(repo *repository.VideoRepository) fiber.Handler {
 		}
 
 		if err := c.BodyParser(&updateData); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			return errInvalidBody
+		}
+
+		// Get video
+		video, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get video")
+		}
+		if video == nil {
+			return errVideoNotFound
+		}
+
+		entitled, err := canWatchVideo(c, video, user, subscriptionRepo, paymentRepo)
+		if err != nil {
+			log(c).WithError(err).WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"video_id": objectID,
+			}).Error("Failed to check video entitlement")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update watch history")
+		}
+		if err := checkWatchProgress(video, entitled, updateData.ProgressSeconds); err != nil {
+			return err
 		}
 
 		// Create watch history entry
 		history := &models.WatchHistory{
 			UserID:          user.ID,
 			VideoID:         objectID,
-			LastWatchedAt:   time.Now(),
+			LastWatchedAt:   time.Now().UTC(),
 			ProgressSeconds: updateData.ProgressSeconds,
 		}
 
 		// Update watch history
-		if err := repo.UpdateWatchHistory(c.Context(), history); err != nil {
+		firstView, err := repo.UpdateWatchHistory(c.Context(), history)
+		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update watch history")
 		}
 
+		// Only the first progress event of a user counts as a view, resumes do not
+		if firstView {
+			if err := repo.IncrementViewCount(c.Context(), objectID); err != nil {
+				log(c).WithError(err).WithField("video_id", objectID).Error("Failed to increment view count")
+			}
+		}
+
+		// Mark the course as started on first watch
+		if !video.CourseID.IsZero() {
+			if err := activityRepo.MarkCourseStarted(c.Context(), user.ID, video.CourseID); err != nil {
+				log(c).WithError(err).WithField("course_id", video.CourseID).Error("Failed to mark course as started")
+			}
+		}
+
+		// Keep the user's other sessions at the same position
+		broker.Publish(user.ID, events.Event{Type: events.TypeWatchProgress, Data: history})
+
 		return c.JSON(history)
 	}
 }
@@ -349,12 +867,10 @@ func HandleGetWatchHistory(repo *repository.VideoRepository) fiber.Handler {
 			return err
 		}
 
-		// Get pagination parameters
-		page, _ := strconv.ParseInt(c.Query("page", "1"), 10, 64)
-		limit, _ := strconv.ParseInt(c.Query("limit", "10"), 10, 64)
+		pagination := parsePagination(c, defaultPageLimit)
 
 		// Get watch history
-		history, total, err := repo.ListWatchHistory(c.Context(), user.ID, page, limit)
+		history, total, err := repo.ListWatchHistory(c.Context(), user.ID, pagination.Page, pagination.Limit)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get watch history")
 		}
@@ -362,8 +878,69 @@ func HandleGetWatchHistory(repo *repository.VideoRepository) fiber.Handler {
 		return c.JSON(fiber.Map{
 			"history": history,
 			"total":   total,
-			"page":    page,
-			"limit":   limit,
+			"page":    pagination.Page,
+			"limit":   pagination.Limit,
 		})
 	}
 }
+
+// videoMembership describes which courses reference a video and whether that agrees
+// with the course the video itself points to
+type videoMembership struct {
+	VideoID         primitive.ObjectID  `json:"video_id"`
+	CourseID        *primitive.ObjectID `json:"course_id,omitempty"`
+	Courses         []*models.Course    `json:"courses"`
+	InOwnCourse     bool                `json:"in_own_course"`
+	MultipleCourses bool                `json:"multiple_courses"`
+}
+
+// buildVideoMembership compares the courses listing a video with the video's own course_id.
+// video is nil when the video record no longer exists.
+func buildVideoMembership(videoID primitive.ObjectID, video *models.Video, courses []*models.Course) videoMembership {
+	membership := videoMembership{
+		VideoID:         videoID,
+		Courses:         courses,
+		MultipleCourses: len(courses) > 1,
+	}
+	if video == nil {
+		return membership
+	}
+
+	membership.CourseID = &video.CourseID
+	for _, course := range courses {
+		if course.ID == video.CourseID {
+			membership.InOwnCourse = true
+			break
+		}
+	}
+	return membership
+}
+
+// HandleListVideoCourses lists every course whose video order contains a video (admin only)
+func HandleListVideoCourses(repo *repository.VideoRepository, courseRepo *repository.CourseRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := parseObjectID(c, "id")
+		if err != nil {
+			return err
+		}
+
+		video, err := repo.GetByID(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("video_id", objectID).Error("Failed to get video")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get video")
+		}
+
+		courses, err := courseRepo.ListByVideo(c.Context(), objectID)
+		if err != nil {
+			log(c).WithError(err).WithField("video_id", objectID).Error("Failed to list courses for video")
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to list courses for video")
+		}
+
+		// A deleted video can still linger in a course's video order
+		if video == nil && len(courses) == 0 {
+			return errVideoNotFound
+		}
+
+		return c.JSON(buildVideoMembership(objectID, video, courses))
+	}
+}
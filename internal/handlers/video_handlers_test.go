@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+	"cource-api/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestNewVideoMarksThumbnailPending(t *testing.T) {
+	courseID := primitive.NewObjectID()
+
+	video := newVideo(&videoRequest{VideoURL: "videos/intro.mp4"}, courseID, true)
+	if !video.ThumbnailPending || video.Thumbnail != "" {
+		t.Fatalf("expected a pending thumbnail when one will be generated, got %+v", video)
+	}
+
+	video = newVideo(&videoRequest{VideoURL: "videos/intro.mp4", ThumbnailURL: "thumbnails/custom.png"}, courseID, true)
+	if video.ThumbnailPending || video.Thumbnail != "thumbnails/custom.png" {
+		t.Fatalf("expected the client thumbnail to be kept, got %+v", video)
+	}
+
+	video = newVideo(&videoRequest{VideoURL: "videos/intro.mp4"}, courseID, false)
+	if video.ThumbnailPending {
+		t.Fatal("expected no pending thumbnail without generation")
+	}
+}
+
+func TestListVideosRequiresCourseID(t *testing.T) {
+	app := fiber.New()
+	app.Get("/videos", HandleListVideos(nil))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/videos", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("expected status 400 without course_id, got %d", resp.StatusCode)
+	}
+}
+
+func TestListVideosPropagatesRepositoryError(t *testing.T) {
+	// A client pointed at a closed port fails every query once server selection times out
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	original := database.Videos
+	database.Videos = client.Database("test").Collection("videos")
+	defer func() { database.Videos = original }()
+
+	app := fiber.New()
+	app.Get("/videos", HandleListVideos(repository.NewVideoRepository()))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/videos?course_id="+primitive.NewObjectID().Hex(), nil), 5000)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("expected status 500 when the repository fails, got %d", resp.StatusCode)
+	}
+}
+
+func TestBuildVideoMembership(t *testing.T) {
+	own := &models.Course{ID: primitive.NewObjectID()}
+	other := &models.Course{ID: primitive.NewObjectID()}
+	video := &models.Video{ID: primitive.NewObjectID(), CourseID: own.ID}
+
+	cases := []struct {
+		name         string
+		courses      []*models.Course
+		wantInOwn    bool
+		wantMultiple bool
+	}{
+		{"none", []*models.Course{}, false, false},
+		{"one", []*models.Course{own}, true, false},
+		{"other only", []*models.Course{other}, false, false},
+		{"multiple", []*models.Course{own, other}, true, true},
+	}
+
+	for _, tc := range cases {
+		got := buildVideoMembership(video.ID, video, tc.courses)
+		if got.InOwnCourse != tc.wantInOwn || got.MultipleCourses != tc.wantMultiple {
+			t.Errorf("%s: expected in_own_course=%v multiple_courses=%v, got %+v", tc.name, tc.wantInOwn, tc.wantMultiple, got)
+		}
+		if got.CourseID == nil || *got.CourseID != own.ID || len(got.Courses) != len(tc.courses) {
+			t.Errorf("%s: unexpected membership %+v", tc.name, got)
+		}
+	}
+
+	orphan := buildVideoMembership(video.ID, nil, []*models.Course{own})
+	if orphan.InOwnCourse || orphan.CourseID != nil {
+		t.Errorf("expected no own course for a deleted video, got %+v", orphan)
+	}
+}
+
+func TestCourseNavigation(t *testing.T) {
+	first, middle, last := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	order := []primitive.ObjectID{first, middle, last}
+
+	nav, ok := courseNavigation(order, middle)
+	if !ok || nav.Index != 1 || nav.Total != 3 || *nav.PreviousVideoID != first || *nav.NextVideoID != last {
+		t.Fatalf("unexpected navigation %+v", nav)
+	}
+
+	nav, ok = courseNavigation(order, first)
+	if !ok || nav.PreviousVideoID != nil || *nav.NextVideoID != middle {
+		t.Fatalf("expected no previous video at the start, got %+v", nav)
+	}
+
+	nav, ok = courseNavigation(order, last)
+	if !ok || nav.Index != 2 || nav.NextVideoID != nil {
+		t.Fatalf("expected no next video at the end, got %+v", nav)
+	}
+
+	if _, ok := courseNavigation(order, primitive.NewObjectID()); ok {
+		t.Fatal("expected a video outside the course to be reported")
+	}
+}
+
+func TestVideoResponseJSON(t *testing.T) {
+	next := primitive.NewObjectID()
+	video := &models.Video{ID: primitive.NewObjectID(), Title: "Intro", IsPaid: true, PreviewSeconds: 90}
+	encoded, err := json.Marshal(videoResponse{
+		Video:           video,
+		videoNavigation: &videoNavigation{NextVideoID: &next, Index: 0, Total: 2},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(encoded, &body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body["title"] != "Intro" || body["next_video_id"] != next.Hex() || body["previous_video_id"] != nil || body["total"] != float64(2) {
+		t.Fatalf("expected the video fields alongside the navigation, got %s", encoded)
+	}
+	if body["is_entitled"] != false || body["preview_seconds"] != float64(90) {
+		t.Fatalf("expected the preview and entitlement, got %s", encoded)
+	}
+
+	// Outside a course there is no navigation
+	encoded, err = json.Marshal(videoResponse{Video: video, IsEntitled: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body = nil
+	if err := json.Unmarshal(encoded, &body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := body["total"]; ok || body["is_entitled"] != true {
+		t.Fatalf("expected no navigation outside a course, got %s", encoded)
+	}
+}
+
+func TestCheckWatchProgress(t *testing.T) {
+	preview := &models.Video{IsPaid: true, PreviewSeconds: 60}
+	noPreview := &models.Video{IsPaid: true}
+
+	tests := []struct {
+		name     string
+		video    *models.Video
+		entitled bool
+		progress int
+		want     error
+	}{
+		{"entitled past the preview", preview, true, 600, nil},
+		{"within the preview", preview, false, 60, nil},
+		{"past the preview", preview, false, 61, errPreviewLimitExceeded},
+		{"no preview", noPreview, false, 0, errSubscriptionRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkWatchProgress(tt.video, tt.entitled, tt.progress); err != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidatePreviewSeconds(t *testing.T) {
+	if err := validatePreviewSeconds(30, 0); err != nil {
+		t.Fatalf("expected a preview of a video with unknown duration to be valid, got %v", err)
+	}
+	if err := validatePreviewSeconds(-1, 120); err == nil {
+		t.Fatal("expected a negative preview to be rejected")
+	}
+	if err := validatePreviewSeconds(121, 120); err == nil {
+		t.Fatal("expected a preview longer than the video to be rejected")
+	}
+}
+
+func TestSignVideoMedia(t *testing.T) {
+	sign := func(key string) (string, error) { return "https://signed/" + key, nil }
+
+	single := &models.Video{URL: "videos/intro.mp4"}
+	if err := signVideoMedia(single, sign); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if single.URL != "https://signed/videos/intro.mp4" || single.Renditions != nil {
+		t.Fatalf("expected only the original URL to be signed, got %+v", single)
+	}
+
+	adaptive := &models.Video{
+		URL:            "videos/intro.mp4",
+		MasterPlaylist: "videos/intro/master.m3u8",
+		Renditions: map[string]string{
+			"720p":  "videos/intro/720p.m3u8",
+			"1080p": "videos/intro/1080p.m3u8",
+		},
+	}
+	if err := signVideoMedia(adaptive, sign); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if adaptive.MasterPlaylist != "https://signed/videos/intro/master.m3u8" {
+		t.Fatalf("expected master playlist to be signed, got %q", adaptive.MasterPlaylist)
+	}
+	for quality, want := range map[string]string{
+		"720p":  "https://signed/videos/intro/720p.m3u8",
+		"1080p": "https://signed/videos/intro/1080p.m3u8",
+	} {
+		if adaptive.Renditions[quality] != want {
+			t.Errorf("expected %s rendition %q, got %q", quality, want, adaptive.Renditions[quality])
+		}
+	}
+}
+
+func TestCheckVideoMediaRequiresOriginalKey(t *testing.T) {
+	if err := checkVideoMedia("", map[string]string{"720p": "videos/720p.m3u8"}); err == nil {
+		t.Fatal("expected renditions without an original key to be rejected")
+	}
+	if err := checkVideoMedia("videos/intro.mp4", map[string]string{"720p": ""}); err == nil {
+		t.Fatal("expected a rendition without a key to be rejected")
+	}
+	if err := checkVideoMedia("videos/intro.mp4", nil); err != nil {
+		t.Fatalf("expected a video without renditions to be valid, got %v", err)
+	}
+}
+
+func TestSignThumbnail(t *testing.T) {
+	sign := func(key string) (string, error) { return "https://signed/" + key, nil }
+
+	private := &models.Video{Thumbnail: "thumbnails/intro.jpg"}
+	if err := signThumbnail(private, false, sign); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if private.Thumbnail != "https://signed/thumbnails/intro.jpg" {
+		t.Fatalf("expected private thumbnail to be signed, got %q", private.Thumbnail)
+	}
+
+	public := &models.Video{Thumbnail: "thumbnails/intro.jpg"}
+	if err := signThumbnail(public, true, sign); err != nil || public.Thumbnail != "thumbnails/intro.jpg" {
+		t.Fatalf("expected public thumbnail to be left as is, got %q, %v", public.Thumbnail, err)
+	}
+
+	absolute := &models.Video{Thumbnail: "https://cdn.example.com/intro.jpg"}
+	if err := signThumbnail(absolute, false, sign); err != nil || absolute.Thumbnail != "https://cdn.example.com/intro.jpg" {
+		t.Fatalf("expected full URL to be left as is, got %q, %v", absolute.Thumbnail, err)
+	}
+}
+
+func TestValidateBulkVideosNamesFailingIndex(t *testing.T) {
+	valid := videoRequest{Title: "Intro", VideoURL: "videos/intro.mp4", ThumbnailURL: "thumbs/intro.jpg"}
+	if err := validateBulkVideos([]videoRequest{valid, valid}, false); err != nil {
+		t.Fatalf("expected valid videos, got %v", err)
+	}
+
+	missingTitle := valid
+	missingTitle.Title = ""
+	err := validateBulkVideos([]videoRequest{valid, missingTitle}, false)
+	fiberErr, ok := err.(*fiber.Error)
+	if !ok || fiberErr.Code != fiber.StatusBadRequest || fiberErr.Message != "videos[1]: Title is required" {
+		t.Fatalf("expected index 1 to be named, got %v", err)
+	}
+
+	if err := validateBulkVideos(nil, false); err == nil {
+		t.Fatal("expected an empty batch to be rejected")
+	}
+	if err := validateBulkVideos(make([]videoRequest, maxBulkVideos+1), false); err == nil {
+		t.Fatal("expected an oversized batch to be rejected")
+	}
+}
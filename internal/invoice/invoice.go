@@ -0,0 +1,98 @@
+// Package invoice renders downloadable receipts for completed payments
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"cource-api/internal/models"
+)
+
+// ErrNotCompleted is returned when a receipt is requested for a payment that has not completed
+var ErrNotCompleted = errors.New("payment is not completed")
+
+// Customer is who a receipt is made out to
+type Customer struct {
+	Name  string
+	Email string
+}
+
+// Receipt holds everything printed on a payment receipt
+type Receipt struct {
+	Number         string
+	TransactionID  string
+	Date           time.Time
+	Customer       Customer
+	Description    string
+	Amount         string
+	RefundedAmount string
+	CouponCode     string
+}
+
+// New builds the receipt of a completed payment. description says what was bought,
+// such as the plan or the course title.
+func New(payment *models.Payment, customer Customer, description string) (*Receipt, error) {
+	if payment.Status != "completed" {
+		return nil, ErrNotCompleted
+	}
+
+	receipt := &Receipt{
+		Number:        payment.ID.Hex(),
+		TransactionID: payment.TransactionID,
+		Date:          payment.Timestamp.UTC(),
+		Customer:      customer,
+		Description:   description,
+		Amount:        formatAmount(payment.Amount, payment.Currency),
+		CouponCode:    payment.CouponCode,
+	}
+	if payment.RefundedAmount > 0 {
+		receipt.RefundedAmount = formatAmount(payment.RefundedAmount, payment.Currency)
+	}
+	return receipt, nil
+}
+
+// formatAmount prints an amount stored in the smallest currency unit
+func formatAmount(amount int, currency string) string {
+	return fmt.Sprintf("%d.%02d %s", amount/100, amount%100, strings.ToUpper(currency))
+}
+
+var receiptTemplate = template.Must(template.New("receipt").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Receipt {{.Number}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; color: #222; }
+table { width: 100%; border-collapse: collapse; margin-top: 1.5em; }
+th, td { text-align: left; padding: 0.5em; border-bottom: 1px solid #ddd; }
+td.amount { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Receipt</h1>
+<p>Receipt number: {{.Number}}<br>
+Transaction ID: {{.TransactionID}}<br>
+Date: {{.Date.Format "2006-01-02 15:04 MST"}}</p>
+<p>Billed to:<br>
+{{.Customer.Name}}<br>
+{{.Customer.Email}}</p>
+<table>
+<tr><th>Description</th><th>Amount</th></tr>
+<tr><td>{{.Description}}{{if .CouponCode}} (coupon {{.CouponCode}}){{end}}</td><td class="amount">{{.Amount}}</td></tr>
+{{- if .RefundedAmount}}
+<tr><td>Refunded</td><td class="amount">-{{.RefundedAmount}}</td></tr>
+{{- end}}
+</table>
+<p>Thank you for your purchase.</p>
+</body>
+</html>
+`))
+
+// WriteHTML renders the receipt as a standalone HTML document
+func (r *Receipt) WriteHTML(w io.Writer) error {
+	return receiptTemplate.Execute(w, r)
+}
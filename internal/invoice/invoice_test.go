@@ -0,0 +1,49 @@
+package invoice
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReceiptHTMLIncludesPaymentDetails(t *testing.T) {
+	payment := &models.Payment{
+		ID:            primitive.NewObjectID(),
+		TransactionID: "cs_test_123",
+		Amount:        4999,
+		Currency:      "usd",
+		Status:        "completed",
+		Timestamp:     time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC),
+	}
+
+	receipt, err := New(payment, Customer{Name: "Jane <Doe>", Email: "jane@example.com"}, "Monthly subscription")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var b strings.Builder
+	if err := receipt.WriteHTML(&b); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	html := b.String()
+	for _, want := range []string{payment.ID.Hex(), "cs_test_123", "49.99 USD", "2025-03-14", "Monthly subscription", "jane@example.com", "Jane &lt;Doe&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected receipt to contain %q", want)
+		}
+	}
+	if strings.Contains(html, "Refunded") {
+		t.Error("expected no refund line for a payment without refunds")
+	}
+}
+
+func TestReceiptRequiresCompletedPayment(t *testing.T) {
+	payment := &models.Payment{ID: primitive.NewObjectID(), Status: "refunded"}
+	if _, err := New(payment, Customer{}, "Course"); !errors.Is(err, ErrNotCompleted) {
+		t.Fatalf("expected ErrNotCompleted, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cource-api/internal/events"
+	"cource-api/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// announceBatchSize is how many subscribers are loaded and notified per insert
+	announceBatchSize = 500
+	// announceQueueSize is how many published courses can wait to be announced
+	announceQueueSize = 100
+)
+
+// Subscribers pages through the users with an active subscription who did not mute a
+// notification type, in ID order after afterID
+type Subscribers interface {
+	ListNotifiableSubscriberIDs(ctx context.Context, notificationType string, afterID primitive.ObjectID, limit int64) ([]primitive.ObjectID, error)
+}
+
+// NotificationWriter inserts notifications in bulk
+type NotificationWriter interface {
+	CreateMany(ctx context.Context, notifications []*models.Notification) error
+}
+
+// Publisher pushes an event to the connected sessions of a user
+type Publisher interface {
+	Publish(userID primitive.ObjectID, event events.Event)
+}
+
+// CourseAnnouncer notifies active subscribers that a course was published. Courses are
+// queued by the request that publishes them and announced in the background, so the
+// request does not wait on the fan-out.
+type CourseAnnouncer struct {
+	subscribers   Subscribers
+	notifications NotificationWriter
+	publisher     Publisher
+	batchSize     int64
+	queue         chan *models.Course
+}
+
+// NewCourseAnnouncer creates an announcer that also pushes the notifications it creates
+// through publisher. Run must be started for queued courses to be announced.
+func NewCourseAnnouncer(subscribers Subscribers, notifications NotificationWriter, publisher Publisher) *CourseAnnouncer {
+	return &CourseAnnouncer{
+		subscribers:   subscribers,
+		notifications: notifications,
+		publisher:     publisher,
+		batchSize:     announceBatchSize,
+		queue:         make(chan *models.Course, announceQueueSize),
+	}
+}
+
+// Enqueue queues a published course to be announced without blocking. It reports false
+// when the queue is full, or the announcer is nil, and the course will not be announced.
+func (a *CourseAnnouncer) Enqueue(course *models.Course) bool {
+	if a == nil {
+		return false
+	}
+	select {
+	case a.queue <- course:
+		return true
+	default:
+		logrus.WithField("course_id", course.ID).Warn("Course announcement queue is full, dropping announcement")
+		return false
+	}
+}
+
+// Announce notifies every active subscriber of a published course, inserting the
+// notifications one batch of subscribers at a time. It returns how many were notified.
+func (a *CourseAnnouncer) Announce(ctx context.Context, course *models.Course) (int, error) {
+	title := "New course published"
+	body := fmt.Sprintf("%s is now available.", course.Title)
+
+	notified := 0
+	afterID := primitive.NilObjectID
+	for {
+		userIDs, err := a.subscribers.ListNotifiableSubscriberIDs(ctx, models.NotificationCoursePublished, afterID, a.batchSize)
+		if err != nil {
+			return notified, err
+		}
+		if len(userIDs) == 0 {
+			return notified, nil
+		}
+
+		now := time.Now().UTC()
+		batch := make([]*models.Notification, 0, len(userIDs))
+		for _, userID := range userIDs {
+			batch = append(batch, &models.Notification{
+				UserID:    userID,
+				Type:      models.NotificationCoursePublished,
+				Title:     title,
+				Body:      body,
+				CreatedAt: now,
+			})
+		}
+		if err := a.notifications.CreateMany(ctx, batch); err != nil {
+			return notified, err
+		}
+		notified += len(batch)
+
+		for _, notification := range batch {
+			a.publisher.Publish(notification.UserID, events.Event{Type: events.TypeNotification, Data: notification})
+		}
+
+		if int64(len(userIDs)) < a.batchSize {
+			return notified, nil
+		}
+		afterID = userIDs[len(userIDs)-1]
+	}
+}
+
+// Run announces queued courses one at a time until ctx is done
+func (a *CourseAnnouncer) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case course := <-a.queue:
+			notified, err := a.Announce(ctx, course)
+			if err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"course_id": course.ID,
+					"notified":  notified,
+				}).Error("Failed to announce published course")
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"course_id": course.ID,
+				"notified":  notified,
+			}).Info("Announced published course")
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cource-api/internal/events"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeSubscribers struct {
+	ids   []primitive.ObjectID
+	calls int
+}
+
+func (f *fakeSubscribers) ListNotifiableSubscriberIDs(ctx context.Context, notificationType string, afterID primitive.ObjectID, limit int64) ([]primitive.ObjectID, error) {
+	f.calls++
+	var page []primitive.ObjectID
+	for _, id := range f.ids {
+		if id.Hex() > afterID.Hex() && int64(len(page)) < limit {
+			page = append(page, id)
+		}
+	}
+	return page, nil
+}
+
+type fakeNotificationWriter struct {
+	batches [][]*models.Notification
+	err     error
+}
+
+func (f *fakeNotificationWriter) CreateMany(ctx context.Context, notifications []*models.Notification) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.batches = append(f.batches, notifications)
+	return nil
+}
+
+type fakePublisher struct {
+	published []primitive.ObjectID
+}
+
+func (f *fakePublisher) Publish(userID primitive.ObjectID, event events.Event) {
+	f.published = append(f.published, userID)
+}
+
+func TestCourseAnnouncerAnnounceInBatches(t *testing.T) {
+	subscribers := &fakeSubscribers{}
+	for i := 0; i < 5; i++ {
+		subscribers.ids = append(subscribers.ids, primitive.NewObjectID())
+	}
+	writer := &fakeNotificationWriter{}
+	publisher := &fakePublisher{}
+	announcer := NewCourseAnnouncer(subscribers, writer, publisher)
+	announcer.batchSize = 2
+
+	notified, err := announcer.Announce(context.Background(), &models.Course{ID: primitive.NewObjectID(), Title: "Go Basics"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if notified != 5 || len(writer.batches) != 3 || subscribers.calls != 3 {
+		t.Fatalf("expected 5 notified in 3 batches, got %d in %d batches", notified, len(writer.batches))
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	for _, batch := range writer.batches {
+		for _, n := range batch {
+			if n.Type != models.NotificationCoursePublished || n.Body != "Go Basics is now available." || n.CreatedAt.IsZero() {
+				t.Fatalf("unexpected notification %+v", n)
+			}
+			seen[n.UserID] = true
+		}
+	}
+	if len(seen) != 5 || len(publisher.published) != 5 {
+		t.Fatalf("expected every subscriber notified and pushed once, got %d notified and %d pushed", len(seen), len(publisher.published))
+	}
+}
+
+func TestCourseAnnouncerAnnounceStopsOnError(t *testing.T) {
+	subscribers := &fakeSubscribers{ids: []primitive.ObjectID{primitive.NewObjectID()}}
+	announcer := NewCourseAnnouncer(subscribers, &fakeNotificationWriter{err: errors.New("insert failed")}, &fakePublisher{})
+
+	if _, err := announcer.Announce(context.Background(), &models.Course{Title: "Go Basics"}); err == nil {
+		t.Fatal("expected the insert error to be returned")
+	}
+}
+
+func TestCourseAnnouncerEnqueue(t *testing.T) {
+	var nilAnnouncer *CourseAnnouncer
+	if nilAnnouncer.Enqueue(&models.Course{}) {
+		t.Fatal("expected a nil announcer to drop the course")
+	}
+
+	announcer := NewCourseAnnouncer(&fakeSubscribers{}, &fakeNotificationWriter{}, &fakePublisher{})
+	for i := 0; i < announceQueueSize; i++ {
+		if !announcer.Enqueue(&models.Course{}) {
+			t.Fatalf("expected course %d to be queued", i)
+		}
+	}
+	if announcer.Enqueue(&models.Course{}) {
+		t.Fatal("expected a full queue to drop the course without blocking")
+	}
+}
@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cource-api/internal/aws"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExpiredOTPs deletes one-time passwords past their expiry
+type ExpiredOTPs interface {
+	DeleteExpiredOTPs(ctx context.Context) (int64, error)
+}
+
+// OrphanedWatchHistory deletes watch history left behind by deleted videos
+type OrphanedWatchHistory interface {
+	DeleteOrphanedWatchHistory(ctx context.Context) (int64, error)
+}
+
+// MultipartUploads lists and aborts multipart uploads that were never completed
+type MultipartUploads interface {
+	ListMultipartUploadsBefore(ctx context.Context, cutoff time.Time) ([]aws.MultipartUpload, error)
+	AbortMultipartUpload(fileKey, uploadID string) error
+}
+
+// MaintenanceResult counts what a maintenance run cleaned
+type MaintenanceResult struct {
+	ExpiredOTPs      int64
+	WatchHistory     int64
+	AbortedMultipart int
+}
+
+// Maintainer removes data nothing else cleans up: expired OTPs, the watch history of
+// deleted videos and abandoned multipart uploads
+type Maintainer struct {
+	otps         ExpiredOTPs
+	watchHistory OrphanedWatchHistory
+	uploads      MultipartUploads
+	// multipartMaxAge is how long a multipart upload may stay open, zero keeps them all
+	multipartMaxAge time.Duration
+}
+
+// NewMaintainer creates a maintainer aborting multipart uploads open longer than multipartMaxAge
+func NewMaintainer(otps ExpiredOTPs, watchHistory OrphanedWatchHistory, uploads MultipartUploads, multipartMaxAge time.Duration) *Maintainer {
+	return &Maintainer{
+		otps:            otps,
+		watchHistory:    watchHistory,
+		uploads:         uploads,
+		multipartMaxAge: multipartMaxAge,
+	}
+}
+
+// Clean runs every cleanup step. A failing step does not stop the others, their errors
+// are joined and returned with the counts of the steps that succeeded.
+func (m *Maintainer) Clean(ctx context.Context, now time.Time) (MaintenanceResult, error) {
+	var result MaintenanceResult
+	var errs []error
+
+	var err error
+	if result.ExpiredOTPs, err = m.otps.DeleteExpiredOTPs(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("expired OTPs: %w", err))
+	}
+	if result.WatchHistory, err = m.watchHistory.DeleteOrphanedWatchHistory(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("orphaned watch history: %w", err))
+	}
+	if m.multipartMaxAge > 0 {
+		if result.AbortedMultipart, err = m.abortStaleMultipart(ctx, now); err != nil {
+			errs = append(errs, fmt.Errorf("multipart uploads: %w", err))
+		}
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// abortStaleMultipart aborts multipart uploads started before now minus the maximum age.
+// A failure on one upload is logged and the rest are still aborted.
+func (m *Maintainer) abortStaleMultipart(ctx context.Context, now time.Time) (int, error) {
+	stale, err := m.uploads.ListMultipartUploadsBefore(ctx, now.UTC().Add(-m.multipartMaxAge))
+	if err != nil {
+		return 0, err
+	}
+
+	aborted := 0
+	for _, upload := range stale {
+		if err := m.uploads.AbortMultipartUpload(upload.Key, upload.UploadID); err != nil {
+			logrus.WithError(err).WithField("file_key", upload.Key).Error("Failed to abort stale multipart upload")
+			continue
+		}
+		aborted++
+	}
+	return aborted, nil
+}
+
+// Run cleans once immediately and then every interval until ctx is done. A run that
+// takes longer than the interval delays the next one rather than overlapping it.
+func (m *Maintainer) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, func(ctx context.Context) {
+		result, err := m.Clean(ctx, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("Maintenance cleanup failed")
+		}
+		logrus.WithFields(logrus.Fields{
+			"expired_otps":      result.ExpiredOTPs,
+			"watch_history":     result.WatchHistory,
+			"aborted_multipart": result.AbortedMultipart,
+		}).Info("Maintenance cleanup finished")
+	})
+}
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cource-api/internal/aws"
+)
+
+type fakeOTPs struct {
+	deleted int64
+	err     error
+}
+
+func (f *fakeOTPs) DeleteExpiredOTPs(ctx context.Context) (int64, error) {
+	return f.deleted, f.err
+}
+
+type fakeWatchHistory struct {
+	deleted int64
+}
+
+func (f *fakeWatchHistory) DeleteOrphanedWatchHistory(ctx context.Context) (int64, error) {
+	return f.deleted, nil
+}
+
+type fakeMultipart struct {
+	uploads []aws.MultipartUpload
+	failKey string
+	aborted []string
+}
+
+func (f *fakeMultipart) ListMultipartUploadsBefore(ctx context.Context, cutoff time.Time) ([]aws.MultipartUpload, error) {
+	var stale []aws.MultipartUpload
+	for _, upload := range f.uploads {
+		if upload.Initiated.Before(cutoff) {
+			stale = append(stale, upload)
+		}
+	}
+	return stale, nil
+}
+
+func (f *fakeMultipart) AbortMultipartUpload(fileKey, uploadID string) error {
+	if fileKey == f.failKey {
+		return errors.New("abort failed")
+	}
+	f.aborted = append(f.aborted, uploadID)
+	return nil
+}
+
+func TestMaintainerCleanAbortsOnlyStaleMultipart(t *testing.T) {
+	now := time.Now().UTC()
+	uploads := &fakeMultipart{
+		uploads: []aws.MultipartUpload{
+			{Key: "video/a.mp4", UploadID: "old", Initiated: now.Add(-48 * time.Hour)},
+			{Key: "video/b.mp4", UploadID: "broken", Initiated: now.Add(-48 * time.Hour)},
+			{Key: "video/c.mp4", UploadID: "recent", Initiated: now.Add(-time.Hour)},
+		},
+		failKey: "video/b.mp4",
+	}
+	m := NewMaintainer(&fakeOTPs{deleted: 3}, &fakeWatchHistory{deleted: 2}, uploads, 24*time.Hour)
+
+	result, err := m.Clean(context.Background(), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExpiredOTPs != 3 || result.WatchHistory != 2 || result.AbortedMultipart != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(uploads.aborted) != 1 || uploads.aborted[0] != "old" {
+		t.Fatalf("expected only the old upload to be aborted, got %v", uploads.aborted)
+	}
+}
+
+func TestMaintainerCleanContinuesAfterFailedStep(t *testing.T) {
+	m := NewMaintainer(&fakeOTPs{err: errors.New("db down")}, &fakeWatchHistory{deleted: 4}, &fakeMultipart{}, 0)
+
+	result, err := m.Clean(context.Background(), time.Now())
+	if err == nil {
+		t.Fatal("expected the failed step to be reported")
+	}
+	if result.WatchHistory != 4 {
+		t.Fatalf("expected later steps to still run, got %+v", result)
+	}
+}
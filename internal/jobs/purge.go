@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cource-api/internal/repository"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SoftDeletedUsers lists and permanently erases soft deleted users
+type SoftDeletedUsers interface {
+	ListDeletedBefore(ctx context.Context, cutoff time.Time) ([]primitive.ObjectID, error)
+	HardDelete(ctx context.Context, id primitive.ObjectID) (bool, error)
+}
+
+// SoftDeletedCourses lists and permanently deletes soft deleted courses
+type SoftDeletedCourses interface {
+	ListDeletedBefore(ctx context.Context, cutoff time.Time) ([]primitive.ObjectID, error)
+	HardDelete(ctx context.Context, id primitive.ObjectID) (*repository.DeletedCourseMedia, error)
+}
+
+// MediaStore removes the files of purged courses
+type MediaStore interface {
+	DeleteFile(fileKey string) error
+	DeleteThumbnail(fileKey string) error
+}
+
+// PurgeResult counts what a purge run removed
+type PurgeResult struct {
+	Users   int
+	Courses int
+	Videos  int64
+}
+
+// Purger hard deletes users and courses that have been soft deleted for longer than
+// the retention window. Running it again is safe: records already purged are skipped.
+type Purger struct {
+	users     SoftDeletedUsers
+	courses   SoftDeletedCourses
+	media     MediaStore
+	retention time.Duration
+}
+
+// NewPurger creates a purger removing records soft deleted longer than retention ago
+func NewPurger(users SoftDeletedUsers, courses SoftDeletedCourses, media MediaStore, retention time.Duration) *Purger {
+	return &Purger{
+		users:     users,
+		courses:   courses,
+		media:     media,
+		retention: retention,
+	}
+}
+
+// Purge removes every record soft deleted before now minus the retention window.
+// A failure on one record is logged and the rest are still purged.
+func (p *Purger) Purge(ctx context.Context, now time.Time) (PurgeResult, error) {
+	var result PurgeResult
+	cutoff := now.UTC().Add(-p.retention)
+
+	userIDs, err := p.users.ListDeletedBefore(ctx, cutoff)
+	if err != nil {
+		return result, err
+	}
+	for _, id := range userIDs {
+		erased, err := p.users.HardDelete(ctx, id)
+		if err != nil {
+			logrus.WithError(err).WithField("user_id", id).Error("Failed to purge user")
+			continue
+		}
+		if erased {
+			result.Users++
+		}
+	}
+
+	courseIDs, err := p.courses.ListDeletedBefore(ctx, cutoff)
+	if err != nil {
+		return result, err
+	}
+	for _, id := range courseIDs {
+		media, err := p.courses.HardDelete(ctx, id)
+		if err != nil {
+			// Another run may have purged it already
+			if !errors.Is(err, repository.ErrCourseNotFound) {
+				logrus.WithError(err).WithField("course_id", id).Error("Failed to purge course")
+			}
+			continue
+		}
+		result.Courses++
+		result.Videos += media.VideosRemoved
+
+		// Deleting a missing S3 object succeeds, so a retried cleanup is harmless
+		for _, key := range media.VideoKeys {
+			if err := p.media.DeleteFile(key); err != nil {
+				logrus.WithError(err).WithField("course_id", id).Error("Failed to delete purged video file from S3")
+			}
+		}
+		for _, key := range media.ThumbnailKeys {
+			if err := p.media.DeleteThumbnail(key); err != nil {
+				logrus.WithError(err).WithField("course_id", id).Error("Failed to delete purged thumbnail from S3")
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Run purges once immediately and then every interval until ctx is done
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, func(ctx context.Context) {
+		result, err := p.Purge(ctx, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("Soft delete purge failed")
+		} else if result.Users > 0 || result.Courses > 0 {
+			logrus.WithFields(logrus.Fields{
+				"users":   result.Users,
+				"courses": result.Courses,
+				"videos":  result.Videos,
+			}).Info("Purged soft deleted records past retention")
+		}
+	})
+}
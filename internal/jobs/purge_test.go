@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cource-api/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// softDeleted is an in-memory store of soft deletion times
+type softDeleted map[primitive.ObjectID]time.Time
+
+func (s softDeleted) ListDeletedBefore(ctx context.Context, cutoff time.Time) ([]primitive.ObjectID, error) {
+	var ids []primitive.ObjectID
+	for id, deletedAt := range s {
+		if !deletedAt.After(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+type fakeUsers struct{ softDeleted }
+
+func (u fakeUsers) HardDelete(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	if _, ok := u.softDeleted[id]; !ok {
+		return false, nil
+	}
+	delete(u.softDeleted, id)
+	return true, nil
+}
+
+type fakeCourses struct{ softDeleted }
+
+func (c fakeCourses) HardDelete(ctx context.Context, id primitive.ObjectID) (*repository.DeletedCourseMedia, error) {
+	if _, ok := c.softDeleted[id]; !ok {
+		return nil, repository.ErrCourseNotFound
+	}
+	delete(c.softDeleted, id)
+	return &repository.DeletedCourseMedia{
+		VideosRemoved: 1,
+		VideoKeys:     []string{"videos/" + id.Hex() + ".mp4"},
+		ThumbnailKeys: []string{"thumbnails/" + id.Hex() + ".jpg"},
+	}, nil
+}
+
+type fakeMedia struct{ deleted []string }
+
+func (m *fakeMedia) DeleteFile(key string) error      { m.deleted = append(m.deleted, key); return nil }
+func (m *fakeMedia) DeleteThumbnail(key string) error { m.deleted = append(m.deleted, key); return nil }
+
+func TestPurgeRemovesOnlyRecordsPastRetention(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	retention := 30 * 24 * time.Hour
+
+	oldUser, newUser := primitive.NewObjectID(), primitive.NewObjectID()
+	oldCourse, newCourse := primitive.NewObjectID(), primitive.NewObjectID()
+	users := fakeUsers{softDeleted{oldUser: now.Add(-31 * 24 * time.Hour), newUser: now.Add(-time.Hour)}}
+	courses := fakeCourses{softDeleted{oldCourse: now.Add(-retention), newCourse: now.Add(-29 * 24 * time.Hour)}}
+	media := &fakeMedia{}
+
+	purger := NewPurger(users, courses, media, retention)
+	result, err := purger.Purge(context.Background(), now)
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+
+	if result.Users != 1 || result.Courses != 1 || result.Videos != 1 {
+		t.Fatalf("expected one user, one course and one video purged, got %+v", result)
+	}
+	if _, ok := users.softDeleted[oldUser]; ok {
+		t.Error("expected the user past retention to be purged")
+	}
+	if _, ok := users.softDeleted[newUser]; !ok {
+		t.Error("expected the recently deleted user to remain")
+	}
+	if _, ok := courses.softDeleted[oldCourse]; ok {
+		t.Error("expected the course past retention to be purged")
+	}
+	if _, ok := courses.softDeleted[newCourse]; !ok {
+		t.Error("expected the recently deleted course to remain")
+	}
+	if len(media.deleted) != 2 {
+		t.Fatalf("expected the purged course's video and thumbnail removed from S3, got %v", media.deleted)
+	}
+
+	// A second run finds nothing left to purge
+	result, err = purger.Purge(context.Background(), now)
+	if err != nil {
+		t.Fatalf("second purge failed: %v", err)
+	}
+	if result != (PurgeResult{}) {
+		t.Fatalf("expected nothing purged on the second run, got %+v", result)
+	}
+}
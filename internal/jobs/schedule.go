@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"context"
+	"time"
+)
+
+// defaultInterval is used when a job is run with an interval that is not positive
+const defaultInterval = time.Hour
+
+// runPeriodically calls run once immediately and then every interval until ctx is done
+func runPeriodically(ctx context.Context, interval time.Duration, run func(ctx context.Context)) {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
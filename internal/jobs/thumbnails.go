@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/media"
+	"cource-api/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// thumbnailQueueSize is how many videos can wait for a thumbnail, a bulk creation
+	// queues up to a hundred at once
+	thumbnailQueueSize = 500
+	// thumbnailGenerationTimeout bounds a single thumbnail generation
+	thumbnailGenerationTimeout = 60 * time.Second
+)
+
+// GeneratedThumbnails lists the videos whose thumbnail is pending and stores the outcome
+// of a thumbnail generation on one. An empty key clears the pending flag without a thumbnail.
+type GeneratedThumbnails interface {
+	ListPendingThumbnails(ctx context.Context) ([]*models.Video, error)
+	SetGeneratedThumbnail(ctx context.Context, videoID primitive.ObjectID, thumbnailKey string) error
+}
+
+// thumbnailJob is a video waiting for its thumbnail
+type thumbnailJob struct {
+	videoID  primitive.ObjectID
+	videoKey string
+}
+
+// ThumbnailWorker generates the thumbnails of videos created without one. Videos are
+// queued by the request that creates them with their thumbnail pending, so the request
+// does not wait on ffmpeg.
+type ThumbnailWorker struct {
+	generator media.ThumbnailGenerator
+	videos    GeneratedThumbnails
+	timeout   time.Duration
+	queue     chan thumbnailJob
+}
+
+// NewThumbnailWorker creates a worker storing the thumbnails generator creates. Run must
+// be started for queued videos to get a thumbnail.
+func NewThumbnailWorker(generator media.ThumbnailGenerator, videos GeneratedThumbnails) *ThumbnailWorker {
+	return &ThumbnailWorker{
+		generator: generator,
+		videos:    videos,
+		timeout:   thumbnailGenerationTimeout,
+		queue:     make(chan thumbnailJob, thumbnailQueueSize),
+	}
+}
+
+// Enqueue queues a created video with a pending thumbnail without blocking. When the
+// queue is full the pending flag is cleared, so the video does not wait for a thumbnail
+// that never comes, and false is returned.
+func (w *ThumbnailWorker) Enqueue(ctx context.Context, video *models.Video) bool {
+	select {
+	case w.queue <- thumbnailJob{videoID: video.ID, videoKey: video.URL}:
+		return true
+	default:
+	}
+
+	logrus.WithField("video_id", video.ID).Warn("Thumbnail queue is full, skipping thumbnail generation")
+	if err := w.videos.SetGeneratedThumbnail(ctx, video.ID, ""); err != nil {
+		logrus.WithError(err).WithField("video_id", video.ID).Error("Failed to clear pending thumbnail")
+	}
+	video.ThumbnailPending = false
+	return false
+}
+
+// Generate creates the thumbnail of a queued video and stores it. A failed generation
+// still clears the pending flag.
+func (w *ThumbnailWorker) Generate(ctx context.Context, job thumbnailJob) error {
+	genCtx, cancel := context.WithTimeout(ctx, w.timeout)
+	thumbnailKey, genErr := w.generator.Generate(genCtx, job.videoKey)
+	cancel()
+
+	if err := w.videos.SetGeneratedThumbnail(ctx, job.videoID, thumbnailKey); err != nil {
+		return err
+	}
+	return genErr
+}
+
+// requeuePending queues the videos left pending by a previous run, blocking while the
+// queue is full since Run is draining it
+func (w *ThumbnailWorker) requeuePending(ctx context.Context) {
+	videos, err := w.videos.ListPendingThumbnails(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list videos with a pending thumbnail")
+		return
+	}
+
+	for _, video := range videos {
+		select {
+		case <-ctx.Done():
+			return
+		case w.queue <- thumbnailJob{videoID: video.ID, videoKey: video.URL}:
+		}
+	}
+	if len(videos) > 0 {
+		logrus.WithField("count", len(videos)).Info("Queued pending thumbnails")
+	}
+}
+
+// Run generates the thumbnails of queued videos one at a time until ctx is done. Videos
+// still pending from before a restart are queued again first.
+func (w *ThumbnailWorker) Run(ctx context.Context) {
+	go w.requeuePending(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-w.queue:
+			if err := w.Generate(ctx, job); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"video_id":  job.videoID,
+					"video_key": job.videoKey,
+				}).Error("Failed to generate thumbnail")
+				continue
+			}
+			logrus.WithField("video_id", job.videoID).Info("Generated thumbnail")
+		}
+	}
+}
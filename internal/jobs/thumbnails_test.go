@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeThumbnailGenerator struct {
+	err error
+}
+
+func (f *fakeThumbnailGenerator) Generate(ctx context.Context, videoKey string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return "auto/" + videoKey + ".jpg", nil
+}
+
+type fakeGeneratedThumbnails struct {
+	pending []*models.Video
+	stored  map[primitive.ObjectID]string
+}
+
+func (f *fakeGeneratedThumbnails) ListPendingThumbnails(ctx context.Context) ([]*models.Video, error) {
+	return f.pending, nil
+}
+
+func (f *fakeGeneratedThumbnails) SetGeneratedThumbnail(ctx context.Context, videoID primitive.ObjectID, thumbnailKey string) error {
+	f.stored[videoID] = thumbnailKey
+	return nil
+}
+
+func TestThumbnailWorkerGenerate(t *testing.T) {
+	store := &fakeGeneratedThumbnails{stored: map[primitive.ObjectID]string{}}
+	worker := NewThumbnailWorker(&fakeThumbnailGenerator{}, store)
+
+	videoID := primitive.NewObjectID()
+	if err := worker.Generate(context.Background(), thumbnailJob{videoID: videoID, videoKey: "videos/intro"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.stored[videoID] != "auto/videos/intro.jpg" {
+		t.Fatalf("expected the generated thumbnail to be stored, got %q", store.stored[videoID])
+	}
+}
+
+func TestThumbnailWorkerGenerateFailureClearsPending(t *testing.T) {
+	store := &fakeGeneratedThumbnails{stored: map[primitive.ObjectID]string{}}
+	worker := NewThumbnailWorker(&fakeThumbnailGenerator{err: errors.New("ffmpeg failed")}, store)
+
+	videoID := primitive.NewObjectID()
+	if err := worker.Generate(context.Background(), thumbnailJob{videoID: videoID, videoKey: "videos/intro"}); err == nil {
+		t.Fatal("expected the generation error")
+	}
+	if key, ok := store.stored[videoID]; !ok || key != "" {
+		t.Fatalf("expected the pending flag to be cleared without a thumbnail, got %q", key)
+	}
+}
+
+func TestThumbnailWorkerEnqueueWhenFull(t *testing.T) {
+	store := &fakeGeneratedThumbnails{stored: map[primitive.ObjectID]string{}}
+	worker := NewThumbnailWorker(&fakeThumbnailGenerator{}, store)
+	worker.queue = make(chan thumbnailJob, 1)
+
+	first := &models.Video{ID: primitive.NewObjectID(), URL: "videos/a", ThumbnailPending: true}
+	second := &models.Video{ID: primitive.NewObjectID(), URL: "videos/b", ThumbnailPending: true}
+	if !worker.Enqueue(context.Background(), first) {
+		t.Fatal("expected the first video to be queued")
+	}
+	if worker.Enqueue(context.Background(), second) {
+		t.Fatal("expected the second video to be dropped")
+	}
+	if second.ThumbnailPending {
+		t.Fatal("expected a dropped video to no longer be pending")
+	}
+	if _, ok := store.stored[second.ID]; !ok {
+		t.Fatal("expected the pending flag of a dropped video to be cleared")
+	}
+}
+
+func TestThumbnailWorkerRequeuesPendingVideos(t *testing.T) {
+	pending := []*models.Video{
+		{ID: primitive.NewObjectID(), URL: "videos/a", ThumbnailPending: true},
+		{ID: primitive.NewObjectID(), URL: "videos/b", ThumbnailPending: true},
+	}
+	store := &fakeGeneratedThumbnails{pending: pending, stored: map[primitive.ObjectID]string{}}
+	worker := NewThumbnailWorker(&fakeThumbnailGenerator{}, store)
+	// A queue smaller than the backlog, so requeueing has to wait on Run
+	worker.queue = make(chan thumbnailJob, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.requeuePending(ctx)
+
+	for _, video := range pending {
+		select {
+		case job := <-worker.queue:
+			if job.videoID != video.ID || job.videoKey != video.URL {
+				t.Fatalf("expected %s to be queued, got %+v", video.URL, job)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %s to be queued", video.URL)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UploadIntents lists abandoned uploads and records their cleanup
+type UploadIntents interface {
+	ListStale(ctx context.Context, cutoff time.Time, page, limit int64) ([]*models.UploadIntent, int64, error)
+	IsReferenced(ctx context.Context, fileKey string) (bool, error)
+	MarkCompleted(ctx context.Context, fileKey string, userID primitive.ObjectID) (bool, error)
+	MarkRevoked(ctx context.Context, id primitive.ObjectID) (bool, error)
+}
+
+// UploadCleanupResult counts what a cleanup run did
+type UploadCleanupResult struct {
+	Revoked int
+	// Completed counts stale intents found in use and marked completed instead
+	Completed int
+}
+
+// UploadCleaner deletes the S3 objects of presigned uploads that were never completed
+type UploadCleaner struct {
+	intents UploadIntents
+	media   MediaStore
+	maxAge  time.Duration
+}
+
+// NewUploadCleaner creates a cleaner for uploads pending longer than maxAge
+func NewUploadCleaner(intents UploadIntents, media MediaStore, maxAge time.Duration) *UploadCleaner {
+	return &UploadCleaner{
+		intents: intents,
+		media:   media,
+		maxAge:  maxAge,
+	}
+}
+
+// deleteUploadObject removes the object of an intent from the bucket its kind uploads to
+func deleteUploadObject(media MediaStore, intent *models.UploadIntent) error {
+	if intent.Kind == "thumbnail" {
+		return media.DeleteThumbnail(intent.FileKey)
+	}
+	return media.DeleteFile(intent.FileKey)
+}
+
+// RevokeUpload deletes the object of a pending upload and marks its intent revoked.
+// Keys used by a video or course are marked completed instead and kept.
+func RevokeUpload(ctx context.Context, intents UploadIntents, media MediaStore, intent *models.UploadIntent) (revoked bool, err error) {
+	referenced, err := intents.IsReferenced(ctx, intent.FileKey)
+	if err != nil {
+		return false, err
+	}
+	if referenced {
+		_, err := intents.MarkCompleted(ctx, intent.FileKey, intent.UserID)
+		return false, err
+	}
+
+	// Revoke first so an upload completed in the meantime is never deleted
+	revoked, err = intents.MarkRevoked(ctx, intent.ID)
+	if err != nil || !revoked {
+		return false, err
+	}
+
+	// Deleting a missing S3 object succeeds, so uploads never started are fine
+	return true, deleteUploadObject(media, intent)
+}
+
+// Clean revokes every upload pending since before now minus the maximum age. A failure
+// on one upload is logged and the rest are still cleaned.
+func (u *UploadCleaner) Clean(ctx context.Context, now time.Time) (UploadCleanupResult, error) {
+	var result UploadCleanupResult
+
+	stale, _, err := u.intents.ListStale(ctx, now.UTC().Add(-u.maxAge), 1, 0)
+	if err != nil {
+		return result, err
+	}
+
+	for _, intent := range stale {
+		revoked, err := RevokeUpload(ctx, u.intents, u.media, intent)
+		if err != nil {
+			logrus.WithError(err).WithField("file_key", intent.FileKey).Error("Failed to clean up abandoned upload")
+			continue
+		}
+		if revoked {
+			result.Revoked++
+		} else {
+			result.Completed++
+		}
+	}
+
+	return result, nil
+}
+
+// Run cleans once immediately and then every interval until ctx is done
+func (u *UploadCleaner) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, func(ctx context.Context) {
+		result, err := u.Clean(ctx, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("Abandoned upload cleanup failed")
+		} else if result.Revoked > 0 || result.Completed > 0 {
+			logrus.WithFields(logrus.Fields{
+				"revoked":   result.Revoked,
+				"completed": result.Completed,
+			}).Info("Cleaned up abandoned uploads")
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeIntents is an in-memory store of upload intents
+type fakeIntents struct {
+	intents    []*models.UploadIntent
+	referenced map[string]bool
+}
+
+func (f *fakeIntents) ListStale(ctx context.Context, cutoff time.Time, page, limit int64) ([]*models.UploadIntent, int64, error) {
+	var stale []*models.UploadIntent
+	for _, intent := range f.intents {
+		if intent.Status == models.UploadIntentPending && intent.IssuedAt.Before(cutoff) {
+			stale = append(stale, intent)
+		}
+	}
+	return stale, int64(len(stale)), nil
+}
+
+func (f *fakeIntents) IsReferenced(ctx context.Context, fileKey string) (bool, error) {
+	return f.referenced[fileKey], nil
+}
+
+func (f *fakeIntents) MarkCompleted(ctx context.Context, fileKey string, userID primitive.ObjectID) (bool, error) {
+	for _, intent := range f.intents {
+		if intent.FileKey == fileKey && intent.UserID == userID && intent.Status == models.UploadIntentPending {
+			intent.Status = models.UploadIntentCompleted
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeIntents) MarkRevoked(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	for _, intent := range f.intents {
+		if intent.ID == id && intent.Status == models.UploadIntentPending {
+			intent.Status = models.UploadIntentRevoked
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newIntent(key, kind string, issuedAt time.Time) *models.UploadIntent {
+	return &models.UploadIntent{
+		ID:       primitive.NewObjectID(),
+		FileKey:  key,
+		UserID:   primitive.NewObjectID(),
+		Kind:     kind,
+		Status:   models.UploadIntentPending,
+		IssuedAt: issuedAt,
+	}
+}
+
+func TestUploadCleanerRevokesOnlyStaleUnusedUploads(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	abandoned := newIntent("video/u1/abandoned.mp4", "video", now.Add(-48*time.Hour))
+	thumbnail := newIntent("thumbnail/u1/cover.jpg", "thumbnail", now.Add(-30*time.Hour))
+	inUse := newIntent("video/u1/published.mp4", "video", now.Add(-72*time.Hour))
+	recent := newIntent("video/u1/uploading.mp4", "video", now.Add(-time.Hour))
+	completed := newIntent("video/u1/done.mp4", "video", now.Add(-72*time.Hour))
+	completed.Status = models.UploadIntentCompleted
+
+	intents := &fakeIntents{
+		intents:    []*models.UploadIntent{abandoned, thumbnail, inUse, recent, completed},
+		referenced: map[string]bool{inUse.FileKey: true},
+	}
+	media := &fakeMedia{}
+
+	result, err := NewUploadCleaner(intents, media, 24*time.Hour).Clean(context.Background(), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Revoked != 2 || result.Completed != 1 {
+		t.Fatalf("expected 2 revoked and 1 completed, got %+v", result)
+	}
+	if len(media.deleted) != 2 || media.deleted[0] != abandoned.FileKey || media.deleted[1] != thumbnail.FileKey {
+		t.Fatalf("expected only the abandoned objects to be deleted, got %v", media.deleted)
+	}
+	if inUse.Status != models.UploadIntentCompleted {
+		t.Fatalf("expected upload in use to be marked completed, got %s", inUse.Status)
+	}
+	if recent.Status != models.UploadIntentPending {
+		t.Fatalf("expected recent upload to stay pending, got %s", recent.Status)
+	}
+
+	// A second run finds nothing left to clean
+	again, err := NewUploadCleaner(intents, media, 24*time.Hour).Clean(context.Background(), now)
+	if err != nil || again.Revoked != 0 || again.Completed != 0 {
+		t.Fatalf("expected nothing to clean on rerun, got %+v (%v)", again, err)
+	}
+}
+
+func TestRevokeUploadKeepsCompletedUpload(t *testing.T) {
+	intent := newIntent("video/u1/late.mp4", "video", time.Now().Add(-48*time.Hour))
+	intents := &fakeIntents{intents: []*models.UploadIntent{intent}}
+
+	// The upload completes after the intent was listed as stale
+	if ok, _ := intents.MarkCompleted(context.Background(), intent.FileKey, intent.UserID); !ok {
+		t.Fatal("expected pending intent to be marked completed")
+	}
+
+	media := &fakeMedia{}
+	revoked, err := RevokeUpload(context.Background(), intents, media, intent)
+	if err != nil || revoked {
+		t.Fatalf("expected completed upload not to be revoked, got %v (%v)", revoked, err)
+	}
+	if len(media.deleted) != 0 {
+		t.Fatalf("expected completed upload to be kept, got deletions %v", media.deleted)
+	}
+}
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a mailer for the given SMTP server. Authentication is
+// skipped when username is empty.
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+// Send delivers a plain text email
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	headers := []string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	msg := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg))
+}
+
+// NoopMailer discards every email. It is used when SMTP is not configured and in tests.
+type NoopMailer struct{}
+
+// Send logs the recipient and subject without sending anything
+func (NoopMailer) Send(ctx context.Context, to, subject, body string) error {
+	logrus.WithFields(logrus.Fields{
+		"to":      to,
+		"subject": subject,
+	}).Debug("Email not sent, mailer is disabled")
+	return nil
+}
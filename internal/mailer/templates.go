@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"fmt"
+	"strings"
+
+	"cource-api/internal/models"
+)
+
+// OTPMessage returns the subject and body of the email carrying an OTP of the given type
+func OTPMessage(otpType, code string, validMinutes int) (string, string) {
+	switch otpType {
+	case models.OTPTypeReset:
+		return "Reset your password",
+			fmt.Sprintf("We received a request to reset your password.\n\n"+
+				"Your password reset code is: %s\n\n"+
+				"The code expires in %d minutes. If you did not request a password reset, you can ignore this email; your password will not change.\n", code, validMinutes)
+	case models.OTPTypeLogin:
+		return "Confirm your sign-in",
+			fmt.Sprintf("We noticed a sign-in to your account from a new device or location.\n\n"+
+				"Your sign-in code is: %s\n\n"+
+				"The code expires in %d minutes. If this was not you, change your password right away.\n", code, validMinutes)
+	default:
+		return "Verify your email address",
+			fmt.Sprintf("Welcome! Please confirm your email address to finish creating your account.\n\n"+
+				"Your verification code is: %s\n\n"+
+				"The code expires in %d minutes.\n", code, validMinutes)
+	}
+}
+
+// ReceiptMessage returns the subject and body of the receipt email for a payment.
+// Amounts are stored in the smallest currency unit.
+func ReceiptMessage(payment *models.Payment) (string, string) {
+	subject := fmt.Sprintf("Your receipt for payment %s", payment.ID.Hex())
+
+	var b strings.Builder
+	b.WriteString("Thank you for your purchase. Here is your receipt.\n\n")
+	fmt.Fprintf(&b, "Payment ID: %s\n", payment.ID.Hex())
+	fmt.Fprintf(&b, "Transaction ID: %s\n", payment.TransactionID)
+	fmt.Fprintf(&b, "Date: %s\n", payment.Timestamp.UTC().Format("2006-01-02 15:04 MST"))
+	fmt.Fprintf(&b, "Amount: %d.%02d %s\n", payment.Amount/100, payment.Amount%100, strings.ToUpper(payment.Currency))
+	fmt.Fprintf(&b, "Status: %s\n", payment.Status)
+	if payment.CourseID != nil {
+		fmt.Fprintf(&b, "Course ID: %s\n", payment.CourseID.Hex())
+	}
+
+	return subject, b.String()
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOTPMessageDiffersByType(t *testing.T) {
+	regSubject, regBody := OTPMessage("registration", "123456", 15)
+	resetSubject, resetBody := OTPMessage("reset", "654321", 15)
+
+	if regSubject == resetSubject {
+		t.Fatalf("expected different subjects, both were %q", regSubject)
+	}
+	if !strings.Contains(regBody, "123456") || !strings.Contains(resetBody, "654321") {
+		t.Fatal("expected bodies to contain the OTP code")
+	}
+	if !strings.Contains(resetBody, "15 minutes") {
+		t.Fatalf("expected reset body to mention expiry, got %q", resetBody)
+	}
+}
+
+func TestReceiptMessageIncludesPaymentDetails(t *testing.T) {
+	courseID := primitive.NewObjectID()
+	payment := &models.Payment{
+		ID:            primitive.NewObjectID(),
+		TransactionID: "cs_test_123",
+		Amount:        4999,
+		Currency:      "usd",
+		Status:        "completed",
+		CourseID:      &courseID,
+		Timestamp:     time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC),
+	}
+
+	subject, body := ReceiptMessage(payment)
+	if !strings.Contains(subject, payment.ID.Hex()) {
+		t.Fatalf("expected subject to reference the payment, got %q", subject)
+	}
+	for _, want := range []string{"cs_test_123", "49.99 USD", "completed", "2025-03-14", courseID.Hex()} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected receipt to contain %q, got %q", want, body)
+		}
+	}
+}
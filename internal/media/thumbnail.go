@@ -0,0 +1,76 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"cource-api/internal/aws"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// ThumbnailGenerator creates a thumbnail for an uploaded video and returns its
+// key in the thumbnail bucket
+type ThumbnailGenerator interface {
+	Generate(ctx context.Context, videoKey string) (string, error)
+}
+
+// FFmpegThumbnailGenerator grabs a single frame from the video with ffmpeg and
+// uploads it to the thumbnail bucket
+type FFmpegThumbnailGenerator struct {
+	s3         *aws.S3Client
+	ffmpegPath string
+	offset     time.Duration
+}
+
+// NewFFmpegThumbnailGenerator creates a generator that captures the frame one second into the video
+func NewFFmpegThumbnailGenerator(s3c *aws.S3Client, ffmpegPath string) *FFmpegThumbnailGenerator {
+	return &FFmpegThumbnailGenerator{
+		s3:         s3c,
+		ffmpegPath: ffmpegPath,
+		offset:     time.Second,
+	}
+}
+
+// Generate streams the video from S3 through ffmpeg and stores the captured frame as a JPEG
+func (g *FFmpegThumbnailGenerator) Generate(ctx context.Context, videoKey string) (string, error) {
+	// ffmpeg reads the video over HTTP, seeking only as far as it needs
+	sourceURL, err := g.s3.GenerateWatchURL(videoKey, 1)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign video url: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, g.ffmpegPath,
+		"-ss", fmt.Sprintf("%.3f", g.offset.Seconds()),
+		"-i", sourceURL,
+		"-frames:v", "1",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"pipe:1",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return "", fmt.Errorf("ffmpeg produced no frame for %s", videoKey)
+	}
+
+	thumbnailKey := ThumbnailKeyFor(videoKey)
+	if err := g.s3.UploadThumbnail(ctx, thumbnailKey, "image/jpeg", &stdout); err != nil {
+		return "", fmt.Errorf("failed to upload thumbnail: %w", err)
+	}
+
+	return thumbnailKey, nil
+}
+
+// ThumbnailKeyFor derives the thumbnail bucket key for an auto generated thumbnail
+func ThumbnailKeyFor(videoKey string) string {
+	base := strings.TrimSuffix(videoKey, path.Ext(videoKey))
+	return "auto/" + base + ".jpg"
+}
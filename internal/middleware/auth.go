@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"cource-api/internal/config"
 	"cource-api/internal/models"
 	"strings"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -16,9 +18,21 @@ type Claims struct {
 	UserID primitive.ObjectID `json:"user_id"`
 	Email  string             `json:"email"`
 	Role   string             `json:"role"`
+	// ImpersonatedBy is the admin acting as this user, set only on impersonation tokens
+	ImpersonatedBy *primitive.ObjectID `json:"impersonated_by,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// TokenDenylist reports whether an access token has been revoked by its JWT ID
+type TokenDenylist interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// NewTokenID returns a random JWT ID so a single token can be revoked
+func NewTokenID() string {
+	return primitive.NewObjectID().Hex()
+}
+
 // GenerateToken generates a new JWT token
 func GenerateToken(user *models.User) (string, error) {
 	claims := &Claims{
@@ -26,17 +40,63 @@ func GenerateToken(user *models.User) (string, error) {
 		Email:  user.Email,
 		Role:   user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AppConfig.JWTExpiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        NewTokenID(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(config.AppConfig.JWTExpiration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.AppConfig.JWTSecret))
+	return SignToken(claims)
+}
+
+// GenerateImpersonationToken generates a short lived token that lets an admin act as
+// the user. The token is marked with the admin's ID and only allows reads.
+func GenerateImpersonationToken(user *models.User, adminID primitive.ObjectID) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(config.AppConfig.ImpersonationExpiration)
+
+	claims := &Claims{
+		UserID:         user.ID,
+		Email:          user.Email,
+		Role:           user.Role,
+		ImpersonatedBy: &adminID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        NewTokenID(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	signed, err := SignToken(claims)
+	return signed, expiresAt, err
+}
+
+// impersonationDeniedPaths are reads an impersonation token may not make, the user's
+// full data export and their live event stream
+var impersonationDeniedPaths = []string{"/users/me/export", "/users/me/events"}
+
+// impersonationAllows reports whether an impersonation token may make a request. Impersonation
+// sessions are read-only apart from logging out, which revokes the impersonation token.
+func impersonationAllows(method, path string) bool {
+	// Routing ignores case and a trailing slash, so the checks do too
+	path = strings.TrimSuffix(strings.ToLower(path), "/")
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		for _, denied := range impersonationDeniedPaths {
+			if strings.HasSuffix(path, denied) {
+				return false
+			}
+		}
+		return true
+	case fiber.MethodPost:
+		return strings.HasSuffix(path, "/auth/logout")
+	}
+	return false
 }
 
-// AuthMiddleware handles JWT authentication
-func AuthMiddleware() fiber.Handler {
+// AuthMiddleware handles JWT authentication. Tokens whose JWT ID is in denylist are
+// rejected; denylist may be nil to skip the check.
+func AuthMiddleware(denylist TokenDenylist) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -48,14 +108,38 @@ func AuthMiddleware() fiber.Handler {
 
 		// Parse and validate token
 		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.AppConfig.JWTSecret), nil
-		})
+		token, err := currentTokenKeys().Parse(tokenString, claims)
 
 		if err != nil || !token.Valid {
 			return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
 		}
 
+		// Tokens issued before JWT IDs were added cannot be revoked and expire naturally
+		if denylist != nil && claims.ID != "" {
+			revoked, err := denylist.IsRevoked(c.Context(), claims.ID)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to check token revocation")
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify token")
+			}
+			if revoked {
+				return fiber.NewError(fiber.StatusUnauthorized, "Token has been revoked")
+			}
+		}
+
+		if claims.ImpersonatedBy != nil {
+			entry := logrus.WithFields(logrus.Fields{
+				"user_id":         claims.UserID,
+				"impersonated_by": *claims.ImpersonatedBy,
+				"method":          c.Method(),
+				"path":            c.Path(),
+			})
+			if !impersonationAllows(c.Method(), c.Path()) {
+				entry.Warn("Blocked request during impersonation")
+				return fiber.NewError(fiber.StatusForbidden, "Not allowed during impersonation")
+			}
+			entry.Info("Impersonated request")
+		}
+
 		// Set user info in context
 		c.Locals("user", claims)
 		return c.Next()
@@ -77,6 +161,24 @@ func RequireRole(roles ...string) fiber.Handler {
 	}
 }
 
+// RequireSuperAdmin middleware ensures the user is an admin listed in SuperAdminEmails.
+// Impersonation tokens never pass.
+func RequireSuperAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := c.Locals("user").(*Claims)
+
+		if user.Role == "admin" && user.ImpersonatedBy == nil {
+			for _, email := range config.AppConfig.SuperAdminEmails {
+				if strings.EqualFold(email, user.Email) {
+					return c.Next()
+				}
+			}
+		}
+
+		return fiber.NewError(fiber.StatusForbidden, "Insufficient permissions")
+	}
+}
+
 // RequireSubscription middleware ensures the user has an active subscription
 func RequireSubscription() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cource-api/internal/config"
+	"cource-api/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func withTestConfig(t *testing.T) {
+	original := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = original })
+
+	config.AppConfig.JWTSecret = "test-secret"
+	config.AppConfig.JWTExpiration = time.Hour
+	config.AppConfig.ImpersonationExpiration = 15 * time.Minute
+	config.AppConfig.SuperAdminEmails = []string{"root@example.com"}
+}
+
+func TestImpersonationTokenCarriesMarker(t *testing.T) {
+	withTestConfig(t)
+
+	user := &models.User{ID: primitive.NewObjectID(), Email: "jane@example.com", Role: "user"}
+	adminID := primitive.NewObjectID()
+
+	token, expiresAt, err := GenerateImpersonationToken(user, adminID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Until(expiresAt) > 15*time.Minute {
+		t.Fatalf("expected a short lived token, expires at %v", expiresAt)
+	}
+
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWTSecret), nil
+	}); err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	if claims.UserID != user.ID || claims.ImpersonatedBy == nil || *claims.ImpersonatedBy != adminID {
+		t.Fatalf("expected token for %s impersonated by %s, got %+v", user.ID.Hex(), adminID.Hex(), claims)
+	}
+}
+
+func TestImpersonationBlocksDestructiveActions(t *testing.T) {
+	withTestConfig(t)
+
+	user := &models.User{ID: primitive.NewObjectID(), Email: "jane@example.com", Role: "user"}
+	impersonation, _, err := GenerateImpersonationToken(user, primitive.NewObjectID())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	regular, err := GenerateToken(user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root, err := GenerateToken(&models.User{ID: primitive.NewObjectID(), Email: "root@example.com", Role: "admin"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app := fiber.New()
+	app.Use(AuthMiddleware(nil))
+	app.Get("/me", ok)
+	app.Delete("/me", ok)
+	app.Get("/api/v1/users/me/export", ok)
+	app.Get("/api/v1/users/me/events", ok)
+	app.Post("/api/v1/auth/logout", ok)
+	app.Post("/impersonate", RequireSuperAdmin(), ok)
+
+	cases := []struct {
+		method, path, token string
+		want                int
+	}{
+		{"GET", "/me", impersonation, fiber.StatusOK},
+		{"DELETE", "/me", impersonation, fiber.StatusForbidden},
+		{"DELETE", "/me", regular, fiber.StatusOK},
+		{"GET", "/api/v1/users/me/export", impersonation, fiber.StatusForbidden},
+		{"GET", "/api/v1/Users/Me/Export/", impersonation, fiber.StatusForbidden},
+		{"GET", "/api/v1/users/me/export", regular, fiber.StatusOK},
+		{"GET", "/api/v1/users/me/events", impersonation, fiber.StatusForbidden},
+		{"POST", "/api/v1/auth/logout", impersonation, fiber.StatusOK},
+		{"POST", "/impersonate", impersonation, fiber.StatusForbidden},
+		{"POST", "/impersonate", regular, fiber.StatusForbidden},
+		{"POST", "/impersonate", root, fiber.StatusOK},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: request failed: %v", tc.method, tc.path, err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.want, resp.StatusCode)
+		}
+	}
+}
+
+type fakeDenylist map[string]bool
+
+func (d fakeDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return d[jti], nil
+}
+
+func TestAuthMiddlewareRejectsRevokedTokens(t *testing.T) {
+	withTestConfig(t)
+
+	user := &models.User{ID: primitive.NewObjectID(), Email: "jane@example.com", Role: "user"}
+	revoked, err := GenerateToken(user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	active, err := GenerateToken(user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(revoked, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWTSecret), nil
+	}); err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	if claims.ID == "" {
+		t.Fatal("expected the token to carry a jti")
+	}
+
+	app := fiber.New()
+	app.Use(AuthMiddleware(fakeDenylist{claims.ID: true}))
+	app.Get("/me", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	for token, want := range map[string]int{revoked: fiber.StatusUnauthorized, active: fiber.StatusOK} {
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("expected %d, got %d", want, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// RateLimitPerUser limits an authenticated route to max requests per user within window.
+// It must run after AuthMiddleware.
+func RateLimitPerUser(max int, window time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: window,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			if claims, ok := c.Locals("user").(*Claims); ok {
+				return claims.UserID.Hex()
+			}
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return fiber.NewError(fiber.StatusTooManyRequests, "Too many requests, please try again later")
+		},
+	})
+}
+
+// RateLimitAuth limits unauthenticated auth requests to max per window. Requests are
+// keyed by route, client IP and the email in the body so a single abusive client
+// cannot lock an account out for everyone else.
+func RateLimitAuth(max int, window time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:          max,
+		Expiration:   window,
+		KeyGenerator: authRateLimitKey,
+		LimitReached: func(c *fiber.Ctx) error {
+			return fiber.NewError(fiber.StatusTooManyRequests, "Too many attempts, please try again later")
+		},
+	})
+}
+
+// authRateLimitKey builds the limiter key from the route, client IP and request email
+func authRateLimitKey(c *fiber.Ctx) string {
+	var body struct {
+		Email string `json:"email"`
+	}
+	// Bodies that are not JSON are keyed by IP alone
+	_ = json.Unmarshal(c.Body(), &body)
+
+	return c.Path() + "|" + c.IP() + "|" + strings.ToLower(strings.TrimSpace(body.Email))
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRateLimitAuthKeysByEmail(t *testing.T) {
+	app := fiber.New()
+	app.Post("/login", RateLimitAuth(2, time.Minute), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	login := func(email string) *http.Response {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"email":"`+email+`","password":"wrong"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := login("victim@example.com"); resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("attempt %d: expected 200, got %d", i+1, resp.StatusCode)
+		}
+	}
+
+	blocked := login("Victim@example.com")
+	if blocked.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the limit is reached, got %d", blocked.StatusCode)
+	}
+	if blocked.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+
+	if resp := login("other@example.com"); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected a different email to be unaffected, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+// RequestIDKey is the Locals key holding the ID of the current request
+const RequestIDKey = "request_id"
+
+// maxRequestIDLength caps the length of a request ID accepted from a client
+const maxRequestIDLength = 128
+
+// validRequestID reports whether a client supplied request ID is safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID propagates the X-Request-ID header of a request, generating a new ID when the
+// client sent none or an unusable one. The ID is echoed in the response and stored under
+// RequestIDKey so log lines of the request can be correlated.
+func RequestID() fiber.Handler {
+	generate := requestid.New(requestid.Config{ContextKey: RequestIDKey})
+
+	return func(c *fiber.Ctx) error {
+		if id := c.Get(fiber.HeaderXRequestID); id != "" && !validRequestID(id) {
+			c.Request().Header.Del(fiber.HeaderXRequestID)
+		}
+		return generate(c)
+	}
+}
+
+// GetRequestID returns the ID of the current request, empty when RequestID did not run
+func GetRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(RequestIDKey).(string)
+	return id
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequestIDPropagatesOrGenerates(t *testing.T) {
+	var stored string
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Get("/", func(c *fiber.Ctx) error {
+		stored = GetRequestID(c)
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"propagated", "req-123", true},
+		{"generated", "", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"whitespace", "req id", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(fiber.HeaderXRequestID, tt.incoming)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+
+			echoed := resp.Header.Get(fiber.HeaderXRequestID)
+			if echoed == "" || echoed != stored {
+				t.Fatalf("expected the stored ID %q to be echoed, got %q", stored, echoed)
+			}
+			if (echoed == tt.incoming) != tt.keep {
+				t.Fatalf("incoming %q kept = %v, want %v", tt.incoming, echoed == tt.incoming, tt.keep)
+			}
+		})
+	}
+}
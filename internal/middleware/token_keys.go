@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"cource-api/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT signing algorithms
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+)
+
+// TokenKeys signs access tokens with the current key and verifies them against every
+// key still accepted, so a retired key keeps working until its tokens expire
+type TokenKeys struct {
+	method jwt.SigningMethod
+	// keyID is written to the kid header of new tokens, empty to leave it out
+	keyID      string
+	signingKey interface{}
+	// verifyKeys maps a kid to its verification key, tokens without a kid use keyID
+	verifyKeys map[string]interface{}
+}
+
+// NewHS256Keys signs and verifies tokens with a shared secret
+func NewHS256Keys(secret string) *TokenKeys {
+	return &TokenKeys{
+		method:     jwt.SigningMethodHS256,
+		signingKey: []byte(secret),
+		verifyKeys: map[string]interface{}{"": []byte(secret)},
+	}
+}
+
+// NewRS256Keys signs tokens with privateKey under keyID. Tokens are verified with the
+// matching public key or any of the extra public keys, keyed by their kid.
+func NewRS256Keys(privateKey *rsa.PrivateKey, keyID string, publicKeys map[string]*rsa.PublicKey) (*TokenKeys, error) {
+	if privateKey == nil {
+		return nil, errors.New("RS256 requires a private key")
+	}
+	if keyID == "" {
+		return nil, errors.New("RS256 requires a key ID")
+	}
+
+	verifyKeys := make(map[string]interface{}, len(publicKeys)+1)
+	for kid, key := range publicKeys {
+		verifyKeys[kid] = key
+	}
+	verifyKeys[keyID] = &privateKey.PublicKey
+
+	return &TokenKeys{
+		method:     jwt.SigningMethodRS256,
+		keyID:      keyID,
+		signingKey: privateKey,
+		verifyKeys: verifyKeys,
+	}, nil
+}
+
+// Sign signs claims with the current key
+func (k *TokenKeys) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.keyID != "" {
+		token.Header["kid"] = k.keyID
+	}
+	return token.SignedString(k.signingKey)
+}
+
+// Parse verifies tokenString and decodes it into claims. Only the configured algorithm
+// is accepted, so an RS256 public key can never be used as an HS256 secret.
+func (k *TokenKeys) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = k.keyID
+		}
+		key, ok := k.verifyKeys[kid]
+		if !ok {
+			// HS256 has a single key whatever the kid
+			if key, ok = k.verifyKeys[""]; !ok {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{k.method.Alg()}))
+}
+
+var (
+	tokenKeysMu sync.RWMutex
+	tokenKeys   *TokenKeys
+)
+
+// SetTokenKeys replaces the keys used for access tokens
+func SetTokenKeys(keys *TokenKeys) {
+	tokenKeysMu.Lock()
+	defer tokenKeysMu.Unlock()
+	tokenKeys = keys
+}
+
+// currentTokenKeys returns the configured keys, falling back to HS256 with the
+// configured secret when none were set
+func currentTokenKeys() *TokenKeys {
+	tokenKeysMu.RLock()
+	defer tokenKeysMu.RUnlock()
+	if tokenKeys != nil {
+		return tokenKeys
+	}
+	return NewHS256Keys(config.AppConfig.JWTSecret)
+}
+
+// SignToken signs access token claims with the current key
+func SignToken(claims jwt.Claims) (string, error) {
+	return currentTokenKeys().Sign(claims)
+}
+
+// LoadTokenKeys builds the token keys described by the configuration, reading RSA
+// keys from their PEM files
+func LoadTokenKeys(cfg config.Config) (*TokenKeys, error) {
+	switch strings.ToUpper(cfg.JWTAlgorithm) {
+	case "", JWTAlgorithmHS256:
+		return NewHS256Keys(cfg.JWTSecret), nil
+	case JWTAlgorithmRS256:
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.JWTAlgorithm)
+	}
+
+	data, err := os.ReadFile(cfg.JWTPrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read JWT private key: %w", err)
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse JWT private key: %w", err)
+	}
+
+	// Extra public keys are given as kid=path pairs
+	publicKeys := make(map[string]*rsa.PublicKey, len(cfg.JWTPublicKeys))
+	for _, entry := range cfg.JWTPublicKeys {
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("JWT public key %q must be kid=path", entry)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read JWT public key %s: %w", kid, err)
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse JWT public key %s: %w", kid, err)
+		}
+		publicKeys[kid] = publicKey
+	}
+
+	return NewRS256Keys(privateKey, cfg.JWTKeyID, publicKeys)
+}
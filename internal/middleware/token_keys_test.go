@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return key
+}
+
+func newTestClaims() *Claims {
+	return &Claims{
+		UserID: primitive.NewObjectID(),
+		Email:  "jane@example.com",
+		Role:   "user",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        NewTokenID(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func TestRS256SignAndVerify(t *testing.T) {
+	keys, err := NewRS256Keys(newTestRSAKey(t), "2024-06", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims := newTestClaims()
+	signed, err := keys.Sign(claims)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	parsed := &Claims{}
+	token, err := keys.Parse(signed, parsed)
+	if err != nil || !token.Valid {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if token.Header["kid"] != "2024-06" || token.Method.Alg() != JWTAlgorithmRS256 {
+		t.Fatalf("expected RS256 token with kid, got header %v", token.Header)
+	}
+	if parsed.UserID != claims.UserID {
+		t.Fatalf("expected user %s, got %s", claims.UserID.Hex(), parsed.UserID.Hex())
+	}
+}
+
+func TestRS256VerifiesRetiredKeyDuringRotation(t *testing.T) {
+	oldKey := newTestRSAKey(t)
+	oldKeys, err := NewRS256Keys(oldKey, "old", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	signed, err := oldKeys.Sign(newTestClaims())
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	rotated, err := NewRS256Keys(newTestRSAKey(t), "new", map[string]*rsa.PublicKey{"old": &oldKey.PublicKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := rotated.Parse(signed, &Claims{}); err != nil {
+		t.Fatalf("expected token signed with the retired key to verify, got %v", err)
+	}
+
+	// Once the old key is dropped its tokens are rejected
+	retired, err := NewRS256Keys(newTestRSAKey(t), "new", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := retired.Parse(signed, &Claims{}); err == nil {
+		t.Fatal("expected token signed with a removed key to be rejected")
+	}
+}
+
+func TestRS256RejectsHS256Tokens(t *testing.T) {
+	key := newTestRSAKey(t)
+	keys, err := NewRS256Keys(key, "current", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	forged, err := NewHS256Keys("shared-secret").Sign(newTestClaims())
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if _, err := keys.Parse(forged, &Claims{}); err == nil {
+		t.Fatal("expected HS256 token to be rejected in RS256 mode")
+	}
+}
+
+func TestHS256Fallback(t *testing.T) {
+	withTestConfig(t)
+
+	signed, err := SignToken(newTestClaims())
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if _, err := NewHS256Keys("test-secret").Parse(signed, &Claims{}); err != nil {
+		t.Fatalf("expected HS256 token signed with the configured secret, got %v", err)
+	}
+	if _, err := NewHS256Keys("other-secret").Parse(signed, &Claims{}); err == nil {
+		t.Fatal("expected token to be rejected with a different secret")
+	}
+}
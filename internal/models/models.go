@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -18,8 +19,18 @@ type User struct {
 	IsVerified   bool               `bson:"is_verified" json:"is_verified"`
 	Subscription Subscription       `bson:"subscription" json:"subscription"`
 	Blocked      bool               `bson:"blocked" json:"-"`
-	CreatedAt    time.Time          `bson:"created_at" json:"-"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"-"`
+	// FailedLoginAttempts counts consecutive wrong passwords, LockedUntil is set once it reaches the lockout threshold
+	FailedLoginAttempts int        `bson:"failed_login_attempts" json:"-"`
+	LockedUntil         *time.Time `bson:"locked_until,omitempty" json:"-"`
+	// TrialUsedAt is set when the user starts their first trial, each user gets one
+	TrialUsedAt *time.Time `bson:"trial_used_at,omitempty" json:"-"`
+	// MutedNotifications are the notification types the user opted out of
+	MutedNotifications []string `bson:"muted_notifications,omitempty" json:"muted_notifications,omitempty"`
+	// DeletedAt is set when the user is soft deleted
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	CreatedAt time.Time  `bson:"created_at" json:"-"`
+	// UpdatedAt is exposed so clients can send it back as the version they edited
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }
 
 // OTP represents a one-time password for verification
@@ -27,12 +38,29 @@ type OTP struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Email     string             `bson:"email" json:"email"`
 	Code      string             `bson:"code" json:"-"`
-	Type      string             `bson:"type" json:"type"` // "registration" or "reset"
+	Type      string             `bson:"type" json:"type"` // one of the OTPType constants
 	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	Used      bool               `bson:"used" json:"used"`
 }
 
+// OTP types
+const (
+	OTPTypeRegistration = "registration"
+	OTPTypeReset        = "reset"
+	OTPTypeLogin        = "login"
+)
+
+// OTPSend records that an OTP was requested, including requests for emails without an
+// account so every email is limited alike. Sends outlive the OTPs themselves, which
+// expire within minutes, so the hourly send limit can be enforced.
+type OTPSend struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Email     string             `bson:"email" json:"email"`
+	Type      string             `bson:"type" json:"type"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
 // VerifyPassword checks if the provided password matches the stored hash
 func (u *User) VerifyPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
@@ -84,11 +112,24 @@ type Course struct {
 	VideoOrder   []primitive.ObjectID `bson:"video_order" json:"video_order"` // Ordered array of video IDs
 	IsPaid       bool                 `bson:"is_paid" json:"is_paid"`
 	Skills       []string             `bson:"skills" json:"skills"`
-	Author       string               `bson:"author" json:"author"`
-	IsPublic     bool                 `bson:"is_public" json:"is_public"`
-	CreatedBy    primitive.ObjectID   `bson:"created_by" json:"created_by"`
-	CreatedAt    time.Time            `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time            `bson:"updated_at" json:"updated_at"`
+	// CategoryID is the category the course is listed under, if any
+	CategoryID *primitive.ObjectID `bson:"category_id,omitempty" json:"category_id,omitempty"`
+	Author     string              `bson:"author" json:"author"`
+	IsPublic   bool                `bson:"is_public" json:"is_public"`
+	// Individual purchase, in the smallest currency unit like regional pricing
+	IsPurchasable bool               `bson:"is_purchasable" json:"is_purchasable"`
+	Price         int                `bson:"price" json:"price"`
+	Currency      string             `bson:"currency" json:"currency"`
+	CreatedBy     primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+	// DeletedAt is set when the course is soft deleted
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	// Rating fields are computed for responses from the course reviews and never stored
+	AverageRating float64 `bson:"-" json:"average_rating"`
+	ReviewCount   int64   `bson:"-" json:"review_count"`
+	// ViewCount is computed for responses as the sum of the view counts of the course videos
+	ViewCount int64 `bson:"-" json:"view_count"`
 }
 
 // Product represents a subscription product in the system
@@ -106,6 +147,26 @@ type Product struct {
 	TrialDays     int                `bson:"trial_days" json:"trial_days"`         // Number of trial days
 	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+	// Discount fields are computed for responses by ComputeDiscount and never stored
+	DiscountPercent float64 `bson:"-" json:"discount_percent,omitempty"`
+	DiscountAmount  float64 `bson:"-" json:"discount_amount,omitempty"`
+}
+
+// OnSale reports whether the product is priced below its original price
+func (p *Product) OnSale() bool {
+	return p.OriginalPrice > 0 && p.OriginalPrice > p.Price
+}
+
+// ComputeDiscount fills the discount amount and percentage, rounded to two decimals.
+// Products without a higher original price have no discount.
+func (p *Product) ComputeDiscount() {
+	p.DiscountAmount, p.DiscountPercent = 0, 0
+	if !p.OnSale() {
+		return
+	}
+
+	p.DiscountAmount = math.Round((p.OriginalPrice-p.Price)*100) / 100
+	p.DiscountPercent = math.Round((p.OriginalPrice-p.Price)/p.OriginalPrice*10000) / 100
 }
 
 // Video represents a video in the system
@@ -118,7 +179,35 @@ type Video struct {
 	Duration    int                `bson:"duration" json:"duration"`
 	IsPaid      bool               `bson:"is_paid" json:"is_paid"`
 	CourseID    primitive.ObjectID `bson:"course_id" json:"course_id"`
-	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	// ThumbnailPending is set while a thumbnail is being generated in the background
+	ThumbnailPending bool `bson:"thumbnail_pending,omitempty" json:"thumbnail_pending,omitempty"`
+	// PreviewSeconds is how much of a paid video users without access may watch, zero
+	// means no preview
+	PreviewSeconds int `bson:"preview_seconds" json:"preview_seconds"`
+	// Status is the processing state of the video file, empty for videos stored before it was tracked
+	Status string `bson:"status,omitempty" json:"status,omitempty"`
+	// Renditions maps a quality label (e.g. "720p") to the S3 key of that encoding
+	Renditions map[string]string `bson:"renditions,omitempty" json:"renditions,omitempty"`
+	// MasterPlaylist is the S3 key of the HLS master playlist for the renditions
+	MasterPlaylist string `bson:"master_playlist,omitempty" json:"master_playlist,omitempty"`
+	// Subtitles holds at most one caption track per language
+	Subtitles []Subtitle `bson:"subtitles,omitempty" json:"subtitles,omitempty"`
+	// ViewCount is how many users have started the video, each user counts once
+	ViewCount int64     `bson:"view_count" json:"view_count"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Video processing statuses
+const (
+	VideoStatusProcessing = "processing"
+	VideoStatusReady      = "ready"
+	VideoStatusFailed     = "failed"
+)
+
+// Subtitle is a caption track of a video stored in the main bucket
+type Subtitle struct {
+	Language string `bson:"language" json:"language"` // BCP 47 language tag, e.g. "en" or "pt-BR"
+	Key      string `bson:"key" json:"key"`
 }
 
 // WatchHistory represents a user's video watch history
@@ -135,12 +224,80 @@ type Payment struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
 	Gateway       string             `bson:"gateway" json:"gateway"`
-	TransactionID string             `bson:"transaction_id" json:"transaction_id"`
+	TransactionID string             `bson:"transaction_id,omitempty" json:"transaction_id"`
 	Amount        int                `bson:"amount" json:"amount"`
 	Currency      string             `bson:"currency" json:"currency"`
 	Region        string             `bson:"region" json:"region"`
 	Status        string             `bson:"status" json:"status"`
-	Timestamp     time.Time          `bson:"timestamp" json:"timestamp"`
+	// CourseID is set when the payment bought a single course
+	CourseID *primitive.ObjectID `bson:"course_id,omitempty" json:"course_id,omitempty"`
+	// Plan is the subscription plan bought, monthly or yearly
+	Plan string `bson:"plan,omitempty" json:"plan,omitempty"`
+	// CouponCode is the promo code applied at checkout, if any
+	CouponCode string `bson:"coupon_code,omitempty" json:"coupon_code,omitempty"`
+	// Stripe references used to match refunds, the invoice is set for subscription checkouts
+	PaymentIntentID string `bson:"payment_intent_id,omitempty" json:"payment_intent_id,omitempty"`
+	InvoiceID       string `bson:"invoice_id,omitempty" json:"invoice_id,omitempty"`
+	// RefundedAmount is the total refunded so far, Status becomes "refunded" once it is all refunded
+	RefundedAmount int        `bson:"refunded_amount,omitempty" json:"refunded_amount,omitempty"`
+	RefundedAt     *time.Time `bson:"refunded_at,omitempty" json:"refunded_at,omitempty"`
+	Timestamp      time.Time  `bson:"timestamp" json:"timestamp"`
+}
+
+// Review is a learner's rating of a course, one per user and course
+type Review struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID   primitive.ObjectID `bson:"user_id" json:"user_id"`
+	CourseID primitive.ObjectID `bson:"course_id" json:"course_id"`
+	// Rating is from 1 to 5
+	Rating    int       `bson:"rating" json:"rating"`
+	Comment   string    `bson:"comment" json:"comment"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// RatingSummary is the average rating and number of reviews of a course
+type RatingSummary struct {
+	CourseID      primitive.ObjectID `bson:"_id" json:"course_id"`
+	AverageRating float64            `bson:"average_rating" json:"average_rating"`
+	ReviewCount   int64              `bson:"review_count" json:"review_count"`
+}
+
+// Category groups courses for browsing
+type Category struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Coupon is a promo code that discounts a checkout by a percentage or a fixed amount
+type Coupon struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code       string             `bson:"code" json:"code"`
+	PercentOff float64            `bson:"percent_off,omitempty" json:"percent_off,omitempty"`
+	// AmountOff is in the smallest unit of Currency
+	AmountOff int64  `bson:"amount_off,omitempty" json:"amount_off,omitempty"`
+	Currency  string `bson:"currency,omitempty" json:"currency,omitempty"`
+	// MaxRedemptions of zero allows unlimited redemptions
+	MaxRedemptions int        `bson:"max_redemptions" json:"max_redemptions"`
+	TimesRedeemed  int        `bson:"times_redeemed" json:"times_redeemed"`
+	ExpiresAt      *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	// StripeCouponID is the matching Stripe coupon, created on first use
+	StripeCouponID string    `bson:"stripe_coupon_id,omitempty" json:"-"`
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Expired reports whether the coupon can no longer be used at now
+func (c *Coupon) Expired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
+}
+
+// RedemptionsRemaining reports whether the coupon can be redeemed again
+func (c *Coupon) RedemptionsRemaining() bool {
+	return c.MaxRedemptions == 0 || c.TimesRedeemed < c.MaxRedemptions
 }
 
 // RegionalPricing represents pricing for different regions
@@ -152,3 +309,273 @@ type RegionalPricing struct {
 	YearlyPrice    int                `bson:"yearly_price" json:"yearly_price"`
 	CurrencySymbol string             `bson:"currency_symbol" json:"currency_symbol"`
 }
+
+// TimeSeriesPoint represents a single bucket of an aggregated time series. Series of
+// amounts have a point per bucket and currency.
+type TimeSeriesPoint struct {
+	Bucket   time.Time `bson:"bucket" json:"bucket"`
+	Currency string    `bson:"currency,omitempty" json:"currency,omitempty"`
+	Value    float64   `bson:"value" json:"value"`
+}
+
+// CourseStart records the first time a user watched any video of a course
+type CourseStart struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	CourseID  primitive.ObjectID `bson:"course_id" json:"course_id"`
+	StartedAt time.Time          `bson:"started_at" json:"started_at"`
+}
+
+// ActivityEvent is a single entry in a user's activity feed
+type ActivityEvent struct {
+	// Type is one of video_watched, video_completed, course_started, course_enrolled
+	// or certificate_issued
+	Type       string              `bson:"type" json:"type"`
+	CourseID   *primitive.ObjectID `bson:"course_id,omitempty" json:"course_id,omitempty"`
+	VideoID    *primitive.ObjectID `bson:"video_id,omitempty" json:"video_id,omitempty"`
+	OccurredAt time.Time           `bson:"occurred_at" json:"occurred_at"`
+}
+
+// RefreshToken represents a long-lived token used to obtain new access tokens.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	Revoked   bool               `bson:"revoked" json:"revoked"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Enrollment records that a user enrolled in a course
+type Enrollment struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	CourseID   primitive.ObjectID `bson:"course_id" json:"course_id"`
+	EnrolledAt time.Time          `bson:"enrolled_at" json:"enrolled_at"`
+}
+
+// VideoProgress is how far a user is through a single video
+type VideoProgress struct {
+	ProgressSeconds int     `json:"progress_seconds"`
+	Duration        int     `json:"duration"`
+	Percent         float64 `json:"percent"`
+	Completed       bool    `json:"completed"`
+}
+
+// CourseProgress is how far a user is through a course, with per-video progress keyed by video ID
+type CourseProgress struct {
+	CourseID        primitive.ObjectID       `json:"course_id"`
+	Videos          map[string]VideoProgress `json:"videos"`
+	CompletedVideos int                      `json:"completed_videos"`
+	TotalVideos     int                      `json:"total_videos"`
+	OverallPercent  float64                  `json:"overall_percent"`
+}
+
+// FunnelStep counts the viewers who started and completed one video of a course
+type FunnelStep struct {
+	VideoID   primitive.ObjectID `json:"video_id"`
+	Title     string             `json:"title"`
+	Position  int                `json:"position"`
+	Started   int                `json:"started"`
+	Completed int                `json:"completed"`
+	// DropOff is how many viewers started the previous video but did not start this one
+	DropOff int `json:"drop_off"`
+}
+
+// CourseFunnel is the watch completion funnel of a course, one step per video in course order
+type CourseFunnel struct {
+	CourseID primitive.ObjectID `json:"course_id"`
+	Steps    []FunnelStep       `json:"steps"`
+}
+
+// ContinueWatching is where a user resumes a course they watched recently. Video is nil
+// when every video of the course is completed.
+type ContinueWatching struct {
+	Course        *Course   `json:"course"`
+	Video         *Video    `json:"video"`
+	ResumeSeconds int       `json:"resume_seconds"`
+	LastWatchedAt time.Time `json:"last_watched_at"`
+	Completed     bool      `json:"completed"`
+}
+
+// AuditLog records an administrative action for later review
+type AuditLog struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	ActorID    primitive.ObjectID     `bson:"actor_id" json:"actor_id"`
+	Action     string                 `bson:"action" json:"action"` // subscription.transfer, etc.
+	TargetType string                 `bson:"target_type" json:"target_type"`
+	TargetID   primitive.ObjectID     `bson:"target_id" json:"target_id"`
+	Details    map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt  time.Time              `bson:"created_at" json:"created_at"`
+}
+
+// RevokedToken denylists an access token by its JWT ID until the token expires
+type RevokedToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	JTI       string             `bson:"jti" json:"jti"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt time.Time          `bson:"revoked_at" json:"revoked_at"`
+}
+
+// Webhook event statuses
+const (
+	WebhookEventProcessing = "processing"
+	WebhookEventDone       = "done"
+)
+
+// WebhookEvent records a payment provider event so retries are not applied twice. An
+// event is processing while a delivery holds its lease and done once it was handled.
+type WebhookEvent struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	EventID        string             `bson:"event_id" json:"event_id"`
+	Type           string             `bson:"type" json:"type"`
+	Status         string             `bson:"status" json:"status"`
+	ClaimedAt      time.Time          `bson:"claimed_at" json:"claimed_at"`
+	LeaseExpiresAt time.Time          `bson:"lease_expires_at" json:"lease_expires_at"`
+	ProcessedAt    *time.Time         `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
+}
+
+// Certificate records a course completion certificate issued to a user. The name and
+// title are kept as printed so re-downloads match the first one.
+type Certificate struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
+	CourseID      primitive.ObjectID `bson:"course_id" json:"course_id"`
+	RecipientName string             `bson:"recipient_name" json:"recipient_name"`
+	CourseTitle   string             `bson:"course_title" json:"course_title"`
+	IssuedAt      time.Time          `bson:"issued_at" json:"issued_at"`
+}
+
+// Notification types
+const (
+	NotificationPaymentSucceeded     = "payment_succeeded"
+	NotificationSubscriptionCanceled = "subscription_canceled"
+	NotificationSubscriptionRenewed  = "subscription_renewed"
+	NotificationCoursePublished      = "course_published"
+)
+
+// NotificationTypes lists every notification type a user can mute
+var NotificationTypes = []string{
+	NotificationPaymentSucceeded,
+	NotificationSubscriptionCanceled,
+	NotificationSubscriptionRenewed,
+	NotificationCoursePublished,
+}
+
+// Notification is an entry of a user's in-app notifications feed
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Type      string             `bson:"type" json:"type"`
+	Title     string             `bson:"title" json:"title"`
+	Body      string             `bson:"body" json:"body"`
+	Read      bool               `bson:"read" json:"read"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Login anomaly flags set on a LoginEvent
+const (
+	LoginFlagNewDevice  = "new_device"
+	LoginFlagNewCountry = "new_country"
+	LoginFlagSharedIP   = "shared_ip"
+)
+
+// Login event outcomes
+const (
+	LoginOutcomeSuccess      = "success"
+	LoginOutcomeOTPChallenge = "otp_challenge"
+)
+
+// LoginEvent records the metadata of a login and the anomalies detected for it
+type LoginEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Email     string             `bson:"email" json:"email"`
+	IP        string             `bson:"ip" json:"ip"`
+	Country   string             `bson:"country,omitempty" json:"country,omitempty"`
+	Device    string             `bson:"device" json:"device"` // fingerprint of the device ID or user agent
+	UserAgent string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Outcome   string             `bson:"outcome" json:"outcome"` // success or otp_challenge
+	Flags     []string           `bson:"flags,omitempty" json:"flags,omitempty"`
+	// Reviewed is set once an admin has looked at a flagged login
+	Reviewed   bool                `bson:"reviewed" json:"reviewed"`
+	ReviewedBy *primitive.ObjectID `bson:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time          `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// Upload intent statuses
+const (
+	UploadIntentPending   = "pending"
+	UploadIntentCompleted = "completed"
+	UploadIntentRevoked   = "revoked"
+)
+
+// UploadIntent tracks a presigned upload from issue until it is completed or cleaned up
+type UploadIntent struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FileKey     string             `bson:"file_key" json:"file_key"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Kind        string             `bson:"kind" json:"kind"` // video or thumbnail, picks the bucket
+	ContentType string             `bson:"content_type" json:"content_type"`
+	Status      string             `bson:"status" json:"status"` // pending, completed or revoked
+	IssuedAt    time.Time          `bson:"issued_at" json:"issued_at"`
+	CompletedAt *time.Time         `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	RevokedAt   *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// RevenueTotal is the net revenue of completed payments in one currency. Amounts are in
+// the smallest currency unit with refunds already taken off.
+type RevenueTotal struct {
+	Currency string `bson:"currency" json:"currency"`
+	Amount   int64  `bson:"amount" json:"amount"`
+	Payments int64  `bson:"payments" json:"payments"`
+}
+
+// RegionRevenue is the net revenue of a region in one currency
+type RegionRevenue struct {
+	Region   string `bson:"region" json:"region"`
+	Currency string `bson:"currency" json:"currency"`
+	Amount   int64  `bson:"amount" json:"amount"`
+	Payments int64  `bson:"payments" json:"payments"`
+}
+
+// MonthRevenue is the net revenue of a calendar month (YYYY-MM, UTC) in one currency
+type MonthRevenue struct {
+	Month    string `bson:"month" json:"month"`
+	Currency string `bson:"currency" json:"currency"`
+	Amount   int64  `bson:"amount" json:"amount"`
+	Payments int64  `bson:"payments" json:"payments"`
+}
+
+// SubscriptionCounts counts subscriptions by status
+type SubscriptionCounts struct {
+	Active   int64 `json:"active"`
+	Canceled int64 `json:"canceled"`
+	Trial    int64 `json:"trial"`
+}
+
+// RevenueStats is the admin revenue report for a date range. Subscription counts and
+// MRR describe the current state and do not depend on the range. MRR is keyed by
+// currency and uses the subscription amount units.
+type RevenueStats struct {
+	From          time.Time          `json:"from"`
+	To            time.Time          `json:"to"`
+	ByCurrency    []*RevenueTotal    `json:"by_currency"`
+	ByRegion      []*RegionRevenue   `json:"by_region"`
+	ByMonth       []*MonthRevenue    `json:"by_month"`
+	Subscriptions SubscriptionCounts `json:"subscriptions"`
+	MRR           map[string]float64 `json:"mrr"`
+}
+
+// CourseAnalytics is the admin performance report of a course. AverageCompletion is the
+// mean overall progress of the viewers, and Videos is the per-video drop-off in course order.
+type CourseAnalytics struct {
+	CourseID          primitive.ObjectID `json:"course_id"`
+	Enrollments       int64              `json:"enrollments"`
+	UniqueViewers     int                `json:"unique_viewers"`
+	AverageCompletion float64            `json:"average_completion"`
+	Videos            []FunnelStep       `json:"videos"`
+}
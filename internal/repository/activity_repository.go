@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ActivityRepository struct {
+	courseStarts *mongo.Collection
+	watchHistory *mongo.Collection
+	videos       *mongo.Collection
+	enrollments  *mongo.Collection
+	certificates *mongo.Collection
+}
+
+func NewActivityRepository() *ActivityRepository {
+	return &ActivityRepository{
+		courseStarts: database.CourseStarts,
+		watchHistory: database.WatchHistory,
+		videos:       database.Videos,
+		enrollments:  database.Enrollments,
+		certificates: database.Certificates,
+	}
+}
+
+// MarkCourseStarted records that a user started a course. Only the first call
+// for a user and course is recorded, later calls leave the start time unchanged.
+func (r *ActivityRepository) MarkCourseStarted(ctx context.Context, userID, courseID primitive.ObjectID) error {
+	opts := options.Update().SetUpsert(true)
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"started_at": time.Now().UTC(),
+		},
+	}
+
+	_, err := r.courseStarts.UpdateOne(
+		ctx,
+		bson.M{
+			"user_id":   userID,
+			"course_id": courseID,
+		},
+		update,
+		opts,
+	)
+	return err
+}
+
+// ListActivity returns a user's activity feed, newest first, combining watch
+// history, course starts, enrollments and issued certificates into a single timeline.
+// Watched videos the user completed appear as video_completed.
+func (r *ActivityRepository) ListActivity(ctx context.Context, userID primitive.ObjectID, page, limit int64) ([]*models.ActivityEvent, int64, error) {
+	skip := (page - 1) * limit
+
+	// Get total count across all sources, every document is one event
+	var total int64
+	for _, collection := range []*mongo.Collection{r.watchHistory, r.courseStarts, r.enrollments, r.certificates} {
+		count, err := collection.CountDocuments(ctx, bson.M{"user_id": userID})
+		if err != nil {
+			return nil, 0, err
+		}
+		total += count
+	}
+
+	// courseEvents projects the documents of a collection keyed by course as events
+	courseEvents := func(collection *mongo.Collection, eventType, timeField string) bson.M {
+		return bson.M{
+			"$unionWith": bson.M{
+				"coll": collection.Name(),
+				"pipeline": []bson.M{
+					{"$match": bson.M{"user_id": userID}},
+					{
+						"$project": bson.M{
+							"_id":         0,
+							"type":        bson.M{"$literal": eventType},
+							"course_id":   1,
+							"occurred_at": "$" + timeField,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"user_id": userID}},
+		{
+			"$lookup": bson.M{
+				"from":         r.videos.Name(),
+				"localField":   "video_id",
+				"foreignField": "_id",
+				"as":           "video",
+			},
+		},
+		{
+			"$project": bson.M{
+				"_id":         0,
+				"type":        videoCompletedType(),
+				"video_id":    1,
+				"occurred_at": "$last_watched_at",
+			},
+		},
+		courseEvents(r.courseStarts, "course_started", "started_at"),
+		courseEvents(r.enrollments, "course_enrolled", "enrolled_at"),
+		courseEvents(r.certificates, "certificate_issued", "issued_at"),
+		{"$sort": bson.M{"occurred_at": -1}},
+		{"$skip": skip},
+		{"$limit": limit},
+	}
+
+	cursor, err := r.watchHistory.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*models.ActivityEvent{}
+	if err = decodeAll(ctx, cursor, &events); err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// videoCompletedType is the event type of a watch history entry joined with its video,
+// video_completed when the watched seconds complete the video as videoCompleted decides
+func videoCompletedType() bson.M {
+	return bson.M{
+		"$let": bson.M{
+			"vars": bson.M{
+				"duration": bson.M{"$ifNull": bson.A{bson.M{"$first": "$video.duration"}, 0}},
+			},
+			"in": bson.M{
+				"$cond": bson.A{
+					bson.M{"$cond": bson.A{
+						bson.M{"$gt": bson.A{"$$duration", 0}},
+						bson.M{"$gte": bson.A{"$progress_seconds", bson.M{"$multiply": bson.A{"$$duration", videoCompletionThreshold}}}},
+						bson.M{"$gt": bson.A{"$progress_seconds", 0}},
+					}},
+					"video_completed",
+					"video_watched",
+				},
+			},
+		},
+	}
+}
+
+// ListStartedCourses returns the courses a user has started, most recent first
+func (r *ActivityRepository) ListStartedCourses(ctx context.Context, userID primitive.ObjectID) ([]*models.CourseStart, error) {
+	opts := options.Find().SetSort(bson.M{"started_at": -1})
+
+	cursor, err := r.courseStarts.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	starts := []*models.CourseStart{}
+	if err = cursor.All(ctx, &starts); err != nil {
+		return nil, err
+	}
+
+	return starts, nil
+}
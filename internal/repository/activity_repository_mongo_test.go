@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListActivityOrdersMixedEventsByTime(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewActivityRepository()
+
+	userID := primitive.NewObjectID()
+	courseID := primitive.NewObjectID()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+
+	watched := &models.Video{ID: primitive.NewObjectID(), CourseID: courseID, Duration: 100}
+	completed := &models.Video{ID: primitive.NewObjectID(), CourseID: courseID, Duration: 100}
+	for _, video := range []*models.Video{watched, completed} {
+		if _, err := database.Videos.InsertOne(ctx, video); err != nil {
+			t.Fatalf("failed to seed video: %v", err)
+		}
+	}
+
+	seed := []func() error{
+		func() error {
+			_, err := database.Enrollments.InsertOne(ctx, &models.Enrollment{UserID: userID, CourseID: courseID, EnrolledAt: at(0)})
+			return err
+		},
+		func() error {
+			_, err := database.CourseStarts.InsertOne(ctx, &models.CourseStart{UserID: userID, CourseID: courseID, StartedAt: at(1)})
+			return err
+		},
+		func() error {
+			_, err := database.WatchHistory.InsertOne(ctx, &models.WatchHistory{UserID: userID, VideoID: completed.ID, ProgressSeconds: 95, LastWatchedAt: at(2)})
+			return err
+		},
+		func() error {
+			_, err := database.Certificates.InsertOne(ctx, &models.Certificate{UserID: userID, CourseID: courseID, IssuedAt: at(3)})
+			return err
+		},
+		func() error {
+			_, err := database.WatchHistory.InsertOne(ctx, &models.WatchHistory{UserID: userID, VideoID: watched.ID, ProgressSeconds: 10, LastWatchedAt: at(4)})
+			return err
+		},
+		// Another user's activity stays out of the feed
+		func() error {
+			_, err := database.Enrollments.InsertOne(ctx, &models.Enrollment{UserID: primitive.NewObjectID(), CourseID: courseID, EnrolledAt: at(5)})
+			return err
+		},
+	}
+	for _, insert := range seed {
+		if err := insert(); err != nil {
+			t.Fatalf("failed to seed activity: %v", err)
+		}
+	}
+
+	events, total, err := repo.ListActivity(ctx, userID, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to list activity: %v", err)
+	}
+	if total != 5 {
+		t.Fatalf("expected 5 events in total, got %d", total)
+	}
+
+	want := []string{"video_watched", "certificate_issued", "video_completed", "course_started", "course_enrolled"}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for i, event := range events {
+		if event.Type != want[i] || !event.OccurredAt.Equal(at(len(want)-1-i)) {
+			t.Errorf("event %d: expected %s at %v, got %s at %v", i, want[i], at(len(want)-1-i), event.Type, event.OccurredAt)
+		}
+	}
+
+	// Pages continue the same timeline
+	events, _, err = repo.ListActivity(ctx, userID, 2, 2)
+	if err != nil {
+		t.Fatalf("failed to list activity: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != "video_completed" || events[1].Type != "course_started" {
+		t.Fatalf("expected the second page to continue the timeline, got %+v", events)
+	}
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AnalyticsRepository runs read-only aggregations across collections for admin reporting
+type AnalyticsRepository struct {
+	users         *mongo.Collection
+	payments      *mongo.Collection
+	subscriptions *mongo.Collection
+}
+
+func NewAnalyticsRepository() *AnalyticsRepository {
+	return &AnalyticsRepository{
+		users:         database.Users,
+		payments:      database.Payments,
+		subscriptions: database.Subscriptions,
+	}
+}
+
+// SignupsTimeSeries counts users created per interval bucket
+func (r *AnalyticsRepository) SignupsTimeSeries(ctx context.Context, interval string, from, to time.Time) ([]*models.TimeSeriesPoint, error) {
+	return r.timeSeries(ctx, r.users, bson.M{}, "created_at", 1, false, interval, from, to)
+}
+
+// RevenueTimeSeries sums completed payment amounts per interval bucket and currency,
+// amounts in different currencies are never added up
+func (r *AnalyticsRepository) RevenueTimeSeries(ctx context.Context, interval string, from, to time.Time) ([]*models.TimeSeriesPoint, error) {
+	return r.timeSeries(ctx, r.payments, bson.M{"status": "completed"}, "timestamp", "$amount", true, interval, from, to)
+}
+
+// ActiveSubscriptionsTimeSeries counts, for every interval bucket from the one holding from
+// up to to, the subscriptions that were running at some point during the bucket. A
+// subscription runs from its creation until its current period ends, or until it was
+// canceled when it never had a period. Buckets without any are returned with zero.
+func (r *AnalyticsRepository) ActiveSubscriptionsTimeSeries(ctx context.Context, interval string, from, to time.Time) ([]*models.TimeSeriesPoint, error) {
+	filter := bson.M{
+		"created_at": bson.M{"$lt": to},
+		"$or": []bson.M{
+			{"current_period_end": bson.M{"$gt": from}},
+			{"current_period_end": time.Time{}, "canceled_at": bson.M{"$gt": from}},
+			{"current_period_end": time.Time{}, "canceled_at": nil},
+		},
+	}
+	opts := options.Find().SetProjection(bson.M{"created_at": 1, "current_period_end": 1, "canceled_at": 1})
+
+	cursor, err := r.subscriptions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var subscriptions []*models.Subscription
+	if err = cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+
+	return activePerBucket(subscriptions, interval, from, to), nil
+}
+
+// subscriptionEnd is when a subscription stopped running, zero while it has no end
+func subscriptionEnd(subscription *models.Subscription) time.Time {
+	if !subscription.CurrentPeriodEnd.IsZero() {
+		return subscription.CurrentPeriodEnd
+	}
+	if subscription.CanceledAt != nil {
+		return *subscription.CanceledAt
+	}
+	return time.Time{}
+}
+
+// truncateToBucket returns the start of the UTC interval bucket holding t, weeks starting
+// on Sunday like $dateTrunc
+func truncateToBucket(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		return day.AddDate(0, 0, -int(day.Weekday()))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextBucket returns the start of the bucket after the one starting at bucket
+func nextBucket(bucket time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return bucket.AddDate(0, 0, 7)
+	case "month":
+		return bucket.AddDate(0, 1, 0)
+	default:
+		return bucket.AddDate(0, 0, 1)
+	}
+}
+
+// activePerBucket counts the subscriptions whose running span overlaps each bucket
+func activePerBucket(subscriptions []*models.Subscription, interval string, from, to time.Time) []*models.TimeSeriesPoint {
+	points := []*models.TimeSeriesPoint{}
+	for bucket := truncateToBucket(from, interval); bucket.Before(to); bucket = nextBucket(bucket, interval) {
+		next := nextBucket(bucket, interval)
+		point := &models.TimeSeriesPoint{Bucket: bucket}
+		for _, subscription := range subscriptions {
+			end := subscriptionEnd(subscription)
+			if subscription.CreatedAt.Before(next) && (end.IsZero() || end.After(bucket)) {
+				point.Value++
+			}
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+// timeSeries groups the documents matching filter into interval buckets on dateField
+// and sums value (a constant or a field path) for each bucket. byCurrency splits every
+// bucket by the documents' currency field.
+func (r *AnalyticsRepository) timeSeries(ctx context.Context, collection *mongo.Collection, filter bson.M, dateField string, value interface{}, byCurrency bool, interval string, from, to time.Time) ([]*models.TimeSeriesPoint, error) {
+	match := bson.M{dateField: bson.M{"$gte": from, "$lt": to}}
+	for k, v := range filter {
+		match[k] = v
+	}
+
+	group := bson.M{
+		"bucket": bson.M{
+			"$dateTrunc": bson.M{
+				"date":     "$" + dateField,
+				"unit":     interval,
+				"timezone": "UTC",
+			},
+		},
+	}
+	if byCurrency {
+		group["currency"] = "$currency"
+	}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": group, "value": bson.M{"$sum": value}}},
+		{
+			"$project": bson.M{
+				"_id":      0,
+				"bucket":   "$_id.bucket",
+				"currency": "$_id.currency",
+				"value":    1,
+			},
+		},
+		{"$sort": bson.D{{Key: "bucket", Value: 1}, {Key: "currency", Value: 1}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	points := []*models.TimeSeriesPoint{}
+	if err = cursor.All(ctx, &points); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+)
+
+func TestSignupsTimeSeriesByDay(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewAnalyticsRepository()
+
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, createdAt := range []time.Time{
+		day.Add(-time.Hour), // before the range
+		day.Add(9 * time.Hour),
+		day.Add(23 * time.Hour),
+		day.AddDate(0, 0, 2).Add(time.Hour),
+		day.AddDate(0, 0, 3), // the end of the range is excluded
+	} {
+		if _, err := database.Users.InsertOne(ctx, &models.User{Email: createdAt.String(), CreatedAt: createdAt}); err != nil {
+			t.Fatalf("failed to seed user: %v", err)
+		}
+	}
+
+	points, err := repo.SignupsTimeSeries(ctx, "day", day, day.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatalf("failed to get signups: %v", err)
+	}
+
+	want := []struct {
+		bucket time.Time
+		value  float64
+	}{
+		{day, 2},
+		{day.AddDate(0, 0, 2), 1},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("expected %d buckets, got %d", len(want), len(points))
+	}
+	for i, point := range points {
+		if !point.Bucket.Equal(want[i].bucket) || point.Value != want[i].value || point.Currency != "" {
+			t.Errorf("bucket %d: expected %v signups on %v, got %+v", i, want[i].value, want[i].bucket, point)
+		}
+	}
+}
+
+func TestRevenueTimeSeriesSplitsCurrencies(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewAnalyticsRepository()
+
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, payment := range []*models.Payment{
+		{Amount: 1000, Currency: "usd", Status: "completed", Timestamp: day.Add(time.Hour)},
+		{Amount: 500, Currency: "usd", Status: "completed", Timestamp: day.Add(2 * time.Hour)},
+		{Amount: 80000, Currency: "inr", Status: "completed", Timestamp: day.Add(3 * time.Hour)},
+		{Amount: 700, Currency: "usd", Status: "pending", Timestamp: day.Add(4 * time.Hour)},
+	} {
+		if _, err := database.Payments.InsertOne(ctx, payment); err != nil {
+			t.Fatalf("failed to seed payment: %v", err)
+		}
+	}
+
+	points, err := repo.RevenueTimeSeries(ctx, "day", day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("failed to get revenue: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("expected a point per currency, got %d", len(points))
+	}
+	if points[0].Currency != "inr" || points[0].Value != 80000 || points[1].Currency != "usd" || points[1].Value != 1500 {
+		t.Fatalf("expected completed revenue per currency, got %+v and %+v", points[0], points[1])
+	}
+}
+
+func TestActiveSubscriptionsTimeSeriesCountsRunningSpans(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewAnalyticsRepository()
+
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	canceledAt := day.Add(30 * time.Hour)
+	for _, subscription := range []*models.Subscription{
+		// Started long before the range and still running after it
+		{Status: "active", CreatedAt: day.AddDate(0, 0, -40), CurrentPeriodEnd: day.AddDate(0, 0, 10)},
+		// Canceled the day it started, before it had a period
+		{Status: "canceled", CreatedAt: day.Add(28 * time.Hour), CanceledAt: &canceledAt},
+		// Ended before the range
+		{Status: "canceled", CreatedAt: day.AddDate(0, 0, -10), CurrentPeriodEnd: day.Add(-time.Hour)},
+		// Started after the range
+		{Status: "active", CreatedAt: day.AddDate(0, 0, 5), CurrentPeriodEnd: day.AddDate(0, 1, 5)},
+	} {
+		if _, err := database.Subscriptions.InsertOne(ctx, subscription); err != nil {
+			t.Fatalf("failed to seed subscription: %v", err)
+		}
+	}
+
+	points, err := repo.ActiveSubscriptionsTimeSeries(ctx, "day", day, day.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatalf("failed to get active subscriptions: %v", err)
+	}
+
+	want := []float64{1, 2, 1}
+	if len(points) != len(want) {
+		t.Fatalf("expected %d buckets, got %d", len(want), len(points))
+	}
+	for i, point := range points {
+		bucket := day.AddDate(0, 0, i)
+		if !point.Bucket.Equal(bucket) || point.Value != want[i] {
+			t.Errorf("bucket %d: expected %v active on %v, got %+v", i, want[i], bucket, point)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AuditRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditRepository() *AuditRepository {
+	return &AuditRepository{
+		collection: database.AuditLogs,
+	}
+}
+
+// Record stores an audit entry
+func (r *AuditRepository) Record(ctx context.Context, entry *models.AuditLog) error {
+	entry.CreatedAt = time.Now().UTC()
+
+	result, err := r.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrCategoryNameExists is returned when a category with the same name already exists
+var ErrCategoryNameExists = errors.New("category with this name already exists")
+
+type CategoryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewCategoryRepository() *CategoryRepository {
+	return &CategoryRepository{
+		collection: database.Categories,
+	}
+}
+
+// Create creates a new category
+func (r *CategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	now := versionTimestamp()
+	category.CreatedAt = now
+	category.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, category)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrCategoryNameExists
+		}
+		return err
+	}
+
+	category.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByID finds a category by ID
+func (r *CategoryRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Category, error) {
+	var category models.Category
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&category)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// List returns every category sorted by name
+func (r *CategoryRepository) List(ctx context.Context) ([]*models.Category, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	categories := []*models.Category{}
+	if err = decodeAll(ctx, cursor, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// Update updates the name and description of a category. It returns ErrStaleUpdate when
+// the category changed since it was read.
+func (r *CategoryRepository) Update(ctx context.Context, category *models.Category) error {
+	previous := category.UpdatedAt
+	category.UpdatedAt = versionTimestamp()
+
+	update := bson.M{
+		"$set": bson.M{
+			"name":        category.Name,
+			"description": category.Description,
+			"updated_at":  category.UpdatedAt,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, unmodifiedSince(bson.M{"_id": category.ID}, previous), update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrCategoryNameExists
+		}
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrStaleUpdate
+	}
+	return nil
+}
+
+// Delete deletes a category
+func (r *CategoryRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CertificateRepository struct {
+	collection *mongo.Collection
+}
+
+func NewCertificateRepository() *CertificateRepository {
+	return &CertificateRepository{
+		collection: database.Certificates,
+	}
+}
+
+// GetByUserAndCourse finds the certificate a user was issued for a course
+func (r *CertificateRepository) GetByUserAndCourse(ctx context.Context, userID, courseID primitive.ObjectID) (*models.Certificate, error) {
+	var certificate models.Certificate
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "course_id": courseID}).Decode(&certificate)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// EachByUser passes every certificate issued to a user to fn, newest first, one at a time
+func (r *CertificateRepository) EachByUser(ctx context.Context, userID primitive.ObjectID, fn func(*models.Certificate) error) error {
+	opts := options.Find().SetSort(bson.M{"issued_at": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	return eachDecoded(ctx, cursor, fn)
+}
+
+// Issue stores a certificate for the user and course unless one was already issued, and
+// returns the stored certificate. Concurrent requests end up with the same certificate.
+func (r *CertificateRepository) Issue(ctx context.Context, certificate *models.Certificate) (*models.Certificate, error) {
+	var issued models.Certificate
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": certificate.UserID, "course_id": certificate.CourseID},
+		bson.M{"$setOnInsert": bson.M{
+			"recipient_name": certificate.RecipientName,
+			"course_title":   certificate.CourseTitle,
+			"issued_at":      time.Now().UTC(),
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&issued)
+	if err != nil {
+		return nil, err
+	}
+	return &issued, nil
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrStaleUpdate is returned by an Update when the document changed, or was deleted,
+// since it was read
+var ErrStaleUpdate = errors.New("document was modified since it was read")
+
+// unmodifiedSince restricts filter to the version of a document whose updated_at was read.
+// Documents stored without updated_at are read as the zero time and matched as such.
+func unmodifiedSince(filter bson.M, updatedAt time.Time) bson.M {
+	if updatedAt.IsZero() {
+		filter["updated_at"] = bson.M{"$in": bson.A{nil, updatedAt}}
+	} else {
+		filter["updated_at"] = updatedAt
+	}
+	return filter
+}
+
+// versionTimestamp returns the current time at the millisecond precision BSON dates are
+// stored with, so the updated_at handed back to clients matches the stored one exactly
+func versionTimestamp() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
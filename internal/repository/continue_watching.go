@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListContinueWatching returns the courses a user watched, most recently watched first,
+// each with the video to resume. Watch history is joined to courses through their video
+// order, so videos removed from a course or deleted no longer count towards it.
+func (r *CourseRepository) ListContinueWatching(ctx context.Context, userID primitive.ObjectID, page, limit int64) ([]*models.ContinueWatching, int64, error) {
+	pageStages := []bson.M{{"$skip": (page - 1) * limit}}
+	if limit > 0 {
+		pageStages = append(pageStages, bson.M{"$limit": limit})
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"user_id": userID}},
+		{
+			"$lookup": bson.M{
+				"from":         r.collection.Name(),
+				"localField":   "video_id",
+				"foreignField": "video_order",
+				"as":           "course",
+			},
+		},
+		{"$unwind": "$course"},
+		{"$match": bson.M{"course.deleted_at": nil}},
+		{
+			"$group": bson.M{
+				"_id":             "$course._id",
+				"last_watched_at": bson.M{"$max": "$last_watched_at"},
+			},
+		},
+		{"$sort": bson.D{{Key: "last_watched_at", Value: -1}, {Key: "_id", Value: 1}}},
+		{
+			"$facet": bson.M{
+				"total": []bson.M{{"$count": "count"}},
+				"page":  pageStages,
+			},
+		},
+	}
+
+	cursor, err := database.WatchHistory.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var facets []struct {
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		Page []struct {
+			CourseID      primitive.ObjectID `bson:"_id"`
+			LastWatchedAt time.Time          `bson:"last_watched_at"`
+		} `bson:"page"`
+	}
+	if err = cursor.All(ctx, &facets); err != nil {
+		return nil, 0, err
+	}
+	if len(facets) == 0 || len(facets[0].Total) == 0 {
+		return []*models.ContinueWatching{}, 0, nil
+	}
+	total := facets[0].Total[0].Count
+
+	courseIDs := make([]primitive.ObjectID, 0, len(facets[0].Page))
+	for _, row := range facets[0].Page {
+		courseIDs = append(courseIDs, row.CourseID)
+	}
+	courses, err := r.GetByIDs(ctx, courseIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var videoIDs []primitive.ObjectID
+	for _, course := range courses {
+		videoIDs = append(videoIDs, course.VideoOrder...)
+	}
+	videos, history, err := r.watchState(ctx, userID, videoIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	byID := make(map[primitive.ObjectID]*models.Course, len(courses))
+	for _, course := range courses {
+		byID[course.ID] = course
+	}
+	entries := make([]*models.ContinueWatching, 0, len(courseIDs))
+	for _, row := range facets[0].Page {
+		// A course deleted since the aggregation ran is left out of the page
+		course, ok := byID[row.CourseID]
+		if !ok {
+			continue
+		}
+		entry := computeContinueWatching(course, videos, history)
+		entry.LastWatchedAt = row.LastWatchedAt
+		entries = append(entries, entry)
+	}
+
+	return entries, total, nil
+}
+
+// watchState loads the given videos and the user's watch history for them, both keyed by video ID
+func (r *CourseRepository) watchState(ctx context.Context, userID primitive.ObjectID, videoIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.Video, map[primitive.ObjectID]*models.WatchHistory, error) {
+	videos := make(map[primitive.ObjectID]*models.Video, len(videoIDs))
+	history := make(map[primitive.ObjectID]*models.WatchHistory, len(videoIDs))
+	if len(videoIDs) == 0 {
+		return videos, history, nil
+	}
+
+	videoCursor, err := database.Videos.Find(ctx, bson.M{"_id": bson.M{"$in": videoIDs}})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer videoCursor.Close(ctx)
+
+	var videoList []*models.Video
+	if err = decodeAll(ctx, videoCursor, &videoList); err != nil {
+		return nil, nil, err
+	}
+	for _, video := range videoList {
+		videos[video.ID] = video
+	}
+
+	historyCursor, err := database.WatchHistory.Find(ctx, bson.M{
+		"user_id":  userID,
+		"video_id": bson.M{"$in": videoIDs},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer historyCursor.Close(ctx)
+
+	var historyList []*models.WatchHistory
+	if err = decodeAll(ctx, historyCursor, &historyList); err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range historyList {
+		history[entry.VideoID] = entry
+	}
+
+	return videos, history, nil
+}
+
+// computeContinueWatching picks the video to resume in a course. Starting from the most
+// recently watched video still in the course, it takes the first video in course order
+// that is not completed, wrapping around to the start of the course. Videos that no
+// longer exist are skipped. The course is completed when no such video is left.
+func computeContinueWatching(course *models.Course, videos map[primitive.ObjectID]*models.Video, history map[primitive.ObjectID]*models.WatchHistory) *models.ContinueWatching {
+	entry := &models.ContinueWatching{Course: course, Completed: true}
+
+	order := make([]*models.Video, 0, len(course.VideoOrder))
+	start := 0
+	var latest time.Time
+	for _, videoID := range course.VideoOrder {
+		video, ok := videos[videoID]
+		if !ok {
+			continue
+		}
+		if h, ok := history[videoID]; ok && h.LastWatchedAt.After(latest) {
+			latest = h.LastWatchedAt
+			start = len(order)
+		}
+		order = append(order, video)
+	}
+
+	for i := range order {
+		video := order[(start+i)%len(order)]
+		var watched int
+		if h, ok := history[video.ID]; ok {
+			watched = h.ProgressSeconds
+		}
+		if videoCompleted(video, watched) {
+			continue
+		}
+
+		entry.Video = video
+		entry.ResumeSeconds = watched
+		entry.Completed = false
+		break
+	}
+
+	return entry
+}
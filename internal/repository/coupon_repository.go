@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrCouponCodeExists is returned when a coupon with the same code already exists
+var ErrCouponCodeExists = errors.New("coupon with this code already exists")
+
+type CouponRepository struct {
+	collection *mongo.Collection
+}
+
+func NewCouponRepository() *CouponRepository {
+	return &CouponRepository{
+		collection: database.Coupons,
+	}
+}
+
+// Create creates a new coupon
+func (r *CouponRepository) Create(ctx context.Context, coupon *models.Coupon) error {
+	now := time.Now().UTC()
+	coupon.CreatedAt = now
+	coupon.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, coupon)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrCouponCodeExists
+		}
+		return err
+	}
+
+	coupon.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByID finds a coupon by ID
+func (r *CouponRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Coupon, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+// GetByCode finds a coupon by its code
+func (r *CouponRepository) GetByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	return r.findOne(ctx, bson.M{"code": code})
+}
+
+func (r *CouponRepository) findOne(ctx context.Context, filter bson.M) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := r.collection.FindOne(ctx, filter).Decode(&coupon)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// List returns coupons with pagination, newest first
+func (r *CouponRepository) List(ctx context.Context, page, limit int64) ([]*models.Coupon, int64, error) {
+	total, err := r.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.M{"created_at": -1})
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	coupons := []*models.Coupon{}
+	if err = decodeAll(ctx, cursor, &coupons); err != nil {
+		return nil, 0, err
+	}
+
+	return coupons, total, nil
+}
+
+// Update updates a coupon. The redemption count is left untouched.
+func (r *CouponRepository) Update(ctx context.Context, coupon *models.Coupon) error {
+	coupon.UpdatedAt = time.Now().UTC()
+
+	update := bson.M{
+		"$set": bson.M{
+			"code":             coupon.Code,
+			"percent_off":      coupon.PercentOff,
+			"amount_off":       coupon.AmountOff,
+			"currency":         coupon.Currency,
+			"max_redemptions":  coupon.MaxRedemptions,
+			"expires_at":       coupon.ExpiresAt,
+			"stripe_coupon_id": coupon.StripeCouponID,
+			"updated_at":       coupon.UpdatedAt,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": coupon.ID}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrCouponCodeExists
+	}
+	return err
+}
+
+// SetStripeCouponID stores the Stripe coupon created for a coupon
+func (r *CouponRepository) SetStripeCouponID(ctx context.Context, id primitive.ObjectID, stripeCouponID string) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"stripe_coupon_id": stripeCouponID}},
+	)
+	return err
+}
+
+// IncrementRedemptions counts a completed checkout that used the coupon
+func (r *CouponRepository) IncrementRedemptions(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"times_redeemed": 1}},
+	)
+	return err
+}
+
+// Delete deletes a coupon
+func (r *CouponRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"math"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetCourseAnalytics returns the enrollments, unique viewers, average completion and
+// per-video drop-off of a course. A course without any activity reports zeros.
+// Returns ErrCourseNotFound when the course does not exist.
+func (r *CourseRepository) GetCourseAnalytics(ctx context.Context, courseID primitive.ObjectID) (*models.CourseAnalytics, error) {
+	videos, err := r.GetVideosInOrder(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollments, err := database.Enrollments.CountDocuments(ctx, bson.M{"course_id": courseID})
+	if err != nil {
+		return nil, err
+	}
+
+	viewers, err := viewerProgress(ctx, videos)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics := computeCourseAnalytics(courseID, videos, viewers)
+	analytics.Enrollments = enrollments
+	return analytics, nil
+}
+
+// computeCourseAnalytics builds the viewer side of the course analytics from the seconds
+// each viewer watched per video. Completion uses the same rules as course progress and
+// is rounded to two decimals.
+func computeCourseAnalytics(courseID primitive.ObjectID, videos []*models.Video, viewers map[primitive.ObjectID]map[primitive.ObjectID]int) *models.CourseAnalytics {
+	analytics := &models.CourseAnalytics{
+		CourseID:      courseID,
+		UniqueViewers: len(viewers),
+		Videos:        computeCompletionFunnel(courseID, videos, secondsPerVideo(viewers)).Steps,
+	}
+
+	if len(viewers) == 0 {
+		return analytics
+	}
+
+	var percentSum float64
+	for _, progress := range viewers {
+		percentSum += computeCourseProgress(courseID, videos, progress).OverallPercent
+	}
+	analytics.AverageCompletion = math.Round(percentSum/float64(len(viewers))*100) / 100
+
+	return analytics
+}
@@ -15,6 +15,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrCourseNotFound is returned when an operation targets a course that does not exist
+var ErrCourseNotFound = errors.New("course not found")
+
 type CourseRepository struct {
 	collection *mongo.Collection
 	videoRepo  *VideoRepository
@@ -29,8 +32,8 @@ func NewCourseRepository(videoRepo *VideoRepository) *CourseRepository {
 
 // Create creates a new course
 func (r *CourseRepository) Create(ctx context.Context, course *models.Course) error {
-	course.CreatedAt = time.Now()
-	course.UpdatedAt = time.Now()
+	course.CreatedAt = versionTimestamp()
+	course.UpdatedAt = course.CreatedAt
 	course.VideoOrder = []primitive.ObjectID{} // Initialize empty video order
 
 	result, err := r.collection.InsertOne(ctx, course)
@@ -42,10 +45,10 @@ func (r *CourseRepository) Create(ctx context.Context, course *models.Course) er
 	return nil
 }
 
-// GetByID finds a course by ID
+// GetByID finds a course by ID, soft deleted courses are not found
 func (r *CourseRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Course, error) {
 	var course models.Course
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&course)
+	err := r.collection.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&course)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
@@ -55,12 +58,87 @@ func (r *CourseRepository) GetByID(ctx context.Context, id primitive.ObjectID) (
 	return &course, nil
 }
 
+// GetByIDs finds the courses with the given IDs. Missing and soft deleted courses are skipped.
+func (r *CourseRepository) GetByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*models.Course, error) {
+	if len(ids) == 0 {
+		return []*models.Course{}, nil
+	}
+
+	cursor, err := r.collection.Find(ctx, notDeleted(bson.M{"_id": bson.M{"$in": ids}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	courses := []*models.Course{}
+	if err = decodeAll(ctx, cursor, &courses); err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+// ListByVideo returns every course whose video order contains the video, excluding soft deleted courses
+func (r *CourseRepository) ListByVideo(ctx context.Context, videoID primitive.ObjectID) ([]*models.Course, error) {
+	cursor, err := r.collection.Find(ctx, notDeleted(bson.M{"video_order": videoID}), options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	courses := []*models.Course{}
+	if err = decodeAll(ctx, cursor, &courses); err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+// ListNotReadyVideos returns the videos of a course that are still processing or failed
+func (r *CourseRepository) ListNotReadyVideos(ctx context.Context, courseID primitive.ObjectID) ([]*models.Video, error) {
+	return r.videoRepo.ListNotReadyByCourse(ctx, courseID)
+}
+
+// CourseFilter narrows the courses returned by List. The zero value matches every
+// course that is not soft deleted.
+type CourseFilter struct {
+	// Search is a full-text query over title, subtitle and description
+	Search string
+	// Skills matches courses teaching any of the given skills
+	Skills []string
+	// IsPaid matches only paid or only free courses when set
+	IsPaid *bool
+	// CategoryID matches only the courses in the category when set
+	CategoryID *primitive.ObjectID
+	// IncludeDeleted also matches soft deleted courses
+	IncludeDeleted bool
+}
+
+// query builds the Mongo criteria for the filter
+func (f CourseFilter) query() bson.M {
+	query := bson.M{}
+	if f.Search != "" {
+		query["$text"] = bson.M{"$search": f.Search}
+	}
+	if len(f.Skills) > 0 {
+		query["skills"] = bson.M{"$in": f.Skills}
+	}
+	if f.IsPaid != nil {
+		query["is_paid"] = *f.IsPaid
+	}
+	if f.CategoryID != nil {
+		query["category_id"] = *f.CategoryID
+	}
+	if !f.IncludeDeleted {
+		notDeleted(query)
+	}
+	return query
+}
+
 // List returns a list of courses with pagination
-func (r *CourseRepository) List(ctx context.Context, page, limit int64, public bool) ([]*models.Course, int64, error) {
+func (r *CourseRepository) List(ctx context.Context, page, limit int64, public bool, courseFilter CourseFilter) ([]*models.Course, int64, error) {
 	skip := (page - 1) * limit
 
 	// Get total count
-	total, err := r.collection.CountDocuments(ctx, bson.M{})
+	total, err := r.collection.CountDocuments(ctx, courseFilter.query())
 	if err != nil {
 		return nil, 0, err
 	}
@@ -71,9 +149,9 @@ func (r *CourseRepository) List(ctx context.Context, page, limit int64, public b
 		SetLimit(limit).
 		SetSort(bson.M{"created_at": -1})
 
-	filter := bson.M{}
+	filter := courseFilter.query()
 	if public {
-		filter = bson.M{"is_public": true}
+		filter["is_public"] = true
 	}
 
 	cursor, err := r.collection.Find(ctx, filter, opts)
@@ -83,88 +161,287 @@ func (r *CourseRepository) List(ctx context.Context, page, limit int64, public b
 	defer cursor.Close(ctx)
 
 	var courses []*models.Course
-	if err = cursor.All(ctx, &courses); err != nil {
+	if err = decodeAll(ctx, cursor, &courses); err != nil {
 		return nil, 0, err
 	}
 
 	return courses, total, nil
 }
 
-// Update updates a course
-func (r *CourseRepository) Update(ctx context.Context, course *models.Course) error {
-	course.UpdatedAt = time.Now()
+// ListIDs returns the IDs of every course matching the filter, without pagination
+func (r *CourseRepository) ListIDs(ctx context.Context, public bool, courseFilter CourseFilter) ([]primitive.ObjectID, error) {
+	filter := courseFilter.query()
+	if public {
+		filter["is_public"] = true
+	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"title":         course.Title,
-			"subtitle":      course.SubTitle,
-			"description":   course.Description,
-			"thumbnail_url": course.ThumbnailURL,
-			"video_order":   course.VideoOrder,
-			"is_paid":       course.IsPaid,
-			"is_public":     course.IsPublic,
-			"skills":        course.Skills,
-			"author":        course.Author,
-			"updated_at":    course.UpdatedAt,
-		},
+	values, err := r.collection.Distinct(ctx, "_id", filter)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := r.collection.UpdateOne(
-		ctx,
-		bson.M{"_id": course.ID},
-		update,
-	)
-	return err
+	courseIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			courseIDs = append(courseIDs, id)
+		}
+	}
+	return courseIDs, nil
+}
+
+// PartialUpdate sets only the given fields of a course, keyed by their stored names, and
+// returns the updated course. updatedAt is the version the fields were computed from,
+// ErrStaleUpdate is returned when the course changed or was deleted since.
+func (r *CourseRepository) PartialUpdate(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields map[string]interface{}) (*models.Course, error) {
+	set := bson.M{"updated_at": versionTimestamp()}
+	for key, value := range fields {
+		set[key] = value
+	}
+
+	var course models.Course
+	err := r.collection.FindOneAndUpdate(ctx,
+		notDeleted(unmodifiedSince(bson.M{"_id": id}, updatedAt)),
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&course)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrStaleUpdate
+		}
+		return nil, err
+	}
+	return &course, nil
 }
 
-// Delete deletes a course
+// Delete soft deletes a course. Its videos are kept so the course can be restored.
+// ErrCourseNotFound is returned when the course does not exist or is already deleted.
 func (r *CourseRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
-	return err
+	now := time.Now().UTC()
+	result, err := r.collection.UpdateOne(ctx,
+		notDeleted(bson.M{"_id": id}),
+		bson.M{"$set": bson.M{"deleted_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCourseNotFound
+	}
+	return nil
 }
 
-// AddVideoToCourse adds a video to a course at a specific position
+// Restore undoes a soft delete. ErrCourseNotFound is returned when no deleted course has the ID.
+func (r *CourseRepository) Restore(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.UpdateOne(ctx,
+		isDeleted(bson.M{"_id": id}),
+		bson.M{
+			"$set":   bson.M{"updated_at": time.Now().UTC()},
+			"$unset": bson.M{"deleted_at": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCourseNotFound
+	}
+	return nil
+}
+
+// ListDeletedBefore returns the IDs of courses soft deleted at or before cutoff
+func (r *CourseRepository) ListDeletedBefore(ctx context.Context, cutoff time.Time) ([]primitive.ObjectID, error) {
+	return listDeletedBefore(ctx, r.collection, cutoff)
+}
+
+// DeletedCourseMedia lists the S3 keys left behind by a deleted course. Video files
+// and thumbnails live in separate buckets so they are kept apart.
+type DeletedCourseMedia struct {
+	VideosRemoved int64
+	VideoKeys     []string
+	ThumbnailKeys []string
+}
+
+// HardDelete permanently deletes a course, whether or not it is soft deleted, together
+// with its videos and their watch history in a single transaction. It returns the S3
+// keys of the removed videos so the caller can delete the files.
+func (r *CourseRepository) HardDelete(ctx context.Context, courseID primitive.ObjectID) (*DeletedCourseMedia, error) {
+	var media *DeletedCourseMedia
+	err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		media = &DeletedCourseMedia{}
+
+		result, err := r.collection.DeleteOne(sessCtx, bson.M{"_id": courseID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return ErrCourseNotFound
+		}
+
+		cursor, err := database.Videos.Find(sessCtx, bson.M{"course_id": courseID})
+		if err != nil {
+			return err
+		}
+		var videos []*models.Video
+		if err := cursor.All(sessCtx, &videos); err != nil {
+			return err
+		}
+		if len(videos) == 0 {
+			return nil
+		}
+
+		videoIDs := make([]primitive.ObjectID, len(videos))
+		for i, video := range videos {
+			videoIDs[i] = video.ID
+			if video.URL != "" {
+				media.VideoKeys = append(media.VideoKeys, video.URL)
+			}
+			if video.Thumbnail != "" {
+				media.ThumbnailKeys = append(media.ThumbnailKeys, video.Thumbnail)
+			}
+		}
+
+		if _, err := database.WatchHistory.DeleteMany(sessCtx, bson.M{"video_id": bson.M{"$in": videoIDs}}); err != nil {
+			return err
+		}
+
+		deleted, err := database.Videos.DeleteMany(sessCtx, bson.M{"course_id": courseID})
+		if err != nil {
+			return err
+		}
+		media.VideosRemoved = deleted.DeletedCount
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// ErrInvalidVideoPosition is returned when a video is inserted past the end of a course's video order
+var ErrInvalidVideoPosition = errors.New("invalid position")
+
+// AddVideoToCourse adds a video to a course at a specific position. The insert is a single
+// $push so concurrent adds never overwrite each other, and the position is checked against
+// the stored order in the same update. Returns ErrCourseNotFound when the course does not
+// exist and ErrInvalidVideoPosition when the position is out of range.
 func (r *CourseRepository) AddVideoToCourse(ctx context.Context, courseID primitive.ObjectID, videoID primitive.ObjectID, position int) error {
-	// Get the course first
+	if position < 0 {
+		return ErrInvalidVideoPosition
+	}
+
+	filter := notDeleted(bson.M{
+		"_id": courseID,
+		"$expr": bson.M{"$lte": bson.A{
+			position,
+			bson.M{"$size": bson.M{"$ifNull": bson.A{"$video_order", bson.A{}}}},
+		}},
+	})
+	update := bson.M{
+		"$push": bson.M{"video_order": bson.M{
+			"$each":     bson.A{videoID},
+			"$position": position,
+		}},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// Nothing matched, either the course is gone or the position is past the end
 	course, err := r.GetByID(ctx, courseID)
 	if err != nil {
 		return err
 	}
 	if course == nil {
-		return errors.New("course not found")
+		return ErrCourseNotFound
 	}
+	return ErrInvalidVideoPosition
+}
 
-	// Get current video order
-	currentOrder := course.VideoOrder
+// AddVideosToCourse appends videos to the end of a course's video order and returns
+// the position of the first one. Returns ErrCourseNotFound when the course does not exist.
+func (r *CourseRepository) AddVideosToCourse(ctx context.Context, courseID primitive.ObjectID, videoIDs []primitive.ObjectID) (int, error) {
+	update := bson.M{
+		"$push": bson.M{"video_order": bson.M{"$each": videoIDs}},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
-	// Validate position
-	if position < 0 || position > len(currentOrder) {
-		return errors.New("invalid position")
+	var course models.Course
+	err := r.collection.FindOneAndUpdate(ctx, notDeleted(bson.M{"_id": courseID}), update, opts).Decode(&course)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrCourseNotFound
+		}
+		return 0, err
 	}
 
-	// Create new order array with the video inserted at the specified position
-	newOrder := make([]primitive.ObjectID, len(currentOrder)+1)
-	copy(newOrder[:position], currentOrder[:position])
-	newOrder[position] = videoID
-	copy(newOrder[position+1:], currentOrder[position:])
+	return len(course.VideoOrder) - len(videoIDs), nil
+}
 
-	// Update the course's video order
-	update := bson.M{
-		"$set": bson.M{
-			"video_order": newOrder,
-			"updated_at":  time.Now(),
-		},
+// CreateVideosInCourse creates videos and appends them to a course's video order in a
+// single transaction, returning the position of the first video. Nothing is stored
+// when any step fails.
+func (r *CourseRepository) CreateVideosInCourse(ctx context.Context, courseID primitive.ObjectID, videos []*models.Video) (int, error) {
+	var start int
+	err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if err := r.videoRepo.CreateMany(sessCtx, videos); err != nil {
+			return err
+		}
+
+		videoIDs := make([]primitive.ObjectID, len(videos))
+		for i, video := range videos {
+			videoIDs[i] = video.ID
+		}
+
+		var err error
+		start, err = r.AddVideosToCourse(sessCtx, courseID, videoIDs)
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
+	return start, nil
+}
 
-	_, err = r.collection.UpdateOne(
-		ctx,
-		bson.M{"_id": courseID},
-		update,
-	)
+// CreateVideoInCourse creates a video and appends it to the video order of its course
+// in a single transaction. Returns ErrCourseNotFound, with nothing stored, when the
+// course does not exist.
+func (r *CourseRepository) CreateVideoInCourse(ctx context.Context, video *models.Video) error {
+	_, err := r.CreateVideosInCourse(ctx, video.CourseID, []*models.Video{video})
 	return err
 }
 
-// ReorderVideos reorders videos within a course
+// UpdateVideoInCourse stores an edited video and, when its course changed from
+// fromCourseID, removes it from the old course's video order and appends it to the new
+// one, all in a single transaction. Returns ErrCourseNotFound, with nothing stored,
+// when the new course does not exist.
+func (r *CourseRepository) UpdateVideoInCourse(ctx context.Context, video *models.Video, fromCourseID primitive.ObjectID) error {
+	return database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if video.CourseID != fromCourseID {
+			// The old course may already be deleted, so a missing one is not an error
+			pull := bson.M{
+				"$pull": bson.M{"video_order": video.ID},
+				"$set":  bson.M{"updated_at": time.Now().UTC()},
+			}
+			if _, err := r.collection.UpdateOne(sessCtx, bson.M{"_id": fromCourseID}, pull); err != nil {
+				return err
+			}
+			if _, err := r.AddVideosToCourse(sessCtx, video.CourseID, []primitive.ObjectID{video.ID}); err != nil {
+				return err
+			}
+		}
+		return r.videoRepo.Update(sessCtx, video)
+	})
+}
+
+// ReorderVideos reorders videos within a course. The new order is validated against the
+// stored one and then written whole, so concurrent reorders are last-write-wins.
 func (r *CourseRepository) ReorderVideos(ctx context.Context, courseID primitive.ObjectID, newOrder []primitive.ObjectID) error {
 	// Get the course first
 	course, err := r.GetByID(ctx, courseID)
@@ -172,7 +449,7 @@ func (r *CourseRepository) ReorderVideos(ctx context.Context, courseID primitive
 		return err
 	}
 	if course == nil {
-		return errors.New("course not found")
+		return ErrCourseNotFound
 	}
 
 	// Validate that all videos in new order exist in the course
@@ -192,7 +469,7 @@ func (r *CourseRepository) ReorderVideos(ctx context.Context, courseID primitive
 	update := bson.M{
 		"$set": bson.M{
 			"video_order": newOrder,
-			"updated_at":  time.Now(),
+			"updated_at":  time.Now().UTC(),
 		},
 	}
 
@@ -212,7 +489,7 @@ func (r *CourseRepository) RemoveVideoFromCourse(ctx context.Context, courseID p
 		return err
 	}
 	if course == nil {
-		return errors.New("course not found")
+		return ErrCourseNotFound
 	}
 
 	// Create new order array without the specified video
@@ -236,7 +513,7 @@ func (r *CourseRepository) RemoveVideoFromCourse(ctx context.Context, courseID p
 	update := bson.M{
 		"$set": bson.M{
 			"video_order": newOrder,
-			"updated_at":  time.Now(),
+			"updated_at":  time.Now().UTC(),
 		},
 	}
 
@@ -256,7 +533,7 @@ func (r *CourseRepository) GetVideosInOrder(ctx context.Context, courseID primit
 		return nil, err
 	}
 	if course == nil {
-		return nil, errors.New("course not found")
+		return nil, ErrCourseNotFound
 	}
 
 	// Get video order
@@ -280,3 +557,237 @@ func (r *CourseRepository) GetVideosInOrder(ctx context.Context, courseID primit
 
 	return videos, nil
 }
+
+// videoCompletionThreshold is the share of a video that must be watched for it to count as completed
+const videoCompletionThreshold = 0.9
+
+// videoCompleted reports whether watched seconds complete a video. A video with no
+// duration counts as completed once it has been watched at all.
+func videoCompleted(video *models.Video, watched int) bool {
+	if video.Duration > 0 {
+		return float64(watched) >= float64(video.Duration)*videoCompletionThreshold
+	}
+	return watched > 0
+}
+
+// GetCourseProgress returns a user's watch progress through every video of a course
+func (r *CourseRepository) GetCourseProgress(ctx context.Context, userID, courseID primitive.ObjectID) (*models.CourseProgress, error) {
+	videos, err := r.GetVideosInOrder(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	videoIDs := make([]primitive.ObjectID, 0, len(videos))
+	for _, video := range videos {
+		videoIDs = append(videoIDs, video.ID)
+	}
+
+	progress := make(map[primitive.ObjectID]int, len(videos))
+	if len(videoIDs) > 0 {
+		cursor, err := database.WatchHistory.Find(ctx, bson.M{
+			"user_id":  userID,
+			"video_id": bson.M{"$in": videoIDs},
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var history []*models.WatchHistory
+		if err = decodeAll(ctx, cursor, &history); err != nil {
+			return nil, err
+		}
+		for _, entry := range history {
+			progress[entry.VideoID] += entry.ProgressSeconds
+		}
+	}
+
+	return computeCourseProgress(courseID, videos, progress), nil
+}
+
+// computeCourseProgress builds the progress of a course from the seconds watched per video.
+// Videos without history count as 0%. A video with no duration counts as completed once
+// it has been watched at all. The overall percentage is weighted by duration, falling
+// back to a plain average when no video has a duration.
+func computeCourseProgress(courseID primitive.ObjectID, videos []*models.Video, progress map[primitive.ObjectID]int) *models.CourseProgress {
+	result := &models.CourseProgress{
+		CourseID:    courseID,
+		Videos:      make(map[string]models.VideoProgress, len(videos)),
+		TotalVideos: len(videos),
+	}
+
+	var watchedSeconds, totalSeconds int
+	var percentSum float64
+	for _, video := range videos {
+		watched := progress[video.ID]
+		vp := models.VideoProgress{
+			ProgressSeconds: watched,
+			Duration:        video.Duration,
+		}
+
+		vp.Completed = videoCompleted(video, watched)
+		if video.Duration > 0 {
+			capped := min(watched, video.Duration)
+			vp.Percent = float64(capped) / float64(video.Duration) * 100
+			watchedSeconds += capped
+			totalSeconds += video.Duration
+		} else if watched > 0 {
+			vp.Percent = 100
+		}
+
+		if vp.Completed {
+			result.CompletedVideos++
+		}
+		percentSum += vp.Percent
+		result.Videos[video.ID.Hex()] = vp
+	}
+
+	switch {
+	case totalSeconds > 0:
+		result.OverallPercent = float64(watchedSeconds) / float64(totalSeconds) * 100
+	case len(videos) > 0:
+		result.OverallPercent = percentSum / float64(len(videos))
+	}
+
+	return result
+}
+
+// GetCompletionFunnel returns, for every video of a course in order, how many users
+// started and completed it. Returns ErrCourseNotFound when the course does not exist.
+func (r *CourseRepository) GetCompletionFunnel(ctx context.Context, courseID primitive.ObjectID) (*models.CourseFunnel, error) {
+	videos, err := r.GetVideosInOrder(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	viewers, err := viewerProgress(ctx, videos)
+	if err != nil {
+		return nil, err
+	}
+
+	return computeCompletionFunnel(courseID, videos, secondsPerVideo(viewers)), nil
+}
+
+// viewerProgress returns the seconds each viewer watched of the given videos, keyed by
+// user and then video. A user may have several history entries for a video, they are summed.
+func viewerProgress(ctx context.Context, videos []*models.Video) (map[primitive.ObjectID]map[primitive.ObjectID]int, error) {
+	viewers := make(map[primitive.ObjectID]map[primitive.ObjectID]int)
+	if len(videos) == 0 {
+		return viewers, nil
+	}
+
+	videoIDs := make([]primitive.ObjectID, 0, len(videos))
+	for _, video := range videos {
+		videoIDs = append(videoIDs, video.ID)
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"video_id": bson.M{"$in": videoIDs}}},
+		{
+			"$group": bson.M{
+				"_id":     bson.M{"video_id": "$video_id", "user_id": "$user_id"},
+				"seconds": bson.M{"$sum": "$progress_seconds"},
+			},
+		},
+	}
+
+	cursor, err := database.WatchHistory.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID struct {
+			VideoID primitive.ObjectID `bson:"video_id"`
+			UserID  primitive.ObjectID `bson:"user_id"`
+		} `bson:"_id"`
+		Seconds int `bson:"seconds"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		progress, ok := viewers[row.ID.UserID]
+		if !ok {
+			progress = make(map[primitive.ObjectID]int)
+			viewers[row.ID.UserID] = progress
+		}
+		progress[row.ID.VideoID] = row.Seconds
+	}
+	return viewers, nil
+}
+
+// secondsPerVideo regroups viewer progress into the seconds each viewer watched per video
+func secondsPerVideo(viewers map[primitive.ObjectID]map[primitive.ObjectID]int) map[primitive.ObjectID][]int {
+	watched := make(map[primitive.ObjectID][]int)
+	for _, progress := range viewers {
+		for videoID, seconds := range progress {
+			watched[videoID] = append(watched[videoID], seconds)
+		}
+	}
+	return watched
+}
+
+// computeCompletionFunnel builds the funnel of a course from the seconds each viewer
+// watched per video. Any watch history counts as starting a video, and completion
+// uses the same threshold as course progress.
+func computeCompletionFunnel(courseID primitive.ObjectID, videos []*models.Video, watched map[primitive.ObjectID][]int) *models.CourseFunnel {
+	funnel := &models.CourseFunnel{
+		CourseID: courseID,
+		Steps:    make([]models.FunnelStep, 0, len(videos)),
+	}
+
+	for i, video := range videos {
+		step := models.FunnelStep{
+			VideoID:  video.ID,
+			Title:    video.Title,
+			Position: i + 1,
+			Started:  len(watched[video.ID]),
+		}
+		for _, seconds := range watched[video.ID] {
+			if videoCompleted(video, seconds) {
+				step.Completed++
+			}
+		}
+		if i > 0 {
+			step.DropOff = max(funnel.Steps[i-1].Started-step.Started, 0)
+		}
+		funnel.Steps = append(funnel.Steps, step)
+	}
+
+	return funnel
+}
+
+// SetVideosPaid marks a course and all of its videos as paid or free in a single
+// transaction, returning how many videos were changed
+func (r *CourseRepository) SetVideosPaid(ctx context.Context, courseID primitive.ObjectID, isPaid bool) (int64, error) {
+	var modified int64
+	err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		now := time.Now().UTC()
+
+		result, err := r.collection.UpdateOne(sessCtx, bson.M{"_id": courseID}, bson.M{
+			"$set": bson.M{
+				"is_paid":    isPaid,
+				"updated_at": now,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrCourseNotFound
+		}
+
+		videos, err := database.Videos.UpdateMany(sessCtx, bson.M{"course_id": courseID}, bson.M{
+			"$set": bson.M{"is_paid": isPaid},
+		})
+		if err != nil {
+			return err
+		}
+		modified = videos.ModifiedCount
+		return nil
+	})
+	return modified, err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAddVideoToCourseConcurrentAdds(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewCourseRepository(NewVideoRepository())
+
+	course := &models.Course{Title: "Concurrency"}
+	if err := repo.Create(ctx, course); err != nil {
+		t.Fatalf("failed to create course: %v", err)
+	}
+
+	const adds = 20
+	videoIDs := make([]primitive.ObjectID, adds)
+	errs := make([]error, adds)
+	var wg sync.WaitGroup
+	for i := range videoIDs {
+		videoIDs[i] = primitive.NewObjectID()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.AddVideoToCourse(ctx, course.ID, videoIDs[i], 0)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("add %d failed: %v", i, err)
+		}
+	}
+
+	stored, err := repo.GetByID(ctx, course.ID)
+	if err != nil {
+		t.Fatalf("failed to get course: %v", err)
+	}
+	if len(stored.VideoOrder) != adds {
+		t.Fatalf("expected %d videos in the order, got %d", adds, len(stored.VideoOrder))
+	}
+	inOrder := make(map[primitive.ObjectID]bool, adds)
+	for _, id := range stored.VideoOrder {
+		inOrder[id] = true
+	}
+	for _, id := range videoIDs {
+		if !inOrder[id] {
+			t.Errorf("video %s missing from the order", id.Hex())
+		}
+	}
+}
+
+func TestAddVideoToCourseRejectsPositionPastEnd(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewCourseRepository(NewVideoRepository())
+
+	course := &models.Course{Title: "Positions"}
+	if err := repo.Create(ctx, course); err != nil {
+		t.Fatalf("failed to create course: %v", err)
+	}
+
+	if err := repo.AddVideoToCourse(ctx, course.ID, primitive.NewObjectID(), 1); err != ErrInvalidVideoPosition {
+		t.Fatalf("expected ErrInvalidVideoPosition, got %v", err)
+	}
+	if err := repo.AddVideoToCourse(ctx, primitive.NewObjectID(), primitive.NewObjectID(), 0); err != ErrCourseNotFound {
+		t.Fatalf("expected ErrCourseNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCreateVideoInCourseRollsBackWhenAttachFails(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewCourseRepository(NewVideoRepository())
+
+	// The course does not exist, so appending to its video order fails after the insert
+	video := &models.Video{Title: "Orphan", URL: "videos/orphan.mp4", CourseID: primitive.NewObjectID()}
+	if err := repo.CreateVideoInCourse(ctx, video); err != ErrCourseNotFound {
+		t.Fatalf("expected ErrCourseNotFound, got %v", err)
+	}
+
+	count, err := database.Videos.CountDocuments(ctx, bson.M{"course_id": video.CourseID})
+	if err != nil {
+		t.Fatalf("failed to count videos: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no orphan video, found %d", count)
+	}
+}
+
+func TestUpdateVideoInCourseMovesAtomically(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewCourseRepository(NewVideoRepository())
+
+	from := &models.Course{Title: "From"}
+	to := &models.Course{Title: "To"}
+	for _, course := range []*models.Course{from, to} {
+		if err := repo.Create(ctx, course); err != nil {
+			t.Fatalf("failed to create course: %v", err)
+		}
+	}
+	video := &models.Video{Title: "Lesson", URL: "videos/lesson.mp4", CourseID: from.ID}
+	if err := repo.CreateVideoInCourse(ctx, video); err != nil {
+		t.Fatalf("failed to create video: %v", err)
+	}
+
+	// Moving to a missing course leaves the video where it was
+	video.CourseID = primitive.NewObjectID()
+	if err := repo.UpdateVideoInCourse(ctx, video, from.ID); err != ErrCourseNotFound {
+		t.Fatalf("expected ErrCourseNotFound, got %v", err)
+	}
+	stored, err := repo.GetByID(ctx, from.ID)
+	if err != nil {
+		t.Fatalf("failed to get course: %v", err)
+	}
+	if len(stored.VideoOrder) != 1 || stored.VideoOrder[0] != video.ID {
+		t.Fatalf("expected the video to stay in the old course, got %v", stored.VideoOrder)
+	}
+
+	video.CourseID = to.ID
+	if err := repo.UpdateVideoInCourse(ctx, video, from.ID); err != nil {
+		t.Fatalf("failed to move video: %v", err)
+	}
+	if stored, err = repo.GetByID(ctx, from.ID); err != nil {
+		t.Fatalf("failed to get course: %v", err)
+	}
+	if len(stored.VideoOrder) != 0 {
+		t.Fatalf("expected the old course to be empty, got %v", stored.VideoOrder)
+	}
+	if stored, err = repo.GetByID(ctx, to.ID); err != nil {
+		t.Fatalf("failed to get course: %v", err)
+	}
+	if len(stored.VideoOrder) != 1 || stored.VideoOrder[0] != video.ID {
+		t.Fatalf("expected the video in the new course, got %v", stored.VideoOrder)
+	}
+}
+
+func TestUpdateWatchHistoryReportsFirstViewOnce(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewVideoRepository()
+
+	history := &models.WatchHistory{UserID: primitive.NewObjectID(), VideoID: primitive.NewObjectID(), ProgressSeconds: 10}
+	for i, want := range []bool{true, false, false} {
+		firstView, err := repo.UpdateWatchHistory(ctx, history)
+		if err != nil {
+			t.Fatalf("failed to update watch history: %v", err)
+		}
+		if firstView != want {
+			t.Fatalf("progress event %d: expected first view %v, got %v", i+1, want, firstView)
+		}
+		history.ProgressSeconds += 10
+	}
+}
+
+func TestCoursePartialUpdateRejectsStaleVersion(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewCourseRepository(NewVideoRepository())
+
+	course := &models.Course{Title: "Original"}
+	if err := repo.Create(ctx, course); err != nil {
+		t.Fatalf("failed to create course: %v", err)
+	}
+
+	read, err := repo.GetByID(ctx, course.ID)
+	if err != nil {
+		t.Fatalf("failed to get course: %v", err)
+	}
+
+	// Two requests edit the same version, only the first may write
+	first, err := repo.PartialUpdate(ctx, course.ID, read.UpdatedAt, map[string]interface{}{"title": "First edit"})
+	if err != nil {
+		t.Fatalf("expected the first update to succeed, got %v", err)
+	}
+	if _, err := repo.PartialUpdate(ctx, course.ID, read.UpdatedAt, map[string]interface{}{"title": "Second edit"}); err != ErrStaleUpdate {
+		t.Fatalf("expected ErrStaleUpdate for the second update, got %v", err)
+	}
+
+	// The version returned by an update can be used for the next one
+	if _, err := repo.PartialUpdate(ctx, course.ID, first.UpdatedAt, map[string]interface{}{"title": "Third edit"}); err != nil {
+		t.Fatalf("expected an update from the latest version to succeed, got %v", err)
+	}
+}
+
+func TestSetVideosPaidFlipsCourseAndVideos(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewCourseRepository(NewVideoRepository())
+
+	course := &models.Course{Title: "Mixed"}
+	empty := &models.Course{Title: "Empty"}
+	for _, c := range []*models.Course{course, empty} {
+		if err := repo.Create(ctx, c); err != nil {
+			t.Fatalf("failed to create course: %v", err)
+		}
+	}
+	for _, isPaid := range []bool{false, false, true} {
+		video := &models.Video{ID: primitive.NewObjectID(), CourseID: course.ID, Title: "Lesson", URL: "videos/lesson.mp4", IsPaid: isPaid}
+		if _, err := database.Videos.InsertOne(ctx, video); err != nil {
+			t.Fatalf("failed to seed video: %v", err)
+		}
+	}
+
+	modified, err := repo.SetVideosPaid(ctx, course.ID, true)
+	if err != nil {
+		t.Fatalf("failed to mark videos paid: %v", err)
+	}
+	if modified != 2 {
+		t.Fatalf("expected 2 videos changed, got %d", modified)
+	}
+	free, err := database.Videos.CountDocuments(ctx, bson.M{"course_id": course.ID, "is_paid": false})
+	if err != nil {
+		t.Fatalf("failed to count videos: %v", err)
+	}
+	if free != 0 {
+		t.Fatalf("expected every video paid, found %d free", free)
+	}
+	stored, err := repo.GetByID(ctx, course.ID)
+	if err != nil {
+		t.Fatalf("failed to get course: %v", err)
+	}
+	if !stored.IsPaid {
+		t.Fatal("expected the course to be marked paid")
+	}
+
+	// A course without videos still has its own flag updated
+	if modified, err = repo.SetVideosPaid(ctx, empty.ID, true); err != nil {
+		t.Fatalf("failed to mark empty course paid: %v", err)
+	}
+	if modified != 0 {
+		t.Fatalf("expected no videos changed, got %d", modified)
+	}
+	if stored, err = repo.GetByID(ctx, empty.ID); err != nil {
+		t.Fatalf("failed to get course: %v", err)
+	}
+	if !stored.IsPaid {
+		t.Fatal("expected the empty course to be marked paid")
+	}
+
+	if _, err := repo.SetVideosPaid(ctx, primitive.NewObjectID(), true); err != ErrCourseNotFound {
+		t.Fatalf("expected ErrCourseNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCourseFilterEmptyMatchesEverythingNotDeleted(t *testing.T) {
+	want := bson.M{"deleted_at": nil}
+	if query := (CourseFilter{}).query(); !reflect.DeepEqual(query, want) {
+		t.Fatalf("expected %v, got %v", want, query)
+	}
+}
+
+func TestCourseFilterIncludeDeleted(t *testing.T) {
+	if query := (CourseFilter{IncludeDeleted: true}).query(); len(query) != 0 {
+		t.Fatalf("expected empty query, got %v", query)
+	}
+}
+
+func TestCourseFilterQuery(t *testing.T) {
+	paid := false
+	query := CourseFilter{
+		Search: "golang",
+		Skills: []string{"go", "docker"},
+		IsPaid: &paid,
+	}.query()
+
+	want := bson.M{
+		"$text":      bson.M{"$search": "golang"},
+		"skills":     bson.M{"$in": []string{"go", "docker"}},
+		"is_paid":    false,
+		"deleted_at": nil,
+	}
+	if !reflect.DeepEqual(query, want) {
+		t.Fatalf("expected %v, got %v", want, query)
+	}
+}
+
+func TestCourseFilterCategory(t *testing.T) {
+	categoryID := primitive.NewObjectID()
+	query := CourseFilter{CategoryID: &categoryID}.query()
+
+	want := bson.M{"category_id": categoryID, "deleted_at": nil}
+	if !reflect.DeepEqual(query, want) {
+		t.Fatalf("expected %v, got %v", want, query)
+	}
+}
+
+func TestComputeCourseProgress(t *testing.T) {
+	watched := &models.Video{ID: primitive.NewObjectID(), Duration: 100}
+	mostly := &models.Video{ID: primitive.NewObjectID(), Duration: 200}
+	unwatched := &models.Video{ID: primitive.NewObjectID(), Duration: 100}
+
+	progress := computeCourseProgress(primitive.NewObjectID(), []*models.Video{watched, mostly, unwatched}, map[primitive.ObjectID]int{
+		watched.ID: 150, // more than the duration is capped
+		mostly.ID:  180,
+	})
+
+	if progress.TotalVideos != 3 || progress.CompletedVideos != 2 {
+		t.Fatalf("expected 2 of 3 videos completed, got %d of %d", progress.CompletedVideos, progress.TotalVideos)
+	}
+	if got := progress.Videos[unwatched.ID.Hex()]; got.Percent != 0 || got.Completed {
+		t.Fatalf("expected unwatched video at 0%%, got %+v", got)
+	}
+	if got := progress.Videos[mostly.ID.Hex()]; got.Percent != 90 || !got.Completed {
+		t.Fatalf("expected video at 90%% to be completed, got %+v", got)
+	}
+	if progress.OverallPercent != 70 {
+		t.Fatalf("expected overall 70%%, got %v", progress.OverallPercent)
+	}
+}
+
+func TestComputeCourseProgressZeroDuration(t *testing.T) {
+	watched := &models.Video{ID: primitive.NewObjectID()}
+	unwatched := &models.Video{ID: primitive.NewObjectID()}
+
+	progress := computeCourseProgress(primitive.NewObjectID(), []*models.Video{watched, unwatched}, map[primitive.ObjectID]int{
+		watched.ID: 10,
+	})
+
+	if progress.OverallPercent != 50 {
+		t.Fatalf("expected overall 50%%, got %v", progress.OverallPercent)
+	}
+	if !progress.Videos[watched.ID.Hex()].Completed || progress.Videos[unwatched.ID.Hex()].Completed {
+		t.Fatalf("unexpected completion: %+v", progress.Videos)
+	}
+
+	empty := computeCourseProgress(primitive.NewObjectID(), nil, nil)
+	if empty.OverallPercent != 0 || empty.TotalVideos != 0 {
+		t.Fatalf("expected empty course at 0%%, got %+v", empty)
+	}
+}
+
+func TestComputeCompletionFunnel(t *testing.T) {
+	intro := &models.Video{ID: primitive.NewObjectID(), Title: "Intro", Duration: 100}
+	basics := &models.Video{ID: primitive.NewObjectID(), Title: "Basics", Duration: 200}
+	advanced := &models.Video{ID: primitive.NewObjectID(), Title: "Advanced", Duration: 300}
+
+	// Seconds watched per viewer: four start the intro, three finish it, two carry on and
+	// one of them finishes the basics, nobody reaches the advanced video
+	funnel := computeCompletionFunnel(primitive.NewObjectID(), []*models.Video{intro, basics, advanced}, map[primitive.ObjectID][]int{
+		intro.ID:  {100, 95, 90, 20},
+		basics.ID: {200, 50},
+	})
+
+	want := []struct {
+		started, completed, dropOff int
+	}{
+		{4, 3, 0},
+		{2, 1, 2},
+		{0, 0, 2},
+	}
+	if len(funnel.Steps) != len(want) {
+		t.Fatalf("expected %d steps, got %d", len(want), len(funnel.Steps))
+	}
+	for i, w := range want {
+		step := funnel.Steps[i]
+		if step.Position != i+1 || step.Started != w.started || step.Completed != w.completed || step.DropOff != w.dropOff {
+			t.Fatalf("step %d: expected %+v, got %+v", i, w, step)
+		}
+	}
+	if funnel.Steps[0].VideoID != intro.ID || funnel.Steps[2].Title != "Advanced" {
+		t.Fatalf("expected steps in course order, got %+v", funnel.Steps)
+	}
+}
+
+func TestComputeCourseAnalytics(t *testing.T) {
+	intro := &models.Video{ID: primitive.NewObjectID(), Duration: 100}
+	basics := &models.Video{ID: primitive.NewObjectID(), Duration: 300}
+	videos := []*models.Video{intro, basics}
+
+	// One viewer finished everything, the other only watched half of the intro
+	analytics := computeCourseAnalytics(primitive.NewObjectID(), videos, map[primitive.ObjectID]map[primitive.ObjectID]int{
+		primitive.NewObjectID(): {intro.ID: 100, basics.ID: 300},
+		primitive.NewObjectID(): {intro.ID: 50},
+	})
+
+	if analytics.UniqueViewers != 2 {
+		t.Fatalf("expected 2 viewers, got %d", analytics.UniqueViewers)
+	}
+	if analytics.AverageCompletion != 56.25 {
+		t.Fatalf("expected 56.25%% average completion, got %v", analytics.AverageCompletion)
+	}
+	if len(analytics.Videos) != 2 || analytics.Videos[0].Started != 2 || analytics.Videos[0].Completed != 1 || analytics.Videos[1].DropOff != 1 {
+		t.Fatalf("unexpected drop-off %+v", analytics.Videos)
+	}
+
+	empty := computeCourseAnalytics(primitive.NewObjectID(), videos, nil)
+	if empty.UniqueViewers != 0 || empty.AverageCompletion != 0 || len(empty.Videos) != 2 || empty.Videos[0].Started != 0 {
+		t.Fatalf("expected zeros for a course without activity, got %+v", empty)
+	}
+}
+
+func TestComputeContinueWatching(t *testing.T) {
+	now := time.Now().UTC()
+	v1 := &models.Video{ID: primitive.NewObjectID(), Duration: 100}
+	v2 := &models.Video{ID: primitive.NewObjectID(), Duration: 100}
+	v3 := &models.Video{ID: primitive.NewObjectID(), Duration: 100}
+	deleted := primitive.NewObjectID()
+	course := &models.Course{VideoOrder: []primitive.ObjectID{v1.ID, deleted, v2.ID, v3.ID}}
+	videos := map[primitive.ObjectID]*models.Video{v1.ID: v1, v2.ID: v2, v3.ID: v3}
+
+	watched := func(video *models.Video, seconds int, ago time.Duration) *models.WatchHistory {
+		return &models.WatchHistory{VideoID: video.ID, ProgressSeconds: seconds, LastWatchedAt: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name      string
+		history   []*models.WatchHistory
+		video     *models.Video
+		resume    int
+		completed bool
+	}{
+		{"nothing watched", nil, v1, 0, false},
+		{"resume partly watched", []*models.WatchHistory{watched(v1, 95, time.Hour), watched(v2, 40, time.Minute)}, v2, 40, false},
+		{"next after completed", []*models.WatchHistory{watched(v1, 100, time.Minute)}, v2, 0, false},
+		{"wraps to earlier gap", []*models.WatchHistory{watched(v2, 100, time.Hour), watched(v3, 90, time.Minute)}, v1, 0, false},
+		{"all completed", []*models.WatchHistory{watched(v1, 90, 3*time.Minute), watched(v2, 90, 2*time.Minute), watched(v3, 90, time.Minute)}, nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := make(map[primitive.ObjectID]*models.WatchHistory)
+			for _, h := range tt.history {
+				history[h.VideoID] = h
+			}
+
+			entry := computeContinueWatching(course, videos, history)
+			if entry.Video != tt.video || entry.ResumeSeconds != tt.resume || entry.Completed != tt.completed {
+				t.Fatalf("expected video %v resume %d completed %v, got %v %d %v",
+					tt.video, tt.resume, tt.completed, entry.Video, entry.ResumeSeconds, entry.Completed)
+			}
+		})
+	}
+}
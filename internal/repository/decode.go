@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// strictDecoding makes list queries fail on the first document that cannot be decoded
+// instead of skipping it
+var strictDecoding atomic.Bool
+
+// SetStrictDecoding chooses whether list queries fail on undecodable documents or skip them
+func SetStrictDecoding(strict bool) {
+	strictDecoding.Store(strict)
+}
+
+// decodeAll decodes the remaining documents of cursor into results. Unless strict
+// decoding is enabled, a document that fails to decode, such as a record written under
+// an older schema, is logged and skipped so the rest of the list is still returned.
+func decodeAll[T any](ctx context.Context, cursor *mongo.Cursor, results *[]T) error {
+	if strictDecoding.Load() {
+		return cursor.All(ctx, results)
+	}
+
+	for cursor.Next(ctx) {
+		var result T
+		if err := cursor.Decode(&result); err != nil {
+			logrus.WithError(err).
+				WithField("id", cursor.Current.Lookup("_id").String()).
+				Warn("Skipping document that failed to decode")
+			continue
+		}
+		*results = append(*results, result)
+	}
+	return cursor.Err()
+}
+
+// eachDecoded decodes the remaining documents of cursor one at a time and passes each to
+// fn, stopping at the first error fn returns. Undecodable documents are handled as in
+// decodeAll.
+func eachDecoded[T any](ctx context.Context, cursor *mongo.Cursor, fn func(T) error) error {
+	for cursor.Next(ctx) {
+		var result T
+		if err := cursor.Decode(&result); err != nil {
+			if strictDecoding.Load() {
+				return err
+			}
+			logrus.WithError(err).
+				WithField("id", cursor.Current.Lookup("_id").String()).
+				Warn("Skipping document that failed to decode")
+			continue
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
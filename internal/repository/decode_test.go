@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func newCouponCursor(t *testing.T) *mongo.Cursor {
+	t.Helper()
+	cursor, err := mongo.NewCursorFromDocuments([]interface{}{
+		bson.M{"_id": primitive.NewObjectID(), "code": "SPRING25", "percent_off": 25.0},
+		// code drifted from a string to a number
+		bson.M{"_id": primitive.NewObjectID(), "code": 42, "percent_off": 10.0},
+		bson.M{"_id": primitive.NewObjectID(), "code": "TENOFF", "amount_off": int64(1000)},
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create cursor: %v", err)
+	}
+	return cursor
+}
+
+func TestDecodeAllSkipsMalformedDocuments(t *testing.T) {
+	SetStrictDecoding(false)
+
+	coupons := []*models.Coupon{}
+	if err := decodeAll(context.Background(), newCouponCursor(t), &coupons); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(coupons) != 2 || coupons[0].Code != "SPRING25" || coupons[1].Code != "TENOFF" {
+		t.Fatalf("expected the two valid coupons, got %+v", coupons)
+	}
+}
+
+func TestDecodeAllStrictFailsOnMalformedDocument(t *testing.T) {
+	SetStrictDecoding(true)
+	t.Cleanup(func() { SetStrictDecoding(false) })
+
+	coupons := []*models.Coupon{}
+	if err := decodeAll(context.Background(), newCouponCursor(t), &coupons); err == nil {
+		t.Fatal("expected strict decoding to fail on the malformed document")
+	}
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAlreadyEnrolled is returned when a user is already enrolled in a course
+var ErrAlreadyEnrolled = errors.New("user is already enrolled in this course")
+
+type EnrollmentRepository struct {
+	collection *mongo.Collection
+}
+
+func NewEnrollmentRepository() *EnrollmentRepository {
+	return &EnrollmentRepository{
+		collection: database.Enrollments,
+	}
+}
+
+// Enroll enrolls a user in a course
+func (r *EnrollmentRepository) Enroll(ctx context.Context, userID, courseID primitive.ObjectID) (*models.Enrollment, error) {
+	enrollment := &models.Enrollment{
+		UserID:     userID,
+		CourseID:   courseID,
+		EnrolledAt: time.Now().UTC(),
+	}
+
+	result, err := r.collection.InsertOne(ctx, enrollment)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrAlreadyEnrolled
+		}
+		return nil, err
+	}
+
+	enrollment.ID = result.InsertedID.(primitive.ObjectID)
+	return enrollment, nil
+}
+
+// IsEnrolled checks whether a user is enrolled in a course
+func (r *EnrollmentRepository) IsEnrolled(ctx context.Context, userID, courseID primitive.ObjectID) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{
+		"user_id":   userID,
+		"course_id": courseID,
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListByUser returns a user's enrollments with pagination, most recent first
+func (r *EnrollmentRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, page, limit int64) ([]*models.Enrollment, int64, error) {
+	skip := (page - 1) * limit
+
+	// Get total count
+	total, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSkip(skip).
+		SetLimit(limit).
+		SetSort(bson.M{"enrolled_at": -1})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	enrollments := []*models.Enrollment{}
+	if err = decodeAll(ctx, cursor, &enrollments); err != nil {
+		return nil, 0, err
+	}
+
+	return enrollments, total, nil
+}
+
+// EachByUser passes every enrollment of a user to fn, newest first, one at a time
+func (r *EnrollmentRepository) EachByUser(ctx context.Context, userID primitive.ObjectID, fn func(*models.Enrollment) error) error {
+	opts := options.Find().SetSort(bson.M{"enrolled_at": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	return eachDecoded(ctx, cursor, fn)
+}
+
+// ListCourseIDs returns the IDs of every course a user is enrolled in
+func (r *EnrollmentRepository) ListCourseIDs(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "course_id", bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	courseIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			courseIDs = append(courseIDs, id)
+		}
+	}
+	return courseIDs, nil
+}
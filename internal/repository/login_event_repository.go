@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LoginEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLoginEventRepository() *LoginEventRepository {
+	return &LoginEventRepository{
+		collection: database.LoginEvents,
+	}
+}
+
+// Record stores a login event
+func (r *LoginEventRepository) Record(ctx context.Context, event *models.LoginEvent) error {
+	event.CreatedAt = time.Now().UTC()
+
+	result, err := r.collection.InsertOne(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	event.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// KnownDevicesAndCountries returns the distinct devices and countries of the user's
+// completed logins. Logins stopped at an OTP challenge are not counted as known.
+func (r *LoginEventRepository) KnownDevicesAndCountries(ctx context.Context, userID primitive.ObjectID) ([]string, []string, error) {
+	filter := bson.M{"user_id": userID, "outcome": models.LoginOutcomeSuccess}
+
+	devices, err := r.distinctStrings(ctx, "device", filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	countries, err := r.distinctStrings(ctx, "country", filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return devices, countries, nil
+}
+
+// AccountsFromIP returns the distinct users that logged in from the IP since the given time
+func (r *LoginEventRepository) AccountsFromIP(ctx context.Context, ip string, since time.Time) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "user_id", bson.M{
+		"ip":         ip,
+		"created_at": bson.M{"$gte": since},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// ListFlagged returns flagged login events, newest first, optionally filtered by review state
+func (r *LoginEventRepository) ListFlagged(ctx context.Context, reviewed *bool, page, limit int64) ([]*models.LoginEvent, int64, error) {
+	filter := bson.M{"flags.0": bson.M{"$exists": true}}
+	if reviewed != nil {
+		filter["reviewed"] = *reviewed
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.M{"created_at": -1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*models.LoginEvent{}
+	if err = decodeAll(ctx, cursor, &events); err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// MarkReviewed records that an admin reviewed a login event. It returns the updated
+// event, or nil when no event has the ID.
+func (r *LoginEventRepository) MarkReviewed(ctx context.Context, id, adminID primitive.ObjectID) (*models.LoginEvent, error) {
+	now := time.Now().UTC()
+
+	var event models.LoginEvent
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"reviewed":    true,
+			"reviewed_by": adminID,
+			"reviewed_at": now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&event)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// distinctStrings returns the distinct non-empty string values of a field
+func (r *LoginEventRepository) distinctStrings(ctx context.Context, field string, filter bson.M) ([]string, error) {
+	values, err := r.collection.Distinct(ctx, field, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok && s != "" {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type NotificationRepository struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+}
+
+func NewNotificationRepository() *NotificationRepository {
+	return &NotificationRepository{
+		collection: database.Notifications,
+		users:      database.Users,
+	}
+}
+
+// Create adds a notification to a user's feed unless the user muted its type. It
+// reports whether the notification was created.
+func (r *NotificationRepository) Create(ctx context.Context, notification *models.Notification) (bool, error) {
+	muted, err := r.users.CountDocuments(ctx, bson.M{
+		"_id":                 notification.UserID,
+		"muted_notifications": notification.Type,
+	})
+	if err != nil {
+		return false, err
+	}
+	if muted > 0 {
+		return false, nil
+	}
+
+	notification.Read = false
+	notification.CreatedAt = time.Now().UTC()
+
+	result, err := r.collection.InsertOne(ctx, notification)
+	if err != nil {
+		return false, err
+	}
+
+	notification.ID = result.InsertedID.(primitive.ObjectID)
+	return true, nil
+}
+
+// CreateMany inserts a batch of notifications as is, callers have already left out the
+// users who muted their type
+func (r *NotificationRepository) CreateMany(ctx context.Context, notifications []*models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(notifications))
+	for i, notification := range notifications {
+		docs[i] = notification
+	}
+
+	result, err := r.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		return err
+	}
+
+	for i, id := range result.InsertedIDs {
+		notifications[i].ID = id.(primitive.ObjectID)
+	}
+	return nil
+}
+
+// ListByUser returns a user's notifications with pagination, newest first, along with
+// the total and the number of unread notifications
+func (r *NotificationRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, page, limit int64) ([]*models.Notification, int64, int64, error) {
+	filter := bson.M{"user_id": userID}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	unread, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID, "read": false})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []*models.Notification{}
+	if err = decodeAll(ctx, cursor, &notifications); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return notifications, total, unread, nil
+}
+
+// MarkRead marks one of a user's notifications read. It reports whether the user has a
+// notification with that ID.
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID, id primitive.ObjectID) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "user_id": userID},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// MarkAllRead marks every unread notification of a user read and returns how many there were
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := r.collection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "read": false},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
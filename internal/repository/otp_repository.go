@@ -16,18 +16,20 @@ import (
 
 type OTPRepository struct {
 	collection *mongo.Collection
+	sends      *mongo.Collection
 }
 
 func NewOTPRepository() *OTPRepository {
 	return &OTPRepository{
 		collection: database.OTPs,
+		sends:      database.OTPSends,
 	}
 }
 
-// Create creates a new OTP
+// Create creates a new OTP and records it as sent
 func (r *OTPRepository) Create(ctx context.Context, otp *models.OTP) error {
-	otp.CreatedAt = time.Now()
-	otp.ExpiresAt = time.Now().Add(15 * time.Minute) // OTP expires in 15 minutes
+	otp.CreatedAt = time.Now().UTC()
+	otp.ExpiresAt = time.Now().UTC().Add(15 * time.Minute) // OTP expires in 15 minutes
 
 	result, err := r.collection.InsertOne(ctx, otp)
 	if err != nil {
@@ -35,7 +37,23 @@ func (r *OTPRepository) Create(ctx context.Context, otp *models.OTP) error {
 	}
 
 	otp.ID = result.InsertedID.(primitive.ObjectID)
-	return nil
+
+	return r.recordSend(ctx, otp.Email, otp.Type, otp.CreatedAt)
+}
+
+// RecordSend records an OTP request for which no code was sent, such as one for an email
+// without an account, so it counts towards the same cooldown and hourly limit
+func (r *OTPRepository) RecordSend(ctx context.Context, email, otpType string) error {
+	return r.recordSend(ctx, email, otpType, time.Now().UTC())
+}
+
+func (r *OTPRepository) recordSend(ctx context.Context, email, otpType string, sentAt time.Time) error {
+	_, err := r.sends.InsertOne(ctx, &models.OTPSend{
+		Email:     email,
+		Type:      otpType,
+		CreatedAt: sentAt,
+	})
+	return err
 }
 
 // GetLatestOTP gets the latest unused OTP for an email
@@ -46,7 +64,7 @@ func (r *OTPRepository) GetLatestOTP(ctx context.Context, email, otpType string)
 		"type":  otpType,
 		"used":  false,
 		"expires_at": bson.M{
-			"$gt": time.Now(),
+			"$gt": time.Now().UTC(),
 		},
 	}, options.FindOne().SetSort(bson.M{"created_at": -1})).Decode(&otp)
 
@@ -60,6 +78,85 @@ func (r *OTPRepository) GetLatestOTP(ctx context.Context, email, otpType string)
 	return &otp, nil
 }
 
+// LastSendAt returns when an OTP was last requested for an email and type, or nil when
+// none was within the last day
+func (r *OTPRepository) LastSendAt(ctx context.Context, email, otpType string) (*time.Time, error) {
+	var send models.OTPSend
+	err := r.sends.FindOne(ctx, bson.M{
+		"email": email,
+		"type":  otpType,
+	}, options.FindOne().SetSort(bson.M{"created_at": -1})).Decode(&send)
+
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &send.CreatedAt, nil
+}
+
+// CountRecent counts the OTPs sent for an email and type since the given time. Sends are
+// kept for a day, so since must not be older than that.
+func (r *OTPRepository) CountRecent(ctx context.Context, email, otpType string, since time.Time) (int64, error) {
+	return r.sends.CountDocuments(ctx, bson.M{
+		"email": email,
+		"type":  otpType,
+		"created_at": bson.M{
+			"$gte": since,
+		},
+	})
+}
+
+// OldestSendSince returns when the oldest OTP sent for an email and type since the given
+// time was sent, or nil when none was
+func (r *OTPRepository) OldestSendSince(ctx context.Context, email, otpType string, since time.Time) (*time.Time, error) {
+	var send models.OTPSend
+	err := r.sends.FindOne(ctx, bson.M{
+		"email": email,
+		"type":  otpType,
+		"created_at": bson.M{
+			"$gte": since,
+		},
+	}, options.FindOne().SetSort(bson.M{"created_at": 1})).Decode(&send)
+
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &send.CreatedAt, nil
+}
+
+// ListRecent returns the most recent OTPs for an email, newest first. An empty
+// otpType matches every type.
+func (r *OTPRepository) ListRecent(ctx context.Context, email, otpType string, limit int64) ([]*models.OTP, error) {
+	filter := bson.M{"email": email}
+	if otpType != "" {
+		filter["type"] = otpType
+	}
+
+	opts := options.Find().
+		SetLimit(limit).
+		SetSort(bson.M{"created_at": -1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	otps := []*models.OTP{}
+	if err = decodeAll(ctx, cursor, &otps); err != nil {
+		return nil, err
+	}
+
+	return otps, nil
+}
+
 // MarkAsUsed marks an OTP as used
 func (r *OTPRepository) MarkAsUsed(ctx context.Context, id primitive.ObjectID) error {
 	update := bson.M{
@@ -76,12 +173,15 @@ func (r *OTPRepository) MarkAsUsed(ctx context.Context, id primitive.ObjectID) e
 	return err
 }
 
-// DeleteExpiredOTPs deletes expired OTPs
-func (r *OTPRepository) DeleteExpiredOTPs(ctx context.Context) error {
-	_, err := r.collection.DeleteMany(ctx, bson.M{
+// DeleteExpiredOTPs deletes expired OTPs and returns how many were deleted
+func (r *OTPRepository) DeleteExpiredOTPs(ctx context.Context) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{
 		"expires_at": bson.M{
-			"$lt": time.Now(),
+			"$lt": time.Now().UTC(),
 		},
 	})
-	return err
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
 }
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOTPSendsOutliveExpiredOTPs(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewOTPRepository()
+
+	since := time.Now().UTC().Add(-time.Hour)
+	for range 2 {
+		if err := repo.Create(ctx, &models.OTP{Email: "a@example.com", Type: "reset", Code: "123456"}); err != nil {
+			t.Fatalf("failed to create OTP: %v", err)
+		}
+	}
+
+	// Expired OTPs are purged long before the hour is over
+	if _, err := database.OTPs.DeleteMany(ctx, bson.M{}); err != nil {
+		t.Fatalf("failed to purge OTPs: %v", err)
+	}
+
+	count, err := repo.CountRecent(ctx, "a@example.com", "reset", since)
+	if err != nil {
+		t.Fatalf("failed to count sends: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 sends within the hour, got %d", count)
+	}
+
+	oldest, err := repo.OldestSendSince(ctx, "a@example.com", "reset", since)
+	if err != nil || oldest == nil || oldest.Before(since) {
+		t.Fatalf("expected the oldest send within the hour, got %v (%v)", oldest, err)
+	}
+}
+
+func TestRecordSendLimitsEmailsWithoutOTPs(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewOTPRepository()
+
+	last, err := repo.LastSendAt(ctx, "ghost@example.com", "reset")
+	if err != nil || last != nil {
+		t.Fatalf("expected no send yet, got %v (%v)", last, err)
+	}
+
+	before := time.Now().UTC().Add(-time.Second)
+	if err := repo.RecordSend(ctx, "ghost@example.com", "reset"); err != nil {
+		t.Fatalf("failed to record send: %v", err)
+	}
+
+	// The request counts like a real send without issuing a code
+	last, err = repo.LastSendAt(ctx, "ghost@example.com", "reset")
+	if err != nil || last == nil || last.Before(before) {
+		t.Fatalf("expected the recorded send, got %v (%v)", last, err)
+	}
+	count, err := repo.CountRecent(ctx, "ghost@example.com", "reset", before)
+	if err != nil || count != 1 {
+		t.Fatalf("expected 1 send within the hour, got %d (%v)", count, err)
+	}
+	otps, err := database.OTPs.CountDocuments(ctx, bson.M{"email": "ghost@example.com"})
+	if err != nil || otps != 0 {
+		t.Fatalf("expected no OTP issued, got %d (%v)", otps, err)
+	}
+}
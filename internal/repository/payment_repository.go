@@ -14,22 +14,32 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrPaymentRecorded is returned when a payment with the same transaction ID was already recorded
+var ErrPaymentRecorded = errors.New("payment already recorded")
+
 type PaymentRepository struct {
-	collection *mongo.Collection
+	collection    *mongo.Collection
+	subscriptions *mongo.Collection
+	pricingCache  *pricingCache
 }
 
 func NewPaymentRepository() *PaymentRepository {
 	return &PaymentRepository{
-		collection: database.Payments,
+		collection:    database.Payments,
+		subscriptions: database.Subscriptions,
+		pricingCache:  newPricingCache(regionalPricingTTL),
 	}
 }
 
 // Create creates a new payment record
 func (r *PaymentRepository) Create(ctx context.Context, payment *models.Payment) error {
-	payment.Timestamp = time.Now()
+	payment.Timestamp = time.Now().UTC()
 
 	result, err := r.collection.InsertOne(ctx, payment)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrPaymentRecorded
+		}
 		return err
 	}
 
@@ -63,6 +73,30 @@ func (r *PaymentRepository) GetByTransactionID(ctx context.Context, transactionI
 	return &payment, nil
 }
 
+// GetByStripeReference finds the payment charged through a payment intent or invoice
+func (r *PaymentRepository) GetByStripeReference(ctx context.Context, paymentIntentID, invoiceID string) (*models.Payment, error) {
+	var or []bson.M
+	if paymentIntentID != "" {
+		or = append(or, bson.M{"payment_intent_id": paymentIntentID})
+	}
+	if invoiceID != "" {
+		or = append(or, bson.M{"invoice_id": invoiceID})
+	}
+	if len(or) == 0 {
+		return nil, nil
+	}
+
+	var payment models.Payment
+	err := r.collection.FindOne(ctx, bson.M{"$or": or}).Decode(&payment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &payment, nil
+}
+
 // ListByUser returns a list of payments for a specific user
 func (r *PaymentRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, page, limit int64) ([]*models.Payment, int64, error) {
 	skip := (page - 1) * limit
@@ -86,13 +120,58 @@ func (r *PaymentRepository) ListByUser(ctx context.Context, userID primitive.Obj
 	defer cursor.Close(ctx)
 
 	var payments []*models.Payment
-	if err = cursor.All(ctx, &payments); err != nil {
+	if err = decodeAll(ctx, cursor, &payments); err != nil {
 		return nil, 0, err
 	}
 
 	return payments, total, nil
 }
 
+// EachByUser passes every payment of a user to fn, newest first, one at a time
+func (r *PaymentRepository) EachByUser(ctx context.Context, userID primitive.ObjectID, fn func(*models.Payment) error) error {
+	opts := options.Find().SetSort(bson.M{"timestamp": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	return eachDecoded(ctx, cursor, fn)
+}
+
+// HasPurchasedCourse checks whether a user has a completed payment for a course
+func (r *PaymentRepository) HasPurchasedCourse(ctx context.Context, userID, courseID primitive.ObjectID) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{
+		"user_id":   userID,
+		"course_id": courseID,
+		"status":    "completed",
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListPurchasedCourseIDs returns the IDs of the courses a user has bought individually
+func (r *PaymentRepository) ListPurchasedCourseIDs(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "course_id", bson.M{
+		"user_id":   userID,
+		"course_id": bson.M{"$exists": true},
+		"status":    "completed",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	courseIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			courseIDs = append(courseIDs, id)
+		}
+	}
+	return courseIDs, nil
+}
+
 // UpdateStatus updates a payment's status
 func (r *PaymentRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, status string) error {
 	update := bson.M{
@@ -109,8 +188,27 @@ func (r *PaymentRepository) UpdateStatus(ctx context.Context, id primitive.Objec
 	return err
 }
 
-// GetRegionalPricing gets pricing for a specific region
+// MarkRefunded records the total refunded on a payment, marking it refunded once fully
+// refunded. The total never decreases, so a late webhook cannot undo a newer refund.
+func (r *PaymentRepository) MarkRefunded(ctx context.Context, id primitive.ObjectID, refundedAmount int, fullyRefunded bool) error {
+	set := bson.M{"refunded_at": time.Now().UTC()}
+	if fullyRefunded {
+		set["status"] = "refunded"
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$max": bson.M{"refunded_amount": refundedAmount},
+		"$set": set,
+	})
+	return err
+}
+
+// GetRegionalPricing gets pricing for a specific region, served from the cache when possible
 func (r *PaymentRepository) GetRegionalPricing(ctx context.Context, regionCode string) (*models.RegionalPricing, error) {
+	if pricing, ok := r.pricingCache.get(regionCode); ok {
+		return pricing, nil
+	}
+
 	var pricing models.RegionalPricing
 	err := database.RegionalPricing.FindOne(ctx, bson.M{"region_code": regionCode}).Decode(&pricing)
 	if err != nil {
@@ -119,6 +217,8 @@ func (r *PaymentRepository) GetRegionalPricing(ctx context.Context, regionCode s
 		}
 		return nil, err
 	}
+
+	r.pricingCache.set(regionCode, &pricing)
 	return &pricing, nil
 }
 
@@ -140,23 +240,55 @@ func (r *PaymentRepository) UpdateRegionalPricing(ctx context.Context, pricing *
 		update,
 		opts,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	r.pricingCache.invalidate(pricing.RegionCode)
+	return nil
 }
 
-// ListRegionalPricing returns a list of all regional pricing
-func (r *PaymentRepository) ListRegionalPricing(ctx context.Context) ([]*models.RegionalPricing, error) {
-	cursor, err := database.RegionalPricing.Find(ctx, bson.M{})
+// ListRegionalPricing returns a page of regional pricing ordered by region code,
+// optionally restricted to one currency, along with the total number of matches
+func (r *PaymentRepository) ListRegionalPricing(ctx context.Context, currency string, page, limit int64) ([]*models.RegionalPricing, int64, error) {
+	filter := bson.M{}
+	if currency != "" {
+		filter["currency"] = currency
+	}
+
+	total, err := database.RegionalPricing.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.M{"region_code": 1})
+
+	cursor, err := database.RegionalPricing.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer cursor.Close(ctx)
 
 	var pricing []*models.RegionalPricing
-	if err = cursor.All(ctx, &pricing); err != nil {
-		return nil, err
+	if err = decodeAll(ctx, cursor, &pricing); err != nil {
+		return nil, 0, err
+	}
+
+	return pricing, total, nil
+}
+
+// DeleteRegionalPricing removes the pricing of a region. It reports whether there was one.
+func (r *PaymentRepository) DeleteRegionalPricing(ctx context.Context, regionCode string) (bool, error) {
+	result, err := database.RegionalPricing.DeleteOne(ctx, bson.M{"region_code": regionCode})
+	if err != nil {
+		return false, err
 	}
 
-	return pricing, nil
+	r.pricingCache.invalidate(regionCode)
+	return result.DeletedCount > 0, nil
 }
 
 // UpdateSubscription updates a user's subscription
@@ -164,7 +296,7 @@ func (r *PaymentRepository) UpdateSubscription(ctx context.Context, userID primi
 	update := bson.M{
 		"$set": bson.M{
 			"subscription": subscription,
-			"updated_at":   time.Now(),
+			"updated_at":   time.Now().UTC(),
 		},
 	}
 
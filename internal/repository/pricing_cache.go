@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"cource-api/internal/models"
+)
+
+// regionalPricingTTL is how long a regional pricing lookup is served from memory
+const regionalPricingTTL = 5 * time.Minute
+
+type pricingCacheEntry struct {
+	pricing   models.RegionalPricing
+	expiresAt time.Time
+}
+
+// pricingCache is a concurrency-safe in-memory cache of regional pricing keyed by region code
+type pricingCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]pricingCacheEntry
+}
+
+func newPricingCache(ttl time.Duration) *pricingCache {
+	return &pricingCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]pricingCacheEntry),
+	}
+}
+
+// get returns a copy of the cached pricing for a region if it has not expired
+func (c *pricingCache) get(regionCode string) (*models.RegionalPricing, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[regionCode]
+	c.mu.RUnlock()
+
+	if !ok || !c.now().Before(entry.expiresAt) {
+		return nil, false
+	}
+
+	pricing := entry.pricing
+	return &pricing, true
+}
+
+// set stores a copy of the pricing for a region
+func (c *pricingCache) set(regionCode string, pricing *models.RegionalPricing) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[regionCode] = pricingCacheEntry{
+		pricing:   *pricing,
+		expiresAt: c.now().Add(c.ttl),
+	}
+}
+
+// invalidate removes the cached pricing for a region
+func (c *pricingCache) invalidate(regionCode string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, regionCode)
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+)
+
+func TestPricingCacheHit(t *testing.T) {
+	cache := newPricingCache(time.Minute)
+	cache.set("IN", &models.RegionalPricing{RegionCode: "IN", MonthlyPrice: 499})
+
+	pricing, ok := cache.get("IN")
+	if !ok {
+		t.Fatal("expected cache hit")
+	}
+	if pricing.MonthlyPrice != 499 {
+		t.Fatalf("expected monthly price 499, got %d", pricing.MonthlyPrice)
+	}
+
+	// Mutating the returned value must not change the cached entry
+	pricing.MonthlyPrice = 1
+	if cached, _ := cache.get("IN"); cached.MonthlyPrice != 499 {
+		t.Fatalf("expected cached price to be unchanged, got %d", cached.MonthlyPrice)
+	}
+
+	if _, ok := cache.get("US"); ok {
+		t.Fatal("expected cache miss for unknown region")
+	}
+}
+
+func TestPricingCacheTTLExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newPricingCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.set("IN", &models.RegionalPricing{RegionCode: "IN"})
+
+	now = now.Add(59 * time.Second)
+	if _, ok := cache.get("IN"); !ok {
+		t.Fatal("expected cache hit before TTL")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := cache.get("IN"); ok {
+		t.Fatal("expected cache miss after TTL")
+	}
+}
+
+func TestPricingCacheInvalidate(t *testing.T) {
+	cache := newPricingCache(time.Minute)
+	cache.set("IN", &models.RegionalPricing{RegionCode: "IN"})
+	cache.set("US", &models.RegionalPricing{RegionCode: "US"})
+
+	cache.invalidate("IN")
+
+	if _, ok := cache.get("IN"); ok {
+		t.Fatal("expected invalidated region to miss")
+	}
+	if _, ok := cache.get("US"); !ok {
+		t.Fatal("expected other regions to stay cached")
+	}
+}
@@ -14,6 +14,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrProductIDExists is returned when a product with the same external product_id already exists
+var ErrProductIDExists = errors.New("product with this product_id already exists")
+
 type ProductRepository struct {
 	collection *mongo.Collection
 }
@@ -26,11 +29,14 @@ func NewProductRepository() *ProductRepository {
 
 // Create creates a new product
 func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
-	product.CreatedAt = time.Now()
-	product.UpdatedAt = time.Now()
+	product.CreatedAt = time.Now().UTC()
+	product.UpdatedAt = time.Now().UTC()
 
 	result, err := r.collection.InsertOne(ctx, product)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrProductIDExists
+		}
 		return err
 	}
 
@@ -38,6 +44,66 @@ func (r *ProductRepository) Create(ctx context.Context, product *models.Product)
 	return nil
 }
 
+// UpsertByProductID creates or updates a product keyed by its external product_id.
+// It reports whether a new product was created, ErrProductIDExists is only returned
+// when concurrent upserts keep colliding.
+func (r *ProductRepository) UpsertByProductID(ctx context.Context, product *models.Product) (bool, error) {
+	now := time.Now().UTC()
+
+	update := bson.M{
+		"$set": bson.M{
+			"interval":       product.Interval,
+			"currency":       product.Currency,
+			"status":         product.Status,
+			"price":          product.Price,
+			"original_price": product.OriginalPrice,
+			"iap_product_id": product.IAPProductID,
+			"price_id":       product.PriceID,
+			"type":           product.Type,
+			"trial_days":     product.TrialDays,
+			"updated_at":     now,
+		},
+		"$setOnInsert": bson.M{
+			"created_at": now,
+		},
+	}
+
+	// A concurrent upsert can insert the product between the match and the insert of this
+	// one, the retry then matches the stored product and updates it
+	var result *mongo.UpdateResult
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		result, err = r.collection.UpdateOne(
+			ctx,
+			bson.M{"product_id": product.ProductID},
+			update,
+			options.Update().SetUpsert(true),
+		)
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, ErrProductIDExists
+		}
+		return false, err
+	}
+
+	created := result.UpsertedCount > 0
+
+	// Reload so the caller gets the stored ID and timestamps
+	stored, err := r.GetByProductID(ctx, product.ProductID)
+	if err != nil {
+		return created, err
+	}
+	if stored != nil {
+		*product = *stored
+	}
+
+	return created, nil
+}
+
 // GetByID finds a product by ID
 func (r *ProductRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
 	var product models.Product
@@ -87,7 +153,7 @@ func (r *ProductRepository) List(ctx context.Context, page, limit int64) ([]*mod
 	defer cursor.Close(ctx)
 
 	var products []*models.Product
-	if err = cursor.All(ctx, &products); err != nil {
+	if err = decodeAll(ctx, cursor, &products); err != nil {
 		return nil, 0, err
 	}
 
@@ -96,7 +162,7 @@ func (r *ProductRepository) List(ctx context.Context, page, limit int64) ([]*mod
 
 // Update updates a product
 func (r *ProductRepository) Update(ctx context.Context, product *models.Product) error {
-	product.UpdatedAt = time.Now()
+	product.UpdatedAt = time.Now().UTC()
 
 	update := bson.M{
 		"$set": bson.M{
@@ -137,7 +203,7 @@ func (r *ProductRepository) ListActive(ctx context.Context) ([]*models.Product,
 	defer cursor.Close(ctx)
 
 	var products []*models.Product
-	if err = cursor.All(ctx, &products); err != nil {
+	if err = decodeAll(ctx, cursor, &products); err != nil {
 		return nil, err
 	}
 
@@ -150,7 +216,7 @@ func (r *ProductRepository) UpdatePrice(ctx context.Context, id primitive.Object
 		"$set": bson.M{
 			"price":          price,
 			"original_price": originalPrice,
-			"updated_at":     time.Now(),
+			"updated_at":     time.Now().UTC(),
 		},
 	}
 
@@ -167,7 +233,7 @@ func (r *ProductRepository) UpdateStatus(ctx context.Context, id primitive.Objec
 	update := bson.M{
 		"$set": bson.M{
 			"status":     status,
-			"updated_at": time.Now(),
+			"updated_at": time.Now().UTC(),
 		},
 	}
 
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestUpsertByProductIDCreatesThenUpdates(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewProductRepository()
+
+	product := &models.Product{ProductID: "prod_123", Currency: "usd", Price: 10}
+	created, err := repo.UpsertByProductID(ctx, product)
+	if err != nil || !created {
+		t.Fatalf("expected the first upsert to create the product, got created %v (%v)", created, err)
+	}
+	firstID := product.ID
+
+	update := &models.Product{ProductID: "prod_123", Currency: "usd", Price: 12}
+	created, err = repo.UpsertByProductID(ctx, update)
+	if err != nil || created {
+		t.Fatalf("expected the second upsert to update the product, got created %v (%v)", created, err)
+	}
+	if update.ID != firstID || update.Price != 12 || !update.CreatedAt.Equal(product.CreatedAt) {
+		t.Fatalf("expected the stored product to be updated in place, got %+v", update)
+	}
+}
+
+func TestCreateProductRejectsDuplicateProductID(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewProductRepository()
+
+	if err := repo.Create(ctx, &models.Product{ProductID: "prod_dup"}); err != nil {
+		t.Fatalf("failed to create product: %v", err)
+	}
+	if err := repo.Create(ctx, &models.Product{ProductID: "prod_dup"}); err != ErrProductIDExists {
+		t.Fatalf("expected ErrProductIDExists for a duplicate create, got %v", err)
+	}
+}
+
+func TestUpsertByProductIDConcurrentCreates(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewProductRepository()
+
+	const upserts = 10
+	created := make([]bool, upserts)
+	errs := make([]error, upserts)
+	var wg sync.WaitGroup
+	for i := range upserts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created[i], errs[i] = repo.UpsertByProductID(ctx, &models.Product{ProductID: "prod_race", Price: float64(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	creates := 0
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("upsert %d failed: %v", i, err)
+		}
+		if created[i] {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Fatalf("expected exactly one upsert to create the product, got %d", creates)
+	}
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RefreshTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRefreshTokenRepository() *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		collection: database.RefreshTokens,
+	}
+}
+
+// Create stores a new refresh token
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	token.CreatedAt = time.Now().UTC()
+
+	result, err := r.collection.InsertOne(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	token.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByHash finds a refresh token by the hash of its value
+func (r *RefreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Revoke marks a refresh token as revoked
+func (r *RefreshTokenRepository) Revoke(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set": bson.M{
+			"revoked": true,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		update,
+	)
+	return err
+}
+
+// Rotate revokes an unrevoked refresh token in a single update and returns it, so of
+// concurrent refreshes with the same token only one gets it. Nil means the token does
+// not exist or was already revoked.
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"token_hash": tokenHash, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true}},
+	).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokeAllForUser revokes every refresh token issued to a user
+func (r *RefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID primitive.ObjectID) error {
+	update := bson.M{
+		"$set": bson.M{
+			"revoked": true,
+		},
+	}
+
+	_, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "revoked": false},
+		update,
+	)
+	return err
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRotateConcurrentRefreshes(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewRefreshTokenRepository()
+
+	token := &models.RefreshToken{UserID: primitive.NewObjectID(), TokenHash: "rotated", ExpiresAt: time.Now().UTC().Add(time.Hour)}
+	if err := repo.Create(ctx, token); err != nil {
+		t.Fatalf("failed to create refresh token: %v", err)
+	}
+
+	const refreshes = 10
+	rotated := make([]*models.RefreshToken, refreshes)
+	errs := make([]error, refreshes)
+	var wg sync.WaitGroup
+	for i := range rotated {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rotated[i], errs[i] = repo.Rotate(ctx, token.TokenHash)
+		}(i)
+	}
+	wg.Wait()
+
+	var winners int
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("refresh %d failed: %v", i, err)
+		}
+		if rotated[i] != nil {
+			winners++
+		}
+	}
+	if winners != 1 {
+		t.Fatalf("expected exactly one refresh to rotate the token, got %d", winners)
+	}
+
+	stored, err := repo.GetByHash(ctx, token.TokenHash)
+	if err != nil || stored == nil || !stored.Revoked {
+		t.Fatalf("expected the token to be revoked, got %+v (%v)", stored, err)
+	}
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// planTotal is the summed amount of the active subscriptions of one plan and currency
+type planTotal struct {
+	Currency string  `bson:"currency"`
+	Plan     string  `bson:"plan"`
+	Amount   float64 `bson:"amount"`
+}
+
+// RevenueStats reports the net revenue of completed payments in [from, to) by currency,
+// region and month, along with the current subscription counts and MRR
+func (r *PaymentRepository) RevenueStats(ctx context.Context, from, to time.Time) (*models.RevenueStats, error) {
+	stats := &models.RevenueStats{
+		From:       from,
+		To:         to,
+		ByCurrency: []*models.RevenueTotal{},
+		ByRegion:   []*models.RegionRevenue{},
+		ByMonth:    []*models.MonthRevenue{},
+	}
+
+	if err := r.revenueBreakdown(ctx, from, to, stats); err != nil {
+		return nil, err
+	}
+
+	counts, err := r.subscriptionCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.Subscriptions = counts
+
+	totals, err := r.activePlanTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.MRR = monthlyRecurringRevenue(totals)
+
+	return stats, nil
+}
+
+// revenueBreakdown fills the by currency, region and month totals of stats in a single
+// pass over the payments. Partial refunds are taken off, fully refunded payments are no
+// longer completed and so are left out.
+func (r *PaymentRepository) revenueBreakdown(ctx context.Context, from, to time.Time, stats *models.RevenueStats) error {
+	net := bson.M{"$subtract": bson.A{"$amount", bson.M{"$ifNull": bson.A{"$refunded_amount", 0}}}}
+
+	// sum groups on key and flattens it into fields, sorted in the order given
+	sum := func(key bson.M, fields ...string) []bson.M {
+		project := bson.M{"_id": 0, "amount": 1, "payments": 1}
+		sort := bson.D{}
+		for _, field := range fields {
+			project[field] = "$_id." + field
+			sort = append(sort, bson.E{Key: field, Value: 1})
+		}
+		return []bson.M{
+			{"$group": bson.M{
+				"_id":      key,
+				"amount":   bson.M{"$sum": net},
+				"payments": bson.M{"$sum": 1},
+			}},
+			{"$project": project},
+			{"$sort": sort},
+		}
+	}
+
+	month := bson.M{"$dateToString": bson.M{
+		"format":   "%Y-%m",
+		"date":     "$timestamp",
+		"timezone": "UTC",
+	}}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"status":    "completed",
+			"timestamp": bson.M{"$gte": from, "$lt": to},
+		}},
+		{"$facet": bson.M{
+			"by_currency": sum(bson.M{"currency": "$currency"}, "currency"),
+			"by_region":   sum(bson.M{"region": "$region", "currency": "$currency"}, "region", "currency"),
+			"by_month":    sum(bson.M{"month": month, "currency": "$currency"}, "month", "currency"),
+		}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		ByCurrency []*models.RevenueTotal  `bson:"by_currency"`
+		ByRegion   []*models.RegionRevenue `bson:"by_region"`
+		ByMonth    []*models.MonthRevenue  `bson:"by_month"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if result.ByCurrency != nil {
+		stats.ByCurrency = result.ByCurrency
+	}
+	if result.ByRegion != nil {
+		stats.ByRegion = result.ByRegion
+	}
+	if result.ByMonth != nil {
+		stats.ByMonth = result.ByMonth
+	}
+	return nil
+}
+
+// subscriptionCounts counts the active, canceled and trialing subscriptions
+func (r *PaymentRepository) subscriptionCounts(ctx context.Context) (models.SubscriptionCounts, error) {
+	var counts models.SubscriptionCounts
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$in": []string{"active", "canceled", "trial"}}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := r.subscriptions.Aggregate(ctx, pipeline)
+	if err != nil {
+		return counts, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return counts, err
+	}
+
+	for _, row := range rows {
+		switch row.Status {
+		case "active":
+			counts.Active = row.Count
+		case "canceled":
+			counts.Canceled = row.Count
+		case "trial":
+			counts.Trial = row.Count
+		}
+	}
+	return counts, nil
+}
+
+// activePlanTotals sums the amounts of the active subscriptions by currency and plan
+func (r *PaymentRepository) activePlanTotals(ctx context.Context) ([]planTotal, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": "active"}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"currency": "$currency", "plan": "$plan"},
+			"amount": bson.M{"$sum": "$amount"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":      0,
+			"currency": "$_id.currency",
+			"plan":     "$_id.plan",
+			"amount":   1,
+		}}},
+	}
+
+	cursor, err := r.subscriptions.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var totals []planTotal
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// monthlyRecurringRevenue approximates MRR per currency, yearly plans count for a twelfth
+// of their amount. Results are rounded to two decimals.
+func monthlyRecurringRevenue(totals []planTotal) map[string]float64 {
+	mrr := make(map[string]float64)
+	for _, total := range totals {
+		amount := total.Amount
+		if total.Plan == "yearly" {
+			amount /= 12
+		}
+		mrr[total.Currency] += amount
+	}
+	for currency, amount := range mrr {
+		mrr[currency] = math.Round(amount*100) / 100
+	}
+	return mrr
+}
@@ -0,0 +1,21 @@
+package repository
+
+import "testing"
+
+func TestMonthlyRecurringRevenue(t *testing.T) {
+	mrr := monthlyRecurringRevenue([]planTotal{
+		{Currency: "usd", Plan: "monthly", Amount: 30},
+		{Currency: "usd", Plan: "yearly", Amount: 100},
+		{Currency: "inr", Plan: "monthly", Amount: 499},
+	})
+
+	if got := mrr["usd"]; got != 38.33 {
+		t.Errorf("expected usd MRR 38.33, got %v", got)
+	}
+	if got := mrr["inr"]; got != 499 {
+		t.Errorf("expected inr MRR 499, got %v", got)
+	}
+	if len(mrr) != 2 {
+		t.Errorf("expected 2 currencies, got %d", len(mrr))
+	}
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAlreadyReviewed is returned when a user reviews a course they already reviewed
+var ErrAlreadyReviewed = errors.New("user has already reviewed this course")
+
+type ReviewRepository struct {
+	collection *mongo.Collection
+}
+
+func NewReviewRepository() *ReviewRepository {
+	return &ReviewRepository{
+		collection: database.Reviews,
+	}
+}
+
+// Create creates a review, ErrAlreadyReviewed is returned when the user already
+// reviewed the course
+func (r *ReviewRepository) Create(ctx context.Context, review *models.Review) error {
+	now := time.Now().UTC()
+	review.CreatedAt = now
+	review.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, review)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyReviewed
+		}
+		return err
+	}
+
+	review.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByUserAndCourse finds the review a user left on a course
+func (r *ReviewRepository) GetByUserAndCourse(ctx context.Context, userID, courseID primitive.ObjectID) (*models.Review, error) {
+	var review models.Review
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "course_id": courseID}).Decode(&review)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &review, nil
+}
+
+// ListByCourse returns the reviews of a course with pagination, newest first
+func (r *ReviewRepository) ListByCourse(ctx context.Context, courseID primitive.ObjectID, page, limit int64) ([]*models.Review, int64, error) {
+	filter := bson.M{"course_id": courseID}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.M{"created_at": -1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	reviews := []*models.Review{}
+	if err = decodeAll(ctx, cursor, &reviews); err != nil {
+		return nil, 0, err
+	}
+
+	return reviews, total, nil
+}
+
+// Update changes the rating and comment of a review
+func (r *ReviewRepository) Update(ctx context.Context, review *models.Review) error {
+	review.UpdatedAt = time.Now().UTC()
+
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": review.ID},
+		bson.M{"$set": bson.M{
+			"rating":     review.Rating,
+			"comment":    review.Comment,
+			"updated_at": review.UpdatedAt,
+		}},
+	)
+	return err
+}
+
+// Delete deletes the review a user left on a course. It reports whether there was one.
+func (r *ReviewRepository) Delete(ctx context.Context, userID, courseID primitive.ObjectID) (bool, error) {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"user_id": userID, "course_id": courseID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// GetAverage returns the average rating and number of reviews of a course
+func (r *ReviewRepository) GetAverage(ctx context.Context, courseID primitive.ObjectID) (*models.RatingSummary, error) {
+	summaries, err := r.GetAverages(ctx, []primitive.ObjectID{courseID})
+	if err != nil {
+		return nil, err
+	}
+	if summary, ok := summaries[courseID]; ok {
+		return summary, nil
+	}
+	return &models.RatingSummary{CourseID: courseID}, nil
+}
+
+// GetAverages returns the rating summaries of the given courses keyed by course ID.
+// Courses without reviews are left out. Averages are rounded to two decimals.
+func (r *ReviewRepository) GetAverages(ctx context.Context, courseIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.RatingSummary, error) {
+	summaries := make(map[primitive.ObjectID]*models.RatingSummary, len(courseIDs))
+	if len(courseIDs) == 0 {
+		return summaries, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"course_id": bson.M{"$in": courseIDs}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":            "$course_id",
+			"average_rating": bson.M{"$avg": "$rating"},
+			"review_count":   bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []*models.RatingSummary
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		row.AverageRating = math.Round(row.AverageRating*100) / 100
+		summaries[row.CourseID] = row
+	}
+	return summaries, nil
+}
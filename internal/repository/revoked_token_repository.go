@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RevokedTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRevokedTokenRepository() *RevokedTokenRepository {
+	return &RevokedTokenRepository{
+		collection: database.RevokedTokens,
+	}
+}
+
+// Revoke denylists a token until it expires. Revoking the same token twice is a no-op.
+func (r *RevokedTokenRepository) Revoke(ctx context.Context, token *models.RevokedToken) error {
+	token.RevokedAt = time.Now().UTC()
+
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"jti": token.JTI},
+		bson.M{"$setOnInsert": token},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// IsRevoked reports whether the token with the JWT ID has been revoked
+func (r *RevokedTokenRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"jti": jti}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notDeleted adds the criteria excluding soft deleted documents to filter. Documents
+// without a deleted_at field match, so records stored before soft deletes are included.
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = nil
+	return filter
+}
+
+// isDeleted matches only soft deleted documents
+func isDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$ne": nil}
+	return filter
+}
+
+// listDeletedBefore returns the IDs of the documents soft deleted at or before cutoff
+func listDeletedBefore(ctx context.Context, collection *mongo.Collection, cutoff time.Time) ([]primitive.ObjectID, error) {
+	cursor, err := collection.Find(ctx,
+		bson.M{"deleted_at": bson.M{"$lte": cutoff}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"cource-api/internal/database"
+	"cource-api/internal/encryption"
 	"cource-api/internal/models"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,20 +17,71 @@ import (
 
 type SubscriptionRepository struct {
 	collection *mongo.Collection
+	cipher     *encryption.FieldCipher
 }
 
-func NewSubscriptionRepository() *SubscriptionRepository {
+// NewSubscriptionRepository creates the repository. When cipher is non-nil the
+// provider identifiers are encrypted before they are written and decrypted on read.
+func NewSubscriptionRepository(cipher *encryption.FieldCipher) *SubscriptionRepository {
 	return &SubscriptionRepository{
 		collection: database.Subscriptions,
+		cipher:     cipher,
 	}
 }
 
+// encryptedFields lists the subscription fields stored encrypted at rest
+var encryptedFields = []string{"customer_id", "payment_method_id", "subscription_id"}
+
+// encrypt encrypts a single value, passing it through when encryption is disabled
+func (r *SubscriptionRepository) encrypt(value string) (string, error) {
+	if r.cipher == nil {
+		return value, nil
+	}
+	return r.cipher.Encrypt(value)
+}
+
+// encryptFields returns copies of the provider identifiers ready to be stored
+func (r *SubscriptionRepository) encryptFields(subscription *models.Subscription) (customerID, paymentMethodID, subscriptionID string, err error) {
+	if customerID, err = r.encrypt(subscription.CustomerID); err != nil {
+		return
+	}
+	if paymentMethodID, err = r.encrypt(subscription.PaymentMethodID); err != nil {
+		return
+	}
+	subscriptionID, err = r.encrypt(subscription.SubscriptionID)
+	return
+}
+
+// decryptFields decrypts the provider identifiers of a subscription in place
+func (r *SubscriptionRepository) decryptFields(subscription *models.Subscription) error {
+	if r.cipher == nil {
+		return nil
+	}
+
+	var err error
+	if subscription.CustomerID, err = r.cipher.Decrypt(subscription.CustomerID); err != nil {
+		return err
+	}
+	if subscription.PaymentMethodID, err = r.cipher.Decrypt(subscription.PaymentMethodID); err != nil {
+		return err
+	}
+	subscription.SubscriptionID, err = r.cipher.Decrypt(subscription.SubscriptionID)
+	return err
+}
+
 // Create creates a new subscription
 func (r *SubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
-	subscription.CreatedAt = time.Now()
-	subscription.UpdatedAt = time.Now()
+	subscription.CreatedAt = time.Now().UTC()
+	subscription.UpdatedAt = time.Now().UTC()
 
-	result, err := r.collection.InsertOne(ctx, subscription)
+	// Insert an encrypted copy so the caller keeps the plaintext values
+	doc := *subscription
+	var err error
+	if doc.CustomerID, doc.PaymentMethodID, doc.SubscriptionID, err = r.encryptFields(subscription); err != nil {
+		return err
+	}
+
+	result, err := r.collection.InsertOne(ctx, doc)
 	if err != nil {
 		return err
 	}
@@ -48,6 +100,30 @@ func (r *SubscriptionRepository) GetByID(ctx context.Context, id primitive.Objec
 		}
 		return nil, err
 	}
+	if err := r.decryptFields(&subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// GetByStripeID finds a subscription by its Stripe subscription ID, nil when there is none
+func (r *SubscriptionRepository) GetByStripeID(ctx context.Context, stripeID string) (*models.Subscription, error) {
+	subscriptionID, err := r.encrypt(stripeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscription models.Subscription
+	err = r.collection.FindOne(ctx, bson.M{"subscription_id": subscriptionID}).Decode(&subscription)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := r.decryptFields(&subscription); err != nil {
+		return nil, err
+	}
 	return &subscription, nil
 }
 
@@ -74,16 +150,44 @@ func (r *SubscriptionRepository) ListByUser(ctx context.Context, userID primitiv
 	defer cursor.Close(ctx)
 
 	var subscriptions []*models.Subscription
-	if err = cursor.All(ctx, &subscriptions); err != nil {
+	if err = decodeAll(ctx, cursor, &subscriptions); err != nil {
 		return nil, 0, err
 	}
 
+	for _, subscription := range subscriptions {
+		if err := r.decryptFields(subscription); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	return subscriptions, total, nil
 }
 
+// EachByUser passes every subscription of a user to fn, newest first, one at a time
+func (r *SubscriptionRepository) EachByUser(ctx context.Context, userID primitive.ObjectID, fn func(*models.Subscription) error) error {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	return eachDecoded(ctx, cursor, func(subscription *models.Subscription) error {
+		if err := r.decryptFields(subscription); err != nil {
+			return err
+		}
+		return fn(subscription)
+	})
+}
+
 // Update updates a subscription
 func (r *SubscriptionRepository) Update(ctx context.Context, subscription *models.Subscription) error {
-	subscription.UpdatedAt = time.Now()
+	subscription.UpdatedAt = time.Now().UTC()
+
+	customerID, paymentMethodID, subscriptionID, err := r.encryptFields(subscription)
+	if err != nil {
+		return err
+	}
 
 	update := bson.M{
 		"$set": bson.M{
@@ -98,9 +202,9 @@ func (r *SubscriptionRepository) Update(ctx context.Context, subscription *model
 			"canceled_at":          subscription.CanceledAt,
 			"trial_start":          subscription.TrialStart,
 			"trial_end":            subscription.TrialEnd,
-			"payment_method_id":    subscription.PaymentMethodID,
-			"customer_id":          subscription.CustomerID,
-			"subscription_id":      subscription.SubscriptionID,
+			"payment_method_id":    paymentMethodID,
+			"customer_id":          customerID,
+			"subscription_id":      subscriptionID,
 			"last_payment_status":  subscription.LastPaymentStatus,
 			"last_payment_date":    subscription.LastPaymentDate,
 			"next_billing_date":    subscription.NextBillingDate,
@@ -109,7 +213,7 @@ func (r *SubscriptionRepository) Update(ctx context.Context, subscription *model
 		},
 	}
 
-	_, err := r.collection.UpdateOne(
+	_, err = r.collection.UpdateOne(
 		ctx,
 		bson.M{"_id": subscription.ID},
 		update,
@@ -117,12 +221,249 @@ func (r *SubscriptionRepository) Update(ctx context.Context, subscription *model
 	return err
 }
 
+// UpsertByStripeID creates or updates the subscription with the same Stripe
+// subscription ID, so replayed Stripe events do not create duplicates. An existing
+// subscription keeps its owner, since transfers and merges move subscriptions locally
+// and Stripe metadata may still name the previous user. subscription.UserID is set to
+// the stored owner.
+func (r *SubscriptionRepository) UpsertByStripeID(ctx context.Context, subscription *models.Subscription) error {
+	now := time.Now().UTC()
+	subscription.UpdatedAt = now
+
+	customerID, paymentMethodID, subscriptionID, err := r.encryptFields(subscription)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":               subscription.Status,
+			"plan":                 subscription.Plan,
+			"currency":             subscription.Currency,
+			"amount":               subscription.Amount,
+			"current_period_start": subscription.CurrentPeriodStart,
+			"current_period_end":   subscription.CurrentPeriodEnd,
+			"cancel_at_period_end": subscription.CancelAtPeriodEnd,
+			"canceled_at":          subscription.CanceledAt,
+			"trial_start":          subscription.TrialStart,
+			"trial_end":            subscription.TrialEnd,
+			"payment_method_id":    paymentMethodID,
+			"customer_id":          customerID,
+			"auto_renew":           subscription.AutoRenew,
+			"updated_at":           subscription.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{
+			"user_id":    subscription.UserID,
+			"created_at": now,
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"user_id": 1, "created_at": 1})
+
+	var stored struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		UserID    primitive.ObjectID `bson:"user_id"`
+		CreatedAt time.Time          `bson:"created_at"`
+	}
+
+	// A concurrent delivery can insert the subscription between the match and the insert
+	// of this one, the retry then matches the stored subscription and updates it
+	for attempt := 0; attempt < 2; attempt++ {
+		err = r.collection.FindOneAndUpdate(ctx, bson.M{"subscription_id": subscriptionID}, update, opts).Decode(&stored)
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	subscription.ID = stored.ID
+	subscription.UserID = stored.UserID
+	subscription.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+// ChangePlan moves a subscription to another product, updating its plan and amount
+func (r *SubscriptionRepository) ChangePlan(ctx context.Context, id, productID primitive.ObjectID, plan string, amount float64) error {
+	update := bson.M{
+		"$set": bson.M{
+			"product_id": productID,
+			"plan":       plan,
+			"amount":     amount,
+			"updated_at": time.Now().UTC(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		update,
+	)
+	return err
+}
+
+// TransferToUser reassigns a subscription to another user. The plan summary embedded in
+// the users moves along with an active subscription, as in a merge, so access checks and
+// announcements follow the subscription. Reassigning a missing subscription does nothing.
+func (r *SubscriptionRepository) TransferToUser(ctx context.Context, id, userID primitive.ObjectID) error {
+	return database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		now := time.Now().UTC()
+
+		var subscription models.Subscription
+		err := r.collection.FindOneAndUpdate(sessCtx,
+			bson.M{"_id": id},
+			bson.M{"$set": bson.M{"user_id": userID, "updated_at": now}},
+		).Decode(&subscription)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil
+			}
+			return err
+		}
+		if !isActiveStatus(subscription.Status) || subscription.UserID == userID {
+			return nil
+		}
+
+		// Only the plan summary is embedded, provider IDs stay in the subscriptions collection
+		summary := models.Subscription{
+			Status:           subscription.Status,
+			Plan:             subscription.Plan,
+			CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+		}
+		version := versionTimestamp()
+		if _, err := database.Users.UpdateOne(sessCtx,
+			bson.M{"_id": userID},
+			bson.M{"$set": bson.M{"subscription": summary, "updated_at": version}},
+		); err != nil {
+			return err
+		}
+
+		// A user has one active subscription at most, so the previous owner has none left
+		_, err = database.Users.UpdateOne(sessCtx,
+			bson.M{"_id": subscription.UserID},
+			bson.M{"$set": bson.M{"subscription": models.Subscription{}, "updated_at": version}},
+		)
+		return err
+	})
+}
+
 // Delete deletes a subscription
 func (r *SubscriptionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
 	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
 	return err
 }
 
+// GetConflictingActive returns a subscription of the user other than excludeID that is
+// active or trialing and has not run out, nil when there is none. Subscriptions created
+// locally have no period end yet and count as running.
+//
+// One active subscription per user is enforced by checking this before creating or
+// reactivating rather than with a partial unique index: records whose period has ended
+// keep their active status until a webhook updates them, and an index would then block
+// a legitimate new subscription.
+func (r *SubscriptionRepository) GetConflictingActive(ctx context.Context, userID, excludeID primitive.ObjectID) (*models.Subscription, error) {
+	var subscription models.Subscription
+	err := r.collection.FindOne(ctx, bson.M{
+		"_id":     bson.M{"$ne": excludeID},
+		"user_id": userID,
+		"status": bson.M{
+			"$in": []string{"active", "trial"},
+		},
+		"$or": []bson.M{
+			{"current_period_end": bson.M{"$gt": time.Now().UTC()}},
+			{"current_period_end": time.Time{}},
+		},
+	}).Decode(&subscription)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := r.decryptFields(&subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// FulfillOneOff records a payment taken by a one-off gateway and starts the subscription
+// it bought, in one transaction so a paid user is never left without a subscription. A
+// user who already has a running subscription gets it extended by the bought period
+// instead, keeping one active subscription per user. It reports false, writing nothing,
+// when a payment with the same transaction ID was already recorded.
+func (r *SubscriptionRepository) FulfillOneOff(ctx context.Context, payment *models.Payment, subscription *models.Subscription) (bool, error) {
+	var fulfilled bool
+	err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		// The transaction may be retried, so decide afresh
+		fulfilled = false
+
+		err := database.Payments.FindOne(sessCtx, bson.M{"transaction_id": payment.TransactionID}).Err()
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+
+		result, err := database.Payments.InsertOne(sessCtx, payment)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				// A concurrent delivery recorded the payment first
+				return ErrPaymentRecorded
+			}
+			return err
+		}
+		payment.ID = result.InsertedID.(primitive.ObjectID)
+
+		running, err := r.GetConflictingActive(sessCtx, payment.UserID, primitive.NilObjectID)
+		if err != nil {
+			return err
+		}
+		summary := subscription
+		if running != nil {
+			start := running.CurrentPeriodEnd
+			if now := time.Now().UTC(); start.Before(now) {
+				start = now
+			}
+			running.CurrentPeriodEnd = start.Add(subscription.CurrentPeriodEnd.Sub(subscription.CurrentPeriodStart))
+			if _, err := r.collection.UpdateOne(sessCtx,
+				bson.M{"_id": running.ID},
+				bson.M{"$set": bson.M{"current_period_end": running.CurrentPeriodEnd, "updated_at": time.Now().UTC()}},
+			); err != nil {
+				return err
+			}
+			summary = running
+		} else if err := r.Create(sessCtx, subscription); err != nil {
+			return err
+		}
+
+		// Only the plan summary is embedded, provider IDs stay in the subscriptions collection
+		if _, err := database.Users.UpdateOne(sessCtx,
+			bson.M{"_id": payment.UserID},
+			bson.M{"$set": bson.M{
+				"subscription": models.Subscription{
+					Status:           summary.Status,
+					Plan:             summary.Plan,
+					CurrentPeriodEnd: summary.CurrentPeriodEnd,
+				},
+				"updated_at": versionTimestamp(),
+			}},
+		); err != nil {
+			return err
+		}
+
+		fulfilled = true
+		return nil
+	})
+	if errors.Is(err, ErrPaymentRecorded) {
+		return false, nil
+	}
+	return fulfilled, err
+}
+
 // GetActiveSubscription gets the active subscription for a user
 func (r *SubscriptionRepository) GetActiveSubscription(ctx context.Context, userID primitive.ObjectID) (*models.Subscription, error) {
 	var subscription models.Subscription
@@ -132,7 +473,7 @@ func (r *SubscriptionRepository) GetActiveSubscription(ctx context.Context, user
 			"$in": []string{"active", "trial"},
 		},
 		"current_period_end": bson.M{
-			"$gt": time.Now(),
+			"$gt": time.Now().UTC(),
 		},
 	}).Decode(&subscription)
 	if err != nil {
@@ -141,27 +482,95 @@ func (r *SubscriptionRepository) GetActiveSubscription(ctx context.Context, user
 		}
 		return nil, err
 	}
+	if err := r.decryptFields(&subscription); err != nil {
+		return nil, err
+	}
 	return &subscription, nil
 }
 
-// UpdatePaymentInfo updates payment-related information for a subscription
+// paymentInfoFields lists the fields UpdatePaymentInfo may change
+var paymentInfoFields = []string{
+	"status",
+	"payment_method_id",
+	"customer_id",
+	"subscription_id",
+	"last_payment_status",
+	"last_payment_date",
+	"next_billing_date",
+}
+
+// UpdatePaymentInfo updates payment-related information for a subscription. Only the
+// fields present in paymentInfo are changed, including the status.
 func (r *SubscriptionRepository) UpdatePaymentInfo(ctx context.Context, subscriptionID primitive.ObjectID, paymentInfo map[string]interface{}) error {
-	update := bson.M{
-		"$set": bson.M{
-			"payment_method_id":   paymentInfo["payment_method_id"],
-			"customer_id":         paymentInfo["customer_id"],
-			"subscription_id":     paymentInfo["subscription_id"],
-			"last_payment_status": paymentInfo["last_payment_status"],
-			"last_payment_date":   paymentInfo["last_payment_date"],
-			"next_billing_date":   paymentInfo["next_billing_date"],
-			"updated_at":          time.Now(),
-		},
+	for _, field := range encryptedFields {
+		if value, ok := paymentInfo[field].(string); ok {
+			encrypted, err := r.encrypt(value)
+			if err != nil {
+				return err
+			}
+			paymentInfo[field] = encrypted
+		}
+	}
+
+	set := bson.M{"updated_at": time.Now().UTC()}
+	for _, field := range paymentInfoFields {
+		if value, ok := paymentInfo[field]; ok {
+			set[field] = value
+		}
 	}
 
 	_, err := r.collection.UpdateOne(
 		ctx,
 		bson.M{"_id": subscriptionID},
-		update,
+		bson.M{"$set": set},
 	)
 	return err
 }
+
+// EncryptExisting encrypts provider identifiers on rows written before
+// encryption was enabled. It is safe to run repeatedly and returns the number
+// of subscriptions that were rewritten.
+func (r *SubscriptionRepository) EncryptExisting(ctx context.Context) (int64, error) {
+	if r.cipher == nil {
+		return 0, nil
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		var subscription models.Subscription
+		if err := cursor.Decode(&subscription); err != nil {
+			return migrated, err
+		}
+
+		if (subscription.CustomerID == "" || encryption.IsEncrypted(subscription.CustomerID)) &&
+			(subscription.PaymentMethodID == "" || encryption.IsEncrypted(subscription.PaymentMethodID)) &&
+			(subscription.SubscriptionID == "" || encryption.IsEncrypted(subscription.SubscriptionID)) {
+			continue
+		}
+
+		customerID, paymentMethodID, subscriptionID, err := r.encryptFields(&subscription)
+		if err != nil {
+			return migrated, err
+		}
+
+		_, err = r.collection.UpdateOne(ctx, bson.M{"_id": subscription.ID}, bson.M{
+			"$set": bson.M{
+				"customer_id":       customerID,
+				"payment_method_id": paymentMethodID,
+				"subscription_id":   subscriptionID,
+			},
+		})
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, cursor.Err()
+}
@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"testing"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/encryption"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestTransferToUserMovesPlanSummary(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewSubscriptionRepository(nil)
+	users := NewUserRepository()
+
+	periodEnd := time.Now().UTC().Add(30 * 24 * time.Hour).Truncate(time.Millisecond)
+	source := &models.User{ID: primitive.NewObjectID(), Email: "source@example.com",
+		Subscription: models.Subscription{Status: "active", Plan: "monthly", CurrentPeriodEnd: periodEnd}}
+	target := &models.User{ID: primitive.NewObjectID(), Email: "target@example.com"}
+	for _, user := range []*models.User{source, target} {
+		if _, err := database.Users.InsertOne(ctx, user); err != nil {
+			t.Fatalf("failed to seed user: %v", err)
+		}
+	}
+
+	subscription := &models.Subscription{ID: primitive.NewObjectID(), UserID: source.ID, Status: "active", Plan: "monthly", CurrentPeriodEnd: periodEnd}
+	if _, err := database.Subscriptions.InsertOne(ctx, subscription); err != nil {
+		t.Fatalf("failed to seed subscription: %v", err)
+	}
+
+	if err := repo.TransferToUser(ctx, subscription.ID, target.ID); err != nil {
+		t.Fatalf("failed to transfer subscription: %v", err)
+	}
+
+	moved, err := repo.GetByID(ctx, subscription.ID)
+	if err != nil || moved.UserID != target.ID {
+		t.Fatalf("expected the subscription to belong to the target, got %+v (%v)", moved, err)
+	}
+
+	storedTarget, err := users.GetByID(ctx, target.ID)
+	if err != nil {
+		t.Fatalf("failed to get target: %v", err)
+	}
+	if storedTarget.Subscription.Status != "active" || storedTarget.Subscription.Plan != "monthly" || !storedTarget.Subscription.CurrentPeriodEnd.Equal(periodEnd) {
+		t.Fatalf("expected the target to get the plan summary, got %+v", storedTarget.Subscription)
+	}
+	storedSource, err := users.GetByID(ctx, source.ID)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if storedSource.Subscription.Status != "" {
+		t.Fatalf("expected the source to lose the plan summary, got %+v", storedSource.Subscription)
+	}
+
+	// Announcements now reach the new owner only
+	ids, err := users.ListNotifiableSubscriberIDs(ctx, models.NotificationCoursePublished, primitive.NilObjectID, 10)
+	if err != nil {
+		t.Fatalf("failed to list subscribers: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != target.ID {
+		t.Fatalf("expected only the target to be notifiable, got %v", ids)
+	}
+}
+
+func TestFulfillOneOffExtendsRunningSubscription(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewSubscriptionRepository(nil)
+
+	userID := primitive.NewObjectID()
+	periodEnd := time.Now().UTC().Add(10 * 24 * time.Hour).Truncate(time.Millisecond)
+	running := &models.Subscription{UserID: userID, Status: "active", Plan: "monthly", CurrentPeriodEnd: periodEnd}
+	if err := repo.Create(ctx, running); err != nil {
+		t.Fatalf("failed to seed subscription: %v", err)
+	}
+
+	now := time.Now().UTC()
+	payment := &models.Payment{UserID: userID, TransactionID: "pay_extend", Status: "completed", Plan: "monthly", Timestamp: now}
+	bought := &models.Subscription{UserID: userID, Status: "active", Plan: "monthly", CurrentPeriodStart: now, CurrentPeriodEnd: now.AddDate(0, 1, 0)}
+
+	fulfilled, err := repo.FulfillOneOff(ctx, payment, bought)
+	if err != nil || !fulfilled {
+		t.Fatalf("expected the payment to be fulfilled, got %v (%v)", fulfilled, err)
+	}
+
+	total, err := database.Subscriptions.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil || total != 1 {
+		t.Fatalf("expected the running subscription to be the only one, got %d (%v)", total, err)
+	}
+	extended, err := repo.GetByID(ctx, running.ID)
+	if err != nil {
+		t.Fatalf("failed to get subscription: %v", err)
+	}
+	want := periodEnd.Add(bought.CurrentPeriodEnd.Sub(bought.CurrentPeriodStart))
+	if !extended.CurrentPeriodEnd.Equal(want.Truncate(time.Millisecond)) {
+		t.Fatalf("expected the period to end at %v, got %v", want, extended.CurrentPeriodEnd)
+	}
+}
+
+func TestFulfillOneOffRedeliveryAfterFailedSubscription(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewSubscriptionRepository(nil)
+	payments := NewPaymentRepository()
+
+	// A subscription of another user whose ID the first attempt reuses, failing its insert
+	taken := &models.Subscription{UserID: primitive.NewObjectID(), Status: "canceled"}
+	if err := repo.Create(ctx, taken); err != nil {
+		t.Fatalf("failed to seed subscription: %v", err)
+	}
+
+	userID := primitive.NewObjectID()
+	now := time.Now().UTC()
+	delivery := func(subscriptionID primitive.ObjectID) (*models.Payment, *models.Subscription) {
+		payment := &models.Payment{UserID: userID, Gateway: "razorpay", TransactionID: "pay_redelivered", Status: "completed", Plan: "monthly", Timestamp: now}
+		subscription := &models.Subscription{ID: subscriptionID, UserID: userID, Status: "active", Plan: "monthly",
+			CurrentPeriodStart: now, CurrentPeriodEnd: now.AddDate(0, 1, 0), SubscriptionID: "order_redelivered"}
+		return payment, subscription
+	}
+
+	payment, subscription := delivery(taken.ID)
+	if _, err := repo.FulfillOneOff(ctx, payment, subscription); err == nil {
+		t.Fatal("expected the subscription insert to fail")
+	}
+	recorded, err := payments.GetByTransactionID(ctx, "pay_redelivered")
+	if err != nil || recorded != nil {
+		t.Fatalf("expected the payment to be rolled back, got %+v (%v)", recorded, err)
+	}
+
+	// The gateway redelivers the webhook and the payment is fulfilled this time
+	payment, subscription = delivery(primitive.NilObjectID)
+	fulfilled, err := repo.FulfillOneOff(ctx, payment, subscription)
+	if err != nil || !fulfilled {
+		t.Fatalf("expected the redelivery to be fulfilled, got %v (%v)", fulfilled, err)
+	}
+	active, err := repo.GetActiveSubscription(ctx, userID)
+	if err != nil || active == nil || active.SubscriptionID != "order_redelivered" {
+		t.Fatalf("expected the paid subscription to be active, got %+v (%v)", active, err)
+	}
+
+	// Later redeliveries are acknowledged without a second payment or subscription
+	payment, subscription = delivery(primitive.NilObjectID)
+	fulfilled, err = repo.FulfillOneOff(ctx, payment, subscription)
+	if err != nil || fulfilled {
+		t.Fatalf("expected the repeated delivery to be skipped, got %v (%v)", fulfilled, err)
+	}
+	for _, collection := range []*mongo.Collection{database.Payments, database.Subscriptions} {
+		total, err := collection.CountDocuments(ctx, bson.M{"user_id": userID})
+		if err != nil || total != 1 {
+			t.Fatalf("expected one %s record, got %d (%v)", collection.Name(), total, err)
+		}
+	}
+}
+
+func TestUpsertByStripeIDUpdatesAndKeepsOwner(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewSubscriptionRepository(newTestCipher(t))
+
+	owner := primitive.NewObjectID()
+	created := &models.Subscription{UserID: owner, Status: "active", Plan: "monthly", CustomerID: "cus_upsert", SubscriptionID: "sub_upsert"}
+	if err := repo.UpsertByStripeID(ctx, created); err != nil {
+		t.Fatalf("failed to create subscription: %v", err)
+	}
+	if created.ID.IsZero() || created.CreatedAt.IsZero() {
+		t.Fatalf("expected the stored ID and creation time, got %+v", created)
+	}
+
+	// Metadata naming another user does not move an existing subscription
+	updated := &models.Subscription{UserID: primitive.NewObjectID(), Status: "past_due", Plan: "monthly", CustomerID: "cus_upsert", SubscriptionID: "sub_upsert"}
+	if err := repo.UpsertByStripeID(ctx, updated); err != nil {
+		t.Fatalf("failed to update subscription: %v", err)
+	}
+	if updated.ID != created.ID || updated.UserID != owner {
+		t.Fatalf("expected the update to keep subscription %s of %s, got %+v", created.ID.Hex(), owner.Hex(), updated)
+	}
+
+	got, err := repo.GetByStripeID(ctx, "sub_upsert")
+	if err != nil || got == nil || got.Status != "past_due" || got.UserID != owner {
+		t.Fatalf("expected the stored subscription to be updated, got %+v (%v)", got, err)
+	}
+
+	// Subscriptions without a provider ID are not covered by the unique index
+	for range 2 {
+		if err := repo.Create(ctx, &models.Subscription{UserID: owner, Status: "canceled"}); err != nil {
+			t.Fatalf("failed to create subscription without a provider ID: %v", err)
+		}
+	}
+}
+
+func TestUpsertByStripeIDConcurrentDeliveries(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewSubscriptionRepository(nil)
+
+	const upserts = 10
+	errs := make([]error, upserts)
+	var wg sync.WaitGroup
+	for i := range upserts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.UpsertByStripeID(ctx, &models.Subscription{UserID: primitive.NewObjectID(), Status: "active", SubscriptionID: "sub_race"})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("upsert %d failed: %v", i, err)
+		}
+	}
+	total, err := database.Subscriptions.CountDocuments(ctx, bson.M{"subscription_id": "sub_race"})
+	if err != nil || total != 1 {
+		t.Fatalf("expected one subscription, got %d (%v)", total, err)
+	}
+}
+
+// newTestCipher builds a field cipher from a fixed 32 byte key
+func newTestCipher(t *testing.T) *encryption.FieldCipher {
+	t.Helper()
+	cipher, err := encryption.NewFieldCipher(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+	return cipher
+}
+
+func TestSubscriptionFieldsEncryptedAtRest(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewSubscriptionRepository(newTestCipher(t))
+
+	subscription := &models.Subscription{
+		UserID:          primitive.NewObjectID(),
+		Status:          "active",
+		CustomerID:      "cus_123",
+		PaymentMethodID: "pm_123",
+		SubscriptionID:  "sub_123",
+	}
+	if err := repo.Create(ctx, subscription); err != nil {
+		t.Fatalf("failed to create subscription: %v", err)
+	}
+	if subscription.CustomerID != "cus_123" {
+		t.Fatalf("expected the caller to keep the plaintext, got %q", subscription.CustomerID)
+	}
+
+	var raw bson.M
+	if err := database.Subscriptions.FindOne(ctx, bson.M{"_id": subscription.ID}).Decode(&raw); err != nil {
+		t.Fatalf("failed to read raw subscription: %v", err)
+	}
+	for field, plaintext := range map[string]string{"customer_id": "cus_123", "payment_method_id": "pm_123", "subscription_id": "sub_123"} {
+		stored, _ := raw[field].(string)
+		if stored == plaintext || !encryption.IsEncrypted(stored) {
+			t.Fatalf("expected %s to be stored as ciphertext, got %q", field, stored)
+		}
+	}
+
+	got, err := repo.GetByID(ctx, subscription.ID)
+	if err != nil {
+		t.Fatalf("failed to get subscription: %v", err)
+	}
+	if got.CustomerID != "cus_123" || got.PaymentMethodID != "pm_123" || got.SubscriptionID != "sub_123" {
+		t.Fatalf("expected decrypted identifiers, got %+v", got)
+	}
+}
+
+func TestEncryptExistingIsIdempotent(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewSubscriptionRepository(newTestCipher(t))
+
+	// Rows written before encryption was enabled hold plaintext
+	legacy := []*models.Subscription{
+		{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Status: "active", CustomerID: "cus_1", SubscriptionID: "sub_1"},
+		{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Status: "canceled", CustomerID: "cus_2", PaymentMethodID: "pm_2"},
+	}
+	for _, subscription := range legacy {
+		if _, err := database.Subscriptions.InsertOne(ctx, subscription); err != nil {
+			t.Fatalf("failed to seed subscription: %v", err)
+		}
+	}
+
+	migrated, err := repo.EncryptExisting(ctx)
+	if err != nil {
+		t.Fatalf("failed to encrypt existing subscriptions: %v", err)
+	}
+	if migrated != 2 {
+		t.Fatalf("expected 2 subscriptions migrated, got %d", migrated)
+	}
+
+	var before bson.M
+	if err := database.Subscriptions.FindOne(ctx, bson.M{"_id": legacy[0].ID}).Decode(&before); err != nil {
+		t.Fatalf("failed to read raw subscription: %v", err)
+	}
+	if stored, _ := before["customer_id"].(string); !encryption.IsEncrypted(stored) {
+		t.Fatalf("expected customer_id to be encrypted, got %q", stored)
+	}
+
+	// A second run finds nothing left to migrate and leaves the ciphertext alone
+	if migrated, err = repo.EncryptExisting(ctx); err != nil {
+		t.Fatalf("failed to rerun migration: %v", err)
+	}
+	if migrated != 0 {
+		t.Fatalf("expected no subscriptions migrated on rerun, got %d", migrated)
+	}
+	var after bson.M
+	if err := database.Subscriptions.FindOne(ctx, bson.M{"_id": legacy[0].ID}).Decode(&after); err != nil {
+		t.Fatalf("failed to read raw subscription: %v", err)
+	}
+	if after["customer_id"] != before["customer_id"] {
+		t.Fatalf("expected ciphertext unchanged, got %v then %v", before["customer_id"], after["customer_id"])
+	}
+
+	for _, want := range legacy {
+		got, err := repo.GetByID(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("failed to get subscription: %v", err)
+		}
+		if got.CustomerID != want.CustomerID || got.PaymentMethodID != want.PaymentMethodID || got.SubscriptionID != want.SubscriptionID {
+			t.Fatalf("expected %+v after migration, got %+v", want, got)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UploadIntentRepository struct {
+	collection *mongo.Collection
+}
+
+func NewUploadIntentRepository() *UploadIntentRepository {
+	return &UploadIntentRepository{
+		collection: database.UploadIntents,
+	}
+}
+
+// Record stores a pending intent for an issued upload URL. Presigning the same key
+// again restarts its intent.
+func (r *UploadIntentRepository) Record(ctx context.Context, intent *models.UploadIntent) error {
+	intent.Status = models.UploadIntentPending
+	intent.IssuedAt = time.Now().UTC()
+	intent.CompletedAt = nil
+	intent.RevokedAt = nil
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"file_key": intent.FileKey},
+		bson.M{
+			"$set": bson.M{
+				"user_id":      intent.UserID,
+				"kind":         intent.Kind,
+				"content_type": intent.ContentType,
+				"status":       intent.Status,
+				"issued_at":    intent.IssuedAt,
+			},
+			"$unset": bson.M{"completed_at": "", "revoked_at": ""},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.UpsertedID.(primitive.ObjectID); ok {
+		intent.ID = id
+	}
+	return nil
+}
+
+// MarkCompleted completes the user's pending intent for a file key, reporting whether
+// there was one
+func (r *UploadIntentRepository) MarkCompleted(ctx context.Context, fileKey string, userID primitive.ObjectID) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"file_key": fileKey,
+			"user_id":  userID,
+			"status":   models.UploadIntentPending,
+		},
+		bson.M{"$set": bson.M{
+			"status":       models.UploadIntentCompleted,
+			"completed_at": time.Now().UTC(),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// staleFilter matches intents still pending since before cutoff
+func staleFilter(cutoff time.Time) bson.M {
+	return bson.M{
+		"status":    models.UploadIntentPending,
+		"issued_at": bson.M{"$lt": cutoff},
+	}
+}
+
+// ListStale returns intents still pending since before cutoff, oldest first. A limit
+// of zero returns every stale intent.
+func (r *UploadIntentRepository) ListStale(ctx context.Context, cutoff time.Time, page, limit int64) ([]*models.UploadIntent, int64, error) {
+	filter := staleFilter(cutoff)
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.M{"issued_at": 1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	intents := []*models.UploadIntent{}
+	if err = decodeAll(ctx, cursor, &intents); err != nil {
+		return nil, 0, err
+	}
+
+	return intents, total, nil
+}
+
+// GetByID finds an upload intent by ID
+func (r *UploadIntentRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.UploadIntent, error) {
+	var intent models.UploadIntent
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&intent)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// MarkRevoked revokes an intent that is still pending, reporting whether it was. An
+// upload completed in the meantime is left alone.
+func (r *UploadIntentRepository) MarkRevoked(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.UploadIntentPending},
+		bson.M{"$set": bson.M{
+			"status":     models.UploadIntentRevoked,
+			"revoked_at": time.Now().UTC(),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// IsReferenced reports whether a video or course uses the file key, so uploads whose
+// completion was never reported are not deleted while in use
+func (r *UploadIntentRepository) IsReferenced(ctx context.Context, fileKey string) (bool, error) {
+	videos, err := database.Videos.CountDocuments(ctx, bson.M{"$or": []bson.M{
+		{"url": fileKey},
+		{"thumbnail": fileKey},
+		{"master_playlist": fileKey},
+	}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	if videos > 0 {
+		return true, nil
+	}
+
+	courses, err := database.Courses.CountDocuments(ctx, bson.M{"thumbnail_url": fileKey}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return courses > 0, nil
+}
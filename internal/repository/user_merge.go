@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrUserNotFound is returned when a user to merge does not exist or was deleted
+var ErrUserNotFound = errors.New("user not found")
+
+// MergeResult counts the records MergeInto moved from the source user to the target
+type MergeResult struct {
+	Subscriptions int64 `json:"subscriptions"`
+	Payments      int64 `json:"payments"`
+	WatchHistory  int64 `json:"watch_history"`
+	Enrollments   int64 `json:"enrollments"`
+	CourseStarts  int64 `json:"course_starts"`
+	Certificates  int64 `json:"certificates"`
+	Reviews       int64 `json:"reviews"`
+	Notifications int64 `json:"notifications"`
+}
+
+// MergeInto moves the subscriptions, payments, watch history, enrollments, course starts,
+// certificates, reviews and notifications of the source user to the target in one
+// transaction, then soft deletes the source and ends its sessions. Where both users have
+// a record for the same video or course, the target keeps one combining the furthest
+// progress and earliest start, or keeps its own certificate and review.
+func (r *UserRepository) MergeInto(ctx context.Context, sourceID, targetID primitive.ObjectID) (*MergeResult, error) {
+	var result *MergeResult
+	err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		// The transaction may be retried, so start counting afresh
+		result = &MergeResult{}
+
+		cursor, err := r.collection.Find(sessCtx, notDeleted(bson.M{"_id": bson.M{"$in": []primitive.ObjectID{sourceID, targetID}}}))
+		if err != nil {
+			return err
+		}
+		var users []*models.User
+		if err := cursor.All(sessCtx, &users); err != nil {
+			return err
+		}
+		if len(users) != 2 {
+			return ErrUserNotFound
+		}
+		source, target := users[0], users[1]
+		if source.ID != sourceID {
+			source, target = target, source
+		}
+
+		moved := bson.M{"$set": bson.M{"user_id": targetID}}
+		subscriptions, err := database.Subscriptions.UpdateMany(sessCtx, bson.M{"user_id": sourceID}, moved)
+		if err != nil {
+			return err
+		}
+		result.Subscriptions = subscriptions.ModifiedCount
+
+		payments, err := database.Payments.UpdateMany(sessCtx, bson.M{"user_id": sourceID}, moved)
+		if err != nil {
+			return err
+		}
+		result.Payments = payments.ModifiedCount
+
+		result.WatchHistory, err = mergeUserDocuments(sessCtx, database.WatchHistory, "video_id", sourceID, targetID, func(doc bson.M) bson.M {
+			return bson.M{"$max": bson.M{
+				"progress_seconds": doc["progress_seconds"],
+				"last_watched_at":  doc["last_watched_at"],
+			}}
+		})
+		if err != nil {
+			return err
+		}
+
+		result.Enrollments, err = mergeUserDocuments(sessCtx, database.Enrollments, "course_id", sourceID, targetID, func(doc bson.M) bson.M {
+			return bson.M{"$min": bson.M{"enrolled_at": doc["enrolled_at"]}}
+		})
+		if err != nil {
+			return err
+		}
+
+		result.CourseStarts, err = mergeUserDocuments(sessCtx, database.CourseStarts, "course_id", sourceID, targetID, func(doc bson.M) bson.M {
+			return bson.M{"$min": bson.M{"started_at": doc["started_at"]}}
+		})
+		if err != nil {
+			return err
+		}
+
+		// Certificates are kept as printed and reviews as written, so the target's own win
+		result.Certificates, err = mergeUserDocuments(sessCtx, database.Certificates, "course_id", sourceID, targetID, nil)
+		if err != nil {
+			return err
+		}
+
+		result.Reviews, err = mergeUserDocuments(sessCtx, database.Reviews, "course_id", sourceID, targetID, nil)
+		if err != nil {
+			return err
+		}
+
+		notifications, err := database.Notifications.UpdateMany(sessCtx, bson.M{"user_id": sourceID}, moved)
+		if err != nil {
+			return err
+		}
+		result.Notifications = notifications.ModifiedCount
+
+		// A subscription moved from the source becomes the target's plan summary
+		if isActiveStatus(source.Subscription.Status) && !isActiveStatus(target.Subscription.Status) {
+			if _, err := r.collection.UpdateOne(sessCtx,
+				bson.M{"_id": targetID},
+				bson.M{"$set": bson.M{"subscription": source.Subscription}},
+			); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		if _, err := r.collection.UpdateOne(sessCtx,
+			bson.M{"_id": sourceID},
+			bson.M{"$set": bson.M{"deleted_at": now, "updated_at": now}},
+		); err != nil {
+			return err
+		}
+		if _, err := r.collection.UpdateOne(sessCtx,
+			bson.M{"_id": targetID},
+			bson.M{"$set": bson.M{"updated_at": now}},
+		); err != nil {
+			return err
+		}
+
+		_, err = database.RefreshTokens.DeleteMany(sessCtx, bson.M{"user_id": sourceID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isActiveStatus reports whether a subscription status grants access
+func isActiveStatus(status string) bool {
+	return status == "active" || status == "trial"
+}
+
+// mergeUserDocuments moves the source user's documents in a collection unique on
+// user_id and key to the target user. When the target already has a document with the
+// same key, the update built by combine from the source document is applied to it and
+// the source document is dropped. A nil combine leaves the target's document unchanged.
+// It returns the number of source documents merged.
+func mergeUserDocuments(
+	sessCtx mongo.SessionContext,
+	collection *mongo.Collection,
+	key string,
+	sourceID, targetID primitive.ObjectID,
+	combine func(doc bson.M) bson.M,
+) (int64, error) {
+	cursor, err := collection.Find(sessCtx, bson.M{"user_id": sourceID})
+	if err != nil {
+		return 0, err
+	}
+	var docs []bson.M
+	if err := cursor.All(sessCtx, &docs); err != nil {
+		return 0, err
+	}
+
+	for _, doc := range docs {
+		targetDoc := bson.M{"user_id": targetID, key: doc[key]}
+		var matched int64
+		if combine == nil {
+			matched, err = collection.CountDocuments(sessCtx, targetDoc)
+		} else {
+			var existing *mongo.UpdateResult
+			existing, err = collection.UpdateOne(sessCtx, targetDoc, combine(doc))
+			if existing != nil {
+				matched = existing.MatchedCount
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if matched > 0 {
+			_, err = collection.DeleteOne(sessCtx, bson.M{"_id": doc["_id"]})
+		} else {
+			_, err = collection.UpdateOne(sessCtx, bson.M{"_id": doc["_id"]}, bson.M{"$set": bson.M{"user_id": targetID}})
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(docs)), nil
+}
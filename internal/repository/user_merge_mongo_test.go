@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMergeIntoMovesCertificatesReviewsAndNotifications(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewUserRepository()
+
+	source := &models.User{ID: primitive.NewObjectID(), Email: "old@example.com"}
+	target := &models.User{ID: primitive.NewObjectID(), Email: "new@example.com"}
+	for _, user := range []*models.User{source, target} {
+		if _, err := database.Users.InsertOne(ctx, user); err != nil {
+			t.Fatalf("failed to seed user: %v", err)
+		}
+	}
+
+	// Both users finished and reviewed the shared course, only the source the other one
+	shared, other := primitive.NewObjectID(), primitive.NewObjectID()
+	issued := time.Now().UTC().Truncate(time.Millisecond)
+	seed := []struct {
+		name       string
+		collection *mongo.Collection
+		docs       []any
+	}{
+		{"certificates", database.Certificates, []any{
+			&models.Certificate{UserID: target.ID, CourseID: shared, RecipientName: "Target", IssuedAt: issued},
+			&models.Certificate{UserID: source.ID, CourseID: shared, RecipientName: "Source", IssuedAt: issued.Add(-time.Hour)},
+			&models.Certificate{UserID: source.ID, CourseID: other, RecipientName: "Source", IssuedAt: issued},
+		}},
+		{"reviews", database.Reviews, []any{
+			&models.Review{UserID: target.ID, CourseID: shared, Rating: 5},
+			&models.Review{UserID: source.ID, CourseID: shared, Rating: 1},
+			&models.Review{UserID: source.ID, CourseID: other, Rating: 4},
+		}},
+		{"notifications", database.Notifications, []any{
+			&models.Notification{UserID: source.ID, Type: models.NotificationPaymentSucceeded},
+			&models.Notification{UserID: source.ID, Type: models.NotificationSubscriptionRenewed},
+		}},
+	}
+	for _, s := range seed {
+		if _, err := s.collection.InsertMany(ctx, s.docs); err != nil {
+			t.Fatalf("failed to seed %s: %v", s.name, err)
+		}
+	}
+
+	result, err := repo.MergeInto(ctx, source.ID, target.ID)
+	if err != nil {
+		t.Fatalf("failed to merge users: %v", err)
+	}
+	if result.Certificates != 2 || result.Reviews != 2 || result.Notifications != 2 {
+		t.Fatalf("expected 2 certificates, reviews and notifications merged, got %+v", result)
+	}
+
+	for _, s := range seed {
+		left, err := s.collection.CountDocuments(ctx, bson.M{"user_id": source.ID})
+		if err != nil || left != 0 {
+			t.Fatalf("expected no %s left on the source, got %d (%v)", s.name, left, err)
+		}
+		moved, err := s.collection.CountDocuments(ctx, bson.M{"user_id": target.ID})
+		if err != nil || moved != 2 {
+			t.Fatalf("expected 2 %s on the target, got %d (%v)", s.name, moved, err)
+		}
+	}
+
+	// The target keeps its own certificate and review for the shared course
+	var certificate models.Certificate
+	if err := database.Certificates.FindOne(ctx, bson.M{"user_id": target.ID, "course_id": shared}).Decode(&certificate); err != nil {
+		t.Fatalf("failed to get certificate: %v", err)
+	}
+	if certificate.RecipientName != "Target" || !certificate.IssuedAt.Equal(issued) {
+		t.Fatalf("expected the target's certificate unchanged, got %+v", certificate)
+	}
+	var review models.Review
+	if err := database.Reviews.FindOne(ctx, bson.M{"user_id": target.ID, "course_id": shared}).Decode(&review); err != nil {
+		t.Fatalf("failed to get review: %v", err)
+	}
+	if review.Rating != 5 {
+		t.Fatalf("expected the target's review unchanged, got %+v", review)
+	}
+}
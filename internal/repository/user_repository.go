@@ -28,7 +28,7 @@ func NewUserRepository() *UserRepository {
 // Create creates a new user
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	// Set timestamps
-	now := time.Now()
+	now := versionTimestamp()
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
@@ -42,10 +42,10 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	return nil
 }
 
-// GetByEmail finds a user by email
+// GetByEmail finds a user by email, soft deleted users are not found
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := r.collection.FindOne(ctx, notDeleted(bson.M{"email": email})).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
@@ -55,10 +55,10 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 	return &user, nil
 }
 
-// GetByID finds a user by ID
+// GetByID finds a user by ID, soft deleted users are not found
 func (r *UserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
 	var user models.User
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	err := r.collection.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
@@ -68,9 +68,10 @@ func (r *UserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*m
 	return &user, nil
 }
 
-// Update updates a user
+// Update updates a user. It returns ErrStaleUpdate when the user changed since it was read.
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
-	user.UpdatedAt = time.Now()
+	previous := user.UpdatedAt
+	user.UpdatedAt = versionTimestamp()
 
 	update := bson.M{
 		"$set": bson.M{
@@ -84,12 +85,18 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 		},
 	}
 
-	_, err := r.collection.UpdateOne(
+	result, err := r.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": user.ID},
+		unmodifiedSince(bson.M{"_id": user.ID}, previous),
 		update,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrStaleUpdate
+	}
+	return nil
 }
 
 // UpdateSubscription updates a user's subscription
@@ -97,7 +104,7 @@ func (r *UserRepository) UpdateSubscription(ctx context.Context, userID primitiv
 	update := bson.M{
 		"$set": bson.M{
 			"subscription": subscription,
-			"updated_at":   time.Now(),
+			"updated_at":   time.Now().UTC(),
 		},
 	}
 
@@ -109,12 +116,262 @@ func (r *UserRepository) UpdateSubscription(ctx context.Context, userID primitiv
 	return err
 }
 
-// Delete deletes a user
-func (r *UserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+const (
+	// loginLockoutThreshold is the number of consecutive failed logins that locks an account
+	loginLockoutThreshold = 5
+	// loginLockoutBase is the first lockout, doubled for every further failure
+	loginLockoutBase = time.Minute
+	// loginLockoutMax caps the lockout duration
+	loginLockoutMax = 24 * time.Hour
+)
+
+// loginLockoutDuration returns how long an account is locked after the given number
+// of consecutive failed logins, zero below the threshold
+func loginLockoutDuration(attempts int) time.Duration {
+	if attempts < loginLockoutThreshold {
+		return 0
+	}
+
+	duration := loginLockoutBase
+	for i := loginLockoutThreshold; i < attempts; i++ {
+		duration *= 2
+		if duration >= loginLockoutMax {
+			return loginLockoutMax
+		}
+	}
+	return duration
+}
+
+// IncrementFailedLogins records a failed login and locks the account once the threshold
+// is reached. It returns the lock expiry, nil when the account is not locked.
+func (r *UserRepository) IncrementFailedLogins(ctx context.Context, userID primitive.ObjectID) (*time.Time, error) {
+	var user models.User
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"failed_login_attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	lockout := loginLockoutDuration(user.FailedLoginAttempts)
+	if lockout == 0 {
+		return nil, nil
+	}
+
+	lockedUntil := time.Now().UTC().Add(lockout)
+	_, err = r.collection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"locked_until": lockedUntil}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &lockedUntil, nil
+}
+
+// ResetFailedLogins clears the failed login counter and any lock after a successful login
+func (r *UserRepository) ResetFailedLogins(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set":   bson.M{"failed_login_attempts": 0},
+			"$unset": bson.M{"locked_until": ""},
+		},
+	)
 	return err
 }
 
+// ClaimTrial records that the user started a trial. It reports false when the user
+// already used their trial, so concurrent requests cannot both start one.
+func (r *UserRepository) ClaimTrial(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	now := time.Now().UTC()
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "trial_used_at": nil},
+		bson.M{"$set": bson.M{"trial_used_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// SetMutedNotifications replaces the notification types the user opted out of
+func (r *UserRepository) SetMutedNotifications(ctx context.Context, userID primitive.ObjectID, types []string) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		notDeleted(bson.M{"_id": userID}),
+		bson.M{"$set": bson.M{"muted_notifications": types, "updated_at": time.Now().UTC()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// ListNotifiableSubscriberIDs returns up to limit IDs, after afterID in ID order, of the
+// users with an active subscription who did not mute notificationType
+func (r *UserRepository) ListNotifiableSubscriberIDs(ctx context.Context, notificationType string, afterID primitive.ObjectID, limit int64) ([]primitive.ObjectID, error) {
+	filter := notDeleted(bson.M{
+		"_id":                 bson.M{"$gt": afterID},
+		"subscription.status": bson.M{"$in": []string{"active", "trial"}},
+		"muted_notifications": bson.M{"$ne": notificationType},
+	})
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.M{"_id": 1}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids, nil
+}
+
+// Delete soft deletes a user. The document is kept so payments and audit entries still
+// resolve, but the user can no longer log in. It reports whether a user was deleted.
+func (r *UserRepository) Delete(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	now := time.Now().UTC()
+	result, err := r.collection.UpdateOne(ctx,
+		notDeleted(bson.M{"_id": id}),
+		bson.M{"$set": bson.M{"deleted_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// BulkUpdate applies set to every user among ids that exists and is not soft deleted. It
+// returns the IDs of the users that were updated so callers can report the missing ones.
+func (r *UserRepository) BulkUpdate(ctx context.Context, ids []primitive.ObjectID, set map[string]interface{}) ([]primitive.ObjectID, error) {
+	if len(ids) == 0 {
+		return []primitive.ObjectID{}, nil
+	}
+
+	cursor, err := r.collection.Find(ctx,
+		notDeleted(bson.M{"_id": bson.M{"$in": ids}}),
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	found := make([]primitive.ObjectID, len(rows))
+	for i, row := range rows {
+		found[i] = row.ID
+	}
+	if len(found) == 0 {
+		return found, nil
+	}
+
+	update := bson.M{"updated_at": time.Now().UTC()}
+	for k, v := range set {
+		update[k] = v
+	}
+	if _, err := r.collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": found}}, bson.M{"$set": update}); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// BulkDelete soft deletes every user among ids that is not already deleted, returning
+// the IDs of the users that were deleted
+func (r *UserRepository) BulkDelete(ctx context.Context, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	return r.BulkUpdate(ctx, ids, bson.M{"deleted_at": time.Now().UTC()})
+}
+
+// CountByRole counts the users with a role that are not soft deleted
+func (r *UserRepository) CountByRole(ctx context.Context, role string) (int64, error) {
+	return r.collection.CountDocuments(ctx, notDeleted(bson.M{"role": role}))
+}
+
+// Restore undoes a soft delete. It reports whether a deleted user with the ID was found.
+func (r *UserRepository) Restore(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		isDeleted(bson.M{"_id": id}),
+		bson.M{
+			"$set":   bson.M{"updated_at": time.Now().UTC()},
+			"$unset": bson.M{"deleted_at": ""},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// ListDeletedBefore returns the IDs of users soft deleted at or before cutoff
+func (r *UserRepository) ListDeletedBefore(ctx context.Context, cutoff time.Time) ([]primitive.ObjectID, error) {
+	return listDeletedBefore(ctx, r.collection, cutoff)
+}
+
+// HardDelete permanently erases a user, soft deleted or not, along with their personal
+// data for GDPR erasure requests. Payments, subscriptions and audit entries are kept as
+// financial and legal records. It reports whether the user existed.
+func (r *UserRepository) HardDelete(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if _, err := r.collection.DeleteOne(sessCtx, bson.M{"_id": id}); err != nil {
+			return err
+		}
+
+		for _, collection := range []*mongo.Collection{
+			database.WatchHistory,
+			database.CourseStarts,
+			database.Enrollments,
+			database.RefreshTokens,
+			database.LoginEvents,
+			database.Reviews,
+			database.Notifications,
+			database.Certificates,
+		} {
+			if _, err := collection.DeleteMany(sessCtx, bson.M{"user_id": id}); err != nil {
+				return err
+			}
+		}
+
+		if _, err := database.OTPs.DeleteMany(sessCtx, bson.M{"email": user.Email}); err != nil {
+			return err
+		}
+		_, err := database.OTPSends.DeleteMany(sessCtx, bson.M{"email": user.Email})
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // VerifyPassword checks if the provided password matches the stored hash
 func (r *UserRepository) VerifyPassword(hashedPassword, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
@@ -125,8 +382,10 @@ func (r *UserRepository) VerifyPassword(hashedPassword, password string) bool {
 func (r *UserRepository) List(ctx context.Context, page, limit int64) ([]*models.User, int64, error) {
 	skip := (page - 1) * limit
 
+	filter := notDeleted(bson.M{})
+
 	// Get total count
-	total, err := r.collection.CountDocuments(ctx, bson.M{})
+	total, err := r.collection.CountDocuments(ctx, filter)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -137,24 +396,29 @@ func (r *UserRepository) List(ctx context.Context, page, limit int64) ([]*models
 		SetLimit(limit).
 		SetSort(bson.M{"created_at": -1})
 
-	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer cursor.Close(ctx)
 
 	var users []*models.User
-	if err = cursor.All(ctx, &users); err != nil {
+	if err = decodeAll(ctx, cursor, &users); err != nil {
 		return nil, 0, err
 	}
 
 	return users, total, nil
 }
 
-// ListWithFilter returns a list of users with filtering and pagination
-func (r *UserRepository) ListWithFilter(ctx context.Context, filter map[string]interface{}, page, limit int64) ([]*models.User, int64, error) {
+// ListWithFilter returns a list of users with filtering and pagination. Soft deleted
+// users are excluded unless includeDeleted is set.
+func (r *UserRepository) ListWithFilter(ctx context.Context, filter map[string]interface{}, includeDeleted bool, page, limit int64) ([]*models.User, int64, error) {
 	skip := (page - 1) * limit
 
+	if !includeDeleted {
+		filter = notDeleted(filter)
+	}
+
 	// Get total count with filter
 	total, err := r.collection.CountDocuments(ctx, filter)
 	if err != nil {
@@ -174,7 +438,7 @@ func (r *UserRepository) ListWithFilter(ctx context.Context, filter map[string]i
 	defer cursor.Close(ctx)
 
 	var users []*models.User
-	if err = cursor.All(ctx, &users); err != nil {
+	if err = decodeAll(ctx, cursor, &users); err != nil {
 		return nil, 0, err
 	}
 
@@ -185,29 +449,39 @@ func (r *UserRepository) ListWithFilter(ctx context.Context, filter map[string]i
 func (r *UserRepository) GetUserStats(ctx context.Context) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
-	// Total users
-	totalUsers, err := r.collection.CountDocuments(ctx, bson.M{})
+	// Total users, soft deleted users are only counted separately
+	totalUsers, err := r.collection.CountDocuments(ctx, notDeleted(bson.M{}))
 	if err != nil {
 		return nil, err
 	}
 	stats["total_users"] = totalUsers
 
 	// Verified users
-	verifiedUsers, err := r.collection.CountDocuments(ctx, bson.M{"is_verified": true})
+	verifiedUsers, err := r.collection.CountDocuments(ctx, notDeleted(bson.M{"is_verified": true}))
 	if err != nil {
 		return nil, err
 	}
 	stats["verified_users"] = verifiedUsers
 
 	// Blocked users
-	blockedUsers, err := r.collection.CountDocuments(ctx, bson.M{"blocked": true})
+	blockedUsers, err := r.collection.CountDocuments(ctx, notDeleted(bson.M{"blocked": true}))
 	if err != nil {
 		return nil, err
 	}
 	stats["blocked_users"] = blockedUsers
 
+	// Deleted users
+	deletedUsers, err := r.collection.CountDocuments(ctx, isDeleted(bson.M{}))
+	if err != nil {
+		return nil, err
+	}
+	stats["deleted_users"] = deletedUsers
+
 	// Users by role
 	pipeline := []bson.M{
+		{
+			"$match": notDeleted(bson.M{}),
+		},
 		{
 			"$group": bson.M{
 				"_id": "$role",
@@ -238,12 +512,12 @@ func (r *UserRepository) GetUserStats(ctx context.Context) (map[string]interface
 	stats["users_by_role"] = roleCounts
 
 	// New users in last 30 days
-	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
-	newUsers, err := r.collection.CountDocuments(ctx, bson.M{
+	thirtyDaysAgo := statsWindowStart(time.Now(), 30)
+	newUsers, err := r.collection.CountDocuments(ctx, notDeleted(bson.M{
 		"created_at": bson.M{
 			"$gte": thirtyDaysAgo,
 		},
-	})
+	}))
 	if err != nil {
 		return nil, err
 	}
@@ -251,3 +525,9 @@ func (r *UserRepository) GetUserStats(ctx context.Context) (map[string]interface
 
 	return stats, nil
 }
+
+// statsWindowStart returns the start of a trailing window of days ending at now.
+// It is computed in UTC so daylight saving changes in the local zone cannot shift it.
+func statsWindowStart(now time.Time, days int) time.Time {
+	return now.UTC().AddDate(0, 0, -days)
+}
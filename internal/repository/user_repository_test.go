@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsWindowStartIgnoresLocalZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+
+	original := time.Local
+	time.Local = loc
+	defer func() { time.Local = original }()
+
+	// 30 days before this instant crosses the March daylight saving change in New York
+	now := time.Date(2025, 3, 20, 12, 0, 0, 0, time.UTC).In(loc)
+	start := statsWindowStart(now, 30)
+
+	if start.Location() != time.UTC {
+		t.Fatalf("expected window start in UTC, got %v", start.Location())
+	}
+	if got := now.Sub(start); got != 30*24*time.Hour {
+		t.Fatalf("expected a window of exactly 720h, got %v", got)
+	}
+}
+
+func TestLoginLockoutDurationIncreases(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{50, 24 * time.Hour},
+	}
+
+	for _, tc := range cases {
+		if got := loginLockoutDuration(tc.attempts); got != tc.want {
+			t.Errorf("after %d failures expected %v lockout, got %v", tc.attempts, tc.want, got)
+		}
+	}
+}
@@ -14,6 +14,30 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	// ErrVideoMissingOriginal is returned when a video has no original S3 key
+	ErrVideoMissingOriginal = errors.New("video must have an original video key")
+	// ErrInvalidRendition is returned when a rendition has an empty quality or key
+	ErrInvalidRendition = errors.New("video renditions must have a quality and a key")
+	// ErrDuplicateSubtitle is returned when a video already has a subtitle in the language
+	ErrDuplicateSubtitle = errors.New("video already has a subtitle for this language")
+	// ErrSubtitleNotFound is returned when a video has no subtitle in the language
+	ErrSubtitleNotFound = errors.New("subtitle not found")
+)
+
+// ValidateVideoMedia checks that a video keeps its original key alongside any renditions
+func ValidateVideoMedia(video *models.Video) error {
+	if video.URL == "" {
+		return ErrVideoMissingOriginal
+	}
+	for quality, key := range video.Renditions {
+		if quality == "" || key == "" {
+			return ErrInvalidRendition
+		}
+	}
+	return nil
+}
+
 type VideoRepository struct {
 	collection *mongo.Collection
 }
@@ -26,7 +50,10 @@ func NewVideoRepository() *VideoRepository {
 
 // Create creates a new video
 func (r *VideoRepository) Create(ctx context.Context, video *models.Video) error {
-	video.CreatedAt = time.Now()
+	if err := ValidateVideoMedia(video); err != nil {
+		return err
+	}
+	video.CreatedAt = time.Now().UTC()
 
 	result, err := r.collection.InsertOne(ctx, video)
 	if err != nil {
@@ -37,6 +64,29 @@ func (r *VideoRepository) Create(ctx context.Context, video *models.Video) error
 	return nil
 }
 
+// CreateMany creates several videos, assigning their IDs in order
+func (r *VideoRepository) CreateMany(ctx context.Context, videos []*models.Video) error {
+	now := time.Now().UTC()
+	docs := make([]interface{}, len(videos))
+	for i, video := range videos {
+		if err := ValidateVideoMedia(video); err != nil {
+			return err
+		}
+		video.CreatedAt = now
+		docs[i] = video
+	}
+
+	result, err := r.collection.InsertMany(ctx, docs)
+	if err != nil {
+		return err
+	}
+
+	for i, id := range result.InsertedIDs {
+		videos[i].ID = id.(primitive.ObjectID)
+	}
+	return nil
+}
+
 // GetByID finds a video by ID
 func (r *VideoRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Video, error) {
 	var video models.Video
@@ -73,7 +123,7 @@ func (r *VideoRepository) ListByCourse(ctx context.Context, courseID primitive.O
 	defer cursor.Close(ctx)
 
 	var videos []*models.Video
-	if err = cursor.All(ctx, &videos); err != nil {
+	if err = decodeAll(ctx, cursor, &videos); err != nil {
 		return nil, 0, err
 	}
 
@@ -82,15 +132,28 @@ func (r *VideoRepository) ListByCourse(ctx context.Context, courseID primitive.O
 
 // Update updates a video
 func (r *VideoRepository) Update(ctx context.Context, video *models.Video) error {
-	update := bson.M{
-		"$set": bson.M{
-			"title":       video.Title,
-			"description": video.Description,
-			"url":         video.URL,
-			"thumbnail":   video.Thumbnail,
-			"duration":    video.Duration,
-			"is_paid":     video.IsPaid,
-		},
+	if err := ValidateVideoMedia(video); err != nil {
+		return err
+	}
+
+	set := bson.M{
+		"title":           video.Title,
+		"description":     video.Description,
+		"url":             video.URL,
+		"duration":        video.Duration,
+		"is_paid":         video.IsPaid,
+		"preview_seconds": video.PreviewSeconds,
+		"course_id":       video.CourseID,
+		"status":          video.Status,
+		"renditions":      video.Renditions,
+		"master_playlist": video.MasterPlaylist,
+	}
+	update := bson.M{"$set": set}
+	// While the thumbnail is pending the worker owns it, so an edit that did not set a
+	// thumbnail cannot overwrite the generated one
+	if !video.ThumbnailPending {
+		set["thumbnail"] = video.Thumbnail
+		update["$unset"] = bson.M{"thumbnail_pending": ""}
 	}
 
 	_, err := r.collection.UpdateOne(
@@ -101,24 +164,77 @@ func (r *VideoRepository) Update(ctx context.Context, video *models.Video) error
 	return err
 }
 
+// AddSubtitle adds a subtitle track to a video. The language check and the push are a
+// single update so concurrent requests cannot add the same language twice.
+func (r *VideoRepository) AddSubtitle(ctx context.Context, videoID primitive.ObjectID, subtitle models.Subtitle) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"_id":                videoID,
+			"subtitles.language": bson.M{"$ne": subtitle.Language},
+		},
+		bson.M{"$push": bson.M{"subtitles": subtitle}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDuplicateSubtitle
+	}
+	return nil
+}
+
+// RemoveSubtitle removes the subtitle track of a video in the given language
+func (r *VideoRepository) RemoveSubtitle(ctx context.Context, videoID primitive.ObjectID, language string) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": videoID},
+		bson.M{"$pull": bson.M{"subtitles": bson.M{"language": language}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrSubtitleNotFound
+	}
+	return nil
+}
+
+// ListNotReadyByCourse returns the videos of a course that are still processing or failed
+func (r *VideoRepository) ListNotReadyByCourse(ctx context.Context, courseID primitive.ObjectID) ([]*models.Video, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"course_id": courseID,
+		"status":    bson.M{"$in": []string{models.VideoStatusProcessing, models.VideoStatusFailed}},
+	}, options.Find().SetProjection(bson.M{"_id": 1, "status": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	videos := []*models.Video{}
+	if err = decodeAll(ctx, cursor, &videos); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
 // Delete deletes a video
 func (r *VideoRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
 	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
 	return err
 }
 
-// UpdateWatchHistory updates or creates a watch history entry
-func (r *VideoRepository) UpdateWatchHistory(ctx context.Context, history *models.WatchHistory) error {
+// UpdateWatchHistory updates or creates a watch history entry. It reports whether the
+// entry was created, which is the first progress event of the user for the video.
+func (r *VideoRepository) UpdateWatchHistory(ctx context.Context, history *models.WatchHistory) (bool, error) {
 	// Use upsert to create or update the watch history
 	opts := options.Update().SetUpsert(true)
 	update := bson.M{
 		"$set": bson.M{
-			"last_watched_at":  time.Now(),
+			"last_watched_at":  time.Now().UTC(),
 			"progress_seconds": history.ProgressSeconds,
 		},
 	}
 
-	_, err := database.WatchHistory.UpdateOne(
+	result, err := database.WatchHistory.UpdateOne(
 		ctx,
 		bson.M{
 			"user_id":  history.UserID,
@@ -127,9 +243,83 @@ func (r *VideoRepository) UpdateWatchHistory(ctx context.Context, history *model
 		update,
 		opts,
 	)
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// SetGeneratedThumbnail stores a generated thumbnail on a video whose thumbnail is still
+// pending and clears the pending flag. An empty key only clears the flag. A thumbnail set
+// by an admin in the meantime is kept.
+func (r *VideoRepository) SetGeneratedThumbnail(ctx context.Context, videoID primitive.ObjectID, thumbnailKey string) error {
+	update := bson.M{"$unset": bson.M{"thumbnail_pending": ""}}
+	if thumbnailKey != "" {
+		update["$set"] = bson.M{"thumbnail": thumbnailKey}
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": videoID, "thumbnail_pending": true}, update)
 	return err
 }
 
+// ListPendingThumbnails returns the IDs and keys of the videos whose thumbnail is pending
+func (r *VideoRepository) ListPendingThumbnails(ctx context.Context) ([]*models.Video, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "url": 1, "thumbnail_pending": 1})
+	cursor, err := r.collection.Find(ctx, bson.M{"thumbnail_pending": true}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var videos []*models.Video
+	if err = decodeAll(ctx, cursor, &videos); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// IncrementViewCount adds one view to a video
+func (r *VideoRepository) IncrementViewCount(ctx context.Context, videoID primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": videoID}, bson.M{"$inc": bson.M{"view_count": 1}})
+	return err
+}
+
+// GetViewCountsByCourse returns the total view count of the videos of each course keyed
+// by course ID. Courses without videos are left out.
+func (r *VideoRepository) GetViewCountsByCourse(ctx context.Context, courseIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	counts := make(map[primitive.ObjectID]int64, len(courseIDs))
+	if len(courseIDs) == 0 {
+		return counts, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"course_id": bson.M{"$in": courseIDs}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$course_id",
+			"view_count": bson.M{"$sum": "$view_count"},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		CourseID  primitive.ObjectID `bson:"_id"`
+		ViewCount int64              `bson:"view_count"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.CourseID] = row.ViewCount
+	}
+	return counts, nil
+}
+
 // GetWatchHistory gets the watch history for a user and video
 func (r *VideoRepository) GetWatchHistory(ctx context.Context, userID, videoID primitive.ObjectID) (*models.WatchHistory, error) {
 	var history models.WatchHistory
@@ -146,6 +336,51 @@ func (r *VideoRepository) GetWatchHistory(ctx context.Context, userID, videoID p
 	return &history, nil
 }
 
+// DeleteOrphanedWatchHistory deletes the watch history of videos that no longer exist and
+// returns how many entries were deleted
+func (r *VideoRepository) DeleteOrphanedWatchHistory(ctx context.Context) (int64, error) {
+	pipeline := []bson.M{
+		{"$group": bson.M{"_id": "$video_id"}},
+		{
+			"$lookup": bson.M{
+				"from":         r.collection.Name(),
+				"localField":   "_id",
+				"foreignField": "_id",
+				"as":           "video",
+			},
+		},
+		{"$match": bson.M{"video": bson.M{"$size": 0}}},
+		{"$project": bson.M{"_id": 1}},
+	}
+
+	cursor, err := database.WatchHistory.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		VideoID primitive.ObjectID `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	videoIDs := make([]primitive.ObjectID, len(rows))
+	for i, row := range rows {
+		videoIDs[i] = row.VideoID
+	}
+
+	result, err := database.WatchHistory.DeleteMany(ctx, bson.M{"video_id": bson.M{"$in": videoIDs}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
 // ListWatchHistory gets all watch history entries for a user
 func (r *VideoRepository) ListWatchHistory(ctx context.Context, userID primitive.ObjectID, page, limit int64) ([]*models.WatchHistory, int64, error) {
 	skip := (page - 1) * limit
@@ -169,9 +404,22 @@ func (r *VideoRepository) ListWatchHistory(ctx context.Context, userID primitive
 	defer cursor.Close(ctx)
 
 	var history []*models.WatchHistory
-	if err = cursor.All(ctx, &history); err != nil {
+	if err = decodeAll(ctx, cursor, &history); err != nil {
 		return nil, 0, err
 	}
 
 	return history, total, nil
 }
+
+// EachWatchHistory passes every watch history entry of a user to fn, most recently
+// watched first, one at a time
+func (r *VideoRepository) EachWatchHistory(ctx context.Context, userID primitive.ObjectID, fn func(*models.WatchHistory) error) error {
+	opts := options.Find().SetSort(bson.M{"last_watched_at": -1})
+	cursor, err := database.WatchHistory.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	return eachDecoded(ctx, cursor, fn)
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"cource-api/internal/models"
+)
+
+func TestUpdateKeepsGeneratedThumbnail(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewVideoRepository()
+
+	video := &models.Video{Title: "Intro", URL: "videos/intro.mp4", ThumbnailPending: true}
+	if err := repo.Create(ctx, video); err != nil {
+		t.Fatalf("failed to create video: %v", err)
+	}
+
+	pending, err := repo.ListPendingThumbnails(ctx)
+	if err != nil || len(pending) != 1 || pending[0].ID != video.ID || pending[0].URL != video.URL {
+		t.Fatalf("expected the video to be listed as pending, got %+v (%v)", pending, err)
+	}
+
+	// An edit of the video as read before the worker stored its thumbnail
+	stale := *video
+	if err := repo.SetGeneratedThumbnail(ctx, video.ID, "auto/intro.jpg"); err != nil {
+		t.Fatalf("failed to store generated thumbnail: %v", err)
+	}
+	stale.Title = "Introduction"
+	if err := repo.Update(ctx, &stale); err != nil {
+		t.Fatalf("failed to update video: %v", err)
+	}
+
+	stored, err := repo.GetByID(ctx, video.ID)
+	if err != nil {
+		t.Fatalf("failed to get video: %v", err)
+	}
+	if stored.Title != "Introduction" || stored.Thumbnail != "auto/intro.jpg" || stored.ThumbnailPending {
+		t.Fatalf("expected the edit to keep the generated thumbnail, got %+v", stored)
+	}
+
+	// A thumbnail set explicitly replaces it
+	stored.Thumbnail = "custom/intro.jpg"
+	if err := repo.Update(ctx, stored); err != nil {
+		t.Fatalf("failed to update video: %v", err)
+	}
+	if stored, err = repo.GetByID(ctx, video.ID); err != nil || stored.Thumbnail != "custom/intro.jpg" {
+		t.Fatalf("expected the explicit thumbnail to be stored, got %+v (%v)", stored, err)
+	}
+}
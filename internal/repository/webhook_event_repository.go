@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookEventRepository() *WebhookEventRepository {
+	return &WebhookEventRepository{
+		collection: database.WebhookEvents,
+	}
+}
+
+// Claim leases an event before it is handled, so of concurrent deliveries of the same
+// event only one handles it. A delivery may take over an event whose lease expired,
+// which happens when the process handling it died. It reports false when the event is
+// done or leased to another delivery.
+func (r *WebhookEventRepository) Claim(ctx context.Context, eventID, eventType string, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"event_id":         eventID,
+		"status":           models.WebhookEventProcessing,
+		"lease_expires_at": bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"type":             eventType,
+			"status":           models.WebhookEventProcessing,
+			"claimed_at":       now,
+			"lease_expires_at": now.Add(lease),
+		},
+	}
+
+	// A missing event is inserted, a done or still leased one fails the insert on the
+	// unique event_id
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Done marks a claimed event as handled, so later deliveries are skipped
+func (r *WebhookEventRepository) Done(ctx context.Context, eventID string) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"event_id": eventID}, bson.M{
+		"$set": bson.M{
+			"status":       models.WebhookEventDone,
+			"processed_at": time.Now().UTC(),
+		},
+	})
+	return err
+}
+
+// Release removes the claim on an event whose handling failed, so a redelivery can
+// handle it again
+func (r *WebhookEventRepository) Release(ctx context.Context, eventID string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{
+		"event_id": eventID,
+		"status":   models.WebhookEventProcessing,
+	})
+	return err
+}
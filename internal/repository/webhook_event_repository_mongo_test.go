@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cource-api/internal/database"
+	"cource-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWebhookEventClaimDoneAndRelease(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewWebhookEventRepository()
+
+	claimed, err := repo.Claim(ctx, "evt_1", "checkout.session.completed", time.Minute)
+	if err != nil || !claimed {
+		t.Fatalf("expected the first delivery to claim the event, got %v (%v)", claimed, err)
+	}
+	if claimed, err = repo.Claim(ctx, "evt_1", "checkout.session.completed", time.Minute); err != nil || claimed {
+		t.Fatalf("expected a leased event not to be claimed again, got %v (%v)", claimed, err)
+	}
+
+	// A released claim can be taken by the retry
+	if err := repo.Release(ctx, "evt_1"); err != nil {
+		t.Fatalf("failed to release event: %v", err)
+	}
+	if claimed, err = repo.Claim(ctx, "evt_1", "checkout.session.completed", time.Minute); err != nil || !claimed {
+		t.Fatalf("expected a released event to be claimed again, got %v (%v)", claimed, err)
+	}
+
+	if err := repo.Done(ctx, "evt_1"); err != nil {
+		t.Fatalf("failed to mark event done: %v", err)
+	}
+	// Neither a redelivery nor a late release touches a done event
+	if err := repo.Release(ctx, "evt_1"); err != nil {
+		t.Fatalf("failed to release event: %v", err)
+	}
+	if claimed, err = repo.Claim(ctx, "evt_1", "checkout.session.completed", -time.Minute); err != nil || claimed {
+		t.Fatalf("expected a done event not to be claimed, got %v (%v)", claimed, err)
+	}
+}
+
+func TestWebhookEventClaimTakesOverExpiredLease(t *testing.T) {
+	connectTestDatabase(t)
+	ctx := context.Background()
+	repo := NewWebhookEventRepository()
+
+	if claimed, err := repo.Claim(ctx, "evt_crash", "invoice.payment_succeeded", time.Minute); err != nil || !claimed {
+		t.Fatalf("expected the event to be claimed, got %v (%v)", claimed, err)
+	}
+
+	// The process holding the lease died, so it is never released or marked done
+	if _, err := database.WebhookEvents.UpdateOne(ctx, bson.M{"event_id": "evt_crash"}, bson.M{
+		"$set": bson.M{"lease_expires_at": time.Now().UTC().Add(-time.Second)},
+	}); err != nil {
+		t.Fatalf("failed to expire lease: %v", err)
+	}
+
+	claimed, err := repo.Claim(ctx, "evt_crash", "invoice.payment_succeeded", time.Minute)
+	if err != nil || !claimed {
+		t.Fatalf("expected the redelivery to take over the expired lease, got %v (%v)", claimed, err)
+	}
+
+	var event models.WebhookEvent
+	if err := database.WebhookEvents.FindOne(ctx, bson.M{"event_id": "evt_crash"}).Decode(&event); err != nil {
+		t.Fatalf("failed to get event: %v", err)
+	}
+	if event.Status != models.WebhookEventProcessing || !event.LeaseExpiresAt.After(time.Now().UTC()) {
+		t.Fatalf("expected a fresh lease, got %+v", event)
+	}
+	count, err := database.WebhookEvents.CountDocuments(ctx, bson.M{"event_id": "evt_crash"})
+	if err != nil || count != 1 {
+		t.Fatalf("expected a single event record, got %d (%v)", count, err)
+	}
+}
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"cource-api/internal/config"
 	"cource-api/internal/handlers"
 	"cource-api/internal/middleware"
+	"time"
 )
 
 // RegisterRoutes configures all the routes for the application
@@ -13,79 +15,159 @@ func (s *FiberServer) RegisterRoutes() {
 
 	// Auth routes
 	auth := v1.Group("/auth")
-	auth.Post("/register", handlers.HandleRegister(s.UserRepo, s.OTPRepo))
-	auth.Post("/login", handlers.HandleLogin(s.UserRepo))
+	authLimit := middleware.RateLimitAuth(config.AppConfig.AuthRateLimitMax, config.AppConfig.AuthRateLimitWindow)
+	auth.Post("/register", authLimit, handlers.HandleRegister(s.UserRepo, s.OTPRepo, s.Mailer))
+	auth.Post("/login", authLimit, handlers.HandleLogin(s.UserRepo, s.RefreshTokenRepo, s.LoginEventRepo, s.OTPRepo, s.Mailer))
+	auth.Post("/refresh", handlers.HandleRefreshToken(s.UserRepo, s.RefreshTokenRepo))
+	auth.Post("/logout", middleware.AuthMiddleware(s.RevokedTokenRepo), handlers.HandleLogout(s.RevokedTokenRepo, s.RefreshTokenRepo))
 	// auth.Post("/otp/generate", handlers.HandleGenerateOTP(s.OTPRepo))
-	auth.Post("/otp/verify", handlers.HandleVerifyOTP(s.OTPRepo, s.UserRepo))
+	auth.Post("/otp/verify", authLimit, handlers.HandleVerifyOTP(s.OTPRepo, s.UserRepo))
+	auth.Post("/otp/resend", authLimit, handlers.HandleResendOTP(s.OTPRepo, s.UserRepo, s.Mailer))
 
 	// Protected routes
-	protected := v1.Group("/", middleware.AuthMiddleware())
+	protected := v1.Group("/", middleware.AuthMiddleware(s.RevokedTokenRepo))
 
 	// User routes
 	users := protected.Group("/users")
-	users.Get("/me", handlers.HandleGetCurrentUser(s.UserRepo))
+	users.Get("/me", handlers.HandleGetCurrentUser(s.UserRepo, s.SubscriptionRepo))
 	users.Put("/me", handlers.HandleUpdateCurrentUser(s.UserRepo))
+	users.Get("/me/activity", handlers.HandleGetActivity(s.ActivityRepo))
+	users.Get("/me/continue-watching", handlers.HandleContinueWatching(s.CourseRepo))
+	users.Get("/me/courses", handlers.HandleListMyCourses(s.EnrollmentRepo, s.CourseRepo))
+	users.Get("/me/entitlements", handlers.HandleGetEntitlements(s.SubscriptionRepo, s.PaymentRepo, s.EnrollmentRepo, s.CourseRepo))
+	users.Get("/me/events", handlers.HandleLiveEvents(s.EventBroker))
+	users.Get("/me/notifications", handlers.HandleListNotifications(s.NotificationRepo))
+	users.Post("/me/notifications/read-all", handlers.HandleMarkAllNotificationsRead(s.NotificationRepo))
+	users.Get("/me/notifications/preferences", handlers.HandleGetNotificationPreferences(s.UserRepo))
+	users.Put("/me/notifications/preferences", handlers.HandleUpdateNotificationPreferences(s.UserRepo))
+	users.Post("/me/notifications/:id/read", handlers.HandleMarkNotificationRead(s.NotificationRepo))
+	users.Get("/me/export", middleware.RateLimitPerUser(5, time.Hour), handlers.HandleExportUserData(s.UserRepo, s.SubscriptionRepo, s.PaymentRepo, s.VideoRepo, s.EnrollmentRepo, s.CertificateRepo))
 
 	// Course routes
 	courses := protected.Group("/courses")
-	courses.Get("/", handlers.HandleListCourses(s.CourseRepo))
-	courses.Post("/", middleware.RequireRole("admin"), handlers.HandleCreateCourse(s.CourseRepo))
-	courses.Get("/:id", handlers.HandleGetCourse(s.CourseRepo))
-	courses.Put("/:id", middleware.RequireRole("admin"), handlers.HandleUpdateCourse(s.CourseRepo))
+	courses.Get("/", handlers.HandleListCourses(s.CourseRepo, s.ReviewRepo, s.VideoRepo))
+	courses.Get("/accessible", handlers.HandleListAccessibleCourses(s.CourseRepo, s.SubscriptionRepo, s.PaymentRepo))
+	courses.Post("/", middleware.RequireRole("admin"), handlers.HandleCreateCourse(s.CourseRepo, s.CategoryRepo, s.CourseAnnouncer))
+	courses.Get("/:id", handlers.HandleGetCourse(s.CourseRepo, s.ReviewRepo, s.VideoRepo))
+	courses.Put("/:id", middleware.RequireRole("admin"), handlers.HandleUpdateCourse(s.CourseRepo, s.CategoryRepo, s.CourseAnnouncer))
+	courses.Patch("/:id", middleware.RequireRole("admin"), handlers.HandlePatchCourse(s.CourseRepo, s.CategoryRepo, s.CourseAnnouncer))
 	courses.Delete("/:id", middleware.RequireRole("admin"), handlers.HandleDeleteCourse(s.CourseRepo))
+	courses.Get("/:id/progress", handlers.HandleGetCourseProgress(s.CourseRepo))
+	courses.Get("/:id/certificate", handlers.HandleGetCourseCertificate(s.CourseRepo, s.CertificateRepo, s.UserRepo))
+	courses.Post("/:id/checkout", handlers.HandleCreateCoursePayment(s.CourseRepo, s.PaymentRepo))
+	courses.Get("/:id/reviews", handlers.HandleListReviews(s.CourseRepo, s.ReviewRepo))
+	courses.Post("/:id/reviews", handlers.HandleCreateReview(s.CourseRepo, s.ReviewRepo, s.EnrollmentRepo))
+	courses.Put("/:id/reviews", handlers.HandleUpdateReview(s.ReviewRepo))
+	courses.Delete("/:id/reviews", handlers.HandleDeleteReview(s.ReviewRepo))
+	courses.Post("/:id/enroll", handlers.HandleEnrollCourse(s.CourseRepo, s.EnrollmentRepo, s.SubscriptionRepo, s.PaymentRepo))
+
+	// Category routes
+	categories := protected.Group("/categories")
+	categories.Get("/", handlers.HandleListCategories(s.CategoryRepo))
+	categories.Post("/", middleware.RequireRole("admin"), handlers.HandleCreateCategory(s.CategoryRepo))
+	categories.Put("/:id", middleware.RequireRole("admin"), handlers.HandleUpdateCategory(s.CategoryRepo))
+	categories.Delete("/:id", middleware.RequireRole("admin"), handlers.HandleDeleteCategory(s.CategoryRepo, s.CourseRepo))
+	categories.Get("/:id/courses", handlers.HandleListCategoryCourses(s.CategoryRepo, s.CourseRepo))
 
 	//aws s3 routes
 	awsRoutes := protected.Group("/s3")
-	awsRoutes.Post("/generate-video-url", handlers.HandleVideoGeneratePresignedURL())
-	awsRoutes.Post("/generate-thumbnail-url", handlers.HandleThumbnailGeneratePresignedURL())
+	awsRoutes.Post("/generate-video-url", handlers.HandleVideoGeneratePresignedURL(s.UploadIntentRepo))
+	awsRoutes.Post("/generate-video-urls", handlers.HandleVideoGeneratePresignedURLs(s.UploadIntentRepo))
+	awsRoutes.Post("/generate-thumbnail-url", handlers.HandleThumbnailGeneratePresignedURL(s.UploadIntentRepo))
+	awsRoutes.Post("/upload-complete", handlers.HandleUploadComplete(s.VideoRepo, s.UploadIntentRepo))
+	awsRoutes.Post("/multipart/init", handlers.HandleInitMultipartUpload(s.UploadIntentRepo))
+	awsRoutes.Post("/multipart/part-url", handlers.HandleMultipartPartURL())
+	awsRoutes.Post("/multipart/complete", handlers.HandleCompleteMultipartUpload(s.UploadIntentRepo))
+	awsRoutes.Post("/multipart/abort", handlers.HandleAbortMultipartUpload())
 
 	// Video routes
 	videos := protected.Group("/videos")
 	videos.Get("/", handlers.HandleListVideos(s.VideoRepo))
-	videos.Post("/", middleware.RequireRole("admin"), handlers.HandleCreateVideo(s.VideoRepo, s.CourseRepo))
+	videos.Post("/", middleware.RequireRole("admin"), handlers.HandleCreateVideo(s.CourseRepo, s.ThumbnailWorker))
+	videos.Post("/bulk", middleware.RequireRole("admin"), handlers.HandleBulkCreateVideos(s.CourseRepo, s.ThumbnailWorker))
 	videos.Post("/reorder/:id", middleware.RequireRole("admin"), handlers.HandleReorderVideos(s.CourseRepo))
-	videos.Get("/:id", handlers.HandleGetVideo(s.VideoRepo))
+	videos.Get("/:id", handlers.HandleGetVideo(s.VideoRepo, s.CourseRepo, s.SubscriptionRepo, s.PaymentRepo))
 	videos.Put("/:id", middleware.RequireRole("admin"), handlers.HandleUpdateVideo(s.VideoRepo, s.CourseRepo))
+	videos.Patch("/:id", middleware.RequireRole("admin"), handlers.HandlePatchVideo(s.VideoRepo, s.CourseRepo))
 	videos.Delete("/:id", middleware.RequireRole("admin"), handlers.HandleDeleteVideo(s.VideoRepo, s.CourseRepo))
-	videos.Post("/:id/watch", handlers.HandleUpdateWatchHistory(s.VideoRepo))
+	videos.Post("/:id/subtitles", middleware.RequireRole("admin"), handlers.HandleAddSubtitle(s.VideoRepo))
+	videos.Delete("/:id/subtitles/:lang", middleware.RequireRole("admin"), handlers.HandleDeleteSubtitle(s.VideoRepo))
+	videos.Post("/:id/watch", handlers.HandleUpdateWatchHistory(s.VideoRepo, s.ActivityRepo, s.SubscriptionRepo, s.PaymentRepo, s.EventBroker))
 	videos.Get("/history", handlers.HandleGetWatchHistory(s.VideoRepo))
 
 	// Payment routes
 	payments := protected.Group("/payments")
 	payments.Get("/", handlers.HandleListPayments(s.PaymentRepo))
-	payments.Post("/", handlers.HandleCreatePayment(s.PaymentRepo))
+	payments.Post("/", handlers.HandleCreatePayment(s.PaymentRepo, s.CouponRepo, s.ProductRepo, s.UserRepo))
+	payments.Get("/validate-region", handlers.HandleValidateRegion(s.PaymentRepo))
 	payments.Get("/:id", handlers.HandleGetPayment(s.PaymentRepo))
+	payments.Get("/:id/invoice", handlers.HandleGetPaymentInvoice(s.PaymentRepo, s.UserRepo, s.CourseRepo))
+	payments.Post("/:id/email-receipt", middleware.RateLimitPerUser(3, time.Hour), handlers.HandleEmailPaymentReceipt(s.PaymentRepo, s.UserRepo, s.Mailer))
 	payments.Get("/pricing", handlers.HandleGetRegionalPricing(s.PaymentRepo))
+	payments.Get("/pricing/all", handlers.HandleListAllRegionalPricing(s.PaymentRepo))
 
 	// Subscription routes
 	subscriptions := protected.Group("/subscriptions")
-	subscriptions.Post("/", handlers.HandleCreateSubscription(s.SubscriptionRepo, s.ProductRepo))
+	subscriptions.Post("/", handlers.HandleCreateSubscription(s.SubscriptionRepo, s.ProductRepo, s.UserRepo))
 	subscriptions.Get("/", handlers.HandleListSubscriptions(s.SubscriptionRepo))
 	subscriptions.Get("/:id", handlers.HandleGetSubscription(s.SubscriptionRepo))
 	subscriptions.Post("/:id/cancel", handlers.HandleCancelSubscription(s.SubscriptionRepo))
 	subscriptions.Post("/:id/reactivate", handlers.HandleReactivateSubscription(s.SubscriptionRepo))
+	subscriptions.Post("/:id/change-plan", handlers.HandleChangeSubscriptionPlan(s.SubscriptionRepo, s.ProductRepo))
 	subscriptions.Put("/:id/payment-method", handlers.HandleUpdatePaymentMethod(s.SubscriptionRepo))
 
 	// Product routes (admin only)
 	products := protected.Group("/products", middleware.RequireRole("admin"))
 	products.Get("/", handlers.HandleListProducts(s.ProductRepo))
 	products.Post("/", handlers.HandleCreateProduct(s.ProductRepo))
+	products.Put("/by-external/:productID", handlers.HandleUpsertProductByExternalID(s.ProductRepo))
+	products.Get("/on-sale", handlers.HandleListOnSaleProducts(s.ProductRepo))
+	products.Get("/coupons", handlers.HandleListCoupons(s.CouponRepo))
+	products.Post("/coupons", handlers.HandleCreateCoupon(s.CouponRepo))
+	products.Get("/coupons/:id", handlers.HandleGetCoupon(s.CouponRepo))
+	products.Put("/coupons/:id", handlers.HandleUpdateCoupon(s.CouponRepo))
+	products.Delete("/coupons/:id", handlers.HandleDeleteCoupon(s.CouponRepo))
 	products.Get("/:id", handlers.HandleGetProduct(s.ProductRepo))
 	products.Put("/:id", handlers.HandleUpdateProduct(s.ProductRepo))
 	products.Delete("/:id", handlers.HandleDeleteProduct(s.ProductRepo))
 	products.Put("/:id/price", handlers.HandleUpdateProductPrice(s.ProductRepo))
 	products.Put("/:id/status", handlers.HandleUpdateProductStatus(s.ProductRepo))
 
-	// Stripe webhook (public route)
-	v1.Post("/webhook/stripe", handlers.HandleStripeWebhook(s.PaymentRepo))
+	// Payment gateway webhooks (public routes)
+	v1.Post("/webhook/stripe", handlers.HandleStripeWebhook(s.PaymentRepo, s.SubscriptionRepo, s.WebhookEventRepo, s.CouponRepo, s.UserRepo, s.NotificationRepo, s.EventBroker))
+	v1.Post("/webhook/paypal", handlers.HandlePayPalWebhook(s.SubscriptionRepo, s.WebhookEventRepo, s.CouponRepo, s.NotificationRepo, s.EventBroker))
+	v1.Post("/webhook/razorpay", handlers.HandleRazorpayWebhook(s.SubscriptionRepo, s.WebhookEventRepo, s.CouponRepo, s.NotificationRepo, s.EventBroker))
 
 	// Admin routes
 	admin := protected.Group("/admin", middleware.RequireRole("admin"))
 	admin.Get("/users", handlers.HandleListUsers(s.UserRepo))
 	admin.Get("/users/stats", handlers.HandleGetUserStats(s.UserRepo))
+	admin.Get("/stats/revenue", handlers.HandleGetRevenueStats(s.PaymentRepo))
+	admin.Post("/users/bulk", handlers.HandleBulkUserAction(s.UserRepo))
+	admin.Post("/users/merge", handlers.HandleMergeUsers(s.UserRepo, s.SubscriptionRepo, s.AuditRepo))
+	admin.Get("/users/:id/summary", handlers.HandleGetUserSummary(s.UserRepo, s.SubscriptionRepo, s.PaymentRepo, s.ActivityRepo))
 	admin.Put("/users/:id", handlers.HandleUpdateUser(s.UserRepo))
 	admin.Delete("/users/:id", handlers.HandleDeleteUser(s.UserRepo))
+	admin.Post("/users/:id/restore", handlers.HandleRestoreUser(s.UserRepo))
+	admin.Delete("/users/:id/erase", handlers.HandleEraseUser(s.UserRepo, s.AuditRepo))
+	admin.Get("/login-anomalies", handlers.HandleListLoginAnomalies(s.LoginEventRepo))
+	admin.Put("/login-anomalies/:id/review", handlers.HandleReviewLoginAnomaly(s.LoginEventRepo))
+	admin.Post("/users/:id/impersonate", middleware.RequireSuperAdmin(), handlers.HandleImpersonateUser(s.UserRepo, s.AuditRepo))
 	admin.Get("/courses", handlers.HandleAdminListCourses(s.CourseRepo))
+	admin.Post("/courses/:id/restore", handlers.HandleRestoreCourse(s.CourseRepo))
+	admin.Delete("/courses/:id/erase", handlers.HandleEraseCourse(s.CourseRepo))
+	admin.Get("/courses/:id/funnel", handlers.HandleGetCourseFunnel(s.CourseRepo))
+	admin.Get("/courses/:id/analytics", handlers.HandleGetCourseAnalytics(s.CourseRepo))
+	admin.Put("/courses/:id/videos/paid", handlers.HandleSetCourseVideosPaid(s.CourseRepo))
+	admin.Get("/videos/:id/courses", handlers.HandleListVideoCourses(s.VideoRepo, s.CourseRepo))
+	admin.Post("/subscriptions/:id/transfer", handlers.HandleTransferSubscription(s.SubscriptionRepo, s.UserRepo, s.AuditRepo))
+	admin.Get("/uploads/stale", handlers.HandleListStaleUploads(s.UploadIntentRepo))
+	admin.Delete("/uploads/:id", handlers.HandleRevokeUpload(s.UploadIntentRepo))
+	admin.Get("/otps", handlers.HandleAdminListOTPs(s.OTPRepo))
+	admin.Get("/analytics/timeseries", handlers.HandleGetTimeSeries(s.AnalyticsRepo))
 
+	admin.Post("/payments/:id/refund", handlers.HandleRefundPayment(s.PaymentRepo, s.AuditRepo))
+	admin.Get("/pricing", handlers.HandleAdminListRegionalPricing(s.PaymentRepo))
 	admin.Put("/pricing/:region", handlers.HandleUpdateRegionalPricing(s.PaymentRepo))
+	admin.Delete("/pricing/:region", handlers.HandleDeleteRegionalPricing(s.PaymentRepo))
 }
@@ -2,6 +2,11 @@ package server
 
 import (
 	"cource-api/internal/config"
+	"cource-api/internal/events"
+	"cource-api/internal/handlers"
+	"cource-api/internal/jobs"
+	"cource-api/internal/mailer"
+	"cource-api/internal/middleware"
 	"cource-api/internal/repository"
 
 	"github.com/gofiber/fiber/v2"
@@ -18,6 +23,30 @@ type FiberServer struct {
 	OTPRepo          *repository.OTPRepository
 	SubscriptionRepo *repository.SubscriptionRepository
 	ProductRepo      *repository.ProductRepository
+	AnalyticsRepo    *repository.AnalyticsRepository
+	ActivityRepo     *repository.ActivityRepository
+	RefreshTokenRepo *repository.RefreshTokenRepository
+	EnrollmentRepo   *repository.EnrollmentRepository
+	AuditRepo        *repository.AuditRepository
+	WebhookEventRepo *repository.WebhookEventRepository
+	RevokedTokenRepo *repository.RevokedTokenRepository
+	LoginEventRepo   *repository.LoginEventRepository
+	CouponRepo       *repository.CouponRepository
+	UploadIntentRepo *repository.UploadIntentRepository
+	CategoryRepo     *repository.CategoryRepository
+	ReviewRepo       *repository.ReviewRepository
+	NotificationRepo *repository.NotificationRepository
+	CertificateRepo  *repository.CertificateRepository
+
+	// ThumbnailWorker generates missing thumbnails in the background, nil when automatic
+	// thumbnails are disabled
+	ThumbnailWorker *jobs.ThumbnailWorker
+	// CourseAnnouncer notifies subscribers of published courses, nil disables announcements
+	CourseAnnouncer *jobs.CourseAnnouncer
+	// EventBroker pushes live events to connected sessions, nil when live events are disabled
+	EventBroker *events.Broker
+	// Mailer delivers OTP emails, defaults to a no-op mailer
+	Mailer mailer.Mailer
 }
 
 func New(
@@ -28,20 +57,32 @@ func New(
 	otpRepo *repository.OTPRepository,
 	subscriptionRepo *repository.SubscriptionRepository,
 	productRepo *repository.ProductRepository,
+	analyticsRepo *repository.AnalyticsRepository,
+	activityRepo *repository.ActivityRepository,
+	refreshTokenRepo *repository.RefreshTokenRepository,
+	enrollmentRepo *repository.EnrollmentRepository,
+	auditRepo *repository.AuditRepository,
+	webhookEventRepo *repository.WebhookEventRepository,
+	revokedTokenRepo *repository.RevokedTokenRepository,
+	loginEventRepo *repository.LoginEventRepository,
+	couponRepo *repository.CouponRepository,
+	uploadIntentRepo *repository.UploadIntentRepository,
+	categoryRepo *repository.CategoryRepository,
+	reviewRepo *repository.ReviewRepository,
+	notificationRepo *repository.NotificationRepository,
+	certificateRepo *repository.CertificateRepository,
 ) *FiberServer {
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			code := fiber.StatusInternalServerError
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-			}
-			return c.Status(code).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+			status, body := handlers.ErrorResponse(err)
+			return c.Status(status).JSON(body)
 		},
 	})
 
-	app.Use(logger.New())
+	app.Use(middleware.RequestID())
+	app.Use(logger.New(logger.Config{
+		Format: "${time} | ${status} | ${latency} | ${ip} | ${method} | ${path} | ${locals:" + middleware.RequestIDKey + "} | ${error}\n",
+	}))
 	app.Use(cors.New())
 
 	return &FiberServer{
@@ -53,6 +94,21 @@ func New(
 		OTPRepo:          otpRepo,
 		SubscriptionRepo: subscriptionRepo,
 		ProductRepo:      productRepo,
+		AnalyticsRepo:    analyticsRepo,
+		ActivityRepo:     activityRepo,
+		RefreshTokenRepo: refreshTokenRepo,
+		EnrollmentRepo:   enrollmentRepo,
+		AuditRepo:        auditRepo,
+		WebhookEventRepo: webhookEventRepo,
+		RevokedTokenRepo: revokedTokenRepo,
+		LoginEventRepo:   loginEventRepo,
+		CouponRepo:       couponRepo,
+		UploadIntentRepo: uploadIntentRepo,
+		CategoryRepo:     categoryRepo,
+		ReviewRepo:       reviewRepo,
+		NotificationRepo: notificationRepo,
+		CertificateRepo:  certificateRepo,
+		Mailer:           mailer.NoopMailer{},
 	}
 }
 